@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"strconv"
+	"time"
+)
+
+/**
+ * 用于在Go程序中访问 go_redis 或者其他兼容RESP协议的服务端的客户端，
+ * 复用 resp/parser 解析回复，复用 resp/reply 表示回复。
+ *
+ * Client 可以被多个协程同时使用，每个请求从连接池中取出一个连接，请求完成后归还。
+ * 指令发出之前遇到网络错误时在新的连接上重试，服务端的错误回复作为 error 返回
+ */
+
+var (
+	// ErrNil 表示 key 不存在，例如 Get 一个不存在的 key
+	ErrNil = errors.New("redis: nil")
+	// ErrClosed 表示客户端已经关闭
+	ErrClosed = errors.New("redis: client is closed")
+)
+
+// Client 是带有连接池的客户端
+type Client struct {
+	opts *Options
+	pool *pool
+}
+
+// NewClient 按照配置项创建客户端，连接在第一次请求时才建立
+func NewClient(opts Options) *Client {
+	o := opts.withDefaults()
+	return &Client{
+		opts: o,
+		pool: newPool(o),
+	}
+}
+
+// Close 关闭客户端和连接池中的所有连接
+func (c *Client) Close() error {
+	c.pool.close()
+	return nil
+}
+
+// Do 执行一条指令并返回服务端的回复，参数可以是 string、[]byte、整数和浮点数
+// 服务端返回错误回复时，error 为 *reply.StandardErrReply
+func (c *Client) Do(ctx context.Context, args ...interface{}) (resp.Reply, error) {
+	replies, err := c.process(ctx, [][][]byte{toArgs(args...)})
+	if err != nil {
+		return nil, err
+	}
+	if err := replyError(replies[0]); err != nil {
+		return replies[0], err
+	}
+	return replies[0], nil
+}
+
+// process 在连接池的一个连接上发送指令并读取回复，按 MaxRetries 重试建立连接时的网络错误
+// 和指令发出之前发生的错误。指令发出之后出错时无法知道服务端是否已经执行了它，
+// 比如读取回复超时，重试可能让指令执行两次，所以不重试
+func (c *Client) process(ctx context.Context, cmds [][][]byte) ([]resp.Reply, error) {
+	var lastErr error
+	for attempt := 0; attempt <= c.opts.MaxRetries; attempt++ {
+		if attempt > 0 {
+			timer := time.NewTimer(retryBackoff(attempt - 1))
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, ctx.Err()
+			}
+		}
+		cn, err := c.pool.get(ctx)
+		if err != nil {
+			lastErr = unwrapUnsent(err)
+			if !isRetryable(ctx, err) {
+				return nil, lastErr
+			}
+			continue
+		}
+		replies, err := cn.roundTrip(ctx, cmds)
+		c.pool.put(cn)
+		if err == nil {
+			return replies, nil
+		}
+		lastErr = err
+		var unsent *unsentError
+		if !errors.As(err, &unsent) || !isRetryable(ctx, unsent.err) {
+			return nil, unwrapUnsent(err)
+		}
+	}
+	return nil, unwrapUnsent(lastErr)
+}
+
+// unwrapUnsent 去掉 unsentError 的包装，返回给调用方原始的错误
+func unwrapUnsent(err error) error {
+	if unsent, ok := err.(*unsentError); ok {
+		return unsent.err
+	}
+	return err
+}
+
+// toArgs 把各种类型的参数转换为指令参数
+func toArgs(args ...interface{}) [][]byte {
+	result := make([][]byte, 0, len(args))
+	for _, arg := range args {
+		switch v := arg.(type) {
+		case []byte:
+			result = append(result, v)
+		case string:
+			result = append(result, []byte(v))
+		case int:
+			result = append(result, []byte(strconv.Itoa(v)))
+		case int64:
+			result = append(result, []byte(strconv.FormatInt(v, 10)))
+		case float64:
+			result = append(result, []byte(strconv.FormatFloat(v, 'f', -1, 64)))
+		default:
+			result = append(result, []byte(fmt.Sprint(v)))
+		}
+	}
+	return result
+}
+
+// replyError 服务端返回错误回复时返回对应的 error，否则返回 nil
+func replyError(r resp.Reply) error {
+	if errReply, ok := r.(reply.ErrorReply); ok {
+		return errReply
+	}
+	return nil
+}
+
+// firstError 返回多条回复中的第一个错误回复
+func firstError(replies []resp.Reply) error {
+	for _, r := range replies {
+		if err := replyError(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,416 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"go_redis/client"
+	"go_redis/interface/tcp"
+	"go_redis/resp/handler"
+	"go_redis/resp/reply"
+	tcpserver "go_redis/tcp"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// trackingListener 记录服务端接受的每个连接，测试可以统计连接数量或者从服务端关闭连接
+type trackingListener struct {
+	net.Listener
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func (l *trackingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		l.mu.Lock()
+		l.conns = append(l.conns, conn)
+		l.mu.Unlock()
+	}
+	return conn, err
+}
+
+// accepted 返回服务端接受的连接数量
+func (l *trackingListener) accepted() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.conns)
+}
+
+// closeAll 从服务端关闭所有已经接受的连接
+func (l *trackingListener) closeAll() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, conn := range l.conns {
+		_ = conn.Close()
+	}
+}
+
+// startServer 在 127.0.0.1 的随机端口上启动服务端，测试结束时关闭
+func startServer(t *testing.T, h tcp.Handler) *trackingListener {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tl := &trackingListener{Listener: listener}
+	closeChan := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		tcpserver.ListenAndServe(tl, h, closeChan)
+		close(stopped)
+	}()
+	t.Cleanup(func() {
+		close(closeChan)
+		tl.closeAll()
+		<-stopped
+	})
+	return tl
+}
+
+func newClient(t *testing.T, tl *trackingListener, opts client.Options) *client.Client {
+	t.Helper()
+	opts.Addr = tl.Addr().String()
+	c := client.NewClient(opts)
+	t.Cleanup(func() {
+		_ = c.Close()
+	})
+	return c
+}
+
+// silentHandler 读取并丢弃收到的所有数据，从不回复，用于测试超时
+type silentHandler struct{}
+
+func (silentHandler) Handle(ctx context.Context, conn net.Conn) {
+	_, _ = io.Copy(io.Discard, conn)
+	_ = conn.Close()
+}
+
+func (silentHandler) Close() error {
+	return nil
+}
+
+// waitFor 轮询直到 cond 成立，超过1秒时测试失败
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolSizeLimitsConnections(t *testing.T) {
+	tl := startServer(t, handler.MakeHandler())
+	c := newClient(t, tl, client.Options{PoolSize: 2})
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs <- c.Set(ctx, "key:"+strconv.Itoa(i), i)
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := tl.accepted(); n > 2 {
+		t.Fatalf("client opened %d connections with PoolSize 2", n)
+	}
+}
+
+func TestPoolWaitsForFreeConnection(t *testing.T) {
+	tl := startServer(t, silentHandler{})
+	c := newClient(t, tl, client.Options{PoolSize: 1, ReadTimeout: -1, MaxRetries: -1})
+
+	// 服务端不回复，第一个请求一直占用唯一的连接
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := c.Do(firstCtx, "PING")
+		firstErr <- err
+	}()
+	waitFor(t, "first connection", func() bool { return tl.accepted() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := c.Do(ctx, "PING"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("second request got %v, want context.DeadlineExceeded", err)
+	}
+	if n := tl.accepted(); n != 1 {
+		t.Fatalf("client opened %d connections with PoolSize 1", n)
+	}
+
+	cancelFirst()
+	select {
+	case err := <-firstErr:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("first request got %v, want context.Canceled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("cancelling the context did not interrupt the read")
+	}
+}
+
+func TestPipelineKeepsOrder(t *testing.T) {
+	tl := startServer(t, handler.MakeHandler())
+	c := newClient(t, tl, client.Options{})
+	ctx := context.Background()
+
+	pipeline := c.Pipeline()
+	const n = 200
+	for i := 0; i < n; i++ {
+		key := "key:" + strconv.Itoa(i)
+		pipeline.Do("SET", key, i)
+		pipeline.Do("GET", key)
+	}
+	pipeline.Do("GET", "missing")
+	replies, err := pipeline.Exec(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replies) != 2*n+1 {
+		t.Fatalf("got %d replies, want %d", len(replies), 2*n+1)
+	}
+	for i := 0; i < n; i++ {
+		if string(replies[2*i].ToBytes()) != "+OK\r\n" {
+			t.Fatalf("reply %d to SET is %q", i, replies[2*i].ToBytes())
+		}
+		got, err := client.String(replies[2*i+1], nil)
+		if err != nil || got != strconv.Itoa(i) {
+			t.Fatalf("reply %d to GET is %q, %v", i, got, err)
+		}
+	}
+	if _, err := client.String(replies[2*n], nil); err != client.ErrNil {
+		t.Fatalf("GET missing got error %v, want ErrNil", err)
+	}
+}
+
+// publishUntil 重复发布消息，直到收到消息的客户端数量等于 want
+func publishUntil(t *testing.T, c *client.Client, channel string, want int64) {
+	t.Helper()
+	waitFor(t, "subscription to settle", func() bool {
+		n, err := c.Publish(context.Background(), channel, "probe")
+		return err == nil && n == want
+	})
+}
+
+// receive 读取下一条不是探测消息的消息
+func receive(t *testing.T, ps *client.PubSub) *client.Message {
+	t.Helper()
+	timeout := time.After(time.Second)
+	for {
+		select {
+		case msg, ok := <-ps.Channel():
+			if !ok {
+				t.Fatal("message channel closed")
+			}
+			if string(msg.Payload) != "probe" {
+				return msg
+			}
+		case <-timeout:
+			t.Fatal("no message received")
+		}
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	tl := startServer(t, handler.MakeHandler())
+	c := newClient(t, tl, client.Options{})
+	ctx := context.Background()
+
+	ps, err := c.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	publishUntil(t, c, "news", 1)
+	if _, err := c.Publish(ctx, "news", "hello"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := receive(t, ps); msg.Channel != "news" || string(msg.Payload) != "hello" {
+		t.Fatalf("got message %+v", msg)
+	}
+
+	if err := ps.PSubscribe(ctx, "weather.*"); err != nil {
+		t.Fatal(err)
+	}
+	publishUntil(t, c, "weather.today", 1)
+	if _, err := c.Publish(ctx, "weather.today", "sunny"); err != nil {
+		t.Fatal(err)
+	}
+	msg := receive(t, ps)
+	if msg.Pattern != "weather.*" || msg.Channel != "weather.today" || string(msg.Payload) != "sunny" {
+		t.Fatalf("got message %+v", msg)
+	}
+
+	if err := ps.Unsubscribe(ctx, "news"); err != nil {
+		t.Fatal(err)
+	}
+	publishUntil(t, c, "news", 0)
+
+	if err := ps.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-ps.Channel():
+		for ok {
+			_, ok = <-ps.Channel()
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message channel was not closed")
+	}
+}
+
+func TestPubSubResubscribesAfterServerClose(t *testing.T) {
+	tl := startServer(t, handler.MakeHandler())
+	c := newClient(t, tl, client.Options{})
+	ctx := context.Background()
+
+	ps, err := c.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	publishUntil(t, c, "news", 1)
+
+	tl.closeAll()
+	// 重新连接后重新订阅之前订阅的频道，服务端可能还没有发现旧的连接已经关闭，
+	// 发给旧连接的消息会丢失，所以重复发布直到收到
+	waitFor(t, "message after reconnect", func() bool {
+		if _, err := c.Publish(ctx, "news", "again"); err != nil {
+			return false
+		}
+		select {
+		case msg := <-ps.Channel():
+			return msg != nil && string(msg.Payload) == "again"
+		case <-time.After(10 * time.Millisecond):
+			return false
+		}
+	})
+}
+
+// flakyHandler 关闭前 fails 个连接，之后的连接交给 h 处理，用于测试建立连接失败时的重试
+type flakyHandler struct {
+	h     tcp.Handler
+	fails int32
+}
+
+func (f *flakyHandler) Handle(ctx context.Context, conn net.Conn) {
+	if atomic.AddInt32(&f.fails, -1) >= 0 {
+		_ = conn.Close()
+		return
+	}
+	f.h.Handle(ctx, conn)
+}
+
+func (f *flakyHandler) Close() error {
+	return f.h.Close()
+}
+
+func TestRetryWhenDialFails(t *testing.T) {
+	tl := startServer(t, &flakyHandler{h: handler.MakeHandler(), fails: 2})
+	// 建立连接后要先执行 SELECT，服务端关闭连接时建立连接失败，在新的连接上重试
+	c := newClient(t, tl, client.Options{DB: 1})
+	if err := c.Set(context.Background(), "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	if n := tl.accepted(); n != 3 {
+		t.Fatalf("got %d connections, want 3", n)
+	}
+}
+
+func TestNoRetryAfterServerClose(t *testing.T) {
+	tl := startServer(t, handler.MakeHandler())
+	c := newClient(t, tl, client.Options{PoolSize: 1})
+	ctx := context.Background()
+
+	if err := c.Set(ctx, "key", "value"); err != nil {
+		t.Fatal(err)
+	}
+	tl.closeAll()
+	// 指令已经发出之后才发现连接被关闭，服务端可能已经执行了指令，不能重试
+	if err := c.Set(ctx, "key", "other"); err == nil {
+		t.Fatal("expected an error on the closed connection")
+	}
+	// 出错的连接被丢弃，下一个请求建立新的连接
+	got, err := c.Get(ctx, "key")
+	if err != nil || got != "value" {
+		t.Fatalf("got %q, %v after reconnect", got, err)
+	}
+	if n := tl.accepted(); n != 2 {
+		t.Fatalf("got %d connections, want 2", n)
+	}
+}
+
+func TestNoRetryAfterReadTimeout(t *testing.T) {
+	tl := startServer(t, silentHandler{})
+	c := newClient(t, tl, client.Options{ReadTimeout: 50 * time.Millisecond})
+	// 读取回复超时时指令已经发出，即使 MaxRetries 不为0也不重试
+	if _, err := c.Do(context.Background(), "PING"); err == nil {
+		t.Fatal("expected a timeout error")
+	}
+	if n := tl.accepted(); n != 1 {
+		t.Fatalf("got %d connections, want 1", n)
+	}
+}
+
+func TestContextTimeout(t *testing.T) {
+	tl := startServer(t, silentHandler{})
+	c := newClient(t, tl, client.Options{ReadTimeout: 10 * time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := c.Do(ctx, "PING")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request took %v, the context deadline was ignored", elapsed)
+	}
+}
+
+func TestReadTimeout(t *testing.T) {
+	tl := startServer(t, silentHandler{})
+	c := newClient(t, tl, client.Options{ReadTimeout: 50 * time.Millisecond, MaxRetries: -1})
+
+	_, err := c.Do(context.Background(), "PING")
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("got %v, want a timeout error", err)
+	}
+}
+
+func TestMaxBulkLen(t *testing.T) {
+	tl := startServer(t, handler.MakeHandler())
+	ctx := context.Background()
+	c := newClient(t, tl, client.Options{})
+	if err := c.Set(ctx, "big", strings.Repeat("x", 64)); err != nil {
+		t.Fatal(err)
+	}
+
+	limited := newClient(t, tl, client.Options{MaxBulkLen: 16})
+	_, err := limited.Get(ctx, "big")
+	var protoErr *reply.ProtocolErrReply
+	if !errors.As(err, &protoErr) {
+		t.Fatalf("got %v, want a protocol error", err)
+	}
+	if got, err := limited.Get(ctx, "missing"); err != client.ErrNil {
+		t.Fatalf("got %q, %v after the protocol error, want ErrNil", got, err)
+	}
+}
@@ -0,0 +1,143 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+)
+
+/**
+ * 常用指令的类型化封装，把回复转换为Go的类型
+ */
+
+// Ping 检查服务端是否可用
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// Get 返回 key 的值，key 不存在时返回 ErrNil
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	return String(c.Do(ctx, "GET", key))
+}
+
+// Set 设置 key 的值
+func (c *Client) Set(ctx context.Context, key string, value interface{}) error {
+	_, err := c.Do(ctx, "SET", key, value)
+	return err
+}
+
+// SetNX 在 key 不存在时设置它的值，返回是否设置成功
+func (c *Client) SetNX(ctx context.Context, key string, value interface{}) (bool, error) {
+	n, err := Int64(c.Do(ctx, "SETNX", key, value))
+	return n == 1, err
+}
+
+// GetSet 设置 key 的值并返回旧值，key 原本不存在时返回 ErrNil
+func (c *Client) GetSet(ctx context.Context, key string, value interface{}) (string, error) {
+	return String(c.Do(ctx, "GETSET", key, value))
+}
+
+// StrLen 返回 key 的值的长度
+func (c *Client) StrLen(ctx context.Context, key string) (int64, error) {
+	return Int64(c.Do(ctx, "STRLEN", key))
+}
+
+// Del 删除 key，返回删除的数量
+func (c *Client) Del(ctx context.Context, keys ...string) (int64, error) {
+	return Int64(c.Do(ctx, stringArgs("DEL", keys)...))
+}
+
+// Exists 返回存在的 key 的数量
+func (c *Client) Exists(ctx context.Context, keys ...string) (int64, error) {
+	return Int64(c.Do(ctx, stringArgs("EXISTS", keys)...))
+}
+
+// Type 返回 key 的类型，key 不存在时返回 none
+func (c *Client) Type(ctx context.Context, key string) (string, error) {
+	return String(c.Do(ctx, "TYPE", key))
+}
+
+// Rename 重命名 key
+func (c *Client) Rename(ctx context.Context, key, newKey string) error {
+	_, err := c.Do(ctx, "RENAME", key, newKey)
+	return err
+}
+
+// Keys 返回匹配 pattern 的所有 key
+func (c *Client) Keys(ctx context.Context, pattern string) ([]string, error) {
+	return Strings(c.Do(ctx, "KEYS", pattern))
+}
+
+// FlushDB 删除当前数据库的所有 key
+func (c *Client) FlushDB(ctx context.Context) error {
+	_, err := c.Do(ctx, "FLUSHDB")
+	return err
+}
+
+// Publish 向频道发送消息，返回收到消息的客户端数量
+func (c *Client) Publish(ctx context.Context, channel string, message interface{}) (int64, error) {
+	return Int64(c.Do(ctx, "PUBLISH", channel, message))
+}
+
+func stringArgs(cmd string, values []string) []interface{} {
+	args := make([]interface{}, 0, len(values)+1)
+	args = append(args, cmd)
+	for _, v := range values {
+		args = append(args, v)
+	}
+	return args
+}
+
+// String 把字符串、状态和整数回复转换为字符串，null 回复转换为 ErrNil，
+// 参数和返回值同 Do 一致，可以直接包裹 Do 的调用：client.String(c.Do(ctx, "GET", key))
+func String(r resp.Reply, err error) (string, error) {
+	if err != nil {
+		return "", err
+	}
+	switch v := r.(type) {
+	case *reply.BulkReply:
+		return string(v.Arg), nil
+	case *reply.StatusReply:
+		return v.Status, nil
+	case *reply.IntReply:
+		return fmt.Sprint(v.Code), nil
+	case *reply.NullBulkReply, *reply.NullMultiBulkReply:
+		return "", ErrNil
+	}
+	return "", fmt.Errorf("redis: unexpected reply %q", r.ToBytes())
+}
+
+// Int64 把整数回复转换为 int64
+func Int64(r resp.Reply, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	if v, ok := r.(*reply.IntReply); ok {
+		return v.Code, nil
+	}
+	return 0, fmt.Errorf("redis: unexpected reply %q", r.ToBytes())
+}
+
+// Strings 把数组回复转换为字符串切片，数组中的 null 转换为空字符串
+func Strings(r resp.Reply, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	switch v := r.(type) {
+	case *reply.EmptyMultiBulkReply:
+		return []string{}, nil
+	case *reply.MultiRawReply:
+		result := make([]string, 0, len(v.Replies))
+		for _, item := range v.Replies {
+			s, err := String(item, nil)
+			if err != nil && err != ErrNil {
+				return nil, err
+			}
+			result = append(result, s)
+		}
+		return result, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", r.ToBytes())
+}
@@ -0,0 +1,214 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"go_redis/interface/resp"
+	"go_redis/resp/parser"
+	"go_redis/resp/reply"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+/**
+ * 同服务端的单个连接，由连接池和订阅共同使用
+ */
+
+// aLongTimeAgo 用作读写截止时间，让阻塞中的读写立即返回
+var aLongTimeAgo = time.Unix(1, 0)
+
+// conn 是同服务端的一个连接，同一时间只能被一个协程使用
+type conn struct {
+	netConn net.Conn
+	reader  *parser.Reader
+	writer  *bufio.Writer
+	// 统计当前请求写入连接的字节数
+	sent *sentCounter
+	opts *Options
+	// 读写出错后连接的状态未知，比如可能还有没读取的回复，不能再放回连接池
+	broken bool
+}
+
+// dial 建立一个新的连接，并按照配置项完成认证和选择数据库
+func dial(ctx context.Context, opts *Options) (*conn, error) {
+	netConn, err := dialNet(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	sent := &sentCounter{w: netConn}
+	c := &conn{
+		netConn: netConn,
+		reader:  parser.NewReader(netConn),
+		writer:  bufio.NewWriter(sent),
+		sent:    sent,
+		opts:    opts,
+	}
+	c.reader.SetLimits(opts.MaxBulkLen, opts.MaxMultiBulkLen)
+	var setup [][][]byte
+	if opts.Username != "" {
+		setup = append(setup, toArgs("AUTH", opts.Username, opts.Password))
+	} else if opts.Password != "" {
+		setup = append(setup, toArgs("AUTH", opts.Password))
+	}
+	if opts.DB != 0 {
+		setup = append(setup, toArgs("SELECT", opts.DB))
+	}
+	if len(setup) > 0 {
+		replies, err := c.roundTrip(ctx, setup)
+		if err == nil {
+			err = firstError(replies)
+		}
+		if err != nil {
+			_ = c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// dialNet 建立网络连接，优先使用配置项中的 Dialer
+func dialNet(ctx context.Context, opts *Options) (net.Conn, error) {
+	if opts.Dialer != nil {
+		ctx, cancel := context.WithTimeout(ctx, opts.DialTimeout)
+		defer cancel()
+		return opts.Dialer(ctx)
+	}
+	dialer := net.Dialer{Timeout: opts.DialTimeout}
+	return dialer.DialContext(ctx, opts.Network, opts.Addr)
+}
+
+// roundTrip 一次性发送多条指令，再按顺序读取它们的回复，用于单条指令和管道
+// 服务端的错误回复作为回复返回，返回的 error 只表示网络或协议错误，此时连接被标记为不可用；
+// 出错时还没有任何数据发给服务端的，返回的 error 是 *unsentError
+func (c *conn) roundTrip(ctx context.Context, cmds [][][]byte) ([]resp.Reply, error) {
+	c.sent.n = 0
+	replies := make([]resp.Reply, 0, len(cmds))
+	err := c.withContext(ctx, func() error {
+		if err := c.writeCommands(cmds); err != nil {
+			return err
+		}
+		for range cmds {
+			r, err := c.reader.ReadReply()
+			if err != nil {
+				return err
+			}
+			replies = append(replies, r)
+		}
+		return nil
+	})
+	if err != nil {
+		if c.sent.n == 0 {
+			return nil, &unsentError{err: err}
+		}
+		return nil, err
+	}
+	return replies, nil
+}
+
+// sentCounter 统计写入连接的字节数
+type sentCounter struct {
+	w io.Writer
+	n int64
+}
+
+func (s *sentCounter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	return n, err
+}
+
+// unsentError 是请求的数据发给服务端之前发生的错误，服务端没有收到指令，可以安全地重试
+type unsentError struct {
+	err error
+}
+
+func (e *unsentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *unsentError) Unwrap() error {
+	return e.err
+}
+
+// writeCommands 把指令按RESP数组格式写入连接
+func (c *conn) writeCommands(cmds [][][]byte) error {
+	for _, args := range cmds {
+		if _, err := c.writer.Write(reply.MakeMultiBulkReply(args).ToBytes()); err != nil {
+			return err
+		}
+	}
+	return c.writer.Flush()
+}
+
+// withContext 执行 fn 期间，按读写超时和 ctx 的截止时间限制读写，ctx 被取消时中断阻塞的读写
+// fn 返回错误后连接被标记为不可用，ctx 已经结束时返回 ctx 的错误
+func (c *conn) withContext(ctx context.Context, fn func() error) error {
+	now := time.Now()
+	_ = c.netConn.SetWriteDeadline(deadlineOf(ctx, now, c.opts.WriteTimeout))
+	_ = c.netConn.SetReadDeadline(deadlineOf(ctx, now, c.opts.ReadTimeout))
+	if done := ctx.Done(); done != nil {
+		stop := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case <-done:
+				_ = c.netConn.SetDeadline(aLongTimeAgo)
+			case <-stop:
+			}
+		}()
+		defer func() {
+			// 等待协程退出，确保它不会在连接被下一个请求使用时修改截止时间
+			close(stop)
+			wg.Wait()
+		}()
+	}
+	if err := fn(); err != nil {
+		c.broken = true
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		// 读写的截止时间取自 ctx 时，连接可能比 ctx 先一步超时
+		if deadline, ok := ctx.Deadline(); ok && isTimeout(err) && !time.Now().Before(deadline) {
+			return context.DeadlineExceeded
+		}
+		return err
+	}
+	return nil
+}
+
+// deadlineOf 返回从 now 开始经过 timeout 的时间和 ctx 的截止时间中更早的一个，都没有时返回零值表示不超时
+func deadlineOf(ctx context.Context, now time.Time, timeout time.Duration) time.Time {
+	var t time.Time
+	if timeout > 0 {
+		t = now.Add(timeout)
+	}
+	if deadline, ok := ctx.Deadline(); ok && (t.IsZero() || deadline.Before(t)) {
+		t = deadline
+	}
+	return t
+}
+
+// isTimeout 判断 err 是否是读写超时
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+func (c *conn) close() error {
+	return c.netConn.Close()
+}
+
+// isRetryable 判断取连接时发生的错误是否可以重试，只有网络错误可以重试，
+// 服务端的错误回复（比如 AUTH 失败）和协议错误重试也不会成功
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil || errors.Is(err, ErrClosed) {
+		return false
+	}
+	var errReply reply.ErrorReply
+	return !errors.As(err, &errReply)
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"net"
+	"time"
+)
+
+/**
+ * 客户端的配置项
+ */
+
+const (
+	defaultAddr         = "127.0.0.1:6379"
+	defaultPoolSize     = 10
+	defaultDialTimeout  = 5 * time.Second
+	defaultReadTimeout  = 3 * time.Second
+	defaultWriteTimeout = 3 * time.Second
+	defaultMaxRetries   = 3
+	// defaultMaxBulkLen 和服务端 proto-max-bulk-len 的默认值相同
+	defaultMaxBulkLen = 512 * 1024 * 1024
+
+	// 重试前等待的时间从 minRetryBackoff 开始逐次翻倍，最多等待 maxRetryBackoff
+	minRetryBackoff = 8 * time.Millisecond
+	maxRetryBackoff = 512 * time.Millisecond
+)
+
+// Options 是创建客户端时的配置项，零值表示使用默认值
+type Options struct {
+	// Network 是连接服务端使用的网络类型，tcp 或 unix，默认为 tcp
+	Network string
+	// Addr 是服务端的地址，默认为 127.0.0.1:6379，Network 为 unix 时是 Unix Socket 文件的路径
+	Addr string
+	// Password 不为空时，建立连接后先发送 AUTH 指令，Username 不为空时发送 AUTH Username Password
+	Username string
+	Password string
+	// Dialer 不为空时用它建立连接，Network 和 Addr 被忽略，
+	// 比如通过 embedded.Engine 的 DialContext 连接进程内的服务端
+	Dialer func(ctx context.Context) (net.Conn, error)
+	// DB 不为0时，建立连接后先发送 SELECT 指令
+	DB int
+
+	// PoolSize 是连接池中连接数量的上限，默认为10，连接都在使用中时新的请求会等待
+	PoolSize int
+	// DialTimeout 是建立连接的超时时间，默认为5秒
+	DialTimeout time.Duration
+	// ReadTimeout 和 WriteTimeout 是每次读写的超时时间，默认为3秒，-1 表示不超时
+	// context 的截止时间更早时以 context 为准
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	// MaxRetries 是遇到网络错误时重试的次数，默认为3，-1 表示不重试
+	// 只重试建立连接失败和指令发出之前失败的请求，重试时会重新建立连接；
+	// 指令已经发出的请求失败时不重试，因为服务端可能已经执行了它
+	MaxRetries int
+	// MaxBulkLen 是回复中单个字符串的最大长度，默认为512MB，-1 表示不限制
+	// MaxMultiBulkLen 是回复中数组的最大元素数量，默认不限制
+	// 服务端发来超过限制的回复时连接会被关闭，避免不可信的服务端让客户端分配过多内存
+	MaxBulkLen      int
+	MaxMultiBulkLen int
+}
+
+// withDefaults 返回填充了默认值的配置项
+func (opts Options) withDefaults() *Options {
+	if opts.Network == "" {
+		opts.Network = "tcp"
+	}
+	if opts.Addr == "" {
+		opts.Addr = defaultAddr
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = defaultPoolSize
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = defaultDialTimeout
+	}
+	opts.ReadTimeout = timeoutOrDefault(opts.ReadTimeout, defaultReadTimeout)
+	opts.WriteTimeout = timeoutOrDefault(opts.WriteTimeout, defaultWriteTimeout)
+	if opts.MaxBulkLen == 0 {
+		opts.MaxBulkLen = defaultMaxBulkLen
+	}
+	if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultMaxRetries
+	} else if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	}
+	return &opts
+}
+
+// timeoutOrDefault 把零值转换为默认值，把 -1 转换为0，0表示不超时
+func timeoutOrDefault(timeout, def time.Duration) time.Duration {
+	if timeout == 0 {
+		return def
+	}
+	if timeout < 0 {
+		return 0
+	}
+	return timeout
+}
+
+// retryBackoff 返回第 attempt 次重试前等待的时间
+func retryBackoff(attempt int) time.Duration {
+	backoff := minRetryBackoff << uint(attempt)
+	if backoff > maxRetryBackoff || backoff <= 0 {
+		backoff = maxRetryBackoff
+	}
+	return backoff
+}
@@ -0,0 +1,44 @@
+package client
+
+import (
+	"context"
+	"go_redis/interface/resp"
+)
+
+/**
+ * 管道：把多条指令一次性发送给服务端，再一次性读取所有回复
+ */
+
+// Pipeline 收集多条指令，在 Exec 时通过同一个连接一次性发送
+// Pipeline 不能被多个协程同时使用
+type Pipeline struct {
+	client *Client
+	cmds   [][][]byte
+}
+
+// Pipeline 创建一个管道
+func (c *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: c}
+}
+
+// Do 向管道中添加一条指令
+func (p *Pipeline) Do(args ...interface{}) {
+	p.cmds = append(p.cmds, toArgs(args...))
+}
+
+// Len 返回管道中指令的数量
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+// Exec 发送管道中的所有指令并按顺序返回它们的回复，之后管道被清空可以继续使用
+// 某条指令的错误回复不影响其他指令，它作为回复中的 *reply.StandardErrReply 返回，
+// 返回的 error 只表示网络或协议错误
+func (p *Pipeline) Exec(ctx context.Context) ([]resp.Reply, error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	return p.client.process(ctx, cmds)
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"sync"
+)
+
+/**
+ * 有上限的连接池，连接在第一次需要时才建立，出错的连接被丢弃，下次需要时重新建立
+ */
+
+type pool struct {
+	opts *Options
+	// 空闲的连接
+	idle chan *conn
+	// 每个已建立或正在建立的连接占用一个位置，容量即连接数量的上限
+	slots chan struct{}
+
+	mu     sync.Mutex
+	closed bool
+}
+
+func newPool(opts *Options) *pool {
+	return &pool{
+		opts:  opts,
+		idle:  make(chan *conn, opts.PoolSize),
+		slots: make(chan struct{}, opts.PoolSize),
+	}
+}
+
+// get 取出一个空闲的连接，没有空闲的连接时在数量上限内建立新连接，否则等待其他请求归还连接
+func (p *pool) get(ctx context.Context) (*conn, error) {
+	if p.isClosed() {
+		return nil, ErrClosed
+	}
+	// 优先使用空闲的连接
+	select {
+	case c := <-p.idle:
+		return c, nil
+	default:
+	}
+	select {
+	case c := <-p.idle:
+		return c, nil
+	case p.slots <- struct{}{}:
+		c, err := dial(ctx, p.opts)
+		if err != nil {
+			<-p.slots
+			return nil, err
+		}
+		return c, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// put 归还连接，出错的连接和连接池关闭后归还的连接会被关闭
+func (p *pool) put(c *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if c.broken || p.closed {
+		p.remove(c)
+		return
+	}
+	// idle 的容量等于连接数量的上限，不会阻塞
+	p.idle <- c
+}
+
+// remove 关闭连接并释放它占用的位置
+func (p *pool) remove(c *conn) {
+	_ = c.close()
+	<-p.slots
+}
+
+func (p *pool) isClosed() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.closed
+}
+
+// close 关闭所有空闲的连接，使用中的连接在归还时关闭
+func (p *pool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	for {
+		select {
+		case c := <-p.idle:
+			p.remove(c)
+		default:
+			return
+		}
+	}
+}
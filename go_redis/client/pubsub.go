@@ -0,0 +1,271 @@
+package client
+
+import (
+	"context"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"sync"
+	"time"
+)
+
+/**
+ * 发布订阅：订阅使用单独的连接，不占用连接池
+ * 连接断开后自动重新连接，并重新订阅之前订阅的所有频道和模式，断开期间发布的消息会丢失
+ */
+
+// messageQueueSize 是等待调用方读取的消息数量的上限，调用方读取太慢时订阅的连接会停止读取，
+// 由服务端的 client-output-buffer-limit 决定何时断开
+const messageQueueSize = 100
+
+// Message 是订阅收到的消息
+type Message struct {
+	Channel string
+	// Pattern 是通过 PSUBSCRIBE 收到的消息匹配的模式，通过 SUBSCRIBE 收到时为空
+	Pattern string
+	Payload []byte
+}
+
+// PubSub 表示一组订阅，可以被多个协程同时使用
+type PubSub struct {
+	client *Client
+
+	mu       sync.Mutex
+	cn       *conn
+	channels map[string]struct{}
+	patterns map[string]struct{}
+	closed   bool
+
+	messages chan *Message
+	done     chan struct{}
+}
+
+// Subscribe 订阅频道，通过返回的 PubSub 的 Channel 接收消息
+func (c *Client) Subscribe(ctx context.Context, channels ...string) (*PubSub, error) {
+	ps := c.newPubSub()
+	if err := ps.Subscribe(ctx, channels...); err != nil {
+		_ = ps.Close()
+		return nil, err
+	}
+	go ps.run()
+	return ps, nil
+}
+
+// PSubscribe 订阅匹配模式的频道，通过返回的 PubSub 的 Channel 接收消息
+func (c *Client) PSubscribe(ctx context.Context, patterns ...string) (*PubSub, error) {
+	ps := c.newPubSub()
+	if err := ps.PSubscribe(ctx, patterns...); err != nil {
+		_ = ps.Close()
+		return nil, err
+	}
+	go ps.run()
+	return ps, nil
+}
+
+func (c *Client) newPubSub() *PubSub {
+	return &PubSub{
+		client:   c,
+		channels: make(map[string]struct{}),
+		patterns: make(map[string]struct{}),
+		messages: make(chan *Message, messageQueueSize),
+		done:     make(chan struct{}),
+	}
+}
+
+// Channel 返回接收消息的 channel，PubSub 关闭后它也被关闭
+func (ps *PubSub) Channel() <-chan *Message {
+	return ps.messages
+}
+
+// Subscribe 订阅更多的频道
+func (ps *PubSub) Subscribe(ctx context.Context, channels ...string) error {
+	return ps.update(ctx, "SUBSCRIBE", ps.channels, channels, true)
+}
+
+// PSubscribe 订阅更多的模式
+func (ps *PubSub) PSubscribe(ctx context.Context, patterns ...string) error {
+	return ps.update(ctx, "PSUBSCRIBE", ps.patterns, patterns, true)
+}
+
+// Unsubscribe 取消订阅频道，不指定频道时取消订阅所有频道
+func (ps *PubSub) Unsubscribe(ctx context.Context, channels ...string) error {
+	return ps.update(ctx, "UNSUBSCRIBE", ps.channels, channels, false)
+}
+
+// PUnsubscribe 取消订阅模式，不指定模式时取消订阅所有模式
+func (ps *PubSub) PUnsubscribe(ctx context.Context, patterns ...string) error {
+	return ps.update(ctx, "PUNSUBSCRIBE", ps.patterns, patterns, false)
+}
+
+// update 记录订阅的变化并发送给服务端，没有连接时先建立连接
+func (ps *PubSub) update(ctx context.Context, cmd string, set map[string]struct{}, names []string, add bool) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return ErrClosed
+	}
+	if add {
+		for _, name := range names {
+			set[name] = struct{}{}
+		}
+	} else if len(names) == 0 {
+		for name := range set {
+			delete(set, name)
+		}
+	} else {
+		for _, name := range names {
+			delete(set, name)
+		}
+	}
+	if ps.cn == nil {
+		// 建立连接时会订阅所有记录的频道和模式，其中已经包含了这次的变化
+		_, err := ps.connectLocked(ctx)
+		return err
+	}
+	err := ps.writeLocked(ctx, [][][]byte{toArgs(stringArgs(cmd, names)...)})
+	if err != nil {
+		// 接收协程会发现连接出错，重新连接后订阅所有记录的频道和模式
+		_ = ps.cn.close()
+	}
+	return nil
+}
+
+// connectLocked 建立新的连接并订阅所有记录的频道和模式，必须在持有锁时调用
+func (ps *PubSub) connectLocked(ctx context.Context) (*conn, error) {
+	cn, err := dial(ctx, ps.client.opts)
+	if err != nil {
+		return nil, err
+	}
+	ps.cn = cn
+	var cmds [][][]byte
+	if len(ps.channels) > 0 {
+		cmds = append(cmds, toArgs(stringArgs("SUBSCRIBE", setKeys(ps.channels))...))
+	}
+	if len(ps.patterns) > 0 {
+		cmds = append(cmds, toArgs(stringArgs("PSUBSCRIBE", setKeys(ps.patterns))...))
+	}
+	if err := ps.writeLocked(ctx, cmds); err != nil {
+		_ = cn.close()
+		ps.cn = nil
+		return nil, err
+	}
+	return cn, nil
+}
+
+// writeLocked 在订阅的连接上发送指令，回复由接收协程读取，必须在持有锁时调用
+func (ps *PubSub) writeLocked(ctx context.Context, cmds [][][]byte) error {
+	if len(cmds) == 0 {
+		return nil
+	}
+	_ = ps.cn.netConn.SetWriteDeadline(deadlineOf(ctx, time.Now(), ps.client.opts.WriteTimeout))
+	return ps.cn.writeCommands(cmds)
+}
+
+// run 接收消息，连接断开后按退避时间重新连接，直到 PubSub 关闭
+func (ps *PubSub) run() {
+	defer close(ps.messages)
+	attempt := 0
+	for {
+		ps.mu.Lock()
+		if ps.closed {
+			ps.mu.Unlock()
+			return
+		}
+		cn := ps.cn
+		var err error
+		if cn == nil {
+			cn, err = ps.connectLocked(context.Background())
+		}
+		ps.mu.Unlock()
+
+		if err != nil {
+			timer := time.NewTimer(retryBackoff(attempt))
+			select {
+			case <-timer.C:
+			case <-ps.done:
+				timer.Stop()
+				return
+			}
+			attempt++
+			continue
+		}
+		attempt = 0
+		ps.receive(cn)
+
+		ps.mu.Lock()
+		_ = cn.close()
+		if ps.cn == cn {
+			ps.cn = nil
+		}
+		ps.mu.Unlock()
+	}
+}
+
+// receive 从连接读取消息直到连接出错，订阅和取消订阅的确认回复被忽略
+func (ps *PubSub) receive(cn *conn) {
+	// 订阅的连接长时间没有消息是正常的，不设置读超时
+	_ = cn.netConn.SetReadDeadline(time.Time{})
+	for {
+		r, err := cn.reader.ReadReply()
+		if err != nil {
+			return
+		}
+		msg := parseMessage(r)
+		if msg == nil {
+			continue
+		}
+		select {
+		case ps.messages <- msg:
+		case <-ps.done:
+			return
+		}
+	}
+}
+
+// parseMessage 把 message 和 pmessage 回复转换为 Message，其他回复返回 nil
+func parseMessage(r resp.Reply) *Message {
+	multi, ok := r.(*reply.MultiRawReply)
+	if !ok || len(multi.Replies) < 3 {
+		return nil
+	}
+	parts := make([][]byte, 0, len(multi.Replies))
+	for _, item := range multi.Replies {
+		bulk, ok := item.(*reply.BulkReply)
+		if !ok {
+			return nil
+		}
+		parts = append(parts, bulk.Arg)
+	}
+	switch string(parts[0]) {
+	case "message":
+		return &Message{Channel: string(parts[1]), Payload: parts[2]}
+	case "pmessage":
+		if len(parts) < 4 {
+			return nil
+		}
+		return &Message{Pattern: string(parts[1]), Channel: string(parts[2]), Payload: parts[3]}
+	}
+	return nil
+}
+
+// Close 取消所有订阅并关闭连接
+func (ps *PubSub) Close() error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if ps.closed {
+		return nil
+	}
+	ps.closed = true
+	close(ps.done)
+	if ps.cn != nil {
+		_ = ps.cn.close()
+	}
+	return nil
+}
+
+func setKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	return keys
+}
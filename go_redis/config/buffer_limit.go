@@ -0,0 +1,113 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ * client-output-buffer-limit <class> <hard limit> <soft limit> <soft seconds>
+ */
+
+// Client classes of client-output-buffer-limit
+const (
+	ClientClassNormal  = "normal"
+	ClientClassReplica = "replica"
+	ClientClassPubSub  = "pubsub"
+)
+
+// OutputBufferLimit limits the pending output of a client.
+// A client is disconnected as soon as it reaches Hard bytes, or once it stayed
+// above Soft bytes for SoftSeconds. A limit of 0 disables it.
+type OutputBufferLimit struct {
+	Hard        int64
+	Soft        int64
+	SoftSeconds int64
+}
+
+// ClientOutputBufferLimits holds the output buffer limit of each client class
+type ClientOutputBufferLimits struct {
+	Normal  OutputBufferLimit
+	Replica OutputBufferLimit
+	PubSub  OutputBufferLimit
+}
+
+// defaultClientOutputBufferLimits returns the same limits as the official redis.conf
+func defaultClientOutputBufferLimits() ClientOutputBufferLimits {
+	return ClientOutputBufferLimits{
+		Replica: OutputBufferLimit{Hard: 256 << 20, Soft: 64 << 20, SoftSeconds: 60},
+		PubSub:  OutputBufferLimit{Hard: 32 << 20, Soft: 8 << 20, SoftSeconds: 60},
+	}
+}
+
+// For returns the limit of the given client class
+func (limits ClientOutputBufferLimits) For(class string) OutputBufferLimit {
+	switch class {
+	case ClientClassReplica:
+		return limits.Replica
+	case ClientClassPubSub:
+		return limits.PubSub
+	}
+	return limits.Normal
+}
+
+// Set updates the classes given in args, each class takes 4 arguments.
+// Classes not mentioned keep their limits, so the directive can be repeated once per class.
+func (limits *ClientOutputBufferLimits) Set(args []string) error {
+	fields := make([]string, 0, len(args))
+	for _, arg := range args {
+		// CONFIG SET passes all the classes as a single argument
+		fields = append(fields, strings.Fields(arg)...)
+	}
+	if len(fields) == 0 || len(fields)%4 != 0 {
+		return errors.New("wrong number of arguments")
+	}
+	updated := *limits
+	for i := 0; i < len(fields); i += 4 {
+		var target *OutputBufferLimit
+		switch strings.ToLower(fields[i]) {
+		case ClientClassNormal:
+			target = &updated.Normal
+		case ClientClassReplica, "slave":
+			target = &updated.Replica
+		case ClientClassPubSub:
+			target = &updated.PubSub
+		default:
+			return fmt.Errorf("invalid client class '%s'", fields[i])
+		}
+		hard, err := parseMemory(fields[i+1])
+		if err != nil {
+			return err
+		}
+		soft, err := parseMemory(fields[i+2])
+		if err != nil {
+			return err
+		}
+		seconds, err := strconv.ParseInt(fields[i+3], 10, 64)
+		if err != nil || seconds < 0 {
+			return errors.New("soft limit seconds must be a non-negative integer")
+		}
+		*target = OutputBufferLimit{Hard: hard, Soft: soft, SoftSeconds: seconds}
+	}
+	*limits = updated
+	return nil
+}
+
+// String formats the limits the same way CONFIG GET does in the official server
+func (limits ClientOutputBufferLimits) String() string {
+	classes := []struct {
+		name  string
+		limit OutputBufferLimit
+	}{
+		{ClientClassNormal, limits.Normal},
+		{ClientClassReplica, limits.Replica},
+		{ClientClassPubSub, limits.PubSub},
+	}
+	parts := make([]string, 0, len(classes))
+	for _, c := range classes {
+		parts = append(parts, fmt.Sprintf("%s %d %d %d", c.name, c.limit.Hard, c.limit.Soft, c.limit.SoftSeconds))
+	}
+	return strings.Join(parts, " ")
+}
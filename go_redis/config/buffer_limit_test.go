@@ -0,0 +1,41 @@
+package config
+
+import "testing"
+
+func TestClientOutputBufferLimitsSet(t *testing.T) {
+	cases := []struct {
+		args []string
+		want string // formatted limits, empty if Set should fail
+	}{
+		{[]string{"normal", "1mb", "512kb", "10"},
+			"normal 1048576 524288 10 replica 268435456 67108864 60 pubsub 33554432 8388608 60"},
+		{[]string{"pubsub 0 0 0 slave 1k 1k 1"},
+			"normal 0 0 0 replica 1000 1000 1 pubsub 0 0 0"},
+		{[]string{"PubSub", "1", "2", "3"},
+			"normal 0 0 0 replica 268435456 67108864 60 pubsub 1 2 3"},
+		{[]string{"normal", "1mb", "512kb"}, ""},
+		{[]string{"master", "0", "0", "0"}, ""},
+		{[]string{"normal", "-1", "0", "0"}, ""},
+		{[]string{"normal", "0", "0", "-1"}, ""},
+		// an invalid later class leaves the earlier ones unchanged
+		{[]string{"normal 1 1 1 pubsub x 0 0"}, ""},
+		{nil, ""},
+	}
+	for _, c := range cases {
+		limits := defaultClientOutputBufferLimits()
+		err := limits.Set(c.args)
+		if (err == nil) != (c.want != "") {
+			t.Errorf("Set(%q) error = %v, want ok = %v", c.args, err, c.want != "")
+			continue
+		}
+		if err != nil {
+			if limits != defaultClientOutputBufferLimits() {
+				t.Errorf("Set(%q) failed but changed the limits to %s", c.args, limits)
+			}
+			continue
+		}
+		if got := limits.String(); got != c.want {
+			t.Errorf("Set(%q) = %s, want %s", c.args, got, c.want)
+		}
+	}
+}
@@ -2,105 +2,223 @@ package config
 
 import (
 	"bufio"
+	"fmt"
 	"go_redis/lib/logger"
 	"io"
 	"os"
+	"path/filepath"
 	"reflect"
-	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 // ServerProperties defines global config properties
+//
+// The cfg tag holds the directive name, optionally followed by ",memory" for
+// sizes that accept units like 100mb, or ",signed" for ints that may be
+// negative, or ",octal" for ints written in base 8 like file permissions.
+// time.Duration fields accept a number of seconds or a Go duration string
+// like 1m30s.
 type ServerProperties struct {
 	Bind           string `cfg:"bind"`
 	Port           int    `cfg:"port"`
 	AppendOnly     bool   `cfg:"appendOnly"`
 	AppendFilename string `cfg:"appendFilename"`
 	MaxClients     int    `cfg:"maxclients"`
-	RequirePass    string `cfg:"requirepass"`
-	Databases      int    `cfg:"databases"`
+	// ClientOutputBufferLimit can be given once per client class
+	ClientOutputBufferLimit ClientOutputBufferLimits `cfg:"client-output-buffer-limit"`
+	Timeout                 time.Duration            `cfg:"timeout"`
+	TCPKeepAlive            time.Duration            `cfg:"tcp-keepalive"`
+	RequirePass             string                   `cfg:"requirepass"`
+	Databases               int                      `cfg:"databases"`
+	LogLevel                string                   `cfg:"loglevel"`
+
+	MaxMemory        int    `cfg:"maxmemory,memory"`
+	MaxMemoryPolicy  string `cfg:"maxmemory-policy"`
+	MaxMemorySamples int    `cfg:"maxmemory-samples"`
+
+	SlowLogLogSlowerThan int `cfg:"slowlog-log-slower-than,signed"`
+	SlowLogMaxLen        int `cfg:"slowlog-max-len"`
+
+	MetricsPort int `cfg:"metrics-port"`
+
+	// ProtoMaxBulkLen limits the length of a single argument of a client request,
+	// ProtoMaxMultiBulkLen limits the number of arguments
+	ProtoMaxBulkLen      int `cfg:"proto-max-bulk-len,memory"`
+	ProtoMaxMultiBulkLen int `cfg:"proto-max-multibulk-len"`
+
+	UnixSocket     string `cfg:"unixsocket"`
+	UnixSocketPerm int    `cfg:"unixsocketperm,octal"`
+
+	TLSPort        int    `cfg:"tls-port"`
+	TLSCertFile    string `cfg:"tls-cert-file"`
+	TLSKeyFile     string `cfg:"tls-key-file"`
+	TLSCACertFile  string `cfg:"tls-ca-cert-file"`
+	TLSAuthClients string `cfg:"tls-auth-clients"`
+
+	NotifyKeyspaceEvents string `cfg:"notify-keyspace-events"`
+	TrackingTableMaxKeys int    `cfg:"tracking-table-max-keys"`
 
 	Peers []string `cfg:"peers"`
 	Self  string   `cfg:"self"`
 }
 
-// Properties holds global config properties
-var Properties *ServerProperties
+// properties holds the current *ServerProperties. A published value is never modified,
+// CONFIG SET stores an updated copy instead, so readers need no lock
+var properties atomic.Value
+
+// Properties returns the current global config properties, the result must not be modified
+func Properties() *ServerProperties {
+	return properties.Load().(*ServerProperties)
+}
+
+// Update applies fn to a copy of the current properties and publishes the copy.
+// It is meant for adjusting settings at startup, values are not validated
+func Update(fn func(props *ServerProperties)) {
+	setMu.Lock()
+	defer setMu.Unlock()
+	props := *Properties()
+	fn(&props)
+	properties.Store(&props)
+}
+
+// maxIncludeDepth limits nested include directives, so an include cycle fails instead of recursing forever
+const maxIncludeDepth = 16
 
 func init() {
 	// default config
-	Properties = &ServerProperties{
-		Bind:       "127.0.0.1",
-		Port:       6379,
-		AppendOnly: false,
+	props := defaultProperties()
+	props.Bind = "127.0.0.1"
+	properties.Store(props)
+}
+
+// defaultProperties returns the values used for directives missing from the config file
+func defaultProperties() *ServerProperties {
+	return &ServerProperties{
+		Port:         6379,
+		TCPKeepAlive: 300 * time.Second,
+
+		ClientOutputBufferLimit: defaultClientOutputBufferLimits(),
+		AppendOnly:              false,
+		Databases:               16,
+		LogLevel:                "notice",
+		MaxMemoryPolicy:         "noeviction",
+		MaxMemorySamples:        5,
+
+		SlowLogLogSlowerThan: 10000,
+		SlowLogMaxLen:        128,
+
+		ProtoMaxBulkLen:      512 * 1024 * 1024,
+		ProtoMaxMultiBulkLen: 1024 * 1024,
+
+		TLSAuthClients: "yes",
+
+		TrackingTableMaxKeys: 1000000,
 	}
 }
 
-func parse(src io.Reader) *ServerProperties {
-	config := &ServerProperties{}
+// configError describes a bad line of a config file
+type configError struct {
+	filename string
+	line     int
+	text     string
+	msg      string
+}
+
+func (e *configError) Error() string {
+	return fmt.Sprintf("config file %s, line %d: '%s': %s", e.filename, e.line, e.text, e.msg)
+}
+
+// parse reads directives from src into config, filename is only used in error messages and to resolve includes
+func parse(config *ServerProperties, src io.Reader, filename string, depth int) error {
+	t := reflect.TypeOf(config).Elem()
+	v := reflect.ValueOf(config).Elem()
+	fields := make(map[string]int)
+	for i := 0; i < t.NumField(); i++ {
+		fields[propertyName(t.Field(i))] = i
+	}
 
-	// read config file
-	rawMap := make(map[string]string)
 	scanner := bufio.NewScanner(src)
+	lineNum := 0
 	for scanner.Scan() {
-		line := scanner.Text()
-		if len(line) > 0 && line[0] == '#' {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || line[0] == '#' {
 			continue
 		}
-		pivot := strings.IndexAny(line, " ")
-		if pivot > 0 && pivot < len(line)-1 {
-			// separator found
-			key := line[0:pivot]
-			value := strings.Trim(line[pivot+1:], " ")
-			rawMap[strings.ToLower(key)] = value
+		args, err := splitArgs(line)
+		if err != nil {
+			return &configError{filename: filename, line: lineNum, text: line, msg: err.Error()}
 		}
-	}
-	if err := scanner.Err(); err != nil {
-		logger.Fatal(err)
-	}
-
-	// parse format
-	t := reflect.TypeOf(config)
-	v := reflect.ValueOf(config)
-	n := t.Elem().NumField()
-	for i := 0; i < n; i++ {
-		field := t.Elem().Field(i)
-		fieldVal := v.Elem().Field(i)
-		key, ok := field.Tag.Lookup("cfg")
-		if !ok {
-			key = field.Name
+		if len(args) == 0 {
+			continue
 		}
-		value, ok := rawMap[strings.ToLower(key)]
-		if ok {
-			// fill config
-			switch field.Type.Kind() {
-			case reflect.String:
-				fieldVal.SetString(value)
-			case reflect.Int:
-				intValue, err := strconv.ParseInt(value, 10, 64)
-				if err == nil {
-					fieldVal.SetInt(intValue)
-				}
-			case reflect.Bool:
-				boolValue := "yes" == value
-				fieldVal.SetBool(boolValue)
-			case reflect.Slice:
-				if field.Type.Elem().Kind() == reflect.String {
-					slice := strings.Split(value, ",")
-					fieldVal.Set(reflect.ValueOf(slice))
+		key := strings.ToLower(args[0])
+		args = args[1:]
+
+		if key == "include" {
+			if len(args) != 1 {
+				return &configError{filename: filename, line: lineNum, text: line, msg: "wrong number of arguments"}
+			}
+			if depth >= maxIncludeDepth {
+				return &configError{filename: filename, line: lineNum, text: line, msg: "too many nested includes"}
+			}
+			path := args[0]
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(filepath.Dir(filename), path)
+			}
+			if err := parseFile(config, path, depth+1); err != nil {
+				if _, ok := err.(*configError); ok {
+					return err
 				}
+				return &configError{filename: filename, line: lineNum, text: line, msg: err.Error()}
 			}
+			continue
+		}
+
+		i, ok := fields[key]
+		if !ok {
+			// keep accepting redis.conf files written for the official server,
+			// directives we don't support are reported but not fatal
+			logger.Warn(fmt.Sprintf("config file %s, line %d: unsupported directive '%s' ignored", filename, lineNum, key))
+			continue
+		}
+		if err := setValue(t.Field(i), v.Field(i), args); err != nil {
+			return &configError{filename: filename, line: lineNum, text: line, msg: err.Error()}
 		}
 	}
-	return config
+	return scanner.Err()
 }
 
-// SetupConfig read config file and store properties into Properties
-func SetupConfig(configFilename string) {
-	file, err := os.Open(configFilename)
+// parseFile reads directives from the named file into config
+func parseFile(config *ServerProperties, filename string, depth int) error {
+	file, err := os.Open(filename)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer file.Close()
-	Properties = parse(file)
+	return parse(config, file, filename, depth)
+}
+
+// Load reads the config file into a new ServerProperties, starting from the default values
+func Load(configFilename string) (*ServerProperties, error) {
+	config := defaultProperties()
+	if err := parseFile(config, configFilename, 0); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SetupConfig read config file and publish the properties
+func SetupConfig(configFilename string) {
+	config, err := Load(configFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	properties.Store(config)
+	configFilePath, err = filepath.Abs(configFilename)
+	if err != nil {
+		configFilePath = configFilename
+	}
 }
@@ -0,0 +1,270 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"go_redis/lib/logger"
+	"go_redis/lib/wildcard"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+/*
+ * Runtime access to config properties, used by CONFIG GET/SET/REWRITE
+ */
+
+// immutableProperties can only be set in the config file at startup
+var immutableProperties = map[string]bool{
+	"bind":           true,
+	"port":           true,
+	"appendonly":     true,
+	"appendfilename": true,
+	"databases":      true,
+	"metrics-port":   true,
+	"tls-port":       true,
+	"unixsocket":     true,
+	"unixsocketperm": true,
+	"peers":          true,
+	"self":           true,
+}
+
+// unsupportedProperties are known to Redis but rejected by CONFIG SET with the given reason
+var unsupportedProperties = map[string]string{
+	"appendfsync": "the append only file is not implemented",
+}
+
+// enumProperties lists the accepted values of properties that take one of a fixed set of values
+var enumProperties = map[string][]string{
+	"loglevel":         {"debug", "verbose", "notice", "warning"},
+	"tls-auth-clients": {"yes", "no", "optional"},
+	"maxmemory-policy": {
+		"noeviction", "allkeys-lru", "allkeys-lfu", "allkeys-random",
+		"volatile-lru", "volatile-lfu", "volatile-random", "volatile-ttl",
+	},
+}
+
+// minProperties lists the smallest accepted value of int properties whose lower values would break the server
+var minProperties = map[string]int64{
+	"proto-max-bulk-len":      1024 * 1024,
+	"proto-max-multibulk-len": 1,
+}
+
+// charsetProperties lists the characters accepted by properties made of single character flags
+var charsetProperties = map[string]string{
+	"notify-keyspace-events": "KEg$lshzxetmnA",
+}
+
+var (
+	// configFilePath is the file the properties were loaded from, empty if started without a config file
+	configFilePath string
+	// setMu serializes CONFIG SET, CONFIG REWRITE and reloads
+	setMu sync.Mutex
+	// updateListeners are called after the properties are changed at runtime
+	updateListeners []func(props *ServerProperties)
+)
+
+// AddUpdateListener registers fn to be called with the new properties
+// whenever they are changed by CONFIG SET or a reload
+func AddUpdateListener(fn func(props *ServerProperties)) {
+	setMu.Lock()
+	defer setMu.Unlock()
+	updateListeners = append(updateListeners, fn)
+}
+
+// notifyUpdate must be called with setMu held
+func notifyUpdate(props *ServerProperties) {
+	for _, fn := range updateListeners {
+		fn(props)
+	}
+}
+
+// GetConfigFilePath returns the config file the server was started with
+func GetConfigFilePath() string {
+	return configFilePath
+}
+
+// Get returns name and value of every property whose name matches the glob pattern,
+// as a flat list of name, value, name, value ...
+func Get(pattern string) []string {
+	matcher := wildcard.CompilePattern(strings.ToLower(pattern))
+	props := Properties()
+	t := reflect.TypeOf(props).Elem()
+	v := reflect.ValueOf(props).Elem()
+	result := make([]string, 0)
+	for i := 0; i < t.NumField(); i++ {
+		name := propertyName(t.Field(i))
+		if matcher.IsMatch(name) {
+			result = append(result, name, formatValue(t.Field(i), v.Field(i)))
+		}
+	}
+	return result
+}
+
+// Set validates and applies properties at runtime, pairs holds name, value, name, value ...
+// Either all properties are applied or none of them. The current properties are replaced by an
+// updated copy, so readers holding the old pointer are not affected.
+func Set(pairs ...string) error {
+	setMu.Lock()
+	defer setMu.Unlock()
+
+	props := *Properties()
+	t := reflect.TypeOf(&props).Elem()
+	v := reflect.ValueOf(&props).Elem()
+	for p := 0; p+1 < len(pairs); p += 2 {
+		name := strings.ToLower(pairs[p])
+		value := pairs[p+1]
+		if reason, ok := unsupportedProperties[name]; ok {
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - not supported, %s", name, reason)
+		}
+		found := false
+		for i := 0; i < t.NumField(); i++ {
+			if propertyName(t.Field(i)) != name {
+				continue
+			}
+			found = true
+			if immutableProperties[name] {
+				return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - can't set immutable config", name)
+			}
+			args := []string{value}
+			if t.Field(i).Type.Kind() == reflect.Slice {
+				args = strings.Fields(value)
+			}
+			if err := setValue(t.Field(i), v.Field(i), args); err != nil {
+				return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %s", name, err.Error())
+			}
+			break
+		}
+		if !found {
+			return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", name)
+		}
+	}
+	properties.Store(&props)
+	notifyUpdate(&props)
+	return nil
+}
+
+// Reload re-reads the config file and applies every setting that can be changed at runtime.
+// Changes to immutable settings are logged and ignored until the next restart.
+// On error the current properties are left untouched.
+func Reload() error {
+	setMu.Lock()
+	defer setMu.Unlock()
+
+	if configFilePath == "" {
+		return errors.New("the server is running without a config file")
+	}
+	loaded, err := Load(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	props := *Properties()
+	t := reflect.TypeOf(&props).Elem()
+	v := reflect.ValueOf(&props).Elem()
+	newVal := reflect.ValueOf(loaded).Elem()
+	changed := 0
+	for i := 0; i < t.NumField(); i++ {
+		name := propertyName(t.Field(i))
+		oldValue := formatValue(t.Field(i), v.Field(i))
+		newValue := formatValue(t.Field(i), newVal.Field(i))
+		if oldValue == newValue {
+			continue
+		}
+		if immutableProperties[name] {
+			logger.Warn(fmt.Sprintf("config reload: %s changed from '%s' to '%s', restart required to apply it", name, oldValue, newValue))
+			continue
+		}
+		v.Field(i).Set(newVal.Field(i))
+		changed++
+		if name == "requirepass" {
+			logger.Info("config reload: requirepass changed")
+		} else {
+			logger.Info(fmt.Sprintf("config reload: %s '%s' -> '%s'", name, oldValue, newValue))
+		}
+	}
+	properties.Store(&props)
+	notifyUpdate(&props)
+	logger.Info(fmt.Sprintf("config reloaded from %s, %d setting(s) changed", configFilePath, changed))
+	return nil
+}
+
+// Rewrite writes the current properties back to the config file.
+// Comments, blank lines and the order of directives are kept, only values are updated;
+// properties missing from the file are appended at the end if they differ from the defaults.
+func Rewrite() error {
+	setMu.Lock()
+	defer setMu.Unlock()
+
+	if configFilePath == "" {
+		return errors.New("The server is running without a config file")
+	}
+	content, err := os.ReadFile(configFilePath)
+	if err != nil {
+		return err
+	}
+
+	props := Properties()
+	t := reflect.TypeOf(props).Elem()
+	v := reflect.ValueOf(props).Elem()
+	values := make(map[string]string)
+	names := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := propertyName(t.Field(i))
+		values[name] = formatValue(t.Field(i), v.Field(i))
+		if t.Field(i).Type.Kind() == reflect.String {
+			values[name] = quoteArg(values[name])
+		}
+		names = append(names, name)
+	}
+
+	var buf bytes.Buffer
+	written := make(map[string]bool)
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) == 0 || trimmed[0] == '#' {
+			buf.WriteString(line + "\n")
+			continue
+		}
+		key := strings.ToLower(strings.Fields(trimmed)[0])
+		value, known := values[key]
+		if !known {
+			buf.WriteString(line + "\n")
+			continue
+		}
+		if written[key] {
+			// drop repeated directives, the first one already holds the current value
+			continue
+		}
+		written[key] = true
+		if value != "" && value != `""` {
+			buf.WriteString(key + " " + value + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	defaults := reflect.ValueOf(defaultProperties()).Elem()
+	for i, name := range names {
+		if written[name] || formatValue(t.Field(i), defaults.Field(i)) == formatValue(t.Field(i), v.Field(i)) {
+			continue
+		}
+		buf.WriteString(name + " " + values[name] + "\n")
+	}
+
+	// write to a temp file first so a failed write can't leave a truncated config behind
+	tmpFile := configFilePath + ".tmp"
+	info, err := os.Stat(configFilePath)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(tmpFile, buf.Bytes(), info.Mode()); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile, configFilePath)
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSetPublishesNewCopy(t *testing.T) {
+	old := Properties()
+	defer properties.Store(old)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			_ = Properties().MaxClients
+		}
+	}()
+	for i := 1; i <= 100; i++ {
+		if err := Set("maxclients", strconv.Itoa(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+	if got := Properties().MaxClients; got != 100 {
+		t.Fatalf("maxclients = %d, want 100", got)
+	}
+	if old.MaxClients == 100 {
+		t.Fatal("Set modified the published properties in place")
+	}
+}
+
+func TestSet(t *testing.T) {
+	old := Properties()
+	defer properties.Store(old)
+
+	tests := []struct {
+		pairs   []string
+		wantErr string
+	}{
+		{[]string{"requirepass", "secret"}, ""},
+		{[]string{"maxmemory-policy", "ALLKEYS-LRU", "maxclients", "10"}, ""},
+		{[]string{"appendfsync", "always"}, "not supported"},
+		{[]string{"port", "7000"}, "can't set immutable config"},
+		{[]string{"maxclients", "-1"}, "non-negative"},
+		{[]string{"maxmemory-policy", "lru"}, "argument must be one of"},
+		{[]string{"nosuchoption", "1"}, "Unknown option"},
+		// 一个参数出错时，其他参数也不会生效
+		{[]string{"maxclients", "20", "maxmemory-policy", "bad"}, "argument must be one of"},
+	}
+	for _, tt := range tests {
+		err := Set(tt.pairs...)
+		if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("Set(%v) = %v, want error containing %q", tt.pairs, err, tt.wantErr)
+		}
+	}
+	props := Properties()
+	if props.RequirePass != "secret" || props.MaxMemoryPolicy != "allkeys-lru" || props.MaxClients != 10 {
+		t.Errorf("unexpected properties after Set: %+v", props)
+	}
+}
+
+func TestReload(t *testing.T) {
+	old, oldPath, oldListeners := Properties(), configFilePath, updateListeners
+	defer func() {
+		properties.Store(old)
+		configFilePath, updateListeners = oldPath, oldListeners
+	}()
+
+	configFilePath = filepath.Join(t.TempDir(), "redis.conf")
+	base, err := Load(writeConfig(t, configFilePath, "port 6379\nmaxclients 10\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	properties.Store(base)
+	var notified *ServerProperties
+	updateListeners = nil
+	AddUpdateListener(func(props *ServerProperties) {
+		notified = props
+	})
+
+	tests := []struct {
+		content    string
+		wantErr    bool
+		port       int
+		maxClients int
+		logLevel   string
+	}{
+		{"port 6379\nmaxclients 20\nloglevel warning\n", false, 6379, 20, "warning"},
+		// port 只能在启动时设置，其他配置仍然生效
+		{"port 7000\nmaxclients 30\n", false, 6379, 30, "notice"},
+		// 配置文件有错误时保留当前配置
+		{"port 6379\nmaxclients -1\n", true, 6379, 30, "notice"},
+		{"port 6379\nmaxclients 40 \"unbalanced\n", true, 6379, 30, "notice"},
+	}
+	for _, tt := range tests {
+		notified = nil
+		writeConfig(t, configFilePath, tt.content)
+		err := Reload()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Reload(%q) error = %v, want error %v", tt.content, err, tt.wantErr)
+		}
+		props := Properties()
+		if props.Port != tt.port || props.MaxClients != tt.maxClients || props.LogLevel != tt.logLevel {
+			t.Errorf("after Reload(%q): port %d maxclients %d loglevel %s", tt.content, props.Port, props.MaxClients, props.LogLevel)
+		}
+		if tt.wantErr && notified != nil || !tt.wantErr && notified != props {
+			t.Errorf("Reload(%q): listener got %p, current properties %p", tt.content, notified, props)
+		}
+	}
+
+	configFilePath = ""
+	if err := Reload(); err == nil {
+		t.Error("Reload without a config file should fail")
+	}
+}
+
+func writeConfig(t *testing.T, path, content string) string {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
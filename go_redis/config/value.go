@@ -0,0 +1,384 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * Conversion between directive arguments and typed property values
+ */
+
+// customValue is implemented by property types with their own directive syntax, e.g. ClientOutputBufferLimits
+type customValue interface {
+	Set(args []string) error
+	String() string
+}
+
+// memoryUnits maps memory size suffixes to multipliers, same as the official redis.conf
+var memoryUnits = map[string]int64{
+	"":   1,
+	"b":  1,
+	"k":  1000,
+	"kb": 1024,
+	"m":  1000 * 1000,
+	"mb": 1024 * 1024,
+	"g":  1000 * 1000 * 1000,
+	"gb": 1024 * 1024 * 1024,
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// propertyName returns the lower case config name of a struct field
+func propertyName(field reflect.StructField) string {
+	key, ok := field.Tag.Lookup("cfg")
+	if !ok {
+		return strings.ToLower(field.Name)
+	}
+	if pivot := strings.IndexByte(key, ','); pivot >= 0 {
+		key = key[:pivot]
+	}
+	return strings.ToLower(key)
+}
+
+// hasOption reports whether the cfg tag of field carries the given option, e.g. "memory"
+func hasOption(field reflect.StructField, option string) bool {
+	options := strings.Split(field.Tag.Get("cfg"), ",")
+	for _, o := range options[1:] {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// splitArgs splits a directive line into arguments.
+// Arguments are separated by spaces and may be quoted: "..." supports \n \r \t \b \a \\ \" and \xHH escapes,
+// '...' only supports \'. A closing quote must be followed by a space or the end of line.
+func splitArgs(line string) ([]string, error) {
+	args := make([]string, 0)
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i >= len(line) {
+			return args, nil
+		}
+		var current strings.Builder
+		switch line[i] {
+		case '"':
+			i++
+			closed := false
+			for i < len(line) && !closed {
+				c := line[i]
+				if c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]) {
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					current.WriteByte(byte(b))
+					i += 4
+					continue
+				}
+				if c == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						current.WriteByte('\n')
+					case 'r':
+						current.WriteByte('\r')
+					case 't':
+						current.WriteByte('\t')
+					case 'b':
+						current.WriteByte('\b')
+					case 'a':
+						current.WriteByte('\a')
+					default:
+						current.WriteByte(line[i])
+					}
+					i++
+					continue
+				}
+				if c == '"' {
+					closed = true
+				} else {
+					current.WriteByte(c)
+				}
+				i++
+			}
+			if !closed || (i < len(line) && !isSpace(line[i])) {
+				return nil, errors.New("unbalanced quotes")
+			}
+		case '\'':
+			i++
+			closed := false
+			for i < len(line) && !closed {
+				c := line[i]
+				if c == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					current.WriteByte('\'')
+					i += 2
+					continue
+				}
+				if c == '\'' {
+					closed = true
+				} else {
+					current.WriteByte(c)
+				}
+				i++
+			}
+			if !closed || (i < len(line) && !isSpace(line[i])) {
+				return nil, errors.New("unbalanced quotes")
+			}
+		default:
+			for i < len(line) && !isSpace(line[i]) {
+				current.WriteByte(line[i])
+				i++
+			}
+		}
+		args = append(args, current.String())
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// quoteArg quotes s for writing back to a config file if splitArgs would not read it back as one argument.
+// Only the escapes splitArgs decodes are used, bytes that are not printable ASCII are written as \xHH
+func quoteArg(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\r\n\"'\\") && isPrintable(s) {
+		return s
+	}
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch c {
+		case '\\', '"':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\a':
+			b.WriteString(`\a`)
+		default:
+			if c < ' ' || c > '~' {
+				fmt.Fprintf(&b, `\x%02x`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// isPrintable reports whether s only contains printable ASCII characters
+func isPrintable(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// parseMemory parses a size like 100, 1k, 10kb or 2GB into bytes
+func parseMemory(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	pivot := len(lower)
+	for pivot > 0 && (lower[pivot-1] < '0' || lower[pivot-1] > '9') {
+		pivot--
+	}
+	multiplier, ok := memoryUnits[lower[pivot:]]
+	if !ok || pivot == 0 {
+		return 0, errors.New("argument must be a memory value")
+	}
+	n, err := strconv.ParseInt(lower[:pivot], 10, 64)
+	if err != nil || n < 0 {
+		return 0, errors.New("argument must be a memory value")
+	}
+	if n > math.MaxInt64/multiplier {
+		return 0, errors.New("argument is out of range")
+	}
+	return n * multiplier, nil
+}
+
+// parseDuration parses a number of seconds or a Go duration string like 1m30s
+func parseDuration(value string) (time.Duration, error) {
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+		if seconds < 0 {
+			return 0, errors.New("argument must be a non-negative duration")
+		}
+		if seconds > int64(math.MaxInt64/time.Second) {
+			return 0, errors.New("argument is out of range")
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, errors.New("argument must be a number of seconds or a duration like 1m30s")
+	}
+	if d < 0 {
+		return 0, errors.New("argument must be a non-negative duration")
+	}
+	return d, nil
+}
+
+// formatDuration prints whole seconds as a plain number like redis.conf does, other durations like 1.5s
+func formatDuration(d time.Duration) string {
+	if d%time.Second == 0 {
+		return strconv.FormatInt(int64(d/time.Second), 10)
+	}
+	return d.String()
+}
+
+// setValue validates the directive arguments and stores them into fieldVal
+func setValue(field reflect.StructField, fieldVal reflect.Value, args []string) error {
+	name := propertyName(field)
+	if custom, ok := fieldVal.Addr().Interface().(customValue); ok {
+		return custom.Set(args)
+	}
+	if field.Type.Kind() == reflect.Slice {
+		if field.Type.Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type of '%s'", name)
+		}
+		// peers can be given as separate arguments or as a comma separated list
+		values := make([]string, 0, len(args))
+		for _, arg := range args {
+			for _, item := range strings.Split(arg, ",") {
+				if item != "" {
+					values = append(values, item)
+				}
+			}
+		}
+		fieldVal.Set(reflect.ValueOf(values))
+		return nil
+	}
+
+	if len(args) != 1 {
+		return errors.New("wrong number of arguments")
+	}
+	value := args[0]
+	if field.Type == durationType {
+		d, err := parseDuration(value)
+		if err != nil {
+			return err
+		}
+		fieldVal.SetInt(int64(d))
+		return nil
+	}
+	switch field.Type.Kind() {
+	case reflect.String:
+		if accepted, ok := enumProperties[name]; ok {
+			value = strings.ToLower(value)
+			if !containsString(accepted, value) {
+				return fmt.Errorf("argument must be one of %s", strings.Join(accepted, ", "))
+			}
+		}
+		if charset, ok := charsetProperties[name]; ok {
+			for _, c := range value {
+				if !strings.ContainsRune(charset, c) {
+					return fmt.Errorf("argument must only contain the characters %s", charset)
+				}
+			}
+		}
+		fieldVal.SetString(value)
+	case reflect.Int:
+		var intValue int64
+		var err error
+		if hasOption(field, "memory") {
+			intValue, err = parseMemory(value)
+			if err != nil {
+				return err
+			}
+		} else {
+			base := 10
+			if hasOption(field, "octal") {
+				base = 8
+			}
+			intValue, err = strconv.ParseInt(value, base, 64)
+			if err != nil {
+				return errors.New("argument couldn't be parsed into an integer")
+			}
+		}
+		if intValue < 0 && !hasOption(field, "signed") {
+			return errors.New("argument must be a non-negative integer")
+		}
+		if fieldVal.OverflowInt(intValue) {
+			return errors.New("argument is out of range")
+		}
+		if min, ok := minProperties[name]; ok && intValue < min {
+			return fmt.Errorf("argument must be at least %d", min)
+		}
+		fieldVal.SetInt(intValue)
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "yes":
+			fieldVal.SetBool(true)
+		case "no":
+			fieldVal.SetBool(false)
+		default:
+			return errors.New("argument must be 'yes' or 'no'")
+		}
+	default:
+		return fmt.Errorf("unsupported type of '%s'", name)
+	}
+	return nil
+}
+
+// formatValue converts a property value into its string representation
+func formatValue(field reflect.StructField, fieldVal reflect.Value) string {
+	if fieldVal.Type() == durationType {
+		return formatDuration(time.Duration(fieldVal.Int()))
+	}
+	if custom, ok := fieldVal.Interface().(customValue); ok {
+		return custom.String()
+	}
+	if fieldVal.CanAddr() {
+		if custom, ok := fieldVal.Addr().Interface().(customValue); ok {
+			return custom.String()
+		}
+	}
+	switch fieldVal.Kind() {
+	case reflect.String:
+		return fieldVal.String()
+	case reflect.Int:
+		if hasOption(field, "octal") {
+			return strconv.FormatInt(fieldVal.Int(), 8)
+		}
+		return strconv.FormatInt(fieldVal.Int(), 10)
+	case reflect.Bool:
+		if fieldVal.Bool() {
+			return "yes"
+		}
+		return "no"
+	case reflect.Slice:
+		if slice, ok := fieldVal.Interface().([]string); ok {
+			return strings.Join(slice, ",")
+		}
+	}
+	return ""
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQuoteArgRoundTrip(t *testing.T) {
+	values := []string{
+		"",
+		"plain",
+		"with space",
+		`double"quote`,
+		"single'quote",
+		`back\slash`,
+		`\x41 is not an escape`,
+		"line\nbreak\r\ttab",
+		"bell\a backspace\b",
+		"nul\x00byte",
+		"\x7f\xff",
+		"héllo",
+	}
+	for _, value := range values {
+		quoted := quoteArg(value)
+		args, err := splitArgs("key " + quoted)
+		if err != nil {
+			t.Errorf("splitArgs(%s) error: %v", quoted, err)
+			continue
+		}
+		if len(args) != 2 || args[1] != value {
+			t.Errorf("quoteArg(%q) = %s, read back as %q", value, quoted, args)
+		}
+	}
+}
+
+func TestQuoteArgEscapes(t *testing.T) {
+	cases := map[string]string{
+		"plain":     "plain",
+		"a b":       `"a b"`,
+		"\x01":      `"\x01"`,
+		"é":         `"\xc3\xa9"`,
+		"tab\there": `"tab\there"`,
+	}
+	for value, want := range cases {
+		if got := quoteArg(value); got != want {
+			t.Errorf("quoteArg(%q) = %s, want %s", value, got, want)
+		}
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	cases := []struct {
+		value string
+		want  int64
+		ok    bool
+	}{
+		{"100", 100, true},
+		{"1k", 1000, true},
+		{"10kb", 10 * 1024, true},
+		{"2GB", 2 << 30, true},
+		{strconv.FormatInt(math.MaxInt64, 10), math.MaxInt64, true},
+		{"8589934592gb", 0, false},
+		{strconv.FormatInt(math.MaxInt64/1024+1, 10) + "kb", 0, false},
+		{"-1", 0, false},
+		{"gb", 0, false},
+		{"1tb", 0, false},
+	}
+	for _, c := range cases {
+		got, err := parseMemory(c.value)
+		if (err == nil) != c.ok {
+			t.Errorf("parseMemory(%s) error = %v, want ok = %v", c.value, err, c.ok)
+			continue
+		}
+		if c.ok && got != c.want {
+			t.Errorf("parseMemory(%s) = %d, want %d", c.value, got, c.want)
+		}
+	}
+}
+
+func TestSetValue(t *testing.T) {
+	type props struct {
+		Port   int           `cfg:"port"`
+		Perm   int           `cfg:"perm,octal"`
+		Signed int           `cfg:"signed,signed"`
+		Flag   bool          `cfg:"flag"`
+		Name   string        `cfg:"name"`
+		Idle   time.Duration `cfg:"idle"`
+		// minProperties is looked up by directive name
+		BulkLen int `cfg:"proto-max-bulk-len,memory"`
+	}
+	cases := []struct {
+		field string
+		value string
+		want  string // value printed by formatValue, empty if setValue should fail
+	}{
+		{"Port", "6379", "6379"},
+		{"Port", "-1", ""},
+		{"Port", "0x10", ""},
+		{"Perm", "700", "700"},
+		{"Perm", "0755", "755"},
+		{"Perm", "8", ""},
+		{"Signed", "-1", "-1"},
+		{"Flag", "YES", "yes"},
+		{"Flag", "1", ""},
+		{"Name", "a b", "a b"},
+		{"Idle", "300", "300"},
+		{"Idle", "1m30s", "90"},
+		{"Idle", "1500ms", "1.5s"},
+		{"Idle", "-1", ""},
+		{"BulkLen", "2mb", "2097152"},
+		{"BulkLen", "512kb", ""},
+	}
+	for _, c := range cases {
+		v := reflect.ValueOf(&props{}).Elem()
+		field, _ := v.Type().FieldByName(c.field)
+		fieldVal := v.FieldByName(c.field)
+		err := setValue(field, fieldVal, []string{c.value})
+		if (err == nil) != (c.want != "") {
+			t.Errorf("%s %s: error = %v, want ok = %v", c.field, c.value, err, c.want != "")
+			continue
+		}
+		if got := formatValue(field, fieldVal); err == nil && got != c.want {
+			t.Errorf("%s %s: formatted as %s, want %s", c.field, c.value, got, c.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	cases := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"0", 0, true},
+		{"300", 300 * time.Second, true},
+		{"1m30s", 90 * time.Second, true},
+		{"250ms", 250 * time.Millisecond, true},
+		{"-1", 0, false},
+		{"-1s", 0, false},
+		{"10x", 0, false},
+		{"", 0, false},
+		{strconv.FormatInt(math.MaxInt64, 10), 0, false},
+	}
+	for _, c := range cases {
+		got, err := parseDuration(c.value)
+		if (err == nil) != c.ok {
+			t.Errorf("parseDuration(%s) error = %v, want ok = %v", c.value, err, c.ok)
+			continue
+		}
+		if c.ok && got != c.want {
+			t.Errorf("parseDuration(%s) = %v, want %v", c.value, got, c.want)
+		}
+	}
+}
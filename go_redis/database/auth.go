@@ -0,0 +1,41 @@
+package database
+
+import (
+	"crypto/subtle"
+	"go_redis/config"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+)
+
+/*
+ * 执行 AUTH 指令：配置了 requirepass 时，客户端要先验证密码才能执行其他指令
+ * 和 Redis 一样，修改 requirepass 不影响已经通过验证的客户端
+ */
+
+// defaultUser 是 AUTH username password 中唯一可用的用户名
+const defaultUser = "default"
+
+// isAuthenticated 判断客户端是否可以执行指令
+func isAuthenticated(c resp.Connection) bool {
+	return config.Properties().RequirePass == "" || c.IsAuthenticated()
+}
+
+// execAuth AUTH [username] password
+func execAuth(c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 || len(args) > 2 {
+		return reply.MakeArgNumErrReply("auth")
+	}
+	requirePass := config.Properties().RequirePass
+	if requirePass == "" {
+		return reply.MakeErrReply("ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?")
+	}
+	password := args[len(args)-1]
+	userOK := len(args) == 1 || string(args[0]) == defaultUser
+	// 使用固定时间的比较，避免通过响应时间猜测密码
+	passOK := subtle.ConstantTimeCompare(password, []byte(requirePass)) == 1
+	if !userOK || !passOK {
+		return reply.MakeErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+	}
+	c.SetAuthenticated(true)
+	return reply.MakeOkReply()
+}
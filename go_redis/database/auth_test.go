@@ -0,0 +1,58 @@
+package database
+
+import (
+	"go_redis/config"
+	"strings"
+	"testing"
+)
+
+func TestAuth(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	old := config.Properties()
+	defer config.Update(func(props *config.ServerProperties) {
+		*props = *old
+	})
+
+	c := &blockingConn{}
+	other := &blockingConn{}
+	tests := []struct {
+		conn *blockingConn
+		cmd  string
+		want string
+	}{
+		{c, "auth secret", "-ERR AUTH <password> called without any password configured for the default user. Are you sure your configuration is correct?\r\n"},
+		{c, "config set requirepass secret", "+OK\r\n"},
+		// 修改密码不影响已经连接的客户端之外，其他客户端都要先验证
+		{c, "get k", "-NOAUTH Authentication required.\r\n"},
+		{c, "config set requirepass x", "-NOAUTH Authentication required.\r\n"},
+		{c, "auth wrong", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{c, "auth someone secret", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{c, "auth", "-ERR wrong number of arguments for 'auth' command\r\n"},
+		{c, "auth secret", "+OK\r\n"},
+		{c, "set k v", "+OK\r\n"},
+		{c, "auth wrong", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		// 验证失败不会撤销之前的验证
+		{c, "get k", "$1\r\nv\r\n"},
+		{other, "get k", "-NOAUTH Authentication required.\r\n"},
+		{other, "auth default secret", "+OK\r\n"},
+		{other, "get k", "$1\r\nv\r\n"},
+		// 已经通过验证的客户端在密码修改后仍然可以执行指令
+		{c, "config set requirepass changed", "+OK\r\n"},
+		{c, "get k", "$1\r\nv\r\n"},
+		{&blockingConn{}, "auth secret", "-WRONGPASS invalid username-password pair or user is disabled.\r\n"},
+		{c, "config set requirepass \"\"", "+OK\r\n"},
+	}
+	for _, tt := range tests {
+		args := strings.Fields(tt.cmd)
+		if args[len(args)-1] == "\"\"" {
+			args[len(args)-1] = ""
+		}
+		if got := string(mdb.Exec(tt.conn, toCmdLine(args...)).ToBytes()); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+	if got := string(mdb.Exec(&blockingConn{}, toCmdLine("get", "k")).ToBytes()); got != "$1\r\nv\r\n" {
+		t.Errorf("get without requirepass: got %q", got)
+	}
+}
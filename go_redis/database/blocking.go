@@ -0,0 +1,323 @@
+package database
+
+import (
+	"container/list"
+	"context"
+	"go_redis/interface/resp"
+	"go_redis/lib/utils"
+	"go_redis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * 阻塞指令的等待队列：BLPOP 等阻塞指令在等待的 key 没有数据时返回 BlockedReply，
+ * 网络层在处理这个客户端的协程中调用 Database.Block 挂起客户端，直到有指令写入等待的 key、超时或客户端断开。
+ *
+ * 同一个 key 的等待者按开始等待的先后顺序排队。key 被写入后开始一轮唤醒：
+ * 从队头开始依次让每个等待者重新执行一次指令，前一个执行完之后才轮到下一个，
+ * 执行成功的等待者离开队列，没有取到数据的等待者留在原来的位置。
+ * 这样先开始等待的客户端总是先拿到数据，一次写入多个元素时也能依次满足多个等待者。
+ *
+ * 不能挂起客户端的场景（比如在进程内直接执行指令）按超时处理，和Redis在事务中执行阻塞指令的行为相同
+ */
+
+// BlockedReply 是阻塞指令在等待的 key 没有数据时返回的回复，由 DB.Block 创建
+type BlockedReply struct {
+	dbIndex int
+	keys    []string
+	// 为0时一直等待
+	timeout time.Duration
+	// 超时后发给客户端的回复
+	timeoutReply resp.Reply
+	// 被唤醒后重新执行的指令，执行函数没有设置时由 Database.Exec 保存原始的指令
+	cmdLine CmdLine
+}
+
+// ToBytes 返回超时的回复，网络层没有挂起客户端时直接把它发给客户端
+func (r *BlockedReply) ToBytes() []byte {
+	return r.timeoutReply.ToBytes()
+}
+
+// Block 创建 BlockedReply，阻塞指令的执行函数在等待的 key 都没有数据时返回它，timeout 为0表示一直等待
+func (db *DB) Block(keys []string, timeout time.Duration, timeoutReply resp.Reply) *BlockedReply {
+	return &BlockedReply{
+		dbIndex:      db.index,
+		keys:         keys,
+		timeout:      timeout,
+		timeoutReply: timeoutReply,
+	}
+}
+
+// copyCmdLine 复制指令的每个参数
+func copyCmdLine(cmdLine CmdLine) CmdLine {
+	copied := make(CmdLine, len(cmdLine))
+	for i, arg := range cmdLine {
+		copied[i] = utils.CopyBytes(arg)
+	}
+	return copied
+}
+
+// withCmdLine 设置被唤醒后重新执行的指令，用于重新执行时参数需要改写的指令，
+// 例如 XREAD 的 ID "$" 表示开始阻塞时的最后一条消息，重新执行时要换成具体的ID
+func (r *BlockedReply) withCmdLine(cmdLine CmdLine) *BlockedReply {
+	r.cmdLine = cmdLine
+	return r
+}
+
+// parseBlockTimeout 解析以秒为单位的阻塞超时时间，可以是小数，0 表示一直等待
+func parseBlockTimeout(arg []byte) (time.Duration, reply.ErrorReply) {
+	seconds, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, reply.MakeErrReply("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, reply.MakeErrReply("ERR timeout is negative")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+// blockingKey 是某个数据库中的一个 key
+type blockingKey struct {
+	dbIndex int
+	key     string
+}
+
+// waiter 是一个阻塞中的客户端
+type waiter struct {
+	conn  resp.Connection
+	keys  []blockingKey
+	elems []*list.Element
+	// 轮到这个客户端重新执行指令时收到通知，容量为1，多次通知合并为一次
+	ready chan struct{}
+	// 正在轮到这个客户端的 key，它执行完之后要把这一轮交给队列中的下一个客户端
+	turns map[blockingKey]struct{}
+	// 为true时已经离开了所有的等待队列
+	removed bool
+}
+
+// waitQueue 是等待同一个 key 的客户端
+type waitQueue struct {
+	waiters *list.List
+	// 当前这一轮轮到的客户端，为 nil 表示没有进行中的一轮
+	turn *list.Element
+	// 一轮进行中 key 又被写入了，这一轮结束之后从队头再开始一轮
+	again bool
+}
+
+// blockingRegistry 记录阻塞中的客户端和它们等待的 key
+type blockingRegistry struct {
+	mu      sync.Mutex
+	keys    map[blockingKey]*waitQueue
+	clients map[resp.Connection]*waiter
+	// 阻塞中的客户端数量，为0时写入 key 不需要加锁检查等待者
+	count int32
+}
+
+func makeBlockingRegistry() *blockingRegistry {
+	return &blockingRegistry{
+		keys:    make(map[blockingKey]*waitQueue),
+		clients: make(map[resp.Connection]*waiter),
+	}
+}
+
+// add 把客户端加入它等待的每个 key 的队尾
+func (r *blockingRegistry) add(c resp.Connection, dbIndex int, keys []string) *waiter {
+	w := &waiter{
+		conn:  c,
+		keys:  make([]blockingKey, 0, len(keys)),
+		elems: make([]*list.Element, 0, len(keys)),
+		ready: make(chan struct{}, 1),
+		turns: make(map[blockingKey]struct{}),
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range keys {
+		bk := blockingKey{dbIndex: dbIndex, key: key}
+		queue, ok := r.keys[bk]
+		if !ok {
+			queue = &waitQueue{waiters: list.New()}
+			r.keys[bk] = queue
+		}
+		w.keys = append(w.keys, bk)
+		w.elems = append(w.elems, queue.waiters.PushBack(w))
+	}
+	r.clients[c] = w
+	atomic.AddInt32(&r.count, 1)
+	return w
+}
+
+// giveTurn 让 elem 对应的客户端重新执行指令
+func (r *blockingRegistry) giveTurn(bk blockingKey, queue *waitQueue, elem *list.Element) {
+	queue.turn = elem
+	if elem == nil {
+		return
+	}
+	w := elem.Value.(*waiter)
+	w.turns[bk] = struct{}{}
+	select {
+	case w.ready <- struct{}{}:
+	default:
+	}
+}
+
+// passTurn 这一轮中 next 之前的客户端都已经执行过，轮到 next；队列走完时结束这一轮
+func (r *blockingRegistry) passTurn(bk blockingKey, queue *waitQueue, next *list.Element) {
+	if next == nil && queue.again {
+		queue.again = false
+		next = queue.waiters.Front()
+	}
+	r.giveTurn(bk, queue, next)
+}
+
+// signal 在 key 被写入后开始一轮唤醒，已经有进行中的一轮时，在它结束后再来一轮
+func (r *blockingRegistry) signal(dbIndex int, key string) {
+	if atomic.LoadInt32(&r.count) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	bk := blockingKey{dbIndex: dbIndex, key: key}
+	if queue, ok := r.keys[bk]; ok {
+		r.signalLocked(bk, queue)
+	}
+}
+
+// signalDB 为数据库中所有被等待的 key 开始一轮唤醒，用于 SWAPDB 这样整体替换数据库数据的指令
+func (r *blockingRegistry) signalDB(dbIndex int) {
+	if atomic.LoadInt32(&r.count) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for bk, queue := range r.keys {
+		if bk.dbIndex == dbIndex {
+			r.signalLocked(bk, queue)
+		}
+	}
+}
+
+func (r *blockingRegistry) signalLocked(bk blockingKey, queue *waitQueue) {
+	if queue.turn != nil {
+		queue.again = true
+		return
+	}
+	r.giveTurn(bk, queue, queue.waiters.Front())
+}
+
+// done 在客户端重新执行指令但没有取到数据之后调用，它留在队列中原来的位置，把这一轮交给下一个客户端
+func (r *blockingRegistry) done(w *waiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, bk := range w.keys {
+		if _, ok := w.turns[bk]; !ok {
+			continue
+		}
+		delete(w.turns, bk)
+		r.passTurn(bk, r.keys[bk], w.elems[i].Next())
+	}
+}
+
+// remove 把客户端从所有队列中移除，正在轮到它的 key 交给下一个客户端
+func (r *blockingRegistry) remove(w *waiter) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.removeLocked(w)
+}
+
+func (r *blockingRegistry) removeLocked(w *waiter) {
+	if w.removed {
+		return
+	}
+	w.removed = true
+	for i, bk := range w.keys {
+		queue := r.keys[bk]
+		next := w.elems[i].Next()
+		queue.waiters.Remove(w.elems[i])
+		if queue.turn == w.elems[i] {
+			r.passTurn(bk, queue, next)
+		}
+		if queue.waiters.Len() == 0 {
+			delete(r.keys, bk)
+		}
+	}
+	if r.clients[w.conn] == w {
+		delete(r.clients, w.conn)
+	}
+	atomic.AddInt32(&r.count, -1)
+}
+
+// removeClient 在客户端断开后移除它的等待
+func (r *blockingRegistry) removeClient(c resp.Connection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if w, ok := r.clients[c]; ok {
+		r.removeLocked(w)
+	}
+}
+
+// isBlocked 判断客户端是否正在阻塞
+func (r *blockingRegistry) isBlocked(c resp.Connection) bool {
+	if atomic.LoadInt32(&r.count) == 0 {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, ok := r.clients[c]
+	return ok
+}
+
+// signalKeyReady 在 key 被写入后唤醒等待它的客户端
+func (db *DB) signalKeyReady(key string) {
+	if db.blocking != nil {
+		db.blocking.signal(db.index, key)
+	}
+}
+
+// Block 挂起执行阻塞指令的客户端，直到等待的 key 被写入后重新执行指令成功、超时或 ctx 结束，
+// 返回要发给客户端的回复，ctx 结束时返回 nil。由网络层在处理这个客户端的协程中调用
+func (mdb *Database) Block(ctx context.Context, c resp.Connection, blocked *BlockedReply) resp.Reply {
+	var deadline <-chan time.Time
+	if blocked.timeout > 0 {
+		timer := time.NewTimer(blocked.timeout)
+		defer timer.Stop()
+		deadline = timer.C
+	}
+	// 先加入等待队列再重新执行指令，执行指令之后写入的数据一定会唤醒这个客户端
+	w := mdb.blocking.add(c, blocked.dbIndex, blocked.keys)
+	// 离开队列时，正在轮到这个客户端的 key 会交给下一个客户端，
+	// 取到数据之后下一个客户端接着检查 key 中是否还有剩余的数据
+	defer mdb.blocking.remove(w)
+	for {
+		// 直接交给 DB 执行：指令第一次执行时已经经过了 Database.Exec 的检查和统计，
+		// 重新执行是同一条指令的延续，不应再次计入
+		// 和 Database.Exec 一样持有读锁，不会和 SWAPDB FLUSHALL 交错执行
+		mdb.dbLock.RLock()
+		result := mdb.dbSet[blocked.dbIndex].Exec(c, blocked.cmdLine)
+		mdb.dbLock.RUnlock()
+		next, ok := result.(*BlockedReply)
+		if !ok {
+			// 挂起之后才完成的写指令在这里为修改的 key 发送失效消息
+			if cmd, ok := cmdTable[strings.ToLower(string(blocked.cmdLine[0]))]; ok {
+				mdb.tracking.afterCommand(c, cmd, blocked.cmdLine)
+			}
+			return result
+		}
+		if next.cmdLine == nil {
+			next.cmdLine = blocked.cmdLine
+		}
+		blocked = next
+		mdb.blocking.done(w)
+		select {
+		case <-w.ready:
+		case <-deadline:
+			return blocked.timeoutReply
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package database
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// blockingConn 是测试用的客户端连接
+type blockingConn struct {
+	id            int64
+	dbIndex       int
+	name          string
+	authenticated bool
+	subscribed    bool
+}
+
+func (c *blockingConn) Write(b []byte) error {
+	return nil
+}
+
+func (c *blockingConn) GetID() int64 {
+	return c.id
+}
+
+func (c *blockingConn) GetDBIndex() int {
+	return c.dbIndex
+}
+
+func (c *blockingConn) SelectDB(dbIndex int) {
+	c.dbIndex = dbIndex
+}
+
+func (c *blockingConn) RemoteAddr() net.Addr {
+	return nil
+}
+
+func (c *blockingConn) GetName() string {
+	return c.name
+}
+
+func (c *blockingConn) SetName(name string) {
+	c.name = name
+}
+
+func (c *blockingConn) SetAuthenticated(authenticated bool) {
+	c.authenticated = authenticated
+}
+
+func (c *blockingConn) IsAuthenticated() bool {
+	return c.authenticated
+}
+
+func (c *blockingConn) SetSubscribed(subscribed bool) {
+	c.subscribed = subscribed
+}
+
+// blockAsync 在新协程中执行一条指令，回复是 BlockedReply 时像网络层一样挂起客户端，
+// 等到客户端进入等待队列后才返回，回复的 RESP 编码通过 channel 发送，ctx 结束时发送空字符串
+func blockAsync(t *testing.T, ctx context.Context, mdb *Database, c *blockingConn, line string) <-chan string {
+	t.Helper()
+	ch := make(chan string, 1)
+	go func() {
+		result := mdb.Exec(c, toCmdLine(strings.Fields(line)...))
+		if blocked, ok := result.(*BlockedReply); ok {
+			result = mdb.Block(ctx, c, blocked)
+		}
+		if result == nil {
+			ch <- ""
+			return
+		}
+		ch <- string(result.ToBytes())
+	}()
+	deadline := time.Now().Add(time.Second)
+	for !mdb.blocking.isBlocked(c) {
+		select {
+		case reply := <-ch:
+			// 没有阻塞，直接返回了回复
+			ch <- reply
+			return ch
+		default:
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s: client is not blocked", line)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return ch
+}
+
+// waitReply 等待阻塞的客户端收到回复
+func waitReply(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case reply := <-ch:
+		return reply
+	case <-time.After(2 * time.Second):
+		t.Fatal("client is still blocked")
+	}
+	return ""
+}
+
+// assertBlocked 确认客户端仍然在阻塞
+func assertBlocked(t *testing.T, ch <-chan string) {
+	t.Helper()
+	select {
+	case reply := <-ch:
+		t.Fatalf("client should be blocked, got %q", reply)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func execMdb(mdb *Database, line string) string {
+	return string(mdb.Exec(&blockingConn{}, toCmdLine(strings.Fields(line)...)).ToBytes())
+}
+
+func TestBlockingFIFO(t *testing.T) {
+	mdb := NewDatabase()
+	ctx := context.Background()
+	first := blockAsync(t, ctx, mdb, &blockingConn{}, "blpop l 0")
+	second := blockAsync(t, ctx, mdb, &blockingConn{}, "brpop other l 0")
+
+	execMdb(mdb, "rpush l a")
+	if got := waitReply(t, first); got != "*2\r\n$1\r\nl\r\n$1\r\na\r\n" {
+		t.Errorf("first waiter got %q", got)
+	}
+	assertBlocked(t, second)
+
+	execMdb(mdb, "rpush l b")
+	if got := waitReply(t, second); got != "*2\r\n$1\r\nl\r\n$1\r\nb\r\n" {
+		t.Errorf("second waiter got %q", got)
+	}
+	if got := execMdb(mdb, "exists l"); got != ":0\r\n" {
+		t.Errorf("list should be empty, exists got %q", got)
+	}
+}
+
+func TestBlockingServesEveryWaiter(t *testing.T) {
+	mdb := NewDatabase()
+	ctx := context.Background()
+	var waiters []<-chan string
+	for i := 0; i < 3; i++ {
+		waiters = append(waiters, blockAsync(t, ctx, mdb, &blockingConn{}, "blpop l 0"))
+	}
+	// 一次写入多个元素，按等待的先后顺序依次满足每个客户端
+	execMdb(mdb, "rpush l a b c")
+	for i, want := range []string{"a", "b", "c"} {
+		if got := waitReply(t, waiters[i]); got != "*2\r\n$1\r\nl\r\n$1\r\n"+want+"\r\n" {
+			t.Errorf("waiter %d got %q, want %s", i, got, want)
+		}
+	}
+}
+
+func TestBlockingTimeout(t *testing.T) {
+	mdb := NewDatabase()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"blpop l 0.05", "*-1\r\n"},
+		{"bzpopmax z 0.05", "*-1\r\n"},
+		{"blmove l dst left left 0.05", "$-1\r\n"},
+		{"xread block 50 streams s $", "*-1\r\n"},
+	}
+	for _, tt := range tests {
+		start := time.Now()
+		if got := waitReply(t, blockAsync(t, context.Background(), mdb, &blockingConn{}, tt.cmd)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("%s: returned after %v", tt.cmd, elapsed)
+		}
+	}
+	if mdb.blocking.count != 0 || len(mdb.blocking.keys) != 0 {
+		t.Error("timed out clients should leave the wait queues")
+	}
+}
+
+func TestBlockingErrors(t *testing.T) {
+	mdb := NewDatabase()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"blpop l x", "-ERR timeout is not a float or out of range\r\n"},
+		{"blpop l -1", "-ERR timeout is negative\r\n"},
+		{"set str v", "+OK\r\n"},
+		{"blpop str 0", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		// 不能挂起客户端时按超时处理
+		{"blpop l 0", "*-1\r\n"},
+		{"bzpopmin z 0", "*-1\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execMdb(mdb, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestBlockingDisconnect(t *testing.T) {
+	mdb := NewDatabase()
+	ctx, cancel := context.WithCancel(context.Background())
+	gone := &blockingConn{}
+	first := blockAsync(t, ctx, mdb, gone, "blpop l 0")
+	second := blockAsync(t, context.Background(), mdb, &blockingConn{}, "blpop l 0")
+
+	// 客户端断开：网络层结束阻塞并调用 AfterClientClose
+	cancel()
+	if got := waitReply(t, first); got != "" {
+		t.Errorf("disconnected client got %q", got)
+	}
+	mdb.AfterClientClose(gone)
+	if mdb.blocking.isBlocked(gone) {
+		t.Error("disconnected client is still in the wait queue")
+	}
+
+	execMdb(mdb, "rpush l a")
+	if got := waitReply(t, second); got != "*2\r\n$1\r\nl\r\n$1\r\na\r\n" {
+		t.Errorf("second waiter got %q", got)
+	}
+}
+
+func TestBlockingPassesWakeup(t *testing.T) {
+	mdb := NewDatabase()
+	ctx := context.Background()
+	execMdb(mdb, "set str v")
+	// 第一个客户端被唤醒后因为目标类型错误离开队列，这次唤醒要交给后面的客户端
+	first := blockAsync(t, ctx, mdb, &blockingConn{}, "blmove l str left left 0")
+	second := blockAsync(t, ctx, mdb, &blockingConn{}, "blmove l dst left right 0")
+
+	execMdb(mdb, "rpush l a")
+	if got := waitReply(t, first); got != "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n" {
+		t.Errorf("first waiter got %q", got)
+	}
+	if got := waitReply(t, second); got != "$1\r\na\r\n" {
+		t.Errorf("second waiter got %q", got)
+	}
+	if got := execMdb(mdb, "lrange dst 0 -1"); got != "*1\r\n$1\r\na\r\n" {
+		t.Errorf("lrange dst got %q", got)
+	}
+}
+
+func TestBlockingOtherTypes(t *testing.T) {
+	mdb := NewDatabase()
+	ctx := context.Background()
+
+	zpop := blockAsync(t, ctx, mdb, &blockingConn{}, "bzpopmin z1 z2 0")
+	execMdb(mdb, "zadd z2 2 b 1 a")
+	if got := waitReply(t, zpop); got != "*3\r\n$2\r\nz2\r\n$1\r\na\r\n$1\r\n1\r\n" {
+		t.Errorf("bzpopmin got %q", got)
+	}
+
+	execMdb(mdb, "xadd s 1-0 f old")
+	xread := blockAsync(t, ctx, mdb, &blockingConn{}, "xread block 0 streams s $")
+	execMdb(mdb, "xadd s 2-0 f new")
+	want := "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$3\r\nnew\r\n"
+	if got := waitReply(t, xread); got != want {
+		t.Errorf("xread got %q, want %q", got, want)
+	}
+
+	execMdb(mdb, "xgroup create s g $")
+	xreadgroup := blockAsync(t, ctx, mdb, &blockingConn{}, "xreadgroup group g c block 0 streams s >")
+	execMdb(mdb, "xadd s 3-0 f v")
+	want = "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"
+	if got := waitReply(t, xreadgroup); got != want {
+		t.Errorf("xreadgroup got %q, want %q", got, want)
+	}
+}
+
+func TestBlockingSelectedDB(t *testing.T) {
+	mdb := NewDatabase()
+	waiter := blockAsync(t, context.Background(), mdb, &blockingConn{dbIndex: 1}, "blpop l 0")
+	// 其他数据库中的同名 key 不会唤醒客户端
+	execMdb(mdb, "rpush l a")
+	assertBlocked(t, waiter)
+	mdb.Exec(&blockingConn{dbIndex: 1}, toCmdLine("rpush", "l", "b"))
+	if got := waitReply(t, waiter); got != "*2\r\n$1\r\nl\r\n$1\r\nb\r\n" {
+		t.Errorf("waiter got %q", got)
+	}
+}
+
+func TestBlockedCmdLineIsCopied(t *testing.T) {
+	mdb := NewDatabase()
+	c := &blockingConn{}
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"blpop l 0", "blpop l 0"},
+		// XREAD 保存的是把 $ 换成具体ID后的指令
+		{"xread block 0 streams s $", "xread block 0 streams s 0-0"},
+	}
+	for _, tt := range tests {
+		cmdLine := toCmdLine(strings.Fields(tt.line)...)
+		blocked, ok := mdb.Exec(c, cmdLine).(*BlockedReply)
+		if !ok {
+			t.Fatalf("%s: client is not blocked", tt.line)
+		}
+		// 模拟解析器读取下一条指令时覆盖缓冲区
+		for _, arg := range cmdLine {
+			for i := range arg {
+				arg[i] = 'X'
+			}
+		}
+		saved := make([]string, len(blocked.cmdLine))
+		for i, arg := range blocked.cmdLine {
+			saved[i] = string(arg)
+		}
+		if got := strings.Join(saved, " "); got != tt.want {
+			t.Errorf("%s: saved command changed to %q after the buffer was reused", tt.line, got)
+		}
+	}
+}
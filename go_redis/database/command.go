@@ -1,22 +1,334 @@
 package database
 
-import "strings"
+import (
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"sort"
+	"strings"
+)
 
 // 存放 指令 和指令对应的执行函数的容器
 // key是指令 value是 command
 var cmdTable = make(map[string]*command)
 
-// command 有两个成员 1. 指令对应的执行函数 2.指令对应的参数数量用于参数校验
+// 指令的属性标志位，可以用 | 组合使用
+const (
+	// flagWrite 表示指令会修改数据库中的数据
+	flagWrite = 1 << iota
+	// flagReadOnly 表示指令只读取数据库中的数据
+	flagReadOnly
+	// flagDenyOOM 表示指令可能会增加内存占用，内存超过 maxmemory 时拒绝执行
+	flagDenyOOM
+	// flagAdmin 表示管理类的指令，例如 CONFIG
+	flagAdmin
+	// flagPubSub 表示发布订阅相关的指令
+	flagPubSub
+	// flagNoScript 表示指令不允许在脚本中执行
+	flagNoScript
+	// flagRandom 表示相同的参数和数据下指令的结果也可能不同，例如 SCAN
+	flagRandom
+	// flagSortForScript 表示在脚本中执行时需要对结果排序，例如 KEYS
+	flagSortForScript
+	// flagLoading 表示加载数据的过程中也允许执行
+	flagLoading
+	// flagStale 表示从节点的数据过期时也允许执行
+	flagStale
+	// flagFast 表示指令的时间复杂度为 O(1) 或 O(log(N))
+	flagFast
+)
+
+// flagNames 是 COMMAND 指令返回的标志位名称，顺序和Redis官方相同
+var flagNames = []struct {
+	flag int
+	name string
+}{
+	{flagWrite, "write"},
+	{flagReadOnly, "readonly"},
+	{flagDenyOOM, "denyoom"},
+	{flagAdmin, "admin"},
+	{flagPubSub, "pubsub"},
+	{flagNoScript, "noscript"},
+	{flagRandom, "random"},
+	{flagSortForScript, "sort_for_script"},
+	{flagLoading, "loading"},
+	{flagStale, "stale"},
+	{flagFast, "fast"},
+}
+
+// command 描述一个指令：
+// 1. 指令对应的执行函数 2.指令对应的参数数量用于参数校验 3.指令的属性标志位
+// 4. 参数中 key 的位置 5. ACL 分类 6. COMMAND DOCS 返回的文档
 type command struct {
+	name     string
 	executor ExecFunc
 	arity    int
+	flags    int
+
+	// 第一个 key 和最后一个 key 在指令中的下标，以及相邻两个 key 的间隔
+	// 下标从指令名之后的第一个参数开始计为 1，lastKey 为负数时表示从末尾倒数，firstKey 为 0 表示没有 key
+	firstKey int
+	lastKey  int
+	keyStep  int
+	// keysFunc 不为空时用它从指令中取出 key，用于 key 的位置不固定的指令，例如 XREAD 的 STREAMS 选项
+	keysFunc func(cmdLine CmdLine) [][]byte
+
+	// 标志位以外的 ACL 分类，例如 keyspace string dangerous
+	categories []string
+
+	// 指令所属的分组、首次出现的Redis版本和简介
+	group   string
+	since   string
+	summary string
 }
 
 // RegisterCommand 向 cmdTable 中注册指令和该指令对应的 command 结构体变量
-func RegisterCommand(name string, executor ExecFunc, arity int) {
+// 返回的 command 可以继续通过 attachKeys 等方法补充 COMMAND 指令返回的信息
+func RegisterCommand(name string, executor ExecFunc, arity int, flags int) *command {
 	name = strings.ToLower(name)
-	cmdTable[name] = &command{
+	cmd := &command{
+		name:     name,
 		executor: executor,
 		arity:    arity,
+		flags:    flags,
+	}
+	cmdTable[name] = cmd
+	return cmd
+}
+
+// registerServerCommand 注册由 Database 直接执行而不是交给单个 DB 执行的指令，
+// 这些指令没有 executor，注册它们只是为了参数校验、统计和 COMMAND 指令
+func registerServerCommand(name string, arity int, flags int) *command {
+	return RegisterCommand(name, nil, arity, flags)
+}
+
+// attachKeys 设置参数中 key 的位置
+func (cmd *command) attachKeys(firstKey, lastKey, keyStep int) *command {
+	cmd.firstKey = firstKey
+	cmd.lastKey = lastKey
+	cmd.keyStep = keyStep
+	return cmd
+}
+
+// attachKeysFunc 设置从指令中取出 key 的函数，firstKey lastKey keyStep 仍然作为 COMMAND 指令返回的信息
+func (cmd *command) attachKeysFunc(keysFunc func(cmdLine CmdLine) [][]byte) *command {
+	cmd.keysFunc = keysFunc
+	return cmd
+}
+
+// attachCategories 设置标志位以外的 ACL 分类，不需要带 @ 前缀
+func (cmd *command) attachCategories(categories ...string) *command {
+	cmd.categories = categories
+	return cmd
+}
+
+// attachDocs 设置 COMMAND DOCS 返回的文档
+func (cmd *command) attachDocs(group, since, summary string) *command {
+	cmd.group = group
+	cmd.since = since
+	cmd.summary = summary
+	return cmd
+}
+
+// isDenyOOM 判断指令在内存超过 maxmemory 时是否应该被拒绝执行
+func isDenyOOM(cmdName string) bool {
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		return false
+	}
+	return cmd.flags&flagDenyOOM > 0
+}
+
+// flagList 返回指令的标志位名称
+func (cmd *command) flagList() []string {
+	result := make([]string, 0, 4)
+	for _, f := range flagNames {
+		if cmd.flags&f.flag > 0 {
+			result = append(result, f.name)
+		}
+	}
+	if cmd.keysFunc != nil {
+		result = append(result, "movablekeys")
+	}
+	return result
+}
+
+// aclCategories 返回指令的 ACL 分类，由标志位推导出的分类在前
+func (cmd *command) aclCategories() []string {
+	result := make([]string, 0, 4)
+	if cmd.flags&flagWrite > 0 {
+		result = append(result, "@write")
+	}
+	if cmd.flags&flagReadOnly > 0 {
+		result = append(result, "@read")
+	}
+	if cmd.flags&flagAdmin > 0 {
+		result = append(result, "@admin", "@dangerous")
+	}
+	if cmd.flags&flagPubSub > 0 {
+		result = append(result, "@pubsub")
+	}
+	if cmd.flags&flagFast > 0 {
+		result = append(result, "@fast")
+	} else {
+		result = append(result, "@slow")
 	}
+	for _, category := range cmd.categories {
+		category = "@" + category
+		if !containsCategory(result, category) {
+			result = append(result, category)
+		}
+	}
+	return result
+}
+
+func containsCategory(categories []string, category string) bool {
+	for _, c := range categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// getKeys 根据 key 的位置从指令中取出所有的 key，cmdLine 包括指令名
+func (cmd *command) getKeys(cmdLine CmdLine) [][]byte {
+	if cmd.keysFunc != nil {
+		return cmd.keysFunc(cmdLine)
+	}
+	if cmd.firstKey <= 0 {
+		return nil
+	}
+	last := cmd.lastKey
+	if last < 0 {
+		last = len(cmdLine) + last
+	}
+	keys := make([][]byte, 0, 1)
+	for i := cmd.firstKey; i <= last && i < len(cmdLine); i += cmd.keyStep {
+		keys = append(keys, cmdLine[i])
+	}
+	return keys
+}
+
+// sortedCommands 按名称顺序返回所有注册的指令
+func sortedCommands() []*command {
+	result := make([]*command, 0, len(cmdTable))
+	for _, cmd := range cmdTable {
+		result = append(result, cmd)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// commandInfo 生成 COMMAND 和 COMMAND INFO 返回的一条指令信息：
+// 名称 参数数量 标志位 第一个key 最后一个key key的间隔 ACL分类
+func commandInfo(cmd *command) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(cmd.name)),
+		reply.MakeIntReply(int64(cmd.arity)),
+		makeStatusList(cmd.flagList()),
+		reply.MakeIntReply(int64(cmd.firstKey)),
+		reply.MakeIntReply(int64(cmd.lastKey)),
+		reply.MakeIntReply(int64(cmd.keyStep)),
+		makeStatusList(cmd.aclCategories()),
+	})
+}
+
+// commandDocs 生成 COMMAND DOCS 返回的一条指令文档，格式为 字段名-值 交替排列的数组
+func commandDocs(cmd *command) resp.Reply {
+	docs := make([]resp.Reply, 0, 6)
+	if cmd.summary != "" {
+		docs = append(docs, reply.MakeBulkReply([]byte("summary")), reply.MakeBulkReply([]byte(cmd.summary)))
+	}
+	if cmd.since != "" {
+		docs = append(docs, reply.MakeBulkReply([]byte("since")), reply.MakeBulkReply([]byte(cmd.since)))
+	}
+	if cmd.group != "" {
+		docs = append(docs, reply.MakeBulkReply([]byte("group")), reply.MakeBulkReply([]byte(cmd.group)))
+	}
+	return reply.MakeMultiRawReply(docs)
+}
+
+func makeStatusList(items []string) resp.Reply {
+	replies := make([]resp.Reply, len(items))
+	for i, item := range items {
+		replies[i] = reply.MakeStatusReply(item)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// execCommand COMMAND [COUNT | INFO [name ...] | DOCS [name ...] | GETKEYS cmd [arg ...]]
+func execCommand(db *DB, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		commands := sortedCommands()
+		result := make([]resp.Reply, len(commands))
+		for i, cmd := range commands {
+			result[i] = commandInfo(cmd)
+		}
+		return reply.MakeMultiRawReply(result)
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "count":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("command|count")
+		}
+		return reply.MakeIntReply(int64(len(cmdTable)))
+	case "info":
+		if len(args) == 1 {
+			// 不指定指令名称时返回所有指令的信息
+			return execCommand(db, nil)
+		}
+		result := make([]resp.Reply, len(args)-1)
+		for i, name := range args[1:] {
+			if cmd, ok := cmdTable[strings.ToLower(string(name))]; ok {
+				result[i] = commandInfo(cmd)
+			} else {
+				result[i] = reply.MakeNullBulkReply()
+			}
+		}
+		return reply.MakeMultiRawReply(result)
+	case "docs":
+		var commands []*command
+		if len(args) == 1 {
+			commands = sortedCommands()
+		} else {
+			// 不存在的指令不会出现在结果中
+			for _, name := range args[1:] {
+				if cmd, ok := cmdTable[strings.ToLower(string(name))]; ok {
+					commands = append(commands, cmd)
+				}
+			}
+		}
+		result := make([]resp.Reply, 0, len(commands)*2)
+		for _, cmd := range commands {
+			result = append(result, reply.MakeBulkReply([]byte(cmd.name)), commandDocs(cmd))
+		}
+		return reply.MakeMultiRawReply(result)
+	case "getkeys":
+		if len(args) < 2 {
+			return reply.MakeArgNumErrReply("command|getkeys")
+		}
+		cmdLine := args[1:]
+		cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+		if !ok {
+			return reply.MakeErrReply("ERR Invalid command specified")
+		}
+		if !validateArity(cmd.arity, cmdLine) {
+			return reply.MakeErrReply("ERR Invalid number of arguments specified for command")
+		}
+		keys := cmd.getKeys(cmdLine)
+		if len(keys) == 0 {
+			return reply.MakeErrReply("ERR The command has no key arguments")
+		}
+		return reply.MakeMultiBulkReply(keys)
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try COMMAND HELP.")
+}
+
+func init() {
+	RegisterCommand("Command", execCommand, -1, flagRandom|flagLoading|flagStale).
+		attachCategories("connection").
+		attachDocs("server", "2.8.13", "Returns detailed information about all commands.")
 }
@@ -0,0 +1,79 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCommandGetKeys(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"command getkeys get k", "*1\r\n$1\r\nk\r\n"},
+		{"command getkeys del a b c", "*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"command getkeys rename a b", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"command getkeys blpop a b 0", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"command getkeys bzpopmax z 1.5", "*1\r\n$1\r\nz\r\n"},
+		{"command getkeys xread count 1 streams s1 s2 0 0", "*2\r\n$2\r\ns1\r\n$2\r\ns2\r\n"},
+		{"command getkeys xreadgroup group g c streams s >", "*1\r\n$1\r\ns\r\n"},
+		{"command getkeys xread streams s1 s2 0", "-ERR The command has no key arguments\r\n"},
+		{"command getkeys ping", "-ERR The command has no key arguments\r\n"},
+		{"command getkeys get", "-ERR Invalid number of arguments specified for command\r\n"},
+		{"command getkeys nosuchcommand k", "-ERR Invalid command specified\r\n"},
+		{"command getkeys", "-ERR wrong number of arguments for 'command|getkeys' command\r\n"},
+	}
+	mdb := NewDatabase()
+	defer mdb.Close()
+	for _, tt := range tests {
+		if got := execMdb(mdb, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestCommandInfo(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"command count", ":" + strconv.Itoa(len(cmdTable)) + "\r\n"},
+		{"command info get", "*1\r\n*7\r\n$3\r\nget\r\n:2\r\n*2\r\n+readonly\r\n+fast\r\n:1\r\n:1\r\n:1\r\n*3\r\n+@read\r\n+@fast\r\n+@string\r\n"},
+		{"command info blpop", "*1\r\n*7\r\n$5\r\nblpop\r\n:-3\r\n*2\r\n+write\r\n+noscript\r\n:1\r\n:-2\r\n:1\r\n*4\r\n+@write\r\n+@slow\r\n+@list\r\n+@blocking\r\n"},
+		{"command info xread", "*1\r\n*7\r\n$5\r\nxread\r\n:-4\r\n*2\r\n+readonly\r\n+movablekeys\r\n:1\r\n:1\r\n:1\r\n"},
+		{"command info config", "*1\r\n*7\r\n$6\r\nconfig\r\n:-2\r\n*4\r\n+admin\r\n+noscript\r\n+loading\r\n+stale\r\n:0\r\n:0\r\n:0\r\n*3\r\n+@admin\r\n+@dangerous\r\n+@slow\r\n"},
+		{"command info nosuchcommand", "*1\r\n$-1\r\n"},
+		{"command docs get nosuchcommand", "*2\r\n$3\r\nget\r\n*6\r\n$7\r\nsummary\r\n$34\r\nReturns the string value of a key.\r\n$5\r\nsince\r\n$5\r\n1.0.0\r\n$5\r\ngroup\r\n$6\r\nstring\r\n"},
+		{"command count 1", "-ERR wrong number of arguments for 'command|count' command\r\n"},
+		{"command help", "-ERR unknown subcommand 'help'. Try COMMAND HELP.\r\n"},
+	}
+	mdb := NewDatabase()
+	defer mdb.Close()
+	for _, tt := range tests {
+		// 只比较回复的开头，期望值可以省略不关心的部分
+		if got := execMdb(mdb, tt.cmd); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: got %q, want prefix %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestServerCommandArity(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"select", "-ERR wrong number of arguments for 'select' command\r\n"},
+		{"select 1 2", "-ERR wrong number of arguments for 'select' command\r\n"},
+		{"monitor now", "-ERR wrong number of arguments for 'monitor' command\r\n"},
+		{"config", "-ERR wrong number of arguments for 'config' command\r\n"},
+		{"select 1", "+OK\r\n"},
+	}
+	mdb := NewDatabase()
+	defer mdb.Close()
+	for _, tt := range tests {
+		if got := execMdb(mdb, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
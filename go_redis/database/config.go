@@ -0,0 +1,88 @@
+package database
+
+import (
+	"go_redis/config"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+ * 执行 CONFIG 指令，在运行时查看和修改配置
+ */
+
+// execConfig CONFIG GET|SET|RESETSTAT|REWRITE
+func execConfig(mdb *Database, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("config")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "get":
+		return execConfigGet(args[1:])
+	case "set":
+		return execConfigSet(args[1:])
+	case "resetstat":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("config|resetstat")
+		}
+		mdb.resetStats()
+		return reply.MakeOkReply()
+	case "rewrite":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("config|rewrite")
+		}
+		if err := config.Rewrite(); err != nil {
+			return reply.MakeErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CONFIG HELP.")
+}
+
+// execConfigGet CONFIG GET parameter [parameter ...]，参数支持通配符
+func execConfigGet(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("config|get")
+	}
+	result := make([][]byte, 0)
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		pairs := config.Get(string(arg))
+		for i := 0; i < len(pairs); i += 2 {
+			if seen[pairs[i]] {
+				continue
+			}
+			seen[pairs[i]] = true
+			result = append(result, []byte(pairs[i]), []byte(pairs[i+1]))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execConfigSet CONFIG SET parameter value [parameter value ...]
+// 任何一个参数校验失败时，不会修改任何配置
+func execConfigSet(args [][]byte) resp.Reply {
+	if len(args) == 0 || len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("config|set")
+	}
+	pairs := make([]string, len(args))
+	for i, arg := range args {
+		pairs[i] = string(arg)
+	}
+	if err := config.Set(pairs...); err != nil {
+		return reply.MakeErrReply("ERR " + err.Error())
+	}
+	return reply.MakeOkReply()
+}
+
+// resetStats 重置 INFO 指令中展示的统计信息
+func (mdb *Database) resetStats() {
+	mdb.stats.reset()
+	atomic.StoreInt64(&mdb.evictedKeys, 0)
+	for _, db := range mdb.dbSet {
+		atomic.StoreInt64(&db.hits, 0)
+		atomic.StoreInt64(&db.misses, 0)
+	}
+}
@@ -9,32 +9,108 @@ import (
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Database 是多个 DB 的集合,
 // 参考Redis官方的设计，每个 Database 默认有16个 DB
 type Database struct {
 	dbSet []*DB
+	// 执行指令时持有读锁，SWAPDB 和 FLUSHALL 持有写锁，
+	// 它们因此不会和其他指令交错执行，其他指令看到的要么是操作之前的数据，要么是操作之后的数据
+	dbLock sync.RWMutex
+	// 内存超过 maxmemory 时，存放待淘汰的候选 key
+	evictPool evictionPool
+	// 因内存淘汰被删除的 key 的数量
+	evictedKeys int64
+	// 服务端运行时的统计信息
+	stats *serverStats
+	// 返回当前连接的客户端数量，由网络层通过 SetClientCounter 设置
+	clientCounter func() int
+	// 阻塞指令的等待队列
+	blocking *blockingRegistry
+	// 慢查询日志
+	slowLog slowLog
+	// 执行了 MONITOR 指令的客户端
+	monitors monitorSet
+	// 按指令类型统计的调用次数和耗时
+	cmdStats commandStats
+	// 发布订阅中心
+	hub *pubSubHub
+	// 开启了 CLIENT TRACKING 的客户端
+	tracking trackingTable
+	// 根据连接ID查找客户端连接，由网络层通过 SetClientLookup 设置
+	clientLookup func(id int64) resp.Connection
 }
 
 // NewDatabase 创建一个Redis Database
 func NewDatabase() *Database {
-	mdb := &Database{}
-	if config.Properties.Databases == 0 {
-		config.Properties.Databases = 16
+	mdb := &Database{
+		stats:    makeServerStats(),
+		blocking: makeBlockingRegistry(),
+		hub:      makePubSubHub(),
 	}
-	mdb.dbSet = make([]*DB, config.Properties.Databases)
+	databases := config.Properties().Databases
+	if databases == 0 {
+		databases = 16
+	}
+	mdb.dbSet = make([]*DB, databases)
 	for i := range mdb.dbSet {
 		singleDB := makeDB()
 		singleDB.index = i
+		singleDB.blocking = mdb.blocking
+		singleDB.hub = mdb.hub
 		mdb.dbSet[i] = singleDB
 	}
+	go mdb.stats.cron()
 	return mdb
 }
 
+// SetClientCounter 设置获取当前客户端连接数量的函数，INFO 指令会用到
+func (mdb *Database) SetClientCounter(counter func() int) {
+	mdb.clientCounter = counter
+}
+
+// SetClientLookup 设置根据连接ID查找客户端连接的函数，CLIENT TRACKING 的 REDIRECT 选项会用到
+func (mdb *Database) SetClientLookup(lookup func(id int64) resp.Connection) {
+	mdb.clientLookup = lookup
+}
+
+func init() {
+	registerServerCommand("Auth", -2, flagNoScript|flagLoading|flagStale|flagFast).
+		attachCategories("connection").
+		attachDocs("connection", "1.0.0", "Authenticates the connection.")
+	registerServerCommand("Select", 2, flagLoading|flagStale|flagFast).
+		attachCategories("keyspace").
+		attachDocs("connection", "1.0.0", "Changes the selected database.")
+	registerServerCommand("Info", -1, flagRandom|flagLoading|flagStale).
+		attachCategories("dangerous").
+		attachDocs("server", "1.0.0", "Returns information and statistics about the server.")
+	registerServerCommand("Config", -2, flagAdmin|flagNoScript|flagLoading|flagStale).
+		attachDocs("server", "2.0.0", "A container for server configuration commands.")
+	registerServerCommand("SlowLog", -2, flagAdmin|flagRandom|flagLoading|flagStale).
+		attachDocs("server", "2.2.12", "A container for slow log commands.")
+	registerServerCommand("Client", -2, flagAdmin|flagNoScript|flagRandom|flagLoading|flagStale).
+		attachCategories("connection").
+		attachDocs("connection", "2.4.0", "A container for client connection commands.")
+	registerServerCommand("Monitor", 1, flagAdmin|flagNoScript|flagLoading|flagStale).
+		attachDocs("server", "1.0.0", "Listens for all requests received by the server in real-time.")
+}
+
 // Exec 执行客户端发来的Redis指令
 // 参数 `cmdLine` 包括了命令和它的参数，例如："set key value"
 func (mdb *Database) Exec(c resp.Connection, cmdLine CmdLine) (result resp.Reply) {
+	start := time.Now()
+	defer func() {
+		duration := time.Since(start)
+		mdb.slowLog.record(c, cmdLine, start, duration)
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		if cmd, ok := cmdTable[cmdName]; ok {
+			mdb.cmdStats.record(cmdName, duration)
+			mdb.tracking.afterCommand(c, cmd, cmdLine)
+		}
+	}()
 	defer func() {
 		// 执行用户发来的指令时可能出错，在defer中用recover处理panic
 		// 以免发生的错误层层上发 最后带崩整个程序
@@ -43,28 +119,109 @@ func (mdb *Database) Exec(c resp.Connection, cmdLine CmdLine) (result resp.Reply
 		}
 	}()
 
+	mdb.stats.incrCommands()
 	cmdName := strings.ToLower(string(cmdLine[0])) // 获取指令类型
-	if cmdName == "select" {
+	// 配置了 requirepass 时，客户端通过 AUTH 验证密码之前只能执行 AUTH
+	if cmdName != "auth" && !isAuthenticated(c) {
+		return reply.MakeErrReply("NOAUTH Authentication required.")
+	}
+	// 被拒绝执行的指令不会发给 MONITOR 客户端
+	mdb.monitors.feed(c, cmdLine)
+	if cmd, ok := cmdTable[cmdName]; ok && cmd.executor == nil && !validateArity(cmd.arity, cmdLine) {
+		// 由 Database 直接执行的指令在这里校验参数个数，其他指令交给 DB.Exec 校验
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	if mdb.hub.isSubscribed(c) && !pubSubAllowedCommands[cmdName] {
+		// 订阅模式下只能执行订阅相关的指令
+		return pubSubContextError(cmdName)
+	}
+	switch cmdName {
+	case "auth":
+		return execAuth(c, cmdLine[1:])
+	case "swapdb":
+		return execSwapDB(mdb, cmdLine[1:])
+	case "flushall":
+		return execFlushAll(mdb, cmdLine[1:])
+	case "migrate":
+		// 网络读写期间不能持有 dbLock，由 execMigrate 自己加锁
+		return execMigrate(mdb, c, cmdLine[1:])
+	}
+	mdb.dbLock.RLock()
+	defer mdb.dbLock.RUnlock()
+	// 内存超过 maxmemory 时先尝试淘汰 key，淘汰后仍然超出限制则拒绝可能增加内存占用的指令
+	// 在执行 COPY 等由 Database 直接执行的指令之前检查，它们同样可能增加内存占用
+	if !mdb.freeMemoryIfNeeded() && isDenyOOM(cmdName) {
+		return reply.MakeErrReply("OOM command not allowed when used memory > 'maxmemory'.")
+	}
+	switch cmdName {
+	case "select":
 		// 切换数据库的指令
-		if len(cmdLine) != 2 {
-			return reply.MakeArgNumErrReply("select")
-		}
 		return execSelect(c, mdb, cmdLine[1:])
+	case "info":
+		// 查看服务端信息的指令，需要用到所有 DB 的数据，所以不交给单个 DB 执行
+		return execInfo(mdb, cmdLine[1:])
+	case "config":
+		return execConfig(mdb, cmdLine[1:])
+	case "slowlog":
+		return execSlowLog(mdb, cmdLine[1:])
+	case "client":
+		return execClient(mdb, c, cmdLine[1:])
+	case "monitor":
+		return execMonitor(mdb, c)
+	case "subscribe":
+		return execSubscribe(mdb, c, cmdLine[1:])
+	case "unsubscribe":
+		return execUnsubscribe(mdb, c, cmdLine[1:])
+	case "psubscribe":
+		return execPSubscribe(mdb, c, cmdLine[1:])
+	case "punsubscribe":
+		return execPUnsubscribe(mdb, c, cmdLine[1:])
+	case "copy":
+		return execCopy(mdb, c, cmdLine[1:])
+	case "move":
+		return execMove(mdb, c, cmdLine[1:])
+	case "publish":
+		return execPublish(mdb, cmdLine[1:])
+	case "pubsub":
+		return execPubSub(mdb, cmdLine[1:])
+	case "ping":
+		if mdb.hub.isSubscribed(c) {
+			return subscribedPing(cmdLine[1:])
+		}
+	}
+	if cmd, ok := cmdTable[cmdName]; ok {
+		mdb.tracking.beforeCommand(c, cmd, cmdLine)
 	}
 	// 执行其他的Redis指令时 由 Exec 执行
 	dbIndex := c.GetDBIndex()
 	selectDB := mdb.dbSet[dbIndex]
-	return selectDB.Exec(c, cmdLine)
+	result = selectDB.Exec(c, cmdLine)
+	if blocked, ok := result.(*BlockedReply); ok {
+		if blocked.cmdLine == nil {
+			// 客户端挂起之后还要重新执行这条指令
+			blocked.cmdLine = cmdLine
+		}
+		// 参数引用的是解析器复用的读缓冲区，挂起期间还要重新执行指令，需要复制一份
+		blocked.cmdLine = copyCmdLine(blocked.cmdLine)
+	}
+	if cmdName == "flushdb" {
+		// 清空数据库之后所有客户端的缓存都失效了
+		mdb.tracking.invalidateAll()
+	}
+	return result
 }
 
 // Close 关闭数据库时，执行的逻辑
 func (mdb *Database) Close() {
-	// Todo: 当前版本未实现该方法
+	mdb.stats.stop()
 }
 
 // AfterClientClose 关闭一个同数据库连接的客户端连接后 要执行的逻辑
 func (mdb *Database) AfterClientClose(c resp.Connection) {
-	// Todo: 当前版本未实现该方法
+	mdb.blocking.removeClient(c)
+	mdb.monitors.remove(c)
+	mdb.hub.removeClient(c)
+	mdb.tracking.removeClient(c)
 }
 
 // execSelect Redis中的 切换数据库的 select语句的执行函数
@@ -79,3 +236,58 @@ func execSelect(c resp.Connection, mdb *Database, args [][]byte) resp.Reply {
 	c.SelectDB(dbIndex)
 	return reply.MakeOkReply()
 }
+
+// execClient CLIENT SETNAME name | GETNAME | ID | TRACKING ... | CACHING YES|NO | TRACKINGINFO | GETREDIR
+func execClient(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch subCmd {
+	case "setname":
+		if len(args) != 2 {
+			return reply.MakeArgNumErrReply("client|setname")
+		}
+		name := string(args[1])
+		if strings.ContainsAny(name, " \n") {
+			return reply.MakeErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+		}
+		c.SetName(name)
+		return reply.MakeOkReply()
+	case "getname":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|getname")
+		}
+		name := c.GetName()
+		if name == "" {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(name))
+	case "id":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|id")
+		}
+		return reply.MakeIntReply(c.GetID())
+	case "tracking":
+		return execClientTracking(mdb, c, args[1:])
+	case "caching":
+		return execClientCaching(mdb, c, args[1:])
+	case "trackinginfo":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|trackinginfo")
+		}
+		return execClientTrackingInfo(mdb, c)
+	case "getredir":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("client|getredir")
+		}
+		return execClientGetRedir(mdb, c)
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLIENT HELP.")
+}
+
+// IsIdleExempt 判断客户端是否不受 timeout 限制，
+// 订阅了频道的客户端和 MONITOR 客户端可能很长时间都不发送指令，阻塞中的客户端由阻塞指令自己的超时时间控制
+func (mdb *Database) IsIdleExempt(c resp.Connection) bool {
+	return mdb.hub.isSubscribed(c) || mdb.monitors.contains(c) || mdb.blocking.isBlocked(c)
+}
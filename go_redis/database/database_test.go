@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"go_redis/interface/resp"
+	"testing"
+)
+
+func TestIsIdleExempt(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	idle := &blockingConn{}
+	subscriber := &recordingConn{blockingConn: &blockingConn{}}
+	mdb.Exec(subscriber, toCmdLine("subscribe", "news"))
+	patternSubscriber := &recordingConn{blockingConn: &blockingConn{}}
+	mdb.Exec(patternSubscriber, toCmdLine("psubscribe", "n*"))
+	monitor := &recordingConn{blockingConn: &blockingConn{}}
+	mdb.Exec(monitor, toCmdLine("monitor"))
+	blocked := &blockingConn{}
+	blockAsync(t, ctx, mdb, blocked, "blpop list 0")
+	unsubscribed := &recordingConn{blockingConn: &blockingConn{}}
+	mdb.Exec(unsubscribed, toCmdLine("subscribe", "news"))
+	mdb.Exec(unsubscribed, toCmdLine("unsubscribe"))
+
+	tests := []struct {
+		name string
+		conn resp.Connection
+		want bool
+	}{
+		{"idle client", idle, false},
+		{"subscriber", subscriber, true},
+		{"pattern subscriber", patternSubscriber, true},
+		{"monitor", monitor, true},
+		{"blocked client", blocked, true},
+		{"unsubscribed client", unsubscribed, false},
+	}
+	for _, tt := range tests {
+		if got := mdb.IsIdleExempt(tt.conn); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
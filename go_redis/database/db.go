@@ -6,6 +6,8 @@ import (
 	"go_redis/interface/resp"
 	"go_redis/resp/reply"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 // DB 1.存储数据 2.执行用户指令
@@ -13,6 +15,28 @@ type DB struct {
 	index int
 	// key -> DataEntity 键值对
 	data dict.Dict
+	// 估算的该数据库中所有 key-value 占用的内存字节数
+	usedMemory int64
+	// 查找 key 时命中和未命中的次数
+	hits   int64
+	misses int64
+	// mu 让 stream 等容器类型的指令串行执行
+	// string 的值是不可变的 []byte，每次写入都是整体替换，不需要加锁；
+	// 容器类型的值会被原地修改，同一个 DB 上对它们的读写需要互斥
+	mu sync.Mutex
+	// 阻塞指令的等待队列，由所有 DB 共享
+	blocking *blockingRegistry
+	// 当前在锁内执行的指令访问过的容器，只在持有 mu 时访问
+	touched []touchedContainer
+	// 发送键空间通知使用的发布订阅中心，由所有 DB 共享
+	hub *pubSubHub
+}
+
+// touchedContainer 记录一个容器被指令访问前占用的内存
+type touchedContainer struct {
+	key    string
+	entity *database.DataEntity
+	size   int64
 }
 
 // ExecFunc 是用户命令的executor的接口
@@ -21,10 +45,46 @@ type ExecFunc func(db *DB, args [][]byte) resp.Reply
 // CmdLine 是[][]byte的别名，表示用户通过客户端传来的一条指令
 type CmdLine = [][]byte
 
+// lockedExec 包装容器类型指令的执行函数，使它在 DB 的锁内执行
+// 容器是被原地修改的，指令执行完后把访问过的容器占用内存的变化计入统计
+func lockedExec(executor ExecFunc) ExecFunc {
+	return func(db *DB, args [][]byte) resp.Reply {
+		db.mu.Lock()
+		defer db.mu.Unlock()
+		defer db.accountTouched()
+		return executor(db, args)
+	}
+}
+
+// touchContainer 在锁内的指令访问容器时调用，记录容器当前占用的内存
+func (db *DB) touchContainer(key string, entity *database.DataEntity) {
+	for _, t := range db.touched {
+		if t.entity == entity {
+			return
+		}
+	}
+	db.touched = append(db.touched, touchedContainer{key: key, entity: entity, size: sizeOfEntity(key, entity)})
+}
+
+// accountTouched 把访问过的容器占用内存的变化计入统计
+// 已经被删除或替换的容器在删除时按当时的大小减去了内存，不再计入
+func (db *DB) accountTouched() {
+	for i, t := range db.touched {
+		if raw, ok := db.data.Get(t.key); ok && raw == t.entity {
+			db.addMemory(sizeOfEntity(t.key, t.entity) - t.size)
+		}
+		db.touched[i] = touchedContainer{}
+	}
+	db.touched = db.touched[:0]
+}
+
+// dataDictSize 是每个 DB 的字典的 shard 数量
+const dataDictSize = 1 << 10
+
 // makeDB 创建一个 DB 实例
 func makeDB() *DB {
 	db := &DB{
-		data: dict.MakeSycnDict(),
+		data: dict.MakeConcurrent(dataDictSize),
 	}
 	return db
 }
@@ -47,7 +107,7 @@ func (db *DB) Exec(c resp.Connection, cmdLine CmdLine) resp.Reply {
 	cmdName := strings.ToLower(string(cmdLine[0])) // 全部转成小写
 	// 从cmdTable中根据用户传来的指令的第一个单词，取出对应的指令的执行函数
 	cmd, ok := cmdTable[cmdName]
-	if !ok {
+	if !ok || cmd.executor == nil {
 		// 说明cmdTable中没有该指令的执行器
 		return reply.MakeErrReply("ERR unknow command '" + cmdName + "'")
 	}
@@ -60,47 +120,90 @@ func (db *DB) Exec(c resp.Connection, cmdLine CmdLine) resp.Reply {
 /* -------- 数据访问 ------- */
 
 // GetEntity 返回数据库中key对应的 DataEntity
+// 每次访问都会更新实体的访问时间和访问频率，供内存淘汰策略使用
 func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 	raw, ok := db.data.Get(key)
 	if !ok {
+		atomic.AddInt64(&db.misses, 1)
 		return nil, false
 	}
+	atomic.AddInt64(&db.hits, 1)
 	entity, _ := raw.(*database.DataEntity)
+	touchEntity(entity)
 	return entity, true
 }
 
 // PutEntity 向数据库中插入一个key-value
 // 如果数据库中已经存在key 会覆盖；如果不存在 会新增一个key-value
 func (db *DB) PutEntity(key string, entity *database.DataEntity) int {
-	return db.data.Put(key, entity)
+	initEntity(entity)
+	old, result := db.data.Put(key, entity)
+	if result == 0 {
+		db.releaseMemory(key, old)
+	}
+	db.addMemory(sizeOfEntity(key, entity))
+	db.signalKeyReady(key)
+	if result > 0 {
+		db.notifyKeyspaceEvent(notifyNew, "new", key)
+	}
+	return result
 }
 
 // PutIfExists 更新一个已经存在的key-value
 // 如果该key不存在 返回0
 func (db *DB) PutIfExists(key string, entity *database.DataEntity) int {
-	return db.data.PutIfExists(key, entity)
+	initEntity(entity)
+	old, result := db.data.PutIfExists(key, entity)
+	if result > 0 {
+		db.releaseMemory(key, old)
+		db.addMemory(sizeOfEntity(key, entity))
+		db.signalKeyReady(key)
+	}
+	return result
 }
 
 // PutIfAbsent 只有在该key不存在时才会向数据库新增一个key-value
 // 如果该key已经存在，则不执行任何操作 返回0
 func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
-	return db.data.PutIfAbsent(key, entity)
+	initEntity(entity)
+	result := db.data.PutIfAbsent(key, entity)
+	if result > 0 {
+		db.addMemory(sizeOfEntity(key, entity))
+		db.signalKeyReady(key)
+		db.notifyKeyspaceEvent(notifyNew, "new", key)
+	}
+	return result
 }
 
 // Remove 从数据库中移除指定的key
 func (db *DB) Remove(key string) {
-	db.data.Remove(key)
+	db.remove(key)
+}
+
+// remove 从数据库中移除指定的key，返回删除的key的数量
+func (db *DB) remove(key string) int {
+	old, result := db.data.Remove(key)
+	if result > 0 {
+		db.releaseMemory(key, old)
+	}
+	return result
+}
+
+// removeIfSame 只有当key的值仍然是 entity 时才移除它，返回删除的key的数量
+// 读取 entity 和删除之间key被其他指令覆盖或删除时不做任何修改
+func (db *DB) removeIfSame(key string, entity *database.DataEntity) int {
+	result := db.data.RemoveIfSame(key, entity)
+	if result > 0 {
+		db.releaseMemory(key, entity)
+	}
+	return result
 }
 
 // Removes 将给定的key全部从数据库中移除
 func (db *DB) Removes(keys ...string) (deleted int) {
 	deleted = 0
 	for _, key := range keys {
-		_, exists := db.data.Get(key)
-		if exists {
-			db.Remove(key)
-			deleted++
-		}
+		deleted += db.remove(key)
 	}
 	return deleted
 }
@@ -108,4 +211,23 @@ func (db *DB) Removes(keys ...string) (deleted int) {
 // Flush 清空数据库
 func (db *DB) Flush() {
 	db.data.Clear()
+	atomic.StoreInt64(&db.usedMemory, 0)
+}
+
+// UsedMemory 返回估算的该数据库占用的内存字节数
+func (db *DB) UsedMemory() int64 {
+	return atomic.LoadInt64(&db.usedMemory)
+}
+
+func (db *DB) addMemory(delta int64) {
+	atomic.AddInt64(&db.usedMemory, delta)
+}
+
+// releaseMemory 从内存统计中减去一个被覆盖或被删除的 key-value 占用的内存
+func (db *DB) releaseMemory(key string, raw interface{}) {
+	entity, ok := raw.(*database.DataEntity)
+	if !ok {
+		return
+	}
+	db.addMemory(-sizeOfEntity(key, entity))
 }
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"go_redis/interface/database"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestUsedMemoryUnderConcurrentWrites(t *testing.T) {
+	db := makeDB()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 不同协程写入长度不同的 value，内存统计出错时才能发现
+			value := []byte(strings.Repeat("v", i+1))
+			for j := 0; j < 20000; j++ {
+				db.PutEntity("key", &database.DataEntity{Data: value})
+				db.PutIfExists("key", &database.DataEntity{Data: value})
+				db.Remove("key")
+			}
+		}(i)
+	}
+	wg.Wait()
+	db.Remove("key")
+	// 所有 key 都删除之后，估算的内存占用应该回到0
+	if used := db.UsedMemory(); used != 0 {
+		t.Fatalf("used memory drifted to %d", used)
+	}
+}
+
+func TestUsedMemoryOfContainers(t *testing.T) {
+	db := makeDB()
+	// 每条指令执行后，估算的内存占用都应该等于所有 key 当前大小的总和
+	cmds := []string{
+		"rpush l a bb ccc",
+		"lpop l",
+		"lmove l l2 left left",
+		"zadd z 1 a 2 bb",
+		"zadd z 3 a",
+		"zpopmin z",
+		"xadd s 1-0 f v",
+		"xadd s 2-0 field value",
+		"xdel s 1-0",
+		"rename l2 l3",
+		"rpush l3 d",
+		"del l l3 z",
+		"xtrim s maxlen 0",
+		"del s",
+	}
+	for _, cmd := range cmds {
+		execLine(db, cmd)
+		var want int64
+		db.data.ForEach(func(key string, val interface{}) bool {
+			want += sizeOfEntity(key, val.(*database.DataEntity))
+			return true
+		})
+		if used := db.UsedMemory(); used != want {
+			t.Errorf("after %s: used memory %d, want %d", cmd, used, want)
+		}
+	}
+	if used := db.UsedMemory(); used != 0 {
+		t.Errorf("used memory drifted to %d", used)
+	}
+}
@@ -0,0 +1,213 @@
+package database
+
+import (
+	List "go_redis/datastructure/list"
+	SortedSet "go_redis/datastructure/sortedset"
+	"go_redis/datastructure/stream"
+	"go_redis/interface/database"
+	"go_redis/interface/resp"
+	"go_redis/lib/utils"
+	"go_redis/resp/reply"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+ * 涉及多个 DB 的指令：COPY MOVE SWAPDB FLUSHALL
+ * 这些指令需要访问 dbSet，所以和 SELECT 一样由 Database 直接执行
+ */
+
+// getDB 按指令参数中的数据库索引返回 DB，参数不合法时返回错误回复
+func (mdb *Database) getDB(arg []byte) (*DB, resp.Reply) {
+	index, err := strconv.Atoi(string(arg))
+	if err != nil {
+		return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if index < 0 || index >= len(mdb.dbSet) {
+		return nil, reply.MakeErrReply("ERR DB index is out of range")
+	}
+	return mdb.dbSet[index], nil
+}
+
+// copyData 深拷贝 key 的值，复制出的 key 和原来的 key 互不影响，不支持的类型返回 nil
+func copyData(data interface{}) interface{} {
+	switch v := data.(type) {
+	case []byte:
+		return utils.CopyBytes(v)
+	case *List.List:
+		return v.Clone()
+	case *SortedSet.SortedSet:
+		return v.Clone()
+	case *stream.Stream:
+		return v.Clone()
+	}
+	return nil
+}
+
+// execCopy 把 key 的值复制到另一个 key，可以复制到其他数据库
+// COPY source destination [DB destination-db] [REPLACE]
+func execCopy(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	srcDB := mdb.dbSet[c.GetDBIndex()]
+	destDB := srcDB
+	replace := false
+	for i := 2; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "db":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			db, errReply := mdb.getDB(args[i+1])
+			if errReply != nil {
+				return errReply
+			}
+			destDB = db
+			i++
+		case "replace":
+			replace = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	src, dest := string(args[0]), string(args[1])
+	if srcDB == destDB && src == dest {
+		return reply.MakeErrReply("ERR source and destination objects are the same")
+	}
+
+	entity, exists := srcDB.GetEntity(src)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	data := copyData(entity.Data)
+	if data == nil {
+		return &reply.UnKnownErrReply{}
+	}
+	copied := &database.DataEntity{Data: data}
+	if replace {
+		destDB.PutEntity(dest, copied)
+	} else if destDB.PutIfAbsent(dest, copied) == 0 {
+		return reply.MakeIntReply(0)
+	}
+	destDB.notifyKeyspaceEvent(notifyGeneric, "copy_to", dest)
+	return reply.MakeIntReply(1)
+}
+
+// execMove 把 key 移动到另一个数据库，目标数据库中已经存在同名的 key 时不移动
+// MOVE key db
+func execMove(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	srcDB := mdb.dbSet[c.GetDBIndex()]
+	destDB, errReply := mdb.getDB(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if srcDB == destDB {
+		return reply.MakeErrReply("ERR source and destination objects are the same")
+	}
+
+	key := string(args[0])
+	for {
+		entity, exists := srcDB.GetEntity(key)
+		if !exists {
+			return reply.MakeIntReply(0)
+		}
+		if destDB.PutIfAbsent(key, entity) == 0 {
+			return reply.MakeIntReply(0)
+		}
+		// 读取之后 key 可能被其他指令修改，只删除仍然是移走的值的 key，以免删掉其他指令写入的值
+		if srcDB.removeIfSame(key, entity) > 0 {
+			break
+		}
+		// key 已经被修改或删除，撤销写入，按修改后的结果重新移动
+		destDB.removeIfSame(key, entity)
+	}
+	srcDB.notifyKeyspaceEvent(notifyGeneric, "move_from", key)
+	destDB.notifyKeyspaceEvent(notifyGeneric, "move_to", key)
+	return reply.MakeIntReply(1)
+}
+
+// execSwapDB 交换两个数据库中的数据
+// 交换的是 DB 中的数据而不是 dbSet 中的 DB，选择了其中一个数据库的客户端之后立即看到另一个数据库的数据
+// SWAPDB index1 index2
+func execSwapDB(mdb *Database, args [][]byte) resp.Reply {
+	first, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid first DB index")
+	}
+	second, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.MakeErrReply("ERR invalid second DB index")
+	}
+	if first < 0 || first >= len(mdb.dbSet) || second < 0 || second >= len(mdb.dbSet) {
+		return reply.MakeErrReply("ERR DB index is out of range")
+	}
+	if first == second {
+		return reply.MakeOkReply()
+	}
+
+	mdb.dbLock.Lock()
+	a, b := mdb.dbSet[first], mdb.dbSet[second]
+	a.data, b.data = b.data, a.data
+	memA, memB := atomic.LoadInt64(&a.usedMemory), atomic.LoadInt64(&b.usedMemory)
+	atomic.StoreInt64(&a.usedMemory, memB)
+	atomic.StoreInt64(&b.usedMemory, memA)
+	// 淘汰池中记录的是数据库的索引，交换后不再准确
+	mdb.evictPool.reset()
+	mdb.dbLock.Unlock()
+
+	// 等待的 key 可能在交换过来的数据中已经存在，让阻塞的客户端重新检查
+	mdb.blocking.signalDB(first)
+	mdb.blocking.signalDB(second)
+	// 客户端缓存的两个数据库的 key 都已经失效
+	mdb.tracking.invalidateAll()
+	return reply.MakeOkReply()
+}
+
+// execFlushAll 清空所有数据库
+// FLUSHALL [ASYNC|SYNC]
+// Go 由垃圾回收器释放内存，ASYNC 清空后立即返回，内存在之后的垃圾回收中释放；
+// SYNC 和不指定时同Redis的默认行为一样，等待内存释放后才返回
+func execFlushAll(mdb *Database, args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeSyntaxErrReply()
+	}
+	async := false
+	if len(args) == 1 {
+		switch strings.ToLower(string(args[0])) {
+		case "async":
+			async = true
+		case "sync":
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	mdb.dbLock.Lock()
+	for _, db := range mdb.dbSet {
+		db.Flush()
+	}
+	mdb.evictPool.reset()
+	mdb.dbLock.Unlock()
+
+	mdb.tracking.invalidateAll()
+	if !async {
+		// 在释放锁之后执行，不阻塞其他客户端的指令
+		debug.FreeOSMemory()
+	}
+	return reply.MakeOkReply()
+}
+
+func init() {
+	registerServerCommand("Copy", -3, flagWrite|flagDenyOOM).
+		attachKeys(1, 2, 1).attachCategories("keyspace").
+		attachDocs("generic", "6.2.0", "Copies the value of a key to a new key.")
+	registerServerCommand("Move", 3, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("keyspace").
+		attachDocs("generic", "1.0.0", "Moves a key to another database.")
+	registerServerCommand("SwapDB", 3, flagWrite|flagFast).
+		attachCategories("keyspace", "dangerous").
+		attachDocs("server", "4.0.0", "Swaps two Redis databases.")
+	registerServerCommand("FlushAll", -1, flagWrite).
+		attachCategories("keyspace", "dangerous").
+		attachDocs("server", "1.0.0", "Removes all keys from all databases.")
+}
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"go_redis/config"
+	"go_redis/resp/connection"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCopyIsDeep(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	c := connection.NewFakeConn()
+	for _, line := range []string{
+		"rpush l a b",
+		"zadd z 1 m",
+		"xadd s 1-0 f v",
+		"xgroup create s g 0",
+		"xreadgroup group g alice streams s >",
+	} {
+		mdb.Exec(c, toCmdLine(strings.Fields(line)...))
+	}
+	for _, key := range []string{"l", "z", "s"} {
+		if got := string(mdb.Exec(c, toCmdLine("copy", key, key+"-copy")).ToBytes()); got != ":1\r\n" {
+			t.Fatalf("COPY %s got %q", key, got)
+		}
+	}
+	// 修改原来的 key 不影响复制出的 key
+	for _, line := range []string{
+		"lset l 0 x",
+		"zadd z 5 m",
+		"xadd s 2-0 f v",
+		"xack s g 1-0",
+		"xgroup createconsumer s g bob",
+	} {
+		mdb.Exec(c, toCmdLine(strings.Fields(line)...))
+	}
+	cases := []struct {
+		line string
+		want string
+	}{
+		{"lrange l-copy 0 -1", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{"zscore z-copy m", "$1\r\n1\r\n"},
+		{"xlen s-copy", ":1\r\n"},
+		{"xpending s-copy g - + 10", "*1\r\n*4\r\n$3\r\n1-0\r\n$5\r\nalice\r\n"},
+		{"xgroup createconsumer s-copy g bob", ":1\r\n"},
+	}
+	for _, tc := range cases {
+		got := string(mdb.Exec(c, toCmdLine(strings.Fields(tc.line)...)).ToBytes())
+		if !strings.HasPrefix(got, tc.want) {
+			t.Errorf("%s: got %q, want prefix %q", tc.line, got, tc.want)
+		}
+	}
+}
+
+func TestSwapDBWakesBlockedClient(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	waiter := blockAsync(t, context.Background(), mdb, &blockingConn{}, "blpop l 0")
+	mdb.Exec(&blockingConn{dbIndex: 1}, toCmdLine("rpush", "l", "a"))
+	assertBlocked(t, waiter)
+	// 交换之后0号数据库中有了 l，等待它的客户端被唤醒
+	if got := execMdb(mdb, "swapdb 0 1"); got != "+OK\r\n" {
+		t.Fatalf("SWAPDB got %q", got)
+	}
+	if got := waitReply(t, waiter); got != "*2\r\n$1\r\nl\r\n$1\r\na\r\n" {
+		t.Errorf("waiter got %q", got)
+	}
+}
+
+func TestCopyDeniedOverMaxMemory(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	c := connection.NewFakeConn()
+	mdb.Exec(c, toCmdLine("set", "k", "v"))
+
+	old := config.Properties()
+	defer config.Update(func(props *config.ServerProperties) { *props = *old })
+	config.Update(func(props *config.ServerProperties) {
+		props.MaxMemory = 1
+		props.MaxMemoryPolicy = policyNoEviction
+	})
+
+	oom := "-OOM command not allowed when used memory > 'maxmemory'.\r\n"
+	if got := string(mdb.Exec(c, toCmdLine("copy", "k", "k2")).ToBytes()); got != oom {
+		t.Fatalf("COPY got %q, want OOM error", got)
+	}
+	if got := string(mdb.Exec(c, toCmdLine("copy", "k", "k2", "db", "1")).ToBytes()); got != oom {
+		t.Fatalf("COPY to another db got %q, want OOM error", got)
+	}
+	// MOVE 不增加内存占用，不受限制
+	if got := string(mdb.Exec(c, toCmdLine("move", "k", "1")).ToBytes()); got != ":1\r\n" {
+		t.Fatalf("MOVE got %q", got)
+	}
+}
+
+func TestMoveKeepsConcurrentWrite(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	writer, mover := connection.NewFakeConn(), connection.NewFakeConn()
+	destConn := connection.NewFakeConn()
+	destConn.SelectDB(1)
+
+	// 写入的每个值都应该被取出：被之后的 GETSET 返回、被 MOVE 移走或者最后留在0号数据库中。
+	// GETSET 的读和写之间没有加锁，和 MOVE 同时执行时同一个值可能被取出两次，但不能丢失
+	const n = 20000
+	seen := make([]int, n+1)
+	record := func(raw []byte) {
+		if len(raw) < 4 || raw[0] != '$' || raw[1] == '-' {
+			return
+		}
+		value := string(raw[bytes.IndexByte(raw, '\n')+1 : len(raw)-2])
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			t.Fatalf("unexpected value %q", value)
+		}
+		seen[i]++
+	}
+	mdb.Exec(writer, toCmdLine("set", "k", "0"))
+
+	var mu sync.Mutex
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 1; i <= n; i++ {
+			old := mdb.Exec(writer, toCmdLine("getset", "k", strconv.Itoa(i))).ToBytes()
+			mu.Lock()
+			record(old)
+			mu.Unlock()
+		}
+	}()
+	for moving := true; moving; {
+		select {
+		case <-done:
+			moving = false
+		default:
+		}
+		if string(mdb.Exec(mover, toCmdLine("move", "k", "1")).ToBytes()) != ":1\r\n" {
+			continue
+		}
+		moved := mdb.Exec(destConn, toCmdLine("get", "k")).ToBytes()
+		mu.Lock()
+		record(moved)
+		mu.Unlock()
+		mdb.Exec(destConn, toCmdLine("del", "k"))
+	}
+	record(mdb.Exec(writer, toCmdLine("get", "k")).ToBytes())
+
+	for i, count := range seen {
+		if count == 0 {
+			t.Fatalf("value %d was lost", i)
+		}
+	}
+}
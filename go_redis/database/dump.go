@@ -0,0 +1,515 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	List "go_redis/datastructure/list"
+	SortedSet "go_redis/datastructure/sortedset"
+	"go_redis/interface/database"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"hash/crc64"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+/*
+ * DUMP 和 RESTORE：序列化 key 的值，格式和Redis官方相同，可以在两种服务端之间互相迁移数据
+ * 序列化的数据由三部分组成：RDB格式的值（类型 + 编码后的值）、2字节的RDB版本、8字节的CRC64校验和，
+ * 版本和校验和都是小端序，校验和覆盖它之前的所有字节
+ */
+
+const (
+	// rdbVersion 是 DUMP 写入的RDB版本，和 redis_version 6.2 使用的版本相同
+	rdbVersion = 9
+	// rdbMaxLoadVersion 是 RESTORE 接受的最高RDB版本，之后的版本没有改变这里用到的编码，
+	// 因此也可以恢复较新的Redis生成的字符串
+	rdbMaxLoadVersion = 12
+
+	// dumpFooterSize 是RDB版本和校验和的字节数
+	dumpFooterSize = 10
+
+	// 列表和有序集合使用Redis仍然可以加载的旧格式：列表依次保存每个元素，
+	// 有序集合依次保存成员和8字节小端序的 float64 分数
+	rdbTypeString = 0
+	rdbTypeList   = 1
+	rdbTypeZSet2  = 5
+
+	// 长度编码的前两位
+	rdb6BitLen  = 0
+	rdb14BitLen = 1
+	rdbEncVal   = 3
+	rdb32BitLen = 0x80
+	rdb64BitLen = 0x81
+
+	// 前两位为 rdbEncVal 时字符串的特殊编码
+	rdbEncInt8  = 0
+	rdbEncInt16 = 1
+	rdbEncInt32 = 2
+	rdbEncLZF   = 3
+)
+
+// crc64Table 是Redis使用的 CRC-64/Jones 的查找表，多项式是 0xad93d23594c935a9 按位反转后的值
+var crc64Table = crc64.MakeTable(0x95ac9329ac4bc9b5)
+
+// errBadDumpFormat 表示序列化的数据无法解析
+var errBadDumpFormat = errors.New("ERR Bad data format")
+
+// makeDumpUnsupportedErrReply 返回值的类型无法序列化时的错误回复
+func makeDumpUnsupportedErrReply(key string) resp.Reply {
+	return reply.MakeErrReply("ERR DUMP is not supported for the type of key '" + key + "'")
+}
+
+// crc64Jones 计算Redis使用的CRC64校验和，初始值为0且结果不取反，
+// 标准库在计算前后都会取反，所以在两端再各取反一次
+func crc64Jones(data []byte) uint64 {
+	return ^crc64.Update(^uint64(0), crc64Table, data)
+}
+
+// dumpEntity 序列化实体的值，不支持的类型返回 nil，当前版本不支持 stream
+func dumpEntity(entity *database.DataEntity) []byte {
+	var buf []byte
+	switch data := entity.Data.(type) {
+	case []byte:
+		buf = make([]byte, 0, len(data)+16)
+		buf = append(buf, rdbTypeString)
+		buf = appendRDBString(buf, data)
+	case *List.List:
+		buf = make([]byte, 0, data.Bytes()+data.Len()*2+16)
+		buf = append(buf, rdbTypeList)
+		buf = appendRDBLength(buf, uint64(data.Len()))
+		data.ForEach(func(i int, val []byte) bool {
+			buf = appendRDBString(buf, val)
+			return true
+		})
+	case *SortedSet.SortedSet:
+		buf = make([]byte, 0, data.Bytes()+int(data.Len())*10+16)
+		buf = append(buf, rdbTypeZSet2)
+		buf = appendRDBLength(buf, uint64(data.Len()))
+		data.ForEach(func(element *SortedSet.Element) bool {
+			buf = appendRDBString(buf, []byte(element.Member))
+			var score [8]byte
+			binary.LittleEndian.PutUint64(score[:], math.Float64bits(element.Score))
+			buf = append(buf, score[:]...)
+			return true
+		})
+	default:
+		return nil
+	}
+	var footer [dumpFooterSize]byte
+	binary.LittleEndian.PutUint16(footer[:2], rdbVersion)
+	binary.LittleEndian.PutUint64(footer[2:], crc64Jones(append(buf, footer[:2]...)))
+	return append(buf, footer[:]...)
+}
+
+// appendRDBLength 按RDB的长度编码写入 n，长度越小占用的字节越少
+func appendRDBLength(buf []byte, n uint64) []byte {
+	switch {
+	case n < 1<<6:
+		return append(buf, byte(rdb6BitLen<<6|n))
+	case n < 1<<14:
+		return append(buf, byte(rdb14BitLen<<6|n>>8), byte(n))
+	case n <= math.MaxUint32:
+		var b [5]byte
+		b[0] = rdb32BitLen
+		binary.BigEndian.PutUint32(b[1:], uint32(n))
+		return append(buf, b[:]...)
+	default:
+		var b [9]byte
+		b[0] = rdb64BitLen
+		binary.BigEndian.PutUint64(b[1:], n)
+		return append(buf, b[:]...)
+	}
+}
+
+// appendRDBString 写入字符串，和Redis一样把可以表示为32位整数的字符串编码为整数
+func appendRDBString(buf []byte, s []byte) []byte {
+	if len(s) <= 11 {
+		if v, err := strconv.ParseInt(string(s), 10, 32); err == nil && strconv.FormatInt(v, 10) == string(s) {
+			switch {
+			case v >= math.MinInt8 && v <= math.MaxInt8:
+				return append(buf, rdbEncVal<<6|rdbEncInt8, byte(v))
+			case v >= math.MinInt16 && v <= math.MaxInt16:
+				return append(buf, rdbEncVal<<6|rdbEncInt16, byte(v), byte(v>>8))
+			default:
+				return append(buf, rdbEncVal<<6|rdbEncInt32, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+			}
+		}
+	}
+	buf = appendRDBLength(buf, uint64(len(s)))
+	return append(buf, s...)
+}
+
+// verifyDumpPayload 检查序列化数据的RDB版本和校验和，返回去掉版本和校验和之后的部分
+func verifyDumpPayload(payload []byte) ([]byte, bool) {
+	if len(payload) < dumpFooterSize {
+		return nil, false
+	}
+	body := payload[:len(payload)-dumpFooterSize]
+	version := binary.LittleEndian.Uint16(payload[len(body):])
+	if version > rdbMaxLoadVersion {
+		return nil, false
+	}
+	checksum := binary.LittleEndian.Uint64(payload[len(payload)-8:])
+	return body, checksum == crc64Jones(payload[:len(payload)-8])
+}
+
+// loadDumpBody 解析 verifyDumpPayload 返回的RDB格式的值
+func loadDumpBody(body []byte) (interface{}, error) {
+	r := &rdbReader{buf: body}
+	typ, err := r.readByte()
+	if err != nil {
+		return nil, err
+	}
+	var value interface{}
+	switch typ {
+	case rdbTypeString:
+		value, err = r.readString()
+	case rdbTypeList:
+		value, err = r.readList()
+	case rdbTypeZSet2:
+		value, err = r.readZSet()
+	default:
+		// Redis 使用的 quicklist、ziplist 等紧凑编码和 stream 没有实现
+		return nil, errBadDumpFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r.pos != len(r.buf) {
+		return nil, errBadDumpFormat
+	}
+	return value, nil
+}
+
+// rdbReader 从序列化的数据中依次读取RDB格式的内容
+type rdbReader struct {
+	buf []byte
+	pos int
+}
+
+func (r *rdbReader) readByte() (byte, error) {
+	if r.pos >= len(r.buf) {
+		return 0, errBadDumpFormat
+	}
+	b := r.buf[r.pos]
+	r.pos++
+	return b, nil
+}
+
+func (r *rdbReader) readBytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.buf)-r.pos) {
+		return nil, errBadDumpFormat
+	}
+	b := r.buf[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return b, nil
+}
+
+// readLength 读取长度编码，encoded 为 true 时返回的是字符串的特殊编码类型
+func (r *rdbReader) readLength() (n uint64, encoded bool, err error) {
+	first, err := r.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case rdb6BitLen:
+		return uint64(first & 0x3f), false, nil
+	case rdb14BitLen:
+		next, err := r.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3f)<<8 | uint64(next), false, nil
+	case rdbEncVal:
+		return uint64(first & 0x3f), true, nil
+	}
+	switch first {
+	case rdb32BitLen:
+		b, err := r.readBytes(4)
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(b)), false, nil
+	case rdb64BitLen:
+		b, err := r.readBytes(8)
+		if err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(b), false, nil
+	}
+	return 0, false, errBadDumpFormat
+}
+
+// readString 读取字符串，包括整数编码和LZF压缩的字符串，返回的切片不引用序列化的数据
+func (r *rdbReader) readString() ([]byte, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		b, err := r.readBytes(n)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), b...), nil
+	}
+	switch n {
+	case rdbEncInt8:
+		b, err := r.readBytes(1)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int8(b[0])), 10), nil
+	case rdbEncInt16:
+		b, err := r.readBytes(2)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(b))), 10), nil
+	case rdbEncInt32:
+		b, err := r.readBytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(b))), 10), nil
+	case rdbEncLZF:
+		compressedLen, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, _, err := r.readLength()
+		if err != nil {
+			return nil, err
+		}
+		compressed, err := r.readBytes(compressedLen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, rawLen)
+	}
+	return nil, errBadDumpFormat
+}
+
+// readList 读取 rdbTypeList 格式的列表，空列表是无效的数据
+func (r *rdbReader) readList() (*List.List, error) {
+	n, err := r.readCount()
+	if err != nil {
+		return nil, err
+	}
+	list := List.Make()
+	for i := uint64(0); i < n; i++ {
+		val, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		list.PushBack(val)
+	}
+	return list, nil
+}
+
+// readZSet 读取 rdbTypeZSet2 格式的有序集合，成员重复或分数为 NaN 时是无效的数据
+func (r *rdbReader) readZSet() (*SortedSet.SortedSet, error) {
+	n, err := r.readCount()
+	if err != nil {
+		return nil, err
+	}
+	set := SortedSet.Make()
+	for i := uint64(0); i < n; i++ {
+		member, err := r.readString()
+		if err != nil {
+			return nil, err
+		}
+		b, err := r.readBytes(8)
+		if err != nil {
+			return nil, err
+		}
+		score := math.Float64frombits(binary.LittleEndian.Uint64(b))
+		if math.IsNaN(score) || !set.Add(string(member), score) {
+			return nil, errBadDumpFormat
+		}
+	}
+	return set, nil
+}
+
+// readCount 读取集合类型的元素数量，每个元素至少占一个字节，
+// 超过剩余数据长度的数量是无效的，避免按伪造的数量分配内存
+func (r *rdbReader) readCount() (uint64, error) {
+	n, encoded, err := r.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if encoded || n == 0 || n > uint64(len(r.buf)-r.pos) {
+		return 0, errBadDumpFormat
+	}
+	return n, nil
+}
+
+// lzfDecompress 解压Redis使用的LZF格式，rawLen 是解压后的长度
+// 控制字节小于32时后面跟着 控制字节+1 个原样的字节，
+// 否则是对已解压数据的引用：高3位是长度减2（为7时再读一个字节加上去），低5位和下一个字节是距离减1
+func lzfDecompress(in []byte, rawLen uint64) ([]byte, error) {
+	// rawLen 来自客户端发送的数据，不能直接按它分配内存，最多预先分配压缩数据的4倍，不够时由 append 扩容
+	capacity := rawLen
+	if limit := uint64(len(in)) * 4; capacity > limit {
+		capacity = limit
+	}
+	out := make([]byte, 0, capacity)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 32 {
+			n := ctrl + 1
+			if i+n > len(in) || uint64(len(out)+n) > rawLen {
+				return nil, errBadDumpFormat
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errBadDumpFormat
+			}
+			n += int(in[i])
+			i++
+		}
+		n += 2
+		if i >= len(in) {
+			return nil, errBadDumpFormat
+		}
+		ref := len(out) - (ctrl&0x1f)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 || uint64(len(out)+n) > rawLen {
+			return nil, errBadDumpFormat
+		}
+		// 引用的范围可能和正在写入的部分重叠，需要逐个字节复制
+		for k := 0; k < n; k++ {
+			out = append(out, out[ref+k])
+		}
+	}
+	if uint64(len(out)) != rawLen {
+		return nil, errBadDumpFormat
+	}
+	return out, nil
+}
+
+// execDump 返回 key 的值序列化后的数据，key 不存在时返回 nil
+func execDump(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	payload := dumpEntity(entity)
+	if payload == nil {
+		return makeDumpUnsupportedErrReply(key)
+	}
+	return reply.MakeBulkReply(payload)
+}
+
+// execRestore 用 DUMP 序列化的数据创建 key
+// RESTORE key ttl serialized-value [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func execRestore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return reply.MakeErrReply("ERR Invalid TTL value, must be >= 0")
+	}
+	replace, absTTL := false, false
+	idleTime, freq := int64(-1), int64(-1)
+	for i := 3; i < len(args); i++ {
+		option := strings.ToLower(string(args[i]))
+		switch {
+		case option == "replace":
+			replace = true
+		case option == "absttl":
+			absTTL = true
+		case option == "idletime" && i+1 < len(args) && freq == -1:
+			i++
+			idleTime, err = strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if idleTime < 0 {
+				return reply.MakeErrReply("ERR Invalid IDLETIME value, must be >= 0")
+			}
+		case option == "freq" && i+1 < len(args) && idleTime == -1:
+			i++
+			freq, err = strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if freq < 0 || freq > lfuCounterMax {
+				return reply.MakeErrReply("ERR Invalid FREQ value, must be >= 0 and <= 255")
+			}
+		default:
+			// IDLETIME 和 FREQ 不能同时使用
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	_, exists := db.GetEntity(key)
+	if exists && !replace {
+		return reply.MakeErrReply("BUSYKEY Target key name already exists.")
+	}
+	body, ok := verifyDumpPayload(args[2])
+	if !ok {
+		return reply.MakeErrReply("ERR DUMP payload version or checksum are wrong")
+	}
+	value, err := loadDumpBody(body)
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+
+	if ttl > 0 {
+		if absTTL && ttl <= nowMillis() {
+			// 过期时间已经过去，同Redis一样不创建 key，REPLACE 时删除原有的 key
+			if exists {
+				db.Remove(key)
+				db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+			}
+			return &reply.OkReply{}
+		}
+		// 当前版本没有实现过期时间，不能静默地把会过期的 key 恢复成永久的 key
+		return reply.MakeErrReply("ERR RESTORE with a TTL is not supported, keys never expire on this server")
+	}
+
+	entity := &database.DataEntity{Data: value}
+	restoreAccessInfo(entity, idleTime, freq)
+	db.PutEntity(key, entity)
+	db.notifyKeyspaceEvent(notifyGeneric, "restore", key)
+	return &reply.OkReply{}
+}
+
+// restoreAccessInfo 按 IDLETIME 或 FREQ 设置实体的访问信息，为 -1 时表示没有指定
+// 和Redis一样，IDLETIME 只在 LFU 以外的淘汰策略下生效，FREQ 只在 LFU 淘汰策略下生效
+func restoreAccessInfo(entity *database.DataEntity, idleTime, freq int64) {
+	switch evictionPolicy() {
+	case policyAllKeysLFU, policyVolatileLFU:
+		if freq >= 0 {
+			atomic.StoreUint32(&entity.Counter, uint32(freq))
+			atomic.StoreInt64(&entity.AccessTime, nowMillis())
+		}
+	default:
+		if idleTime >= 0 {
+			atomic.StoreUint32(&entity.Counter, lfuInitVal)
+			atomic.StoreInt64(&entity.AccessTime, nowMillis()-idleTime*1000)
+		}
+	}
+}
+
+func init() {
+	RegisterCommand("Dump", execDump, 2, flagReadOnly|flagRandom).
+		attachKeys(1, 1, 1).attachCategories("keyspace").
+		attachDocs("generic", "2.6.0", "Returns a serialized representation of the value stored at a key.")
+	RegisterCommand("Restore", execRestore, -4, flagWrite|flagDenyOOM).
+		attachKeys(1, 1, 1).attachCategories("keyspace", "dangerous").
+		attachDocs("generic", "2.6.0", "Creates a key from the serialized representation of a value.")
+}
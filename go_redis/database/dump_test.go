@@ -0,0 +1,228 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"go_redis/interface/database"
+	"go_redis/resp/connection"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// withFooter 在RDB格式的值后面加上版本和校验和
+func withFooter(body []byte, version uint16) []byte {
+	payload := append([]byte(nil), body...)
+	payload = append(payload, byte(version), byte(version>>8))
+	var checksum [8]byte
+	binary.LittleEndian.PutUint64(checksum[:], crc64Jones(payload))
+	return append(payload, checksum[:]...)
+}
+
+func TestDumpEncoding(t *testing.T) {
+	cases := []struct {
+		value string
+		// body 是不包括版本和校验和的部分
+		body string
+	}{
+		{"", "\x00\x00"},
+		{"hello", "\x00\x05hello"},
+		{"10", "\x00\xc0\n"},
+		{"-1", "\x00\xc0\xff"},
+		{"-129", "\x00\xc1\x7f\xff"},
+		{"32768", "\x00\xc2\x00\x80\x00\x00"},
+		// 超出 int32 范围和不是规范形式的整数按字符串保存
+		{"2147483648", "\x00\x0a2147483648"},
+		{"007", "\x00\x03007"},
+		{"+1", "\x00\x02+1"},
+		{strings.Repeat("x", 100), "\x00\x40\x64" + strings.Repeat("x", 100)},
+		{strings.Repeat("y", 20000), "\x00\x80\x00\x00\x4e\x20" + strings.Repeat("y", 20000)},
+	}
+	for _, c := range cases {
+		payload := dumpEntity(&database.DataEntity{Data: []byte(c.value)})
+		want := withFooter([]byte(c.body), rdbVersion)
+		if !bytes.Equal(payload, want) {
+			t.Errorf("dump %.20q: got %q, want %q", c.value, printablePrefix(payload), printablePrefix(want))
+			continue
+		}
+		body, ok := verifyDumpPayload(payload)
+		if !ok {
+			t.Errorf("dump %.20q: checksum mismatch", c.value)
+			continue
+		}
+		value, err := loadDumpBody(body)
+		if err != nil || string(value.([]byte)) != c.value {
+			t.Errorf("dump %.20q: loaded back %.20q, %v", c.value, value, err)
+		}
+	}
+}
+
+func printablePrefix(b []byte) []byte {
+	if len(b) > 40 {
+		return b[:40]
+	}
+	return b
+}
+
+func TestDumpMatchesRedis(t *testing.T) {
+	// Redis 文档中 DUMP 的示例：SET mykey 10 之后 DUMP mykey
+	want := "\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"
+	if got := dumpEntity(&database.DataEntity{Data: []byte("10")}); string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	body, ok := verifyDumpPayload([]byte(want))
+	if !ok {
+		t.Fatal("checksum of the Redis payload does not match")
+	}
+	if value, err := loadDumpBody(body); err != nil || string(value.([]byte)) != "10" {
+		t.Fatalf("loaded %q, %v", value, err)
+	}
+}
+
+func TestVerifyDumpPayload(t *testing.T) {
+	valid := []byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n")
+	badChecksum := append([]byte(nil), valid...)
+	badChecksum[len(badChecksum)-1] ^= 1
+	badBody := append([]byte(nil), valid...)
+	badBody[2] = '\x0b'
+
+	cases := map[string][]byte{
+		"bad checksum":  badChecksum,
+		"modified body": badBody,
+		"too short":     valid[:dumpFooterSize-1],
+		"newer version": withFooter([]byte("\x00\xc0\n"), rdbMaxLoadVersion+1),
+	}
+	for name, payload := range cases {
+		if _, ok := verifyDumpPayload(payload); ok {
+			t.Errorf("%s: payload was accepted", name)
+		}
+	}
+	if _, ok := verifyDumpPayload(withFooter([]byte("\x00\xc0\n"), rdbMaxLoadVersion)); !ok {
+		t.Error("payload with the highest supported version was rejected")
+	}
+}
+
+func TestLoadDumpBody(t *testing.T) {
+	// 10个 a 压缩后是一个原样的 a 和一个距离为1、长度为9的引用
+	lzfA10 := "\x00a\xe0\x00\x00"
+	cases := []struct {
+		name string
+		body string
+		// want 为空时期望解析失败
+		want string
+	}{
+		{"lzf", "\x00\xc3\x05\x0a" + lzfA10, strings.Repeat("a", 10)},
+		{"lzf reference past raw length", "\x00\xc3\x05\x05" + lzfA10, ""},
+		{"lzf raw length too long", "\x00\xc3\x05\x0b" + lzfA10, ""},
+		{"lzf literal past input", "\x00\xc3\x02\x06\x05a", ""},
+		{"lzf reference before start", "\x00\xc3\x02\x02\x20\x00", ""},
+		{"lzf truncated reference", "\x00\xc3\x03\x0a\x00a\xe0", ""},
+		{"lzf compressed length past input", "\x00\xc3\x10\x0a" + lzfA10, ""},
+		{"truncated string", "\x00\x05hel", ""},
+		{"truncated int", "\x00\xc1\x01", ""},
+		{"unknown encoding", "\x00\xc4", ""},
+		{"trailing bytes", "\x00\x01ab", ""},
+		{"unsupported type", "\x0e\x01\x00", ""},
+		{"empty list", "\x01\x00", ""},
+		{"list count past input", "\x01\x05\x01a", ""},
+		{"duplicate zset member", "\x05\x02\x01a" + strings.Repeat("\x00", 8) + "\x01a" + strings.Repeat("\x00", 8), ""},
+		{"truncated zset score", "\x05\x01\x01a\x00\x00", ""},
+		{"empty", "", ""},
+	}
+	for _, c := range cases {
+		value, err := loadDumpBody([]byte(c.body))
+		if c.want == "" {
+			if err == nil {
+				t.Errorf("%s: loaded %q, want an error", c.name, value)
+			}
+			continue
+		}
+		if err != nil || string(value.([]byte)) != c.want {
+			t.Errorf("%s: got %q, %v, want %q", c.name, value, err, c.want)
+		}
+	}
+}
+
+func TestRestoreReplies(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	c := connection.NewFakeConn()
+	payload := string(withFooter([]byte("\x00\x05hello"), rdbVersion))
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"restore", "k", "0", payload}, "+OK\r\n"},
+		{[]string{"restore", "k", "0", payload}, "-BUSYKEY Target key name already exists.\r\n"},
+		{[]string{"restore", "k", "0", payload, "replace"}, "+OK\r\n"},
+		{[]string{"restore", "bad", "0", payload[:len(payload)-1] + "x"}, "-ERR DUMP payload version or checksum are wrong\r\n"},
+		{[]string{"restore", "bad", "0", string(withFooter([]byte("\x00\x05hel"), rdbVersion))}, "-ERR Bad data format\r\n"},
+		{[]string{"restore", "bad", "-1", payload}, "-ERR Invalid TTL value, must be >= 0\r\n"},
+		{[]string{"dump", "k"}, "$" + strconv.Itoa(len(payload)) + "\r\n" + payload + "\r\n"},
+		{[]string{"dump", "missing"}, "$-1\r\n"},
+	}
+	for _, tc := range cases {
+		if got := string(mdb.Exec(c, toCmdLine(tc.args...)).ToBytes()); got != tc.want {
+			t.Errorf("%.30q: got %q, want %q", strings.Join(tc.args, " "), got, tc.want)
+		}
+	}
+}
+
+func TestDumpCollections(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	c := connection.NewFakeConn()
+	mdb.Exec(c, toCmdLine("rpush", "list", "a", "1", strings.Repeat("x", 100)))
+	mdb.Exec(c, toCmdLine("zadd", "zset", "1.5", "a", "-2", "b", "inf", "c"))
+
+	// 列表的元素和字符串使用相同的编码
+	want := withFooter([]byte("\x01\x03\x01a\xc0\x01\x40\x64"+strings.Repeat("x", 100)), rdbVersion)
+	if got := mdb.Exec(c, toCmdLine("dump", "list")).ToBytes(); !bytes.HasSuffix(got, append(want, "\r\n"...)) {
+		t.Fatalf("DUMP list got %q", printablePrefix(got))
+	}
+
+	cases := []struct {
+		key   string
+		check []string
+	}{
+		{"list", []string{"lrange", "", "0", "-1"}},
+		{"zset", []string{"zrange", "", "0", "-1", "withscores"}},
+	}
+	for _, tc := range cases {
+		payload := mdb.Exec(c, toCmdLine("dump", tc.key)).ToBytes()
+		// 去掉 bulk string 的长度前缀和结尾的 \r\n
+		payload = payload[bytes.IndexByte(payload, '\n')+1 : len(payload)-2]
+		restored := tc.key + "-restored"
+		if got := string(mdb.Exec(c, toCmdLine("restore", restored, "0", string(payload))).ToBytes()); got != "+OK\r\n" {
+			t.Fatalf("RESTORE %s got %q", tc.key, got)
+		}
+		check := append([]string(nil), tc.check...)
+		check[1] = tc.key
+		want := string(mdb.Exec(c, toCmdLine(check...)).ToBytes())
+		check[1] = restored
+		if got := string(mdb.Exec(c, toCmdLine(check...)).ToBytes()); got != want {
+			t.Errorf("restored %s: got %q, want %q", tc.key, got, want)
+		}
+	}
+
+	mdb.Exec(c, toCmdLine("xadd", "stream", "*", "f", "v"))
+	if got := string(mdb.Exec(c, toCmdLine("dump", "stream")).ToBytes()); !strings.HasPrefix(got, "-") {
+		t.Errorf("DUMP stream got %q, want an error", got)
+	}
+}
+
+// TestRestoredValueIsCopied 序列化的数据指向解析器复用的缓冲区，恢复的值不能引用它
+func TestRestoredValueIsCopied(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	c := connection.NewFakeConn()
+	payload := dumpEntity(&database.DataEntity{Data: []byte("value")})
+	mdb.Exec(c, CmdLine{[]byte("restore"), []byte("copy"), []byte("0"), payload})
+	for i := range payload {
+		payload[i] = 'X'
+	}
+	if got := mdb.Exec(c, toCmdLine("get", "copy")).ToBytes(); string(got) != "$5\r\nvalue\r\n" {
+		t.Fatalf("restored value changed to %q after the payload was reused", got)
+	}
+}
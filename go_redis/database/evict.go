@@ -0,0 +1,299 @@
+package database
+
+import (
+	"go_redis/config"
+	List "go_redis/datastructure/list"
+	SortedSet "go_redis/datastructure/sortedset"
+	"go_redis/datastructure/stream"
+	"go_redis/interface/database"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * 内存淘汰：配置了 maxmemory 后，每次执行指令前检查估算的内存占用，
+ * 超出限制时按照 maxmemory-policy 指定的策略淘汰 key。
+ * 和Redis官方一样使用近似算法：每次从数据库中随机采样 maxmemory-samples 个 key，
+ * 放入淘汰池中，再从淘汰池中选出最适合淘汰的 key
+ */
+
+// 内存淘汰策略
+const (
+	policyNoEviction     = "noeviction"
+	policyAllKeysLRU     = "allkeys-lru"
+	policyAllKeysLFU     = "allkeys-lfu"
+	policyAllKeysRandom  = "allkeys-random"
+	policyVolatileLRU    = "volatile-lru"
+	policyVolatileLFU    = "volatile-lfu"
+	policyVolatileRandom = "volatile-random"
+	policyVolatileTTL    = "volatile-ttl"
+)
+
+const (
+	// entityOverhead 估算的每个 key-value 除了key和value本身之外的额外内存开销：
+	// DataEntity 结构体以及字典中的一个表项
+	entityOverhead = 64
+	// elementOverhead 估算的容器类型中每个元素除了数据本身之外的额外内存开销
+	elementOverhead = 32
+	// defaultMaxMemorySamples 是 maxmemory-samples 的默认值
+	defaultMaxMemorySamples = 5
+	// evictionPoolSize 是淘汰池能容纳的候选 key 的数量
+	evictionPoolSize = 16
+	// maxEvictionRounds 是一次淘汰最多执行的轮数，避免一直找不到可以淘汰的 key 时陷入死循环
+	maxEvictionRounds = 128
+
+	// LFU 计数器的参数，和Redis的默认配置 lfu-log-factor 10, lfu-decay-time 1 相同
+	lfuInitVal    = 5
+	lfuLogFactor  = 10
+	lfuDecayTime  = time.Minute
+	lfuCounterMax = 255
+)
+
+// sizeOfEntity 估算一个 key-value 占用的内存字节数
+func sizeOfEntity(key string, entity *database.DataEntity) int64 {
+	size := int64(len(key) + entityOverhead)
+	switch data := entity.Data.(type) {
+	case []byte:
+		size += int64(len(data))
+	case *List.List:
+		size += int64(data.Bytes() + data.Len()*elementOverhead)
+	case *SortedSet.SortedSet:
+		size += int64(data.Bytes()) + data.Len()*elementOverhead
+	case *stream.Stream:
+		size += int64(data.Bytes() + data.Len()*elementOverhead)
+	}
+	return size
+}
+
+func nowMillis() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// initEntity 初始化新写入数据库的实体的访问信息
+func initEntity(entity *database.DataEntity) {
+	if atomic.LoadInt64(&entity.AccessTime) == 0 {
+		atomic.StoreUint32(&entity.Counter, lfuInitVal)
+		atomic.StoreInt64(&entity.AccessTime, nowMillis())
+	}
+}
+
+// touchEntity 在实体被访问时更新它的访问时间和访问频率
+func touchEntity(entity *database.DataEntity) {
+	if entity == nil {
+		return
+	}
+	counter := lfuDecrAndReturn(entity)
+	atomic.StoreUint32(&entity.Counter, lfuLogIncr(counter))
+	atomic.StoreInt64(&entity.AccessTime, nowMillis())
+}
+
+// lfuLogIncr 以对数的概率增加访问计数器，计数器越大增加的概率越小
+func lfuLogIncr(counter uint32) uint32 {
+	if counter >= lfuCounterMax {
+		return lfuCounterMax
+	}
+	baseVal := float64(counter) - lfuInitVal
+	if baseVal < 0 {
+		baseVal = 0
+	}
+	p := 1.0 / (baseVal*lfuLogFactor + 1)
+	if rand.Float64() < p {
+		counter++
+	}
+	return counter
+}
+
+// lfuDecrAndReturn 根据距离上次访问经过的时间，返回衰减后的访问计数器
+func lfuDecrAndReturn(entity *database.DataEntity) uint32 {
+	counter := atomic.LoadUint32(&entity.Counter)
+	elapsed := time.Duration(nowMillis()-atomic.LoadInt64(&entity.AccessTime)) * time.Millisecond
+	periods := uint32(elapsed / lfuDecayTime)
+	if periods >= counter {
+		return 0
+	}
+	return counter - periods
+}
+
+// idleScore 计算实体的淘汰分数，分数越高越应该被淘汰
+func idleScore(policy string, entity *database.DataEntity) int64 {
+	switch policy {
+	case policyAllKeysLFU, policyVolatileLFU:
+		return lfuCounterMax - int64(lfuDecrAndReturn(entity))
+	default:
+		return nowMillis() - atomic.LoadInt64(&entity.AccessTime)
+	}
+}
+
+// evictionPolicy 返回当前配置的淘汰策略，没有配置时返回 noeviction
+func evictionPolicy() string {
+	policy := strings.ToLower(config.Properties().MaxMemoryPolicy)
+	if policy == "" {
+		return policyNoEviction
+	}
+	return policy
+}
+
+// evictionCandidate 是淘汰池中的一个候选 key
+type evictionCandidate struct {
+	dbIndex int
+	key     string
+	idle    int64
+}
+
+// evictionPool 按照淘汰分数从小到大保存候选 key，最多保存 evictionPoolSize 个
+type evictionPool struct {
+	mu         sync.Mutex
+	candidates []*evictionCandidate
+}
+
+// add 将候选 key 放入淘汰池，池满时丢弃淘汰分数最小的候选 key
+func (pool *evictionPool) add(candidate *evictionCandidate) {
+	for _, c := range pool.candidates {
+		if c.dbIndex == candidate.dbIndex && c.key == candidate.key {
+			c.idle = candidate.idle
+			return
+		}
+	}
+	if len(pool.candidates) >= evictionPoolSize {
+		if candidate.idle <= pool.candidates[0].idle {
+			return
+		}
+		pool.candidates = pool.candidates[1:]
+	}
+	pool.candidates = append(pool.candidates, candidate)
+	sort.Slice(pool.candidates, func(i, j int) bool {
+		return pool.candidates[i].idle < pool.candidates[j].idle
+	})
+}
+
+// reset 清空淘汰池
+func (pool *evictionPool) reset() {
+	pool.mu.Lock()
+	pool.candidates = nil
+	pool.mu.Unlock()
+}
+
+// pop 取出淘汰分数最高的候选 key
+func (pool *evictionPool) pop() *evictionCandidate {
+	n := len(pool.candidates)
+	if n == 0 {
+		return nil
+	}
+	candidate := pool.candidates[n-1]
+	pool.candidates = pool.candidates[:n-1]
+	return candidate
+}
+
+// UsedMemory 返回所有数据库估算的内存占用之和
+func (mdb *Database) UsedMemory() int64 {
+	var used int64
+	for _, db := range mdb.dbSet {
+		used += db.UsedMemory()
+	}
+	return used
+}
+
+// freeMemoryIfNeeded 在内存占用超过 maxmemory 时淘汰 key，
+// 返回 false 表示无法将内存降到 maxmemory 以下
+func (mdb *Database) freeMemoryIfNeeded() bool {
+	maxMemory := int64(config.Properties().MaxMemory)
+	if maxMemory <= 0 || mdb.UsedMemory() <= maxMemory {
+		return true
+	}
+	policy := evictionPolicy()
+	for round := 0; round < maxEvictionRounds; round++ {
+		if mdb.UsedMemory() <= maxMemory {
+			return true
+		}
+		if !mdb.evictOne(policy) {
+			return false
+		}
+	}
+	return mdb.UsedMemory() <= maxMemory
+}
+
+// evictOne 按照淘汰策略淘汰一个 key，找不到可以淘汰的 key 时返回 false
+func (mdb *Database) evictOne(policy string) bool {
+	switch policy {
+	case policyAllKeysRandom:
+		return mdb.evictRandom()
+	case policyAllKeysLRU, policyAllKeysLFU:
+		return mdb.evictFromPool(policy)
+	case policyVolatileLRU, policyVolatileLFU, policyVolatileRandom, policyVolatileTTL:
+		// volatile 策略只淘汰设置了过期时间的 key，
+		// 当前版本还没有实现过期时间，所以没有可以淘汰的 key
+		return false
+	default:
+		return false
+	}
+}
+
+// evictRandom 从随机一个非空的数据库中随机淘汰一个 key
+func (mdb *Database) evictRandom() bool {
+	start := rand.Intn(len(mdb.dbSet))
+	for i := range mdb.dbSet {
+		db := mdb.dbSet[(start+i)%len(mdb.dbSet)]
+		if db.data.Len() == 0 {
+			continue
+		}
+		keys := db.data.RandomKeys(1)
+		if len(keys) == 0 {
+			continue
+		}
+		db.Remove(keys[0])
+		atomic.AddInt64(&mdb.evictedKeys, 1)
+		db.notifyKeyspaceEvent(notifyEvicted, "evicted", keys[0])
+		mdb.tracking.invalidate(keys[0])
+		return true
+	}
+	return false
+}
+
+// evictFromPool 从每个数据库中采样 key 放入淘汰池，再淘汰池中分数最高的 key
+func (mdb *Database) evictFromPool(policy string) bool {
+	samples := config.Properties().MaxMemorySamples
+	if samples <= 0 {
+		samples = defaultMaxMemorySamples
+	}
+
+	mdb.evictPool.mu.Lock()
+	defer mdb.evictPool.mu.Unlock()
+	for _, db := range mdb.dbSet {
+		if db.data.Len() == 0 {
+			continue
+		}
+		for _, key := range db.data.RandomKeys(samples) {
+			raw, ok := db.data.Get(key)
+			if !ok {
+				continue
+			}
+			entity, _ := raw.(*database.DataEntity)
+			if entity == nil {
+				continue
+			}
+			mdb.evictPool.add(&evictionCandidate{
+				dbIndex: db.index,
+				key:     key,
+				idle:    idleScore(policy, entity),
+			})
+		}
+	}
+
+	// 淘汰池中的 key 可能已经被其他客户端删除了，跳过这些 key
+	for candidate := mdb.evictPool.pop(); candidate != nil; candidate = mdb.evictPool.pop() {
+		db := mdb.dbSet[candidate.dbIndex]
+		if _, exists := db.data.Get(candidate.key); !exists {
+			continue
+		}
+		db.Remove(candidate.key)
+		atomic.AddInt64(&mdb.evictedKeys, 1)
+		db.notifyKeyspaceEvent(notifyEvicted, "evicted", candidate.key)
+		mdb.tracking.invalidate(candidate.key)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"go_redis/config"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * 执行 INFO 指令，以 Redis 官方的 "# Section" 文本格式返回服务端信息
+ */
+
+// redisVersion 是向客户端报告的兼容的 Redis 版本号
+const redisVersion = "6.2.0"
+
+// defaultInfoSections 是 INFO 指令不带参数时返回的信息
+var defaultInfoSections = []string{
+	"server", "clients", "memory", "persistence", "stats", "replication", "keyspace",
+}
+
+// infoSectionGenerators 保存每个 section 对应的生成函数
+var infoSectionGenerators = map[string]func(mdb *Database, buf *bytes.Buffer){
+	"server":      genServerInfo,
+	"clients":     genClientsInfo,
+	"memory":      genMemoryInfo,
+	"persistence": genPersistenceInfo,
+	"stats":       genStatsInfo,
+	"replication": genReplicationInfo,
+	"keyspace":    genKeyspaceInfo,
+}
+
+// execInfo INFO [section [section ...]]
+// keyspace 中的 expires 和 avg_ttl 固定为 0，当前版本没有实现过期时间
+func execInfo(mdb *Database, args [][]byte) resp.Reply {
+	sections := make([]string, 0, len(defaultInfoSections))
+	if len(args) == 0 {
+		sections = defaultInfoSections
+	}
+	for _, arg := range args {
+		section := strings.ToLower(string(arg))
+		switch section {
+		case "all", "everything", "default":
+			sections = defaultInfoSections
+		default:
+			if _, ok := infoSectionGenerators[section]; ok {
+				sections = append(sections, section)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for i, section := range sections {
+		if i > 0 {
+			buf.WriteString(reply.CRLF)
+		}
+		infoSectionGenerators[section](mdb, &buf)
+	}
+	return reply.MakeBulkReply(buf.Bytes())
+}
+
+// writeInfoField 向 buf 写入一行 "name:value"
+func writeInfoField(buf *bytes.Buffer, name string, value interface{}) {
+	buf.WriteString(name + ":" + fmt.Sprint(value) + reply.CRLF)
+}
+
+func genServerInfo(mdb *Database, buf *bytes.Buffer) {
+	uptime := mdb.stats.uptime()
+	buf.WriteString("# Server" + reply.CRLF)
+	writeInfoField(buf, "redis_version", redisVersion)
+	writeInfoField(buf, "redis_mode", "standalone")
+	writeInfoField(buf, "os", runtime.GOOS+" "+runtime.GOARCH)
+	writeInfoField(buf, "arch_bits", strconv.Itoa(strconv.IntSize))
+	writeInfoField(buf, "go_version", runtime.Version())
+	writeInfoField(buf, "process_id", os.Getpid())
+	writeInfoField(buf, "tcp_port", config.Properties().Port)
+	writeInfoField(buf, "uptime_in_seconds", int64(uptime/time.Second))
+	writeInfoField(buf, "uptime_in_days", int64(uptime/(24*time.Hour)))
+}
+
+func genClientsInfo(mdb *Database, buf *bytes.Buffer) {
+	connected := 0
+	if mdb.clientCounter != nil {
+		connected = mdb.clientCounter()
+	}
+	buf.WriteString("# Clients" + reply.CRLF)
+	writeInfoField(buf, "connected_clients", connected)
+	writeInfoField(buf, "maxclients", config.Properties().MaxClients)
+	writeInfoField(buf, "tracking_clients", mdb.tracking.count())
+}
+
+func genMemoryInfo(mdb *Database, buf *bytes.Buffer) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	used := mdb.UsedMemory()
+	maxMemory := int64(config.Properties().MaxMemory)
+	buf.WriteString("# Memory" + reply.CRLF)
+	writeInfoField(buf, "used_memory", used)
+	writeInfoField(buf, "used_memory_human", bytesToHuman(used))
+	writeInfoField(buf, "used_memory_heap", memStats.HeapAlloc)
+	writeInfoField(buf, "used_memory_heap_human", bytesToHuman(int64(memStats.HeapAlloc)))
+	writeInfoField(buf, "used_memory_sys", memStats.Sys)
+	writeInfoField(buf, "used_memory_sys_human", bytesToHuman(int64(memStats.Sys)))
+	writeInfoField(buf, "maxmemory", maxMemory)
+	writeInfoField(buf, "maxmemory_human", bytesToHuman(maxMemory))
+	writeInfoField(buf, "maxmemory_policy", evictionPolicy())
+}
+
+func genPersistenceInfo(mdb *Database, buf *bytes.Buffer) {
+	aofEnabled := 0
+	if config.Properties().AppendOnly {
+		aofEnabled = 1
+	}
+	buf.WriteString("# Persistence" + reply.CRLF)
+	writeInfoField(buf, "loading", 0)
+	writeInfoField(buf, "aof_enabled", aofEnabled)
+}
+
+func genStatsInfo(mdb *Database, buf *bytes.Buffer) {
+	var hits, misses int64
+	for _, db := range mdb.dbSet {
+		hits += atomic.LoadInt64(&db.hits)
+		misses += atomic.LoadInt64(&db.misses)
+	}
+	buf.WriteString("# Stats" + reply.CRLF)
+	writeInfoField(buf, "total_commands_processed", mdb.stats.commandsProcessed())
+	writeInfoField(buf, "instantaneous_ops_per_sec", mdb.stats.instantaneousOps())
+	writeInfoField(buf, "evicted_keys", atomic.LoadInt64(&mdb.evictedKeys))
+	writeInfoField(buf, "keyspace_hits", hits)
+	writeInfoField(buf, "keyspace_misses", misses)
+}
+
+func genReplicationInfo(mdb *Database, buf *bytes.Buffer) {
+	buf.WriteString("# Replication" + reply.CRLF)
+	writeInfoField(buf, "role", "master")
+	writeInfoField(buf, "connected_slaves", 0)
+}
+
+// genKeyspaceInfo 输出每个非空数据库的 key 数量，
+// 当前版本没有实现过期时间，expires 和 avg_ttl 固定为 0
+func genKeyspaceInfo(mdb *Database, buf *bytes.Buffer) {
+	buf.WriteString("# Keyspace" + reply.CRLF)
+	for _, db := range mdb.dbSet {
+		keys := db.data.Len()
+		if keys == 0 {
+			continue
+		}
+		writeInfoField(buf, "db"+strconv.Itoa(db.index),
+			fmt.Sprintf("keys=%d,expires=0,avg_ttl=0", keys))
+	}
+}
+
+// bytesToHuman 将字节数转换成便于阅读的形式，例如 1.50M
+func bytesToHuman(n int64) string {
+	d := float64(n)
+	switch {
+	case n < 1024:
+		return strconv.FormatInt(n, 10) + "B"
+	case n < 1024*1024:
+		return fmt.Sprintf("%.2fK", d/1024)
+	case n < 1024*1024*1024:
+		return fmt.Sprintf("%.2fM", d/(1024*1024))
+	default:
+		return fmt.Sprintf("%.2fG", d/(1024*1024*1024))
+	}
+}
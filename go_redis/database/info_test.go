@@ -0,0 +1,106 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+// infoFields 把 INFO 的回复解析为 section 的列表和 name -> value 的映射
+func infoFields(t *testing.T, mdb *Database, args ...string) ([]string, map[string]string) {
+	t.Helper()
+	r := mdb.Exec(&blockingConn{}, toCmdLine(append([]string{"info"}, args...)...))
+	body := string(r.ToBytes())
+	if !strings.HasPrefix(body, "$") {
+		t.Fatalf("info %v: unexpected reply %q", args, body)
+	}
+	body = body[strings.Index(body, "\r\n")+2:]
+	var sections []string
+	fields := make(map[string]string)
+	for _, line := range strings.Split(body, "\r\n") {
+		switch {
+		case strings.HasPrefix(line, "# "):
+			sections = append(sections, strings.ToLower(line[2:]))
+		case strings.Contains(line, ":"):
+			i := strings.Index(line, ":")
+			fields[line[:i]] = line[i+1:]
+		}
+	}
+	return sections, fields
+}
+
+func TestInfoSections(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{nil, "server clients memory persistence stats replication keyspace"},
+		{[]string{"all"}, "server clients memory persistence stats replication keyspace"},
+		{[]string{"DEFAULT"}, "server clients memory persistence stats replication keyspace"},
+		{[]string{"memory"}, "memory"},
+		{[]string{"keyspace", "Server"}, "keyspace server"},
+		{[]string{"nosuchsection"}, ""},
+	}
+	for _, tt := range tests {
+		sections, _ := infoFields(t, mdb, tt.args...)
+		if got := strings.Join(sections, " "); got != tt.want {
+			t.Errorf("info %v: sections %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestInfoFields(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	mdb.SetClientCounter(func() int { return 3 })
+	c := &blockingConn{}
+	for _, line := range []string{"set a 1", "set b 2", "get a", "get missing", "select 2", "set c 3"} {
+		mdb.Exec(c, toCmdLine(strings.Fields(line)...))
+	}
+
+	_, fields := infoFields(t, mdb)
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"connected_clients", "3"},
+		{"keyspace_hits", "1"},
+		{"keyspace_misses", "1"},
+		{"db0", "keys=2,expires=0,avg_ttl=0"},
+		{"db2", "keys=1,expires=0,avg_ttl=0"},
+		{"db1", ""},
+		{"role", "master"},
+		{"evicted_keys", "0"},
+	}
+	for _, tt := range tests {
+		if got := fields[tt.name]; got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+	// 之前执行的6条指令加上这次 INFO 本身
+	if got := fields["total_commands_processed"]; got != "7" {
+		t.Errorf("total_commands_processed: got %s, want 7", got)
+	}
+	if fields["used_memory"] == "0" {
+		t.Error("used_memory should count the keys")
+	}
+}
+
+func TestBytesToHuman(t *testing.T) {
+	tests := []struct {
+		n    int64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1536, "1.50K"},
+		{3 * 1024 * 1024, "3.00M"},
+		{5 * 1024 * 1024 * 1024, "5.00G"},
+	}
+	for _, tt := range tests {
+		if got := bytesToHuman(tt.n); got != tt.want {
+			t.Errorf("bytesToHuman(%d) = %s, want %s", tt.n, got, tt.want)
+		}
+	}
+}
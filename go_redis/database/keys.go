@@ -1,9 +1,15 @@
 package database
 
 import (
+	List "go_redis/datastructure/list"
+	SortedSet "go_redis/datastructure/sortedset"
+	"go_redis/datastructure/stream"
+	"go_redis/interface/database"
 	"go_redis/interface/resp"
 	"go_redis/lib/wildcard"
 	"go_redis/resp/reply"
+	"strconv"
+	"strings"
 )
 
 /*
@@ -12,12 +18,14 @@ import (
 
 // execDel 从数据库中移除一个key
 func execDel(db *DB, args [][]byte) resp.Reply {
-	keys := make([]string, len(args))
-	for i, v := range args {
-		keys[i] = string(v)
+	deleted := 0
+	for _, arg := range args {
+		key := string(arg)
+		if db.Removes(key) > 0 {
+			deleted++
+			db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+		}
 	}
-
-	deleted := db.Removes(keys...)
 	return reply.MakeIntReply(int64(deleted))
 }
 
@@ -41,19 +49,34 @@ func execFlushDB(db *DB, args [][]byte) resp.Reply {
 }
 
 // execType 根据key返回数据库中实体的类型
-// 包括：string list hash set  zset
-// 当前版本只实现了 string类型相关的功能
+// 包括：string list hash set  zset stream
+// 当前版本实现了 string list zset 和 stream 类型相关的功能
 func execType(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	entity, exists := db.GetEntity(key)
 	if !exists {
 		return reply.MakeStatusReply("none")
 	}
+	typeName := getType(entity)
+	if typeName == "" {
+		return &reply.UnKnownErrReply{}
+	}
+	return reply.MakeStatusReply(typeName)
+}
+
+// getType 返回实体的类型名称，未知类型返回空字符串
+func getType(entity *database.DataEntity) string {
 	switch entity.Data.(type) {
 	case []byte:
-		return reply.MakeStatusReply("string")
+		return "string"
+	case *List.List:
+		return "list"
+	case *SortedSet.SortedSet:
+		return "zset"
+	case *stream.Stream:
+		return "stream"
 	}
-	return &reply.UnKnownErrReply{}
+	return ""
 }
 
 // execRename 更改某个key-value中 的key，例如将key1-value 改为 key2-value
@@ -72,6 +95,8 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	}
 	db.PutEntity(dest, entity)
 	db.Remove(src)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_from", src)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_to", dest)
 	return &reply.OkReply{}
 }
 
@@ -94,6 +119,8 @@ func execRenameNx(db *DB, args [][]byte) resp.Reply {
 	// 感觉这里可能会有并发问题
 	db.Removes(src, dest)
 	db.PutEntity(dest, entity)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_from", src)
+	db.notifyKeyspaceEvent(notifyGeneric, "rename_to", dest)
 	return reply.MakeIntReply(1)
 }
 
@@ -110,12 +137,113 @@ func execKeys(db *DB, args [][]byte) resp.Reply {
 	return reply.MakeMultiBulkReply(result)
 }
 
+// scanOptions 是 SCAN 类指令共用的 [MATCH pattern] [COUNT count] [TYPE type] 参数
+type scanOptions struct {
+	pattern  *wildcard.Pattern
+	count    int
+	typeName string
+}
+
+// parseScanOptions 解析游标之后的参数，withType 为 false 时不接受 TYPE
+func parseScanOptions(args [][]byte, withType bool) (*scanOptions, reply.ErrorReply) {
+	opts := &scanOptions{count: 10}
+	for i := 0; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return nil, reply.MakeSyntaxErrReply()
+		}
+		option := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		switch {
+		case option == "match":
+			opts.pattern = wildcard.CompilePattern(value)
+		case option == "count":
+			count, err := strconv.Atoi(value)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.count = count
+		case option == "type" && withType:
+			opts.typeName = strings.ToLower(value)
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
+}
+
+// parseScanCursor 解析游标
+func parseScanCursor(arg []byte) (int, reply.ErrorReply) {
+	cursor, err := strconv.Atoi(string(arg))
+	if err != nil || cursor < 0 {
+		return 0, reply.MakeErrReply("ERR invalid cursor")
+	}
+	return cursor, nil
+}
+
+// makeScanReply 构造 [cursor, [element ...]] 格式的回复
+func makeScanReply(cursor int, elements [][]byte) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.Itoa(cursor))),
+		reply.MakeMultiBulkReply(elements),
+	})
+}
+
+// execScan 使用游标增量地遍历数据库中的key
+// SCAN cursor [MATCH pattern] [COUNT count] [TYPE type]
+// 在整个遍历过程中一直存在的key至少会被返回一次
+func execScan(db *DB, args [][]byte) resp.Reply {
+	cursor, errReply := parseScanCursor(args[0])
+	if errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[1:], true)
+	if errReply != nil {
+		return errReply
+	}
+
+	keys := make([][]byte, 0, opts.count)
+	nextCursor := db.data.Scan(cursor, opts.count, func(key string, val interface{}) bool {
+		if opts.pattern != nil && !opts.pattern.IsMatch(key) {
+			return true
+		}
+		if opts.typeName != "" {
+			entity, _ := val.(*database.DataEntity)
+			if entity == nil || getType(entity) != opts.typeName {
+				return true
+			}
+		}
+		keys = append(keys, []byte(key))
+		return true
+	})
+	return makeScanReply(nextCursor, keys)
+}
+
 func init() {
-	RegisterCommand("Del", execDel, -2)
-	RegisterCommand("Exists", execExists, -2)
-	RegisterCommand("Keys", execKeys, 2)
-	RegisterCommand("FlushDB", execFlushDB, -1)
-	RegisterCommand("Type", execType, 2)
-	RegisterCommand("Rename", execRename, 3)
-	RegisterCommand("RenameNx", execRenameNx, 3)
+	RegisterCommand("Del", execDel, -2, flagWrite).
+		attachKeys(1, -1, 1).attachCategories("keyspace").
+		attachDocs("generic", "1.0.0", "Deletes one or more keys.")
+	RegisterCommand("Exists", execExists, -2, flagReadOnly|flagFast).
+		attachKeys(1, -1, 1).attachCategories("keyspace").
+		attachDocs("generic", "1.0.0", "Determines whether one or more keys exist.")
+	RegisterCommand("Keys", execKeys, 2, flagReadOnly|flagSortForScript).
+		attachCategories("keyspace", "dangerous").
+		attachDocs("generic", "1.0.0", "Returns all key names that match a pattern.")
+	RegisterCommand("FlushDB", execFlushDB, -1, flagWrite).
+		attachCategories("keyspace", "dangerous").
+		attachDocs("server", "1.0.0", "Removes all keys from the current database.")
+	RegisterCommand("Type", execType, 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).attachCategories("keyspace").
+		attachDocs("generic", "1.0.0", "Determines the type of value stored at a key.")
+	RegisterCommand("Rename", execRename, 3, flagWrite).
+		attachKeys(1, 2, 1).attachCategories("keyspace").
+		attachDocs("generic", "1.0.0", "Renames a key and overwrites the destination.")
+	RegisterCommand("RenameNx", execRenameNx, 3, flagWrite|flagFast).
+		attachKeys(1, 2, 1).attachCategories("keyspace").
+		attachDocs("generic", "1.0.0", "Renames a key only when the target key name doesn't exist.")
+	RegisterCommand("Scan", execScan, -2, flagReadOnly|flagRandom).
+		attachCategories("keyspace").
+		attachDocs("generic", "2.8.0", "Iterates over the key names in the database.")
 }
@@ -0,0 +1,132 @@
+package database
+
+import (
+	"go_redis/resp/reply"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// scanAll 从游标0开始反复执行 SCAN 直到游标回到0，返回所有遍历到的 key 和执行的次数
+func scanAll(t *testing.T, db *DB, options ...string) ([]string, int) {
+	t.Helper()
+	seen := make(map[string]bool)
+	cursor := "0"
+	calls := 0
+	for {
+		args := append([]string{"scan", cursor}, options...)
+		r, ok := db.Exec(nil, toCmdLine(args...)).(*reply.MultiRawReply)
+		if !ok {
+			t.Fatalf("scan %s: unexpected reply", cursor)
+		}
+		calls++
+		cursor = string(r.Replies[0].(*reply.BulkReply).Arg)
+		for _, key := range r.Replies[1].(*reply.MultiBulkReply).Args {
+			seen[string(key)] = true
+		}
+		if cursor == "0" {
+			break
+		}
+		if calls > 10000 {
+			t.Fatal("scan does not terminate")
+		}
+	}
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, calls
+}
+
+func TestScan(t *testing.T) {
+	db := makeDB()
+	for i := 0; i < 50; i++ {
+		execLine(db, "set user:"+strconv.Itoa(i)+" v")
+	}
+	execLine(db, "rpush list a")
+	execLine(db, "zadd zset 1 a")
+	execLine(db, "xadd stream * f v")
+
+	tests := []struct {
+		name    string
+		options []string
+		want    int
+		prefix  string
+	}{
+		{"all keys", nil, 53, ""},
+		{"count 1", []string{"count", "1"}, 53, ""},
+		{"match", []string{"match", "user:1*"}, 11, "user:1"},
+		{"type string", []string{"type", "string"}, 50, "user:"},
+		{"type list", []string{"type", "LIST"}, 1, "list"},
+		{"type zset", []string{"type", "zset"}, 1, "zset"},
+		{"type stream", []string{"type", "stream"}, 1, "stream"},
+		{"match and type", []string{"match", "user:*", "type", "list"}, 0, ""},
+	}
+	for _, tt := range tests {
+		keys, _ := scanAll(t, db, tt.options...)
+		if len(keys) != tt.want {
+			t.Errorf("%s: got %d keys, want %d", tt.name, len(keys), tt.want)
+		}
+		for _, key := range keys {
+			if !strings.HasPrefix(key, tt.prefix) {
+				t.Errorf("%s: unexpected key %s", tt.name, key)
+			}
+		}
+	}
+
+	// COUNT 越小需要的调用次数越多
+	_, small := scanAll(t, db, "count", "1")
+	_, large := scanAll(t, db, "count", "1000")
+	if small <= large || large != 1 {
+		t.Errorf("count 1 took %d calls, count 1000 took %d calls", small, large)
+	}
+}
+
+func TestScanKeepsExistingKeys(t *testing.T) {
+	db := makeDB()
+	for i := 0; i < 100; i++ {
+		execLine(db, "set keep:"+strconv.Itoa(i)+" v")
+	}
+	// 遍历过程中增删其他 key，一直存在的 key 仍然都要被返回
+	seen := make(map[string]bool)
+	cursor := "0"
+	for i := 0; ; i++ {
+		execLine(db, "set tmp:"+strconv.Itoa(i)+" v")
+		execLine(db, "del tmp:"+strconv.Itoa(i-1))
+		r := db.Exec(nil, toCmdLine("scan", cursor, "count", "5")).(*reply.MultiRawReply)
+		cursor = string(r.Replies[0].(*reply.BulkReply).Arg)
+		for _, key := range r.Replies[1].(*reply.MultiBulkReply).Args {
+			seen[string(key)] = true
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	for i := 0; i < 100; i++ {
+		if !seen["keep:"+strconv.Itoa(i)] {
+			t.Errorf("keep:%d was not returned", i)
+		}
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	db := makeDB()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"scan x", "-ERR invalid cursor\r\n"},
+		{"scan -1", "-ERR invalid cursor\r\n"},
+		{"scan 0 count 0", "-Err syntax error\r\n"},
+		{"scan 0 count x", "-ERR value is not an integer or out of range\r\n"},
+		{"scan 0 match", "-Err syntax error\r\n"},
+		{"scan 0 foo bar", "-Err syntax error\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package database
+
+import (
+	List "go_redis/datastructure/list"
+	"go_redis/interface/database"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"strconv"
+	"strings"
+)
+
+/*
+ * 处理和 list 类型有关的Redis指令
+ * list 会被原地修改，所有指令都通过 lockedExec 在 DB 的锁内执行
+ * 和 Redis 一样，元素被全部弹出后删除这个 key
+ */
+
+// getAsList 返回 key 对应的 list，key 不存在时返回 nil
+func (db *DB) getAsList(key string) (*List.List, reply.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	list, ok := entity.Data.(*List.List)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	db.touchContainer(key, entity)
+	return list, nil
+}
+
+// getOrInitList 返回 key 对应的 list，key 不存在时创建一个空的 list 并写入数据库
+func (db *DB) getOrInitList(key string) (*List.List, reply.ErrorReply) {
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if list == nil {
+		list = List.Make()
+		entity := &database.DataEntity{Data: list}
+		db.PutEntity(key, entity)
+		db.touchContainer(key, entity)
+	}
+	return list, nil
+}
+
+// removeIfEmptyList 在 list 的元素被全部弹出后删除 key
+func (db *DB) removeIfEmptyList(key string, list *List.List) {
+	if list.Len() == 0 {
+		db.Remove(key)
+		db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	}
+}
+
+// listEvent 返回在 list 的一端推入或弹出元素的事件名称，例如 lpush、rpop
+func listEvent(op string, left bool) string {
+	if left {
+		return "l" + op
+	}
+	return "r" + op
+}
+
+func execPushGeneric(db *DB, args [][]byte, left bool) resp.Reply {
+	key := string(args[0])
+	list, errReply := db.getOrInitList(key)
+	if errReply != nil {
+		return errReply
+	}
+	for _, arg := range args[1:] {
+		val := make([]byte, len(arg))
+		copy(val, arg)
+		if left {
+			list.PushFront(val)
+		} else {
+			list.PushBack(val)
+		}
+	}
+	db.signalKeyReady(key)
+	db.notifyKeyspaceEvent(notifyList, listEvent("push", left), key)
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execLPush LPUSH key element [element ...]
+func execLPush(db *DB, args [][]byte) resp.Reply {
+	return execPushGeneric(db, args, true)
+}
+
+// execRPush RPUSH key element [element ...]
+func execRPush(db *DB, args [][]byte) resp.Reply {
+	return execPushGeneric(db, args, false)
+}
+
+func popFromList(list *List.List, left bool) []byte {
+	if left {
+		return list.PopFront()
+	}
+	return list.PopBack()
+}
+
+func execPopGeneric(db *DB, args [][]byte, left bool) resp.Reply {
+	key := string(args[0])
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	count := -1
+	if len(args) == 2 {
+		n, errReply := parseNonNegative(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		count = int(n)
+	}
+	list, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		if count >= 0 {
+			return &reply.NullMultiBulkReply{}
+		}
+		return &reply.NullBulkReply{}
+	}
+	if count < 0 {
+		val := popFromList(list, left)
+		db.notifyKeyspaceEvent(notifyList, listEvent("pop", left), key)
+		db.removeIfEmptyList(key, list)
+		return reply.MakeBulkReply(val)
+	}
+	popped := make([][]byte, 0, count)
+	for len(popped) < count && list.Len() > 0 {
+		popped = append(popped, popFromList(list, left))
+	}
+	if len(popped) > 0 {
+		db.notifyKeyspaceEvent(notifyList, listEvent("pop", left), key)
+	}
+	db.removeIfEmptyList(key, list)
+	return reply.MakeMultiBulkReply(popped)
+}
+
+// execLPop LPOP key [count]
+func execLPop(db *DB, args [][]byte) resp.Reply {
+	return execPopGeneric(db, args, true)
+}
+
+// execRPop RPOP key [count]
+func execRPop(db *DB, args [][]byte) resp.Reply {
+	return execPopGeneric(db, args, false)
+}
+
+// execLLen LLEN key
+func execLLen(db *DB, args [][]byte) resp.Reply {
+	list, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(list.Len()))
+}
+
+// execLRange LRANGE key start stop，下标可以是负数，-1 表示最后一个元素
+func execLRange(db *DB, args [][]byte) resp.Reply {
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	list, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if list == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	from, to, ok := normalizeRange(start, stop, int64(list.Len()))
+	if !ok {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	return reply.MakeMultiBulkReply(list.Range(int(from), int(to)))
+}
+
+// normalizeRange 把可以为负数的闭区间下标 [start, stop] 转换为 [from, to) 的非负下标
+// 区间为空时 ok 为 false
+func normalizeRange(start, stop, size int64) (from, to int64, ok bool) {
+	if start < 0 {
+		start += size
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start > stop || start >= size {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+// parseListDirection 解析 LEFT 或 RIGHT，返回是否为 LEFT
+func parseListDirection(arg []byte) (bool, reply.ErrorReply) {
+	switch strings.ToUpper(string(arg)) {
+	case "LEFT":
+		return true, nil
+	case "RIGHT":
+		return false, nil
+	}
+	return false, reply.MakeSyntaxErrReply()
+}
+
+// lmove 从 src 的一端弹出元素放到 dest 的一端，src 不存在时返回 nil
+func (db *DB) lmove(src, dest string, fromLeft, toLeft bool) ([]byte, reply.ErrorReply) {
+	srcList, errReply := db.getAsList(src)
+	if errReply != nil {
+		return nil, errReply
+	}
+	if srcList == nil {
+		return nil, nil
+	}
+	// 先检查目标的类型，避免弹出元素后才发现无法放入
+	if _, errReply := db.getAsList(dest); errReply != nil {
+		return nil, errReply
+	}
+	val := popFromList(srcList, fromLeft)
+	// 和 Redis 一样先放入 dest 再删除空的 src，src 和 dest 相同时 key 不会被删除后重建
+	destList, _ := db.getOrInitList(dest)
+	if toLeft {
+		destList.PushFront(val)
+	} else {
+		destList.PushBack(val)
+	}
+	db.signalKeyReady(dest)
+	db.notifyKeyspaceEvent(notifyList, listEvent("push", toLeft), dest)
+	db.notifyKeyspaceEvent(notifyList, listEvent("pop", fromLeft), src)
+	db.removeIfEmptyList(src, srcList)
+	return val, nil
+}
+
+// execLMove LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) resp.Reply {
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	val, errReply := db.lmove(string(args[0]), string(args[1]), fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return &reply.NullBulkReply{}
+	}
+	return reply.MakeBulkReply(val)
+}
+
+func execBPopGeneric(db *DB, args [][]byte, left bool) resp.Reply {
+	timeout, errReply := parseBlockTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = string(arg)
+	}
+	for _, key := range keys {
+		list, errReply := db.getAsList(key)
+		if errReply != nil {
+			return errReply
+		}
+		if list == nil {
+			continue
+		}
+		val := popFromList(list, left)
+		db.notifyKeyspaceEvent(notifyList, listEvent("pop", left), key)
+		db.removeIfEmptyList(key, list)
+		return reply.MakeMultiBulkReply([][]byte{[]byte(key), val})
+	}
+	return db.Block(keys, timeout, &reply.NullMultiBulkReply{})
+}
+
+// execBLPop BLPOP key [key ...] timeout
+func execBLPop(db *DB, args [][]byte) resp.Reply {
+	return execBPopGeneric(db, args, true)
+}
+
+// execBRPop BRPOP key [key ...] timeout
+func execBRPop(db *DB, args [][]byte) resp.Reply {
+	return execBPopGeneric(db, args, false)
+}
+
+// execBLMove BLMOVE source destination LEFT|RIGHT LEFT|RIGHT timeout
+func execBLMove(db *DB, args [][]byte) resp.Reply {
+	timeout, errReply := parseBlockTimeout(args[4])
+	if errReply != nil {
+		return errReply
+	}
+	fromLeft, errReply := parseListDirection(args[2])
+	if errReply != nil {
+		return errReply
+	}
+	toLeft, errReply := parseListDirection(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	src := string(args[0])
+	val, errReply := db.lmove(src, string(args[1]), fromLeft, toLeft)
+	if errReply != nil {
+		return errReply
+	}
+	if val == nil {
+		return db.Block([]string{src}, timeout, &reply.NullBulkReply{})
+	}
+	return reply.MakeBulkReply(val)
+}
+
+func init() {
+	RegisterCommand("LPush", lockedExec(execLPush), -3, flagWrite|flagDenyOOM|flagFast).
+		attachKeys(1, 1, 1).attachCategories("list").
+		attachDocs("list", "1.0.0", "Prepends one or more elements to a list. Creates the key if it doesn't exist.")
+	RegisterCommand("RPush", lockedExec(execRPush), -3, flagWrite|flagDenyOOM|flagFast).
+		attachKeys(1, 1, 1).attachCategories("list").
+		attachDocs("list", "1.0.0", "Appends one or more elements to a list. Creates the key if it doesn't exist.")
+	RegisterCommand("LPop", lockedExec(execLPop), -2, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("list").
+		attachDocs("list", "1.0.0", "Returns the first elements in a list after removing it. Deletes the list if the last element was popped.")
+	RegisterCommand("RPop", lockedExec(execRPop), -2, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("list").
+		attachDocs("list", "1.0.0", "Returns and removes the last elements of a list. Deletes the list if the last element was popped.")
+	RegisterCommand("LLen", lockedExec(execLLen), 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).attachCategories("list").
+		attachDocs("list", "1.0.0", "Returns the length of a list.")
+	RegisterCommand("LRange", lockedExec(execLRange), 4, flagReadOnly).
+		attachKeys(1, 1, 1).attachCategories("list").
+		attachDocs("list", "1.0.0", "Returns a range of elements from a list.")
+	RegisterCommand("LMove", lockedExec(execLMove), 5, flagWrite|flagDenyOOM).
+		attachKeys(1, 2, 1).attachCategories("list").
+		attachDocs("list", "6.2.0", "Returns an element after popping it from one list and pushing it to another. Deletes the list if the last element was moved.")
+	RegisterCommand("BLPop", lockedExec(execBLPop), -3, flagWrite|flagNoScript).
+		attachKeys(1, -2, 1).attachCategories("list", "blocking").
+		attachDocs("list", "2.0.0", "Removes and returns the first element in a list. Blocks until an element is available otherwise. Deletes the list if the last element was popped.")
+	RegisterCommand("BRPop", lockedExec(execBRPop), -3, flagWrite|flagNoScript).
+		attachKeys(1, -2, 1).attachCategories("list", "blocking").
+		attachDocs("list", "2.0.0", "Removes and returns the last element in a list. Blocks until an element is available otherwise. Deletes the list if the last element was popped.")
+	RegisterCommand("BLMove", lockedExec(execBLMove), 6, flagWrite|flagDenyOOM|flagNoScript).
+		attachKeys(1, 2, 1).attachCategories("list", "blocking").
+		attachDocs("list", "6.2.0", "Pops an element from a list, pushes it to another list and returns it. Blocks until an element is available otherwise. Deletes the list if the last element was moved.")
+}
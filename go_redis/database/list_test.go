@@ -0,0 +1,35 @@
+package database
+
+import "testing"
+
+func TestListCommands(t *testing.T) {
+	db := makeDB()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"rpush l a b c", ":3\r\n"},
+		{"lpush l z", ":4\r\n"},
+		{"lrange l 0 -1", "*4\r\n$1\r\nz\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"lrange l -2 100", "*2\r\n$1\r\nb\r\n$1\r\nc\r\n"},
+		{"lrange l 3 1", "*0\r\n"},
+		{"llen l", ":4\r\n"},
+		{"lpop l", "$1\r\nz\r\n"},
+		{"rpop l 2", "*2\r\n$1\r\nc\r\n$1\r\nb\r\n"},
+		{"lmove l dst left right", "$1\r\na\r\n"},
+		{"exists l", ":0\r\n"},
+		{"lpop l", "$-1\r\n"},
+		{"lpop l 1", "*-1\r\n"},
+		{"type dst", "+list\r\n"},
+		{"set str v", "+OK\r\n"},
+		{"lpush str a", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"lmove dst str left left", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"llen dst", ":1\r\n"},
+		{"lmove dst dst up left", "-Err syntax error\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package database
+
+import (
+	"go_redis/config"
+	"go_redis/lib/metrics"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * 按指令类型统计调用次数和耗时，并以 Prometheus 的格式导出服务端的运行指标
+ */
+
+// latencyBuckets 是指令耗时直方图的桶的上界，单位秒
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// commandStat 是一种指令的调用次数和耗时分布
+type commandStat struct {
+	calls int64
+	// 累计耗时，单位纳秒
+	totalNanos int64
+	// buckets[i] 是耗时落在第 i 个桶中的调用次数，最后一个元素是超过所有上界的调用次数
+	buckets []uint64
+}
+
+// commandStats 保存每种指令的 commandStat
+type commandStats struct {
+	mu    sync.RWMutex
+	stats map[string]*commandStat
+}
+
+// record 记录一次指令调用
+func (cs *commandStats) record(cmdName string, duration time.Duration) {
+	cs.mu.RLock()
+	stat, ok := cs.stats[cmdName]
+	cs.mu.RUnlock()
+	if !ok {
+		cs.mu.Lock()
+		if cs.stats == nil {
+			cs.stats = make(map[string]*commandStat)
+		}
+		stat, ok = cs.stats[cmdName]
+		if !ok {
+			stat = &commandStat{
+				buckets: make([]uint64, len(latencyBuckets)+1),
+			}
+			cs.stats[cmdName] = stat
+		}
+		cs.mu.Unlock()
+	}
+
+	atomic.AddInt64(&stat.calls, 1)
+	atomic.AddInt64(&stat.totalNanos, int64(duration))
+	seconds := duration.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	atomic.AddUint64(&stat.buckets[i], 1)
+}
+
+// WriteMetrics 以 Prometheus 的格式导出服务端的运行指标
+func (mdb *Database) WriteMetrics(w *metrics.Writer) {
+	connected := 0
+	if mdb.clientCounter != nil {
+		connected = mdb.clientCounter()
+	}
+	w.Gauge("go_redis_uptime_seconds", "Number of seconds since the server started.",
+		mdb.stats.uptime().Seconds())
+	w.Gauge("go_redis_connected_clients", "Number of client connections.", float64(connected))
+	w.Counter("go_redis_commands_processed_total", "Total number of commands processed.",
+		float64(mdb.stats.commandsProcessed()))
+
+	mdb.cmdStats.mu.RLock()
+	names := make([]string, 0, len(mdb.cmdStats.stats))
+	for name := range mdb.cmdStats.stats {
+		names = append(names, name)
+	}
+	mdb.cmdStats.mu.RUnlock()
+	sort.Strings(names)
+	stats := make([]*commandStat, len(names))
+	mdb.cmdStats.mu.RLock()
+	for i, name := range names {
+		stats[i] = mdb.cmdStats.stats[name]
+	}
+	mdb.cmdStats.mu.RUnlock()
+	// 同一个指标的所有样本必须写在一起，所以分两次遍历
+	for i, stat := range stats {
+		w.Counter("go_redis_command_calls_total", "Number of calls per command.",
+			float64(atomic.LoadInt64(&stat.calls)), metrics.Label{Name: "cmd", Value: names[i]})
+	}
+	for i, stat := range stats {
+		counts := make([]uint64, len(stat.buckets))
+		for j := range stat.buckets {
+			counts[j] = atomic.LoadUint64(&stat.buckets[j])
+		}
+		w.Histogram("go_redis_command_duration_seconds", "Time spent executing each command.",
+			latencyBuckets, counts, time.Duration(atomic.LoadInt64(&stat.totalNanos)).Seconds(),
+			metrics.Label{Name: "cmd", Value: names[i]})
+	}
+
+	var hits, misses int64
+	// SWAPDB 会交换 DB 中的数据，读取前需要持有读锁
+	mdb.dbLock.RLock()
+	for _, db := range mdb.dbSet {
+		hits += atomic.LoadInt64(&db.hits)
+		misses += atomic.LoadInt64(&db.misses)
+		w.Gauge("go_redis_db_keys", "Number of keys per database.", float64(db.data.Len()),
+			metrics.Label{Name: "db", Value: strconv.Itoa(db.index)})
+	}
+	mdb.dbLock.RUnlock()
+	w.Counter("go_redis_keyspace_hits_total", "Number of successful key lookups.", float64(hits))
+	w.Counter("go_redis_keyspace_misses_total", "Number of failed key lookups.", float64(misses))
+	w.Counter("go_redis_evicted_keys_total", "Number of keys evicted because of the maxmemory limit.",
+		float64(atomic.LoadInt64(&mdb.evictedKeys)))
+
+	w.Gauge("go_redis_memory_used_bytes", "Estimated memory used by keys and values.",
+		float64(mdb.UsedMemory()))
+	w.Gauge("go_redis_memory_max_bytes", "Value of the maxmemory setting, 0 means no limit.",
+		float64(config.Properties().MaxMemory))
+
+	aofEnabled := 0.0
+	if config.Properties().AppendOnly {
+		aofEnabled = 1
+	}
+	w.Gauge("go_redis_aof_enabled", "Whether appendonly is enabled in the config.", aofEnabled)
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"go_redis/lib/metrics"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandStatsBuckets(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		bucket   int
+	}{
+		{50 * time.Microsecond, 0},
+		{100 * time.Microsecond, 0},
+		{200 * time.Microsecond, 1},
+		{3 * time.Millisecond, 3},
+		{time.Second, len(latencyBuckets) - 1},
+		{2 * time.Second, len(latencyBuckets)},
+	}
+	for _, tt := range tests {
+		cs := &commandStats{}
+		cs.record("get", tt.duration)
+		stat := cs.stats["get"]
+		for i, count := range stat.buckets {
+			want := uint64(0)
+			if i == tt.bucket {
+				want = 1
+			}
+			if count != want {
+				t.Errorf("%v: bucket %d has %d observations, want %d", tt.duration, i, count, want)
+			}
+		}
+		if stat.calls != 1 || stat.totalNanos != int64(tt.duration) {
+			t.Errorf("%v: calls %d, total %d", tt.duration, stat.calls, stat.totalNanos)
+		}
+	}
+}
+
+func TestWriteMetrics(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	mdb.SetClientCounter(func() int { return 2 })
+	for _, line := range []string{"set a 1", "get a", "get b", "GET a", "select 1", "nosuchcommand x"} {
+		execMdb(mdb, line)
+	}
+
+	w := metrics.NewWriter()
+	mdb.WriteMetrics(w)
+	out := string(w.Bytes())
+	tests := []struct {
+		sample string
+		want   bool
+	}{
+		{"go_redis_connected_clients 2\n", true},
+		{"go_redis_commands_processed_total 6\n", true},
+		{`go_redis_command_calls_total{cmd="get"} 3` + "\n", true},
+		{`go_redis_command_calls_total{cmd="set"} 1` + "\n", true},
+		{`go_redis_command_calls_total{cmd="select"} 1` + "\n", true},
+		{`go_redis_command_duration_seconds_count{cmd="get"} 3` + "\n", true},
+		// 不存在的指令不会被统计
+		{`cmd="nosuchcommand"`, false},
+		{`go_redis_db_keys{db="0"} 1` + "\n", true},
+		{`go_redis_db_keys{db="1"} 0` + "\n", true},
+		{"go_redis_keyspace_hits_total 2\n", true},
+		{"go_redis_keyspace_misses_total 1\n", true},
+		{"go_redis_aof_enabled 0\n", true},
+	}
+	for _, tt := range tests {
+		if strings.Contains(out, tt.sample) != tt.want {
+			t.Errorf("metrics contain %q: %v, want %v\n%s", tt.sample, !tt.want, tt.want, out)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"go_redis/client"
+	"go_redis/interface/database"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * MIGRATE：通过 DUMP 序列化 key，再在目标服务端上用 RESTORE 恢复，成功后删除本地的 key
+ * 目标服务端可以是 go_redis 或Redis官方的服务端，通过 client 包建立连接
+ *
+ * 和 SWAPDB 一样由 Database 直接执行，只在序列化和删除 key 时持有 dbLock 的读锁，网络读写期间不持有锁：
+ * 读写可能持续到超时，等待写锁的 SWAPDB 和 FLUSHALL 会让之后的所有指令都等待读锁，
+ * 迁移到自身时目标服务端执行 RESTORE 也需要读锁，会和这条指令互相等待。
+ * 网络读写期间 key 可能被其他指令修改，删除时只删除值仍然是迁移出去的值的 key
+ */
+
+// defaultMigrateTimeout 是 timeout 参数为0时使用的超时时间，和Redis相同
+const defaultMigrateTimeout = time.Second
+
+// execMigrate 把 key 迁移到另一个服务端
+// MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [AUTH password] [AUTH2 username password] [KEYS key [key ...]]
+func execMigrate(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	host, port := string(args[0]), string(args[1])
+	destDB, err := strconv.Atoi(string(args[3]))
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	timeout, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	copyOnly, replace := false, false
+	var username, password string
+	keys := args[2:3]
+	for i := 5; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "copy":
+			copyOnly = true
+		case "replace":
+			replace = true
+		case "auth":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			password = string(args[i+1])
+			i++
+		case "auth2":
+			if i+2 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			username, password = string(args[i+1]), string(args[i+2])
+			i += 2
+		case "keys":
+			if len(args[2]) != 0 {
+				return reply.MakeErrReply("ERR When using MIGRATE KEYS option, the key argument must be set to the empty string")
+			}
+			// KEYS 之后的参数都是 key
+			keys = args[i+1:]
+			i = len(args)
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	timeoutDuration := time.Duration(timeout) * time.Millisecond
+	if timeoutDuration <= 0 {
+		timeoutDuration = defaultMigrateTimeout
+	}
+
+	// 只迁移存在的 key，都不存在时返回 NOKEY
+	present := make([]string, 0, len(keys))
+	entities := make([]*database.DataEntity, 0, len(keys))
+	payloads := make([][]byte, 0, len(keys))
+	mdb.dbLock.RLock()
+	db := mdb.dbSet[c.GetDBIndex()]
+	for _, arg := range keys {
+		key := string(arg)
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			continue
+		}
+		payload := dumpEntity(entity)
+		if payload == nil {
+			mdb.dbLock.RUnlock()
+			return makeDumpUnsupportedErrReply(key)
+		}
+		present = append(present, key)
+		entities = append(entities, entity)
+		payloads = append(payloads, payload)
+	}
+	mdb.dbLock.RUnlock()
+	if len(present) == 0 {
+		return reply.MakeStatusReply("NOKEY")
+	}
+
+	cli := client.NewClient(client.Options{
+		Addr:         net.JoinHostPort(host, port),
+		Username:     username,
+		Password:     password,
+		DB:           destDB,
+		PoolSize:     1,
+		DialTimeout:  timeoutDuration,
+		ReadTimeout:  timeoutDuration,
+		WriteTimeout: timeoutDuration,
+		// 写入一部分后失败时无法确定目标服务端执行了哪些 RESTORE，不能重试
+		MaxRetries: -1,
+	})
+	defer func() {
+		_ = cli.Close()
+	}()
+	pipeline := cli.Pipeline()
+	for i, key := range present {
+		if replace {
+			pipeline.Do("RESTORE", key, 0, payloads[i], "REPLACE")
+		} else {
+			pipeline.Do("RESTORE", key, 0, payloads[i])
+		}
+	}
+	replies, err := pipeline.Exec(context.Background())
+	if err != nil {
+		var errReply reply.ErrorReply
+		if errors.As(err, &errReply) {
+			// 建立连接时 AUTH 或 SELECT 失败
+			return reply.MakeErrReply("ERR Target instance replied with error: " + errReply.Error())
+		}
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return reply.MakeErrReply("IOERR error or timeout connecting to the client")
+		}
+		return reply.MakeErrReply("IOERR error or timeout reading to target instance")
+	}
+	// 目标服务端恢复失败的 key 保留在本地，其他的 key 仍然删除
+	mdb.dbLock.RLock()
+	defer mdb.dbLock.RUnlock()
+	var firstErr reply.ErrorReply
+	for i, r := range replies {
+		if errReply, ok := r.(reply.ErrorReply); ok {
+			if firstErr == nil {
+				firstErr = errReply
+			}
+			continue
+		}
+		// 迁移期间被覆盖或删除的 key 保留本地的新值
+		if !copyOnly && db.removeIfSame(present[i], entities[i]) > 0 {
+			db.notifyKeyspaceEvent(notifyGeneric, "del", present[i])
+		}
+	}
+	if firstErr != nil {
+		return reply.MakeErrReply("ERR Target instance replied with error: " + firstErr.Error())
+	}
+	return &reply.OkReply{}
+}
+
+// migrateKeys 返回 MIGRATE 指令迁移的 key，cmdLine 包括指令名
+func migrateKeys(cmdLine CmdLine) [][]byte {
+	if len(cmdLine) > 3 && len(cmdLine[3]) > 0 {
+		return cmdLine[3:4]
+	}
+	for i := 6; i < len(cmdLine); i++ {
+		switch strings.ToLower(string(cmdLine[i])) {
+		case "auth":
+			i++
+		case "auth2":
+			i += 2
+		case "keys":
+			return cmdLine[i+1:]
+		}
+	}
+	return nil
+}
+
+func init() {
+	registerServerCommand("Migrate", -6, flagWrite|flagRandom).
+		attachKeys(3, 3, 1).attachKeysFunc(migrateKeys).attachCategories("keyspace", "dangerous").
+		attachDocs("generic", "2.6.0", "Atomically transfers a key from one Redis instance to another.")
+}
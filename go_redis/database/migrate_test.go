@@ -0,0 +1,188 @@
+package database
+
+import (
+	"go_redis/resp/connection"
+	"go_redis/resp/parser"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveDatabase 在 127.0.0.1 的随机端口上用 mdb 执行收到的指令，作为 MIGRATE 的目标服务端，
+// beforeReply 不为空时在回复每条指令之前调用，返回服务端的端口
+func serveDatabase(t *testing.T, mdb *Database, beforeReply func(cmdLine CmdLine)) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				c := connection.NewFakeConn()
+				reader := parser.NewReader(conn)
+				for {
+					args, err := reader.ReadCommand()
+					if err != nil {
+						return
+					}
+					cmdLine := copyCmdLine(args)
+					result := mdb.Exec(c, cmdLine)
+					if beforeReply != nil {
+						beforeReply(cmdLine)
+					}
+					if _, err := conn.Write(result.ToBytes()); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+func TestMigrate(t *testing.T) {
+	src, dest := NewDatabase(), NewDatabase()
+	defer src.Close()
+	defer dest.Close()
+	port := serveDatabase(t, dest, nil)
+	c := connection.NewFakeConn()
+	src.Exec(c, toCmdLine("set", "a", "1"))
+	src.Exec(c, toCmdLine("set", "b", "2"))
+	src.Exec(c, toCmdLine("set", "c", "3"))
+	src.Exec(c, toCmdLine("rpush", "list", "x", "y"))
+	src.Exec(c, toCmdLine("xadd", "stream", "*", "f", "v"))
+
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"migrate", "127.0.0.1", port, "a", "0", "1000"}, "+OK\r\n"},
+		{[]string{"migrate", "127.0.0.1", port, "missing", "0", "1000"}, "+NOKEY\r\n"},
+		{[]string{"migrate", "127.0.0.1", port, "", "0", "1000", "copy", "keys", "b", "missing"}, "+OK\r\n"},
+		{[]string{"migrate", "127.0.0.1", port, "b", "0", "1000"}, "-ERR Target instance replied with error: BUSYKEY Target key name already exists.\r\n"},
+		{[]string{"migrate", "127.0.0.1", port, "b", "0", "1000", "replace"}, "+OK\r\n"},
+		{[]string{"migrate", "127.0.0.1", port, "c", "1", "1000"}, "+OK\r\n"},
+		{[]string{"migrate", "127.0.0.1", port, "list", "0", "1000"}, "+OK\r\n"},
+		// 无法序列化的 key 不会被当作不存在
+		{[]string{"migrate", "127.0.0.1", port, "stream", "0", "1000"}, "-ERR DUMP is not supported for the type of key 'stream'\r\n"},
+	}
+	for _, tc := range cases {
+		if got := string(src.Exec(c, toCmdLine(tc.args...)).ToBytes()); got != tc.want {
+			t.Fatalf("%q: got %q, want %q", strings.Join(tc.args, " "), got, tc.want)
+		}
+	}
+
+	destConn := connection.NewFakeConn()
+	for key, want := range map[string]string{"a": "$1\r\n1\r\n", "b": "$1\r\n2\r\n", "c": "$-1\r\n"} {
+		if got := string(dest.Exec(destConn, toCmdLine("get", key)).ToBytes()); got != want {
+			t.Errorf("target db 0 GET %s: got %q, want %q", key, got, want)
+		}
+	}
+	if got := string(dest.Exec(destConn, toCmdLine("lrange", "list", "0", "-1")).ToBytes()); got != "*2\r\n$1\r\nx\r\n$1\r\ny\r\n" {
+		t.Errorf("target LRANGE list: got %q", got)
+	}
+	destConn.SelectDB(1)
+	if got := string(dest.Exec(destConn, toCmdLine("get", "c")).ToBytes()); got != "$1\r\n3\r\n" {
+		t.Errorf("target db 1 GET c: got %q", got)
+	}
+	if got := string(src.Exec(c, toCmdLine("exists", "a", "b", "c")).ToBytes()); got != ":0\r\n" {
+		t.Errorf("migrated keys still exist locally: EXISTS got %q", got)
+	}
+}
+
+func TestMigrateToSelf(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	port := serveDatabase(t, mdb, nil)
+	c := connection.NewFakeConn()
+	mdb.Exec(c, toCmdLine("set", "k", "v"))
+
+	done := make(chan string, 1)
+	go func() {
+		done <- string(mdb.Exec(c, toCmdLine("migrate", "127.0.0.1", port, "k", "1", "1000")).ToBytes())
+	}()
+	select {
+	case got := <-done:
+		if got != "+OK\r\n" {
+			t.Fatalf("got %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("MIGRATE to the same server did not finish")
+	}
+	c.SelectDB(1)
+	if got := string(mdb.Exec(c, toCmdLine("get", "k")).ToBytes()); got != "$1\r\nv\r\n" {
+		t.Fatalf("GET in db 1 got %q", got)
+	}
+}
+
+func TestMigrateDoesNotHoldLockDuringIO(t *testing.T) {
+	src, dest := NewDatabase(), NewDatabase()
+	defer src.Close()
+	defer dest.Close()
+	// 目标服务端回复之前，SWAPDB 等待写锁，GET 在它之后执行
+	unblock := make(chan struct{})
+	port := serveDatabase(t, dest, func(CmdLine) { <-unblock })
+	c := connection.NewFakeConn()
+	src.Exec(c, toCmdLine("set", "k", "v"))
+
+	migrated := make(chan string, 1)
+	go func() {
+		migrated <- string(src.Exec(c, toCmdLine("migrate", "127.0.0.1", port, "k", "0", "5000")).ToBytes())
+	}()
+	// 等待 MIGRATE 开始网络读写
+	time.Sleep(50 * time.Millisecond)
+	others := make(chan struct{})
+	go func() {
+		other := connection.NewFakeConn()
+		src.Exec(other, toCmdLine("swapdb", "2", "3"))
+		src.Exec(other, toCmdLine("get", "k"))
+		close(others)
+	}()
+	select {
+	case <-others:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SWAPDB and GET waited for MIGRATE's network I/O")
+	}
+	close(unblock)
+	if got := <-migrated; got != "+OK\r\n" {
+		t.Fatalf("MIGRATE got %q", got)
+	}
+}
+
+func TestMigrateKeepsKeyOverwrittenDuringIO(t *testing.T) {
+	src, dest := NewDatabase(), NewDatabase()
+	defer src.Close()
+	defer dest.Close()
+	writer := connection.NewFakeConn()
+	// 目标服务端执行 RESTORE 之后、回复之前，本地的 key 被覆盖
+	port := serveDatabase(t, dest, func(cmdLine CmdLine) {
+		if strings.EqualFold(string(cmdLine[0]), "restore") {
+			src.Exec(writer, toCmdLine("set", string(cmdLine[1]), "new"))
+		}
+	})
+	c := connection.NewFakeConn()
+	src.Exec(c, toCmdLine("set", "k", "old"))
+	src.Exec(c, toCmdLine("set", "other", "x"))
+
+	got := string(src.Exec(c, toCmdLine("migrate", "127.0.0.1", port, "", "0", "1000", "keys", "k")).ToBytes())
+	if got != "+OK\r\n" {
+		t.Fatalf("MIGRATE got %q", got)
+	}
+	if got := string(src.Exec(c, toCmdLine("get", "k")).ToBytes()); got != "$3\r\nnew\r\n" {
+		t.Fatalf("the value written during MIGRATE was removed, GET got %q", got)
+	}
+	if got := string(dest.Exec(connection.NewFakeConn(), toCmdLine("get", "k")).ToBytes()); got != "$3\r\nold\r\n" {
+		t.Fatalf("target GET got %q", got)
+	}
+}
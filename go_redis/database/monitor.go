@@ -0,0 +1,239 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * MONITOR 指令：执行过 MONITOR 的客户端会收到之后所有客户端执行的每一条指令。
+ * 每个 monitor 有一个带缓冲的 Channel 和一个专门向它发送消息的协程，
+ * 执行指令的协程只向 Channel 中投递消息，Channel 满了就丢弃消息，
+ * 所以一个读得很慢的 monitor 不会拖慢其他客户端
+ */
+
+// monitorBufferSize 是每个 monitor 最多缓存的还未发送的消息数量
+const monitorBufferSize = 1024
+
+// monitor 是一个执行了 MONITOR 指令的客户端
+type monitor struct {
+	conn resp.Connection
+	ch   chan []byte
+	// 因为 Channel 已满被丢弃的消息数量
+	dropped int64
+}
+
+// monitorSet 保存所有的 monitor
+type monitorSet struct {
+	mu       sync.RWMutex
+	monitors map[resp.Connection]*monitor
+	// monitor 的数量，没有 monitor 时执行指令不需要加锁
+	count int32
+}
+
+// add 将客户端注册为 monitor，并启动向它发送消息的协程
+// 对 MONITOR 指令的回复 ok 也通过 monitor 的 Channel 发送，保证客户端先收到它再收到其他指令
+func (set *monitorSet) add(c resp.Connection, ok []byte) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	if set.monitors == nil {
+		set.monitors = make(map[resp.Connection]*monitor)
+	}
+	if m, exists := set.monitors[c]; exists {
+		select {
+		case m.ch <- ok:
+		default:
+			atomic.AddInt64(&m.dropped, 1)
+		}
+		return
+	}
+	m := &monitor{
+		conn: c,
+		ch:   make(chan []byte, monitorBufferSize),
+	}
+	// 注册之前 Channel 是空的，一定放得下
+	m.ch <- ok
+	set.monitors[c] = m
+	atomic.AddInt32(&set.count, 1)
+	go m.serve()
+}
+
+// remove 在客户端断开连接时取消它的 monitor 身份
+func (set *monitorSet) remove(c resp.Connection) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+	m, ok := set.monitors[c]
+	if !ok {
+		return
+	}
+	delete(set.monitors, c)
+	atomic.AddInt32(&set.count, -1)
+	close(m.ch)
+}
+
+// feed 将一条指令发送给所有的 monitor，不会阻塞
+func (set *monitorSet) feed(c resp.Connection, cmdLine CmdLine) {
+	if atomic.LoadInt32(&set.count) == 0 {
+		return
+	}
+	msg := formatMonitorLine(c, redactArgs(cmdLine))
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	for _, m := range set.monitors {
+		select {
+		case m.ch <- msg:
+		default:
+			atomic.AddInt64(&m.dropped, 1)
+		}
+	}
+}
+
+// serve 将 Channel 中的消息发送给 monitor，直到 Channel 被关闭
+func (m *monitor) serve() {
+	for msg := range m.ch {
+		if err := m.conn.Write(msg); err != nil {
+			// 连接已经断开，丢弃剩余的消息，等待 AfterClientClose 关闭 Channel
+			for range m.ch {
+			}
+			return
+		}
+	}
+}
+
+// redactedArg 替换发送给 monitor 的密码参数
+var redactedArg = []byte("(redacted)")
+
+// sensitiveConfigs 是 CONFIG SET 时需要隐藏值的配置项
+var sensitiveConfigs = map[string]bool{
+	"requirepass": true,
+	"masterauth":  true,
+}
+
+// redactArgs 和Redis一样隐藏指令中的密码，需要隐藏时返回修改后的副本，不修改 cmdLine
+func redactArgs(cmdLine CmdLine) CmdLine {
+	var redacted CmdLine
+	redact := func(i int) {
+		if i >= len(cmdLine) {
+			return
+		}
+		if redacted == nil {
+			redacted = make(CmdLine, len(cmdLine))
+			copy(redacted, cmdLine)
+		}
+		redacted[i] = redactedArg
+	}
+	switch strings.ToLower(string(cmdLine[0])) {
+	case "auth":
+		for i := 1; i < len(cmdLine); i++ {
+			redact(i)
+		}
+	case "hello":
+		for i := 2; i < len(cmdLine); i++ {
+			if strings.EqualFold(string(cmdLine[i]), "auth") {
+				redact(i + 1)
+				redact(i + 2)
+				i += 2
+			}
+		}
+	case "config":
+		if len(cmdLine) > 1 && strings.EqualFold(string(cmdLine[1]), "set") {
+			for i := 2; i+1 < len(cmdLine); i += 2 {
+				if sensitiveConfigs[strings.ToLower(string(cmdLine[i]))] {
+					redact(i + 1)
+				}
+			}
+		}
+	case "migrate":
+		for i := 6; i < len(cmdLine); i++ {
+			switch strings.ToLower(string(cmdLine[i])) {
+			case "auth":
+				redact(i + 1)
+				i++
+			case "auth2":
+				redact(i + 2)
+				i += 2
+			case "keys":
+				i = len(cmdLine)
+			}
+		}
+	}
+	if redacted == nil {
+		return cmdLine
+	}
+	return redacted
+}
+
+// formatMonitorLine 生成发送给 monitor 的消息，格式和Redis官方相同：
+// +1339518083.107412 [0 127.0.0.1:60866] "keys" "*"
+func formatMonitorLine(c resp.Connection, cmdLine CmdLine) []byte {
+	now := time.Now()
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("+%d.%06d [", now.Unix(), now.Nanosecond()/1000))
+	if c != nil {
+		buf.WriteString(strconv.Itoa(c.GetDBIndex()))
+		if addr := c.RemoteAddr(); addr != nil {
+			buf.WriteString(" " + addr.String())
+		}
+	}
+	buf.WriteString("]")
+	for _, arg := range cmdLine {
+		buf.WriteByte(' ')
+		writeQuoted(&buf, arg)
+	}
+	buf.WriteString(reply.CRLF)
+	return buf.Bytes()
+}
+
+// writeQuoted 将参数加上双引号写入 buf，并转义其中的特殊字符和不可打印字符
+func writeQuoted(buf *bytes.Buffer, arg []byte) {
+	buf.WriteByte('"')
+	for _, c := range arg {
+		switch c {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString("\\n")
+		case '\r':
+			buf.WriteString("\\r")
+		case '\t':
+			buf.WriteString("\\t")
+		case '\a':
+			buf.WriteString("\\a")
+		case '\b':
+			buf.WriteString("\\b")
+		default:
+			if c < 0x20 || c > 0x7e {
+				buf.WriteString(fmt.Sprintf("\\x%02x", c))
+			} else {
+				buf.WriteByte(c)
+			}
+		}
+	}
+	buf.WriteByte('"')
+}
+
+// execMonitor MONITOR
+// +OK 由 monitor 的发送协程发出，注册之后其他客户端的指令不会先于它到达
+func execMonitor(mdb *Database, c resp.Connection) resp.Reply {
+	mdb.monitors.add(c, reply.MakeOkReply().ToBytes())
+	return &reply.NoReply{}
+}
+
+// contains 判断客户端是否是 monitor
+func (set *monitorSet) contains(c resp.Connection) bool {
+	if atomic.LoadInt32(&set.count) == 0 {
+		return false
+	}
+	set.mu.RLock()
+	defer set.mu.RUnlock()
+	_, ok := set.monitors[c]
+	return ok
+}
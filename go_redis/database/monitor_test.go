@@ -0,0 +1,84 @@
+package database
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordingConn 记录发给客户端的数据
+type recordingConn struct {
+	*blockingConn
+	mu      sync.Mutex
+	written []string
+}
+
+func (c *recordingConn) Write(b []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.written = append(c.written, string(b))
+	return nil
+}
+
+func (c *recordingConn) messages() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.written...)
+}
+
+func TestMonitorRepliesOKFirst(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	mon := &recordingConn{blockingConn: &blockingConn{}}
+	if r := mdb.Exec(mon, toCmdLine("monitor")); len(r.ToBytes()) != 0 {
+		t.Fatalf("MONITOR reply %q should be sent by the monitor itself", r.ToBytes())
+	}
+	mdb.Exec(&blockingConn{}, toCmdLine("set", "key", "value"))
+
+	deadline := time.Now().Add(time.Second)
+	for len(mon.messages()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	msgs := mon.messages()
+	if len(msgs) != 2 {
+		t.Fatalf("got %q", msgs)
+	}
+	if msgs[0] != "+OK\r\n" || !strings.HasSuffix(msgs[1], `"set" "key" "value"`+"\r\n") {
+		t.Fatalf("got %q, want +OK followed by the SET", msgs)
+	}
+	mdb.AfterClientClose(mon)
+}
+
+func TestRedactArgs(t *testing.T) {
+	cases := []struct {
+		cmdLine []string
+		want    string
+	}{
+		{[]string{"auth", "secret"}, "auth (redacted)"},
+		{[]string{"AUTH", "user", "secret"}, "AUTH (redacted) (redacted)"},
+		{[]string{"hello", "3", "auth", "user", "secret", "setname", "x"}, "hello 3 auth (redacted) (redacted) setname x"},
+		{[]string{"config", "set", "requirepass", "secret"}, "config set requirepass (redacted)"},
+		{[]string{"config", "set", "maxclients", "10", "masterauth", "secret"}, "config set maxclients 10 masterauth (redacted)"},
+		{[]string{"config", "get", "requirepass"}, "config get requirepass"},
+		{[]string{"migrate", "h", "1", "", "0", "100", "auth2", "user", "secret", "keys", "auth"}, "migrate h 1  0 100 auth2 user (redacted) keys auth"},
+		{[]string{"set", "auth", "secret"}, "set auth secret"},
+	}
+	for _, c := range cases {
+		cmdLine := toCmdLine(c.cmdLine...)
+		if got := joinCmdLine(redactArgs(cmdLine)); got != c.want {
+			t.Errorf("redactArgs(%q) = %q, want %q", c.cmdLine, got, c.want)
+		}
+		if joinCmdLine(cmdLine) != strings.Join(c.cmdLine, " ") {
+			t.Errorf("redactArgs modified its input %q", c.cmdLine)
+		}
+	}
+}
+
+func joinCmdLine(cmdLine CmdLine) string {
+	parts := make([]string, len(cmdLine))
+	for i, arg := range cmdLine {
+		parts[i] = string(arg)
+	}
+	return strings.Join(parts, " ")
+}
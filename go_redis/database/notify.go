@@ -0,0 +1,93 @@
+package database
+
+import (
+	"go_redis/config"
+	"strconv"
+)
+
+/*
+ * 键空间通知：key 被修改时通过发布订阅发送消息，由 notify-keyspace-events 配置开启
+ * __keyspace@<db>__:<key> 频道的消息内容是事件名称
+ * __keyevent@<db>__:<event> 频道的消息内容是 key
+ */
+
+// 键空间通知的类型，和 notify-keyspace-events 中的字符一一对应
+const (
+	notifyKeyspace = 1 << iota // K
+	notifyKeyevent             // E
+	notifyGeneric              // g
+	notifyString               // $
+	notifyList                 // l
+	notifySet                  // s
+	notifyHash                 // h
+	notifyZSet                 // z
+	notifyExpired              // x
+	notifyEvicted              // e
+	notifyStream               // t
+	notifyKeyMiss              // m
+	notifyNew                  // n
+
+	// notifyAll 是 A 代表的类型，不包括 K E m n
+	notifyAll = notifyGeneric | notifyString | notifyList | notifySet | notifyHash |
+		notifyZSet | notifyExpired | notifyEvicted | notifyStream
+)
+
+// keyspaceEventFlags 将 notify-keyspace-events 的配置解析为类型标志位
+func keyspaceEventFlags(classes string) int {
+	flags := 0
+	for _, c := range classes {
+		switch c {
+		case 'A':
+			flags |= notifyAll
+		case 'g':
+			flags |= notifyGeneric
+		case '$':
+			flags |= notifyString
+		case 'l':
+			flags |= notifyList
+		case 's':
+			flags |= notifySet
+		case 'h':
+			flags |= notifyHash
+		case 'z':
+			flags |= notifyZSet
+		case 'x':
+			flags |= notifyExpired
+		case 'e':
+			flags |= notifyEvicted
+		case 'K':
+			flags |= notifyKeyspace
+		case 'E':
+			flags |= notifyKeyevent
+		case 't':
+			flags |= notifyStream
+		case 'm':
+			flags |= notifyKeyMiss
+		case 'n':
+			flags |= notifyNew
+		}
+	}
+	return flags
+}
+
+// notifyKeyspaceEvent 在 key 发生 event 事件后发送键空间通知，class 是事件的类型
+func (db *DB) notifyKeyspaceEvent(class int, event string, key string) {
+	if db.hub == nil {
+		return
+	}
+	classes := config.Properties().NotifyKeyspaceEvents
+	if classes == "" {
+		return
+	}
+	flags := keyspaceEventFlags(classes)
+	if flags&class == 0 || !db.hub.hasSubscribers() {
+		return
+	}
+	dbIndex := strconv.Itoa(db.index)
+	if flags&notifyKeyspace > 0 {
+		db.hub.publish("__keyspace@"+dbIndex+"__:"+key, []byte(event))
+	}
+	if flags&notifyKeyevent > 0 {
+		db.hub.publish("__keyevent@"+dbIndex+"__:"+event, []byte(key))
+	}
+}
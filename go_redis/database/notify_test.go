@@ -0,0 +1,94 @@
+package database
+
+import (
+	"go_redis/config"
+	"strings"
+	"testing"
+)
+
+func TestKeyspaceEventFlags(t *testing.T) {
+	tests := []struct {
+		classes string
+		want    int
+	}{
+		{"", 0},
+		{"KEA", notifyKeyspace | notifyKeyevent | notifyAll},
+		{"Kl", notifyKeyspace | notifyList},
+		{"Ez$g", notifyKeyevent | notifyZSet | notifyString | notifyGeneric},
+		{"Atmn", notifyAll | notifyStream | notifyKeyMiss | notifyNew},
+		{"K?", notifyKeyspace},
+	}
+	for _, tt := range tests {
+		if got := keyspaceEventFlags(tt.classes); got != tt.want {
+			t.Errorf("%q: got %b, want %b", tt.classes, got, tt.want)
+		}
+	}
+}
+
+// keyspaceEvents 从订阅了 __keyspace@0__:* 的客户端收到的消息中取出 "key event" 列表
+func keyspaceEvents(c *recordingConn) []string {
+	events := make([]string, 0)
+	for _, msg := range c.messages() {
+		// *4 pmessage pattern channel event
+		lines := strings.Split(msg, "\r\n")
+		if len(lines) < 9 || lines[2] != "pmessage" {
+			continue
+		}
+		key := strings.TrimPrefix(lines[6], "__keyspace@0__:")
+		events = append(events, key+" "+lines[8])
+	}
+	return events
+}
+
+func TestKeyspaceNotifications(t *testing.T) {
+	old := config.Properties()
+	defer config.Update(func(props *config.ServerProperties) {
+		*props = *old
+	})
+	tests := []struct {
+		name    string
+		classes string
+		cmds    []string
+		want    []string
+	}{
+		{"disabled", "", []string{"set k v"}, nil},
+		{"keyevent only", "E$", []string{"set k v"}, nil},
+		{"string", "K$", []string{"set k v", "get k"}, []string{"k set"}},
+		{"generic", "Kg", []string{"set a 1", "rename a b", "del b"}, []string{"a rename_from", "b rename_to", "b del"}},
+		{"new key", "Kn$", []string{"set k v", "set k w"}, []string{"k new", "k set", "k set"}},
+		{"key miss", "Km", []string{"get nosuchkey"}, []string{"nosuchkey keymiss"}},
+		{"list", "Klg", []string{"rpush l a b", "lpush l c", "lpop l 0", "rpop l 2", "lpop l"},
+			[]string{"l rpush", "l lpush", "l rpop", "l lpop", "l del"}},
+		{"lmove", "Klg", []string{"rpush src a", "lmove src dst left right"},
+			[]string{"src rpush", "dst rpush", "src lpop", "src del"}},
+		{"lmove same key", "Klg", []string{"rpush l a", "lmove l l left left"},
+			[]string{"l rpush", "l lpush", "l lpop"}},
+		{"blocking list pop", "Kl", []string{"rpush l a", "brpop l 0"}, []string{"l rpush", "l rpop"}},
+		{"zset", "Kzg", []string{"zadd z 1 a 2 b", "zadd z 1 a", "zadd z 3 a", "zrem z nosuch", "zrem z b", "zpopmax z"},
+			[]string{"z zadd", "z zadd", "z zrem", "z zpopmax", "z del"}},
+		{"blocking zset pop", "Kz", []string{"zadd z 1 a", "bzpopmin z 0"}, []string{"z zadd", "z zpopmin"}},
+		{"stream", "Kt", []string{"xadd s 1-0 f v", "xadd s maxlen 1 2-0 f v", "xdel s 9-0", "xdel s 2-0"},
+			[]string{"s xadd", "s xadd", "s xtrim", "s xdel"}},
+		{"stream group", "Kt", []string{"xgroup create s g $ mkstream", "xgroup createconsumer s g c", "xgroup setid s g 0",
+			"xgroup delconsumer s g c", "xgroup destroy s g"},
+			[]string{"s xgroup-create", "s xgroup-createconsumer", "s xgroup-setid", "s xgroup-delconsumer", "s xgroup-destroy"}},
+		{"classes filter", "Kl", []string{"set k v", "zadd z 1 a", "rpush l a"}, []string{"l rpush"}},
+	}
+	for _, tt := range tests {
+		config.Update(func(props *config.ServerProperties) {
+			props.NotifyKeyspaceEvents = tt.classes
+		})
+		mdb := NewDatabase()
+		sub := &recordingConn{blockingConn: &blockingConn{}}
+		mdb.Exec(sub, toCmdLine("psubscribe", "__keyspace@0__:*"))
+		c := &blockingConn{}
+		for _, cmd := range tt.cmds {
+			mdb.Exec(c, toCmdLine(strings.Fields(cmd)...))
+		}
+		got := keyspaceEvents(sub)
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("%s: got events %q, want %q", tt.name, got, tt.want)
+		}
+		mdb.Close()
+	}
+}
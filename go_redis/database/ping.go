@@ -19,5 +19,7 @@ func Ping(db *DB, args [][]byte) resp.Reply {
 }
 
 func init() {
-	RegisterCommand("ping", Ping, -1)
+	RegisterCommand("ping", Ping, -1, flagStale|flagFast).
+		attachCategories("connection").
+		attachDocs("connection", "1.0.0", "Returns the server's liveliness response.")
 }
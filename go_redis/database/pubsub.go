@@ -0,0 +1,420 @@
+package database
+
+import (
+	"go_redis/interface/resp"
+	"go_redis/lib/wildcard"
+	"go_redis/resp/reply"
+	"sort"
+	"strings"
+	"sync"
+)
+
+/*
+ * 发布订阅：SUBSCRIBE PSUBSCRIBE UNSUBSCRIBE PUNSUBSCRIBE PUBLISH PUBSUB
+ * 订阅了频道的客户端进入订阅模式，只能执行订阅相关的指令和 PING
+ */
+
+// subscriber 记录一个客户端订阅的频道和模式
+type subscriber struct {
+	channels map[string]struct{}
+	patterns map[string]struct{}
+}
+
+func (s *subscriber) count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// pubSubHub 保存所有的订阅关系
+type pubSubHub struct {
+	mu sync.RWMutex
+	// 频道 -> 订阅了该频道的客户端
+	channels map[string]map[resp.Connection]struct{}
+	// 模式 -> 订阅了该模式的客户端
+	patterns map[string]map[resp.Connection]struct{}
+	// 编译好的模式，和 patterns 中的 key 一一对应
+	compiled map[string]*wildcard.Pattern
+	// 客户端 -> 它订阅的频道和模式
+	subscribers map[resp.Connection]*subscriber
+}
+
+func makePubSubHub() *pubSubHub {
+	return &pubSubHub{
+		channels:    make(map[string]map[resp.Connection]struct{}),
+		patterns:    make(map[string]map[resp.Connection]struct{}),
+		compiled:    make(map[string]*wildcard.Pattern),
+		subscribers: make(map[resp.Connection]*subscriber),
+	}
+}
+
+// getSubscriber 返回客户端的订阅记录，不存在时创建一个，必须在持有写锁时调用
+func (hub *pubSubHub) getSubscriber(c resp.Connection) *subscriber {
+	s, ok := hub.subscribers[c]
+	if !ok {
+		s = &subscriber{
+			channels: make(map[string]struct{}),
+			patterns: make(map[string]struct{}),
+		}
+		hub.subscribers[c] = s
+		// 订阅了频道的客户端使用 pubsub 类别的输出缓冲区限制
+		c.SetSubscribed(true)
+	}
+	return s
+}
+
+// isSubscribed 判断客户端是否处于订阅模式
+func (hub *pubSubHub) isSubscribed(c resp.Connection) bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	s, ok := hub.subscribers[c]
+	return ok && s.count() > 0
+}
+
+// subscribe 订阅频道，返回客户端订阅的频道和模式的总数
+func (hub *pubSubHub) subscribe(c resp.Connection, channel string) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	s := hub.getSubscriber(c)
+	if _, ok := s.channels[channel]; !ok {
+		s.channels[channel] = struct{}{}
+		subs, ok := hub.channels[channel]
+		if !ok {
+			subs = make(map[resp.Connection]struct{})
+			hub.channels[channel] = subs
+		}
+		subs[c] = struct{}{}
+	}
+	return s.count()
+}
+
+// unsubscribe 取消订阅频道，返回客户端剩余订阅的频道和模式的总数
+func (hub *pubSubHub) unsubscribe(c resp.Connection, channel string) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	s, ok := hub.subscribers[c]
+	if !ok {
+		return 0
+	}
+	if _, ok := s.channels[channel]; ok {
+		delete(s.channels, channel)
+		subs := hub.channels[channel]
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(hub.channels, channel)
+		}
+	}
+	return hub.countAndClean(c, s)
+}
+
+// psubscribe 订阅模式，返回客户端订阅的频道和模式的总数
+func (hub *pubSubHub) psubscribe(c resp.Connection, pattern string) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	s := hub.getSubscriber(c)
+	if _, ok := s.patterns[pattern]; !ok {
+		s.patterns[pattern] = struct{}{}
+		subs, ok := hub.patterns[pattern]
+		if !ok {
+			subs = make(map[resp.Connection]struct{})
+			hub.patterns[pattern] = subs
+			hub.compiled[pattern] = wildcard.CompilePattern(pattern)
+		}
+		subs[c] = struct{}{}
+	}
+	return s.count()
+}
+
+// punsubscribe 取消订阅模式，返回客户端剩余订阅的频道和模式的总数
+func (hub *pubSubHub) punsubscribe(c resp.Connection, pattern string) int {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+	s, ok := hub.subscribers[c]
+	if !ok {
+		return 0
+	}
+	if _, ok := s.patterns[pattern]; ok {
+		delete(s.patterns, pattern)
+		subs := hub.patterns[pattern]
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(hub.patterns, pattern)
+			delete(hub.compiled, pattern)
+		}
+	}
+	return hub.countAndClean(c, s)
+}
+
+// countAndClean 返回客户端订阅的总数，没有任何订阅时删除它的记录，必须在持有写锁时调用
+func (hub *pubSubHub) countAndClean(c resp.Connection, s *subscriber) int {
+	count := s.count()
+	if count == 0 {
+		delete(hub.subscribers, c)
+		c.SetSubscribed(false)
+	}
+	return count
+}
+
+// subscriptionCount 返回客户端订阅的频道和模式的总数
+func (hub *pubSubHub) subscriptionCount(c resp.Connection) int {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	if s, ok := hub.subscribers[c]; ok {
+		return s.count()
+	}
+	return 0
+}
+
+// subscribedChannels 返回客户端订阅的所有频道
+func (hub *pubSubHub) subscribedChannels(c resp.Connection) []string {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	s, ok := hub.subscribers[c]
+	if !ok {
+		return nil
+	}
+	return sortedKeys(s.channels)
+}
+
+// subscribedPatterns 返回客户端订阅的所有模式
+func (hub *pubSubHub) subscribedPatterns(c resp.Connection) []string {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	s, ok := hub.subscribers[c]
+	if !ok {
+		return nil
+	}
+	return sortedKeys(s.patterns)
+}
+
+// removeClient 在客户端断开连接时取消它的所有订阅
+func (hub *pubSubHub) removeClient(c resp.Connection) {
+	for _, channel := range hub.subscribedChannels(c) {
+		hub.unsubscribe(c, channel)
+	}
+	for _, pattern := range hub.subscribedPatterns(c) {
+		hub.punsubscribe(c, pattern)
+	}
+}
+
+// publish 向频道发送消息，返回收到消息的客户端数量
+func (hub *pubSubHub) publish(channel string, message []byte) int {
+	type delivery struct {
+		conn resp.Connection
+		msg  []byte
+	}
+	var deliveries []delivery
+	hub.mu.RLock()
+	if subs, ok := hub.channels[channel]; ok {
+		msg := makeMessage("message", channel, message).ToBytes()
+		for c := range subs {
+			deliveries = append(deliveries, delivery{c, msg})
+		}
+	}
+	for pattern, subs := range hub.patterns {
+		if !hub.compiled[pattern].IsMatch(channel) {
+			continue
+		}
+		msg := reply.MakeMultiBulkReply([][]byte{
+			[]byte("pmessage"), []byte(pattern), []byte(channel), message,
+		}).ToBytes()
+		for c := range subs {
+			deliveries = append(deliveries, delivery{c, msg})
+		}
+	}
+	hub.mu.RUnlock()
+
+	// 释放锁之后再发送，以免一个写得很慢的客户端阻塞订阅和取消订阅
+	for _, d := range deliveries {
+		_ = d.conn.Write(d.msg)
+	}
+	return len(deliveries)
+}
+
+// hasSubscribers 判断是否有客户端可能收到频道的消息，用来在没有订阅者时跳过生成消息
+func (hub *pubSubHub) hasSubscribers() bool {
+	hub.mu.RLock()
+	defer hub.mu.RUnlock()
+	return len(hub.channels) > 0 || len(hub.patterns) > 0
+}
+
+func makeMessage(kind, channel string, payload []byte) *reply.MultiBulkReply {
+	return reply.MakeMultiBulkReply([][]byte{[]byte(kind), []byte(channel), payload})
+}
+
+// makeSubscribeReply 生成订阅和取消订阅的回复：类型 频道或模式 剩余的订阅数量
+func makeSubscribeReply(kind string, channel []byte, count int) []byte {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(kind)),
+		makeNullableBulk(channel),
+		reply.MakeIntReply(int64(count)),
+	}).ToBytes()
+}
+
+func makeNullableBulk(b []byte) resp.Reply {
+	if b == nil {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(b)
+}
+
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// pubSubAllowedCommands 是订阅模式下允许执行的指令
+var pubSubAllowedCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+}
+
+// execSubscribe SUBSCRIBE channel [channel ...]
+func execSubscribe(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	for _, channel := range args {
+		count := mdb.hub.subscribe(c, string(channel))
+		_ = c.Write(makeSubscribeReply("subscribe", channel, count))
+	}
+	return &reply.NoReply{}
+}
+
+// execUnsubscribe UNSUBSCRIBE [channel [channel ...]]
+// 不指定频道时取消订阅所有频道
+func execUnsubscribe(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	channels := args
+	if len(channels) == 0 {
+		for _, channel := range mdb.hub.subscribedChannels(c) {
+			channels = append(channels, []byte(channel))
+		}
+		if len(channels) == 0 {
+			_ = c.Write(makeSubscribeReply("unsubscribe", nil, mdb.hub.subscriptionCount(c)))
+			return &reply.NoReply{}
+		}
+	}
+	for _, channel := range channels {
+		count := mdb.hub.unsubscribe(c, string(channel))
+		_ = c.Write(makeSubscribeReply("unsubscribe", channel, count))
+	}
+	return &reply.NoReply{}
+}
+
+// execPSubscribe PSUBSCRIBE pattern [pattern ...]
+func execPSubscribe(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	for _, pattern := range args {
+		count := mdb.hub.psubscribe(c, string(pattern))
+		_ = c.Write(makeSubscribeReply("psubscribe", pattern, count))
+	}
+	return &reply.NoReply{}
+}
+
+// execPUnsubscribe PUNSUBSCRIBE [pattern [pattern ...]]
+// 不指定模式时取消订阅所有模式
+func execPUnsubscribe(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	patterns := args
+	if len(patterns) == 0 {
+		for _, pattern := range mdb.hub.subscribedPatterns(c) {
+			patterns = append(patterns, []byte(pattern))
+		}
+		if len(patterns) == 0 {
+			_ = c.Write(makeSubscribeReply("punsubscribe", nil, mdb.hub.subscriptionCount(c)))
+			return &reply.NoReply{}
+		}
+	}
+	for _, pattern := range patterns {
+		count := mdb.hub.punsubscribe(c, string(pattern))
+		_ = c.Write(makeSubscribeReply("punsubscribe", pattern, count))
+	}
+	return &reply.NoReply{}
+}
+
+// execPublish PUBLISH channel message
+func execPublish(mdb *Database, args [][]byte) resp.Reply {
+	receivers := mdb.hub.publish(string(args[0]), args[1])
+	return reply.MakeIntReply(int64(receivers))
+}
+
+// execPubSub PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func execPubSub(mdb *Database, args [][]byte) resp.Reply {
+	subCmd := strings.ToLower(string(args[0]))
+	hub := mdb.hub
+	switch subCmd {
+	case "channels":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("pubsub|channels")
+		}
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		hub.mu.RLock()
+		channels := make([]string, 0, len(hub.channels))
+		for channel := range hub.channels {
+			if pattern == nil || pattern.IsMatch(channel) {
+				channels = append(channels, channel)
+			}
+		}
+		hub.mu.RUnlock()
+		sort.Strings(channels)
+		result := make([][]byte, len(channels))
+		for i, channel := range channels {
+			result[i] = []byte(channel)
+		}
+		return reply.MakeMultiBulkReply(result)
+	case "numsub":
+		result := make([]resp.Reply, 0, (len(args)-1)*2)
+		hub.mu.RLock()
+		for _, channel := range args[1:] {
+			result = append(result,
+				reply.MakeBulkReply(channel),
+				reply.MakeIntReply(int64(len(hub.channels[string(channel)]))))
+		}
+		hub.mu.RUnlock()
+		return reply.MakeMultiRawReply(result)
+	case "numpat":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("pubsub|numpat")
+		}
+		hub.mu.RLock()
+		defer hub.mu.RUnlock()
+		return reply.MakeIntReply(int64(len(hub.patterns)))
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try PUBSUB HELP.")
+}
+
+// subscribedPing 订阅模式下的 PING 回复一个数组而不是状态
+func subscribedPing(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("ping")
+	}
+	message := []byte("")
+	if len(args) == 1 {
+		message = args[0]
+	}
+	return reply.MakeMultiBulkReply([][]byte{[]byte("pong"), message})
+}
+
+// pubSubContextError 是订阅模式下执行不允许的指令时的错误
+func pubSubContextError(cmdName string) resp.Reply {
+	return reply.MakeErrReply("ERR Can't execute '" + cmdName +
+		"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context")
+}
+
+func init() {
+	registerServerCommand("Subscribe", -2, flagPubSub|flagNoScript|flagLoading|flagStale).
+		attachDocs("pubsub", "2.0.0", "Listens for messages published to channels.")
+	registerServerCommand("Unsubscribe", -1, flagPubSub|flagNoScript|flagLoading|flagStale).
+		attachDocs("pubsub", "2.0.0", "Stops listening to messages posted to channels.")
+	registerServerCommand("PSubscribe", -2, flagPubSub|flagNoScript|flagLoading|flagStale).
+		attachDocs("pubsub", "2.0.0", "Listens for messages published to channels that match one or more patterns.")
+	registerServerCommand("PUnsubscribe", -1, flagPubSub|flagNoScript|flagLoading|flagStale).
+		attachDocs("pubsub", "2.0.0", "Stops listening to messages published to channels that match one or more patterns.")
+	registerServerCommand("Publish", 3, flagPubSub|flagLoading|flagStale|flagFast).
+		attachDocs("pubsub", "2.0.0", "Posts a message to a channel.")
+	registerServerCommand("PubSub", -2, flagPubSub|flagRandom|flagLoading|flagStale).
+		attachDocs("pubsub", "2.8.0", "A container for Pub/Sub commands.")
+}
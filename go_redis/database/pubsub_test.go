@@ -0,0 +1,103 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPubSubCommands(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	sub := &recordingConn{blockingConn: &blockingConn{}}
+	psub := &recordingConn{blockingConn: &blockingConn{}}
+	c := &blockingConn{}
+
+	tests := []struct {
+		conn    *recordingConn
+		cmd     string
+		want    string
+		written []string
+	}{
+		{sub, "subscribe news sports", "", []string{
+			"*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n",
+			"*3\r\n$9\r\nsubscribe\r\n$6\r\nsports\r\n:2\r\n",
+		}},
+		{psub, "psubscribe n*", "", []string{"*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:1\r\n"}},
+		{nil, "publish news hello", ":2\r\n", nil},
+		{nil, "publish weather sunny", ":0\r\n", nil},
+		{nil, "pubsub channels", "*2\r\n$4\r\nnews\r\n$6\r\nsports\r\n", nil},
+		{nil, "pubsub channels s*", "*1\r\n$6\r\nsports\r\n", nil},
+		{nil, "pubsub numsub news nosuch", "*4\r\n$4\r\nnews\r\n:1\r\n$6\r\nnosuch\r\n:0\r\n", nil},
+		{nil, "pubsub numpat", ":1\r\n", nil},
+		{nil, "pubsub help", "-ERR unknown subcommand 'help'. Try PUBSUB HELP.\r\n", nil},
+		{sub, "ping", "*2\r\n$4\r\npong\r\n$0\r\n\r\n", nil},
+		{sub, "get k", "-ERR Can't execute 'get': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context\r\n", nil},
+		{sub, "unsubscribe", "", []string{
+			"*3\r\n$11\r\nunsubscribe\r\n$4\r\nnews\r\n:1\r\n",
+			"*3\r\n$11\r\nunsubscribe\r\n$6\r\nsports\r\n:0\r\n",
+		}},
+		{sub, "unsubscribe", "", []string{"*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n"}},
+		// 取消全部订阅后回到普通模式
+		{sub, "ping", "+PONG\r\n", nil},
+		{psub, "punsubscribe n*", "", []string{"*3\r\n$12\r\npunsubscribe\r\n$2\r\nn*\r\n:0\r\n"}},
+		{nil, "publish news bye", ":0\r\n", nil},
+	}
+	for _, tt := range tests {
+		var before int
+		var got string
+		args := toCmdLine(strings.Fields(tt.cmd)...)
+		if tt.conn == nil {
+			got = string(mdb.Exec(c, args).ToBytes())
+		} else {
+			before = len(tt.conn.messages())
+			got = string(mdb.Exec(tt.conn, args).ToBytes())
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+		if tt.conn == nil {
+			continue
+		}
+		written := tt.conn.messages()[before:]
+		if strings.Join(written, "") != strings.Join(tt.written, "") {
+			t.Errorf("%s: written %q, want %q", tt.cmd, written, tt.written)
+		}
+	}
+
+	// 频道的订阅者和匹配的模式订阅者都收到了消息
+	want := []string{
+		"*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$5\r\nhello\r\n",
+	}
+	if got := sub.messages()[2:3]; strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("subscriber got %q, want %q", got, want)
+	}
+	want = []string{
+		"*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$5\r\nhello\r\n",
+	}
+	if got := psub.messages()[1:2]; strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("pattern subscriber got %q, want %q", got, want)
+	}
+}
+
+func TestPubSubAfterClientClose(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	sub := &recordingConn{blockingConn: &blockingConn{}}
+	mdb.Exec(sub, toCmdLine("subscribe", "news"))
+	mdb.Exec(sub, toCmdLine("psubscribe", "*"))
+	mdb.AfterClientClose(sub)
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"publish news hello", ":0\r\n"},
+		{"pubsub channels", "*0\r\n"},
+		{"pubsub numpat", ":0\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execMdb(mdb, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
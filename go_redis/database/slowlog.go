@@ -0,0 +1,193 @@
+package database
+
+import (
+	"go_redis/config"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/*
+ * 慢查询日志：记录执行时间超过 slowlog-log-slower-than 微秒的指令，
+ * 最多保留 slowlog-max-len 条，超出时丢弃最早的记录
+ */
+
+const (
+	// slowLogMaxArgs 是每条记录最多保存的参数个数
+	slowLogMaxArgs = 32
+	// slowLogMaxArgLen 是每个参数最多保存的字节数
+	slowLogMaxArgLen = 128
+	// defaultSlowLogGetCount 是 SLOWLOG GET 不指定数量时返回的记录条数
+	defaultSlowLogGetCount = 10
+)
+
+// slowLogEntry 是一条慢查询记录
+type slowLogEntry struct {
+	id         int64
+	timestamp  int64 // 指令开始执行的时间，单位秒
+	duration   int64 // 指令执行耗时，单位微秒
+	args       [][]byte
+	clientAddr string
+	clientName string
+}
+
+// slowLog 用环形缓冲区保存慢查询记录
+type slowLog struct {
+	mu sync.Mutex
+	// entries 是环形缓冲区，写满之后新的记录覆盖 start 处最早的记录
+	entries []*slowLogEntry
+	// start 是最早的一条记录在 entries 中的下标
+	start  int
+	nextID int64
+}
+
+// record 如果指令的执行时间超过了阈值，就记录一条慢查询日志
+func (log *slowLog) record(c resp.Connection, cmdLine CmdLine, start time.Time, duration time.Duration) {
+	threshold := config.Properties().SlowLogLogSlowerThan
+	if threshold < 0 {
+		return
+	}
+	micros := int64(duration / time.Microsecond)
+	if micros < int64(threshold) {
+		return
+	}
+	entry := &slowLogEntry{
+		timestamp: start.Unix(),
+		duration:  micros,
+		// 和 MONITOR 一样隐藏密码，再截断参数
+		args: truncateSlowLogArgs(redactArgs(cmdLine)),
+	}
+	if c != nil {
+		if addr := c.RemoteAddr(); addr != nil {
+			entry.clientAddr = addr.String()
+		}
+		entry.clientName = c.GetName()
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	entry.id = log.nextID
+	log.nextID++
+	log.push(entry, config.Properties().SlowLogMaxLen)
+}
+
+// push 向环形缓冲区中添加一条记录，缓冲区已满时覆盖最早的记录，必须在持有锁时调用
+func (log *slowLog) push(entry *slowLogEntry, maxLen int) {
+	if maxLen <= 0 {
+		log.entries = nil
+		log.start = 0
+		return
+	}
+	if cap(log.entries) != maxLen {
+		// slowlog-max-len 在运行时被修改了，按照新的长度重建缓冲区，只保留最新的记录
+		ordered := log.ordered()
+		if len(ordered) > maxLen {
+			ordered = ordered[len(ordered)-maxLen:]
+		}
+		log.entries = make([]*slowLogEntry, len(ordered), maxLen)
+		copy(log.entries, ordered)
+		log.start = 0
+	}
+	if len(log.entries) < maxLen {
+		log.entries = append(log.entries, entry)
+		return
+	}
+	log.entries[log.start] = entry
+	log.start = (log.start + 1) % maxLen
+}
+
+// ordered 按照从旧到新的顺序返回所有记录，必须在持有锁时调用
+func (log *slowLog) ordered() []*slowLogEntry {
+	result := make([]*slowLogEntry, 0, len(log.entries))
+	result = append(result, log.entries[log.start:]...)
+	result = append(result, log.entries[:log.start]...)
+	return result
+}
+
+// truncateSlowLogArgs 复制指令的参数，超出长度限制的参数和多余的参数会被截断
+func truncateSlowLogArgs(cmdLine CmdLine) [][]byte {
+	argc := len(cmdLine)
+	if argc > slowLogMaxArgs {
+		argc = slowLogMaxArgs
+	}
+	args := make([][]byte, argc)
+	for i := 0; i < argc; i++ {
+		if argc != len(cmdLine) && i == argc-1 {
+			args[i] = []byte("... (" + strconv.Itoa(len(cmdLine)-argc+1) + " more arguments)")
+			break
+		}
+		arg := cmdLine[i]
+		if len(arg) > slowLogMaxArgLen {
+			truncated := make([]byte, 0, slowLogMaxArgLen+32)
+			truncated = append(truncated, arg[:slowLogMaxArgLen]...)
+			truncated = append(truncated, "... ("+strconv.Itoa(len(arg)-slowLogMaxArgLen)+" more bytes)"...)
+			args[i] = truncated
+		} else {
+			args[i] = append([]byte(nil), arg...)
+		}
+	}
+	return args
+}
+
+// execSlowLog SLOWLOG GET [count] | LEN | RESET
+func execSlowLog(mdb *Database, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("slowlog")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	log := &mdb.slowLog
+	switch subCmd {
+	case "get":
+		if len(args) > 2 {
+			return reply.MakeArgNumErrReply("slowlog|get")
+		}
+		count := defaultSlowLogGetCount
+		if len(args) == 2 {
+			n, err := strconv.Atoi(string(args[1]))
+			if err != nil || n < -1 {
+				return reply.MakeErrReply("ERR count should be greater than or equal to -1")
+			}
+			count = n
+		}
+		log.mu.Lock()
+		entries := log.ordered()
+		log.mu.Unlock()
+		if count == -1 || count > len(entries) {
+			count = len(entries)
+		}
+		// 最新的记录排在最前面
+		result := make([]resp.Reply, 0, count)
+		for i := len(entries) - 1; i >= len(entries)-count; i-- {
+			entry := entries[i]
+			result = append(result, reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeIntReply(entry.id),
+				reply.MakeIntReply(entry.timestamp),
+				reply.MakeIntReply(entry.duration),
+				reply.MakeMultiBulkReply(entry.args),
+				reply.MakeBulkReply([]byte(entry.clientAddr)),
+				reply.MakeBulkReply([]byte(entry.clientName)),
+			}))
+		}
+		return reply.MakeMultiRawReply(result)
+	case "len":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("slowlog|len")
+		}
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		return reply.MakeIntReply(int64(len(log.entries)))
+	case "reset":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply("slowlog|reset")
+		}
+		log.mu.Lock()
+		defer log.mu.Unlock()
+		log.entries = nil
+		log.start = 0
+		return reply.MakeOkReply()
+	}
+	return reply.MakeErrReply("ERR unknown subcommand '" + subCmd + "'. Try SLOWLOG HELP.")
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"go_redis/config"
+	"go_redis/resp/reply"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTruncateSlowLogArgs(t *testing.T) {
+	long := strings.Repeat("a", slowLogMaxArgLen+10)
+	many := make([]string, slowLogMaxArgs+5)
+	for i := range many {
+		many[i] = "x"
+	}
+	tests := []struct {
+		name string
+		args []string
+		want []string
+	}{
+		{"short", []string{"set", "k", "v"}, []string{"set", "k", "v"}},
+		{"long argument", []string{"set", "k", long}, []string{"set", "k", long[:slowLogMaxArgLen] + "... (10 more bytes)"}},
+		{"too many arguments", many, append(many[:slowLogMaxArgs-1:slowLogMaxArgs-1], "... (6 more arguments)")},
+	}
+	for _, tt := range tests {
+		cmdLine := toCmdLine(tt.args...)
+		got := truncateSlowLogArgs(cmdLine)
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %d arguments, want %d", tt.name, len(got), len(tt.want))
+			continue
+		}
+		for i := range got {
+			if string(got[i]) != tt.want[i] {
+				t.Errorf("%s: argument %d = %q, want %q", tt.name, i, got[i], tt.want[i])
+			}
+		}
+		// 记录中的参数是复制出来的，修改原来的参数不影响记录
+		cmdLine[0][0] = '#'
+		if got[0][0] == '#' {
+			t.Errorf("%s: arguments are not copied", tt.name)
+		}
+	}
+}
+
+func TestSlowLogPush(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxLens []int
+		wantIDs []int64
+	}{
+		{"not full", []int{4, 4, 4}, []int64{0, 1, 2}},
+		{"overwrite oldest", []int{2, 2, 2, 2, 2}, []int64{3, 4}},
+		{"shrink keeps newest", []int{4, 4, 4, 4, 2}, []int64{3, 4}},
+		{"grow keeps all", []int{2, 2, 2, 4, 4}, []int64{1, 2, 3, 4}},
+		{"disabled", []int{2, 2, 0}, []int64{}},
+	}
+	for _, tt := range tests {
+		log := &slowLog{}
+		for i, maxLen := range tt.maxLens {
+			log.push(&slowLogEntry{id: int64(i)}, maxLen)
+		}
+		entries := log.ordered()
+		if len(entries) != len(tt.wantIDs) {
+			t.Errorf("%s: got %d entries, want %d", tt.name, len(entries), len(tt.wantIDs))
+			continue
+		}
+		for i, entry := range entries {
+			if entry.id != tt.wantIDs[i] {
+				t.Errorf("%s: entry %d has id %d, want %d", tt.name, i, entry.id, tt.wantIDs[i])
+			}
+		}
+	}
+}
+
+func TestSlowLogCommands(t *testing.T) {
+	old := config.Properties()
+	defer config.Update(func(props *config.ServerProperties) {
+		*props = *old
+	})
+	config.Update(func(props *config.ServerProperties) {
+		props.SlowLogLogSlowerThan = 0
+		props.SlowLogMaxLen = 3
+	})
+	mdb := NewDatabase()
+	defer mdb.Close()
+
+	c := &blockingConn{}
+	mdb.Exec(c, toCmdLine("client", "setname", "tester"))
+	mdb.Exec(c, toCmdLine("set", "k", "v"))
+	mdb.Exec(c, toCmdLine("get", "k"))
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		// 每条指令执行完才会被记录，所以 SLOWLOG LEN 看到的是之前的3条指令
+		{"slowlog len", ":3\r\n"},
+		{"slowlog get 1", "*1\r\n*6\r\n:3\r\n"},
+		{"slowlog get -2", "-ERR count should be greater than or equal to -1\r\n"},
+		{"slowlog get 1 2", "-ERR wrong number of arguments for 'slowlog|get' command\r\n"},
+		{"slowlog reset", "+OK\r\n"},
+		{"slowlog len", ":1\r\n"},
+		{"slowlog help", "-ERR unknown subcommand 'help'. Try SLOWLOG HELP.\r\n"},
+		{"client getname", "$6\r\ntester\r\n"},
+		{"client setname a\\nb", "-ERR Client names cannot contain spaces, newlines or special characters.\r\n"},
+	}
+	for _, tt := range tests {
+		// 参数中的 \n 表示换行符
+		args := strings.Fields(strings.ReplaceAll(tt.cmd, "\\n", "\x00"))
+		for i := range args {
+			args[i] = strings.ReplaceAll(args[i], "\x00", "\n")
+		}
+		got := string(mdb.Exec(c, toCmdLine(args...)).ToBytes())
+		if !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: got %q, want prefix %q", tt.cmd, got, tt.want)
+		}
+	}
+
+	// 最新的记录排在最前面，并且带有客户端的名字
+	r, ok := mdb.Exec(c, toCmdLine("slowlog", "get")).(*reply.MultiRawReply)
+	if !ok || len(r.Replies) != 3 {
+		t.Fatalf("slowlog get: unexpected reply %v", r)
+	}
+	newest := r.Replies[0].(*reply.MultiRawReply).Replies
+	if args := newest[3].(*reply.MultiBulkReply).Args; string(args[0]) != "client" || string(args[1]) != "setname" {
+		t.Errorf("newest entry has arguments %q", args)
+	}
+	if name := newest[5].(*reply.BulkReply).Arg; string(name) != "tester" {
+		t.Errorf("newest entry has client name %q", name)
+	}
+	if ts := newest[1].(*reply.IntReply).Code; ts < time.Now().Add(-time.Minute).Unix() {
+		t.Errorf("unexpected timestamp %d", ts)
+	}
+
+	// 记录中的密码被隐藏
+	mdb.Exec(c, toCmdLine("config", "set", "requirepass", "secret"))
+	mdb.Exec(c, toCmdLine("auth", "secret"))
+	mdb.Exec(c, toCmdLine("config", "set", "requirepass", ""))
+	r = mdb.Exec(c, toCmdLine("slowlog", "get", "3")).(*reply.MultiRawReply)
+	for _, entry := range r.Replies {
+		args := entry.(*reply.MultiRawReply).Replies[3].(*reply.MultiBulkReply).Args
+		if string(args[len(args)-1]) != "(redacted)" {
+			t.Errorf("password is not redacted: %q", args)
+		}
+	}
+
+	config.Update(func(props *config.ServerProperties) {
+		props.SlowLogLogSlowerThan = -1
+	})
+	mdb.Exec(c, toCmdLine("slowlog", "reset"))
+	mdb.Exec(c, toCmdLine("get", "k"))
+	if got := string(mdb.Exec(c, toCmdLine("slowlog", "len")).ToBytes()); got != ":0\r\n" {
+		t.Errorf("negative slowlog-log-slower-than should disable logging, slowlog len = %q", got)
+	}
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/*
+ * 服务端运行时的统计信息，供 INFO 指令使用
+ */
+
+const (
+	// opsSampleInterval 是采样已执行指令数量的时间间隔
+	opsSampleInterval = 100 * time.Millisecond
+	// opsSampleCount 是计算每秒执行指令数时使用的样本数量
+	opsSampleCount = 16
+)
+
+// serverStats 记录服务端启动以来的统计信息
+type serverStats struct {
+	startTime time.Time
+	// 服务端启动以来执行的指令总数
+	totalCommands int64
+
+	// 每隔 opsSampleInterval 记录一次每秒执行的指令数，
+	// 瞬时的每秒执行指令数取最近 opsSampleCount 个样本的平均值
+	mu              sync.Mutex
+	opsSamples      [opsSampleCount]int64
+	opsSampleIndex  int
+	lastSampleTime  time.Time
+	lastSampleCount int64
+
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func makeServerStats() *serverStats {
+	now := time.Now()
+	return &serverStats{
+		startTime:      now,
+		lastSampleTime: now,
+		closing:        make(chan struct{}),
+	}
+}
+
+// incrCommands 执行一条指令后将指令总数加一
+func (s *serverStats) incrCommands() {
+	atomic.AddInt64(&s.totalCommands, 1)
+}
+
+// commandsProcessed 返回服务端启动以来执行的指令总数
+func (s *serverStats) commandsProcessed() int64 {
+	return atomic.LoadInt64(&s.totalCommands)
+}
+
+// uptime 返回服务端已经运行的时间
+func (s *serverStats) uptime() time.Duration {
+	return time.Since(s.startTime)
+}
+
+// cron 定时采样已执行的指令数，直到调用 stop
+func (s *serverStats) cron() {
+	ticker := time.NewTicker(opsSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.sampleOps()
+		case <-s.closing:
+			return
+		}
+	}
+}
+
+func (s *serverStats) sampleOps() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	count := s.commandsProcessed()
+	elapsed := now.Sub(s.lastSampleTime)
+	if elapsed <= 0 {
+		return
+	}
+	s.opsSamples[s.opsSampleIndex] = (count - s.lastSampleCount) * int64(time.Second) / int64(elapsed)
+	s.opsSampleIndex = (s.opsSampleIndex + 1) % opsSampleCount
+	s.lastSampleTime = now
+	s.lastSampleCount = count
+}
+
+// instantaneousOps 返回最近一段时间内平均每秒执行的指令数
+func (s *serverStats) instantaneousOps() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var sum int64
+	for _, v := range s.opsSamples {
+		sum += v
+	}
+	return sum / opsSampleCount
+}
+
+// reset 将指令计数和每秒指令数的样本清零
+func (s *serverStats) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	atomic.StoreInt64(&s.totalCommands, 0)
+	s.opsSamples = [opsSampleCount]int64{}
+	s.opsSampleIndex = 0
+	s.lastSampleTime = time.Now()
+	s.lastSampleCount = 0
+}
+
+// stop 停止采样，可以多次调用
+func (s *serverStats) stop() {
+	s.closeOnce.Do(func() {
+		close(s.closing)
+	})
+}
@@ -0,0 +1,10 @@
+package database
+
+import "testing"
+
+func TestCloseTwice(t *testing.T) {
+	mdb := NewDatabase()
+	mdb.Close()
+	// 服务端关闭时可能从多个地方调用 Close，第二次调用不能 panic
+	mdb.Close()
+}
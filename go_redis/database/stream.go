@@ -0,0 +1,1413 @@
+package database
+
+import (
+	"go_redis/datastructure/stream"
+	"go_redis/interface/database"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * 处理和 stream 类型有关的Redis指令，包括消费者组相关的指令
+ * stream 会被原地修改，所有指令都通过 lockedExec 在 DB 的锁内执行
+ */
+
+// nowMs 返回当前的毫秒时间戳
+func nowMs() int64 {
+	return time.Now().UnixNano() / int64(time.Millisecond)
+}
+
+// getAsStream 返回 key 对应的 stream，key 不存在时返回 nil
+func (db *DB) getAsStream(key string) (*stream.Stream, reply.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*stream.Stream)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	db.touchContainer(key, entity)
+	return s, nil
+}
+
+// getOrInitStream 返回 key 对应的 stream，key 不存在时创建一个空的 stream
+// 新建的 stream 还没有写入数据库，调用方确认参数合法后再写入，这样出错时不会留下空的 key
+func (db *DB) getOrInitStream(key string) (s *stream.Stream, created bool, errReply reply.ErrorReply) {
+	s, errReply = db.getAsStream(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if s != nil {
+		return s, false, nil
+	}
+	return stream.Make(), true, nil
+}
+
+/* -------- 回复的构造 ------- */
+
+func makeStreamIDReply(id stream.ID) resp.Reply {
+	return reply.MakeBulkReply([]byte(id.String()))
+}
+
+// makeStreamEntryReply 把一条消息转为 [id, [field, value ...]] 格式的回复
+// 消息已经被删除时 entry 为 nil，回复 [id, nil]
+func makeStreamEntryReply(id stream.ID, entry *stream.Entry) resp.Reply {
+	if entry == nil {
+		return reply.MakeMultiRawReply([]resp.Reply{makeStreamIDReply(id), &reply.NullMultiBulkReply{}})
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		makeStreamIDReply(entry.ID),
+		reply.MakeMultiBulkReply(entry.Fields),
+	})
+}
+
+func makeStreamEntriesReply(entries []*stream.Entry) resp.Reply {
+	replies := make([]resp.Reply, len(entries))
+	for i, entry := range entries {
+		replies[i] = makeStreamEntryReply(entry.ID, entry)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+func makeStreamIDsReply(ids []stream.ID) resp.Reply {
+	replies := make([]resp.Reply, len(ids))
+	for i, id := range ids {
+		replies[i] = makeStreamIDReply(id)
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// makeFieldsReply 构造 XINFO 使用的 name value name value ... 格式的回复
+func makeFieldsReply(fields ...interface{}) resp.Reply {
+	replies := make([]resp.Reply, 0, len(fields))
+	for i, field := range fields {
+		if i%2 == 0 {
+			replies = append(replies, reply.MakeBulkReply([]byte(field.(string))))
+			continue
+		}
+		switch v := field.(type) {
+		case resp.Reply:
+			replies = append(replies, v)
+		case string:
+			replies = append(replies, reply.MakeBulkReply([]byte(v)))
+		case int:
+			replies = append(replies, reply.MakeIntReply(int64(v)))
+		case int64:
+			replies = append(replies, reply.MakeIntReply(v))
+		case uint64:
+			replies = append(replies, reply.MakeIntReply(int64(v)))
+		case stream.ID:
+			replies = append(replies, makeStreamIDReply(v))
+		}
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+/* -------- 参数解析 ------- */
+
+func makeNoGroupErr(key, group string) reply.ErrorReply {
+	return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + group + "'")
+}
+
+// parseStreamID 解析一个完整的消息ID，只有毫秒部分时序号为0
+func parseStreamID(arg []byte) (stream.ID, reply.ErrorReply) {
+	id, err := stream.ParseID(string(arg), 0)
+	if err != nil {
+		return id, reply.MakeErrReply(err.Error())
+	}
+	return id, nil
+}
+
+// parseRangeID 解析 XRANGE 等指令的范围边界
+// 支持 "-"、"+"，以及 "(" 开头的开区间；只有毫秒部分时，起点的序号取0，终点的序号取最大值
+func parseRangeID(arg []byte, isStart bool) (stream.ID, reply.ErrorReply) {
+	s := string(arg)
+	switch s {
+	case "-":
+		return stream.MinID, nil
+	case "+":
+		return stream.MaxID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	if exclusive {
+		s = s[1:]
+	}
+	missingSeq := uint64(0)
+	if !isStart {
+		missingSeq = ^uint64(0)
+	}
+	id, err := stream.ParseID(s, missingSeq)
+	if err != nil {
+		return id, reply.MakeErrReply(err.Error())
+	}
+	if !exclusive {
+		return id, nil
+	}
+	var ok bool
+	if isStart {
+		id, ok = id.Incr()
+	} else {
+		id, ok = id.Decr()
+	}
+	if !ok {
+		return id, reply.MakeErrReply("ERR invalid start ID for the interval")
+	}
+	return id, nil
+}
+
+// parseNonNegative 解析非负整数，出错时返回 "value is out of range" 错误
+func parseNonNegative(arg []byte) (int64, reply.ErrorReply) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if n < 0 {
+		return 0, reply.MakeErrReply("ERR value is out of range, must be positive")
+	}
+	return n, nil
+}
+
+// streamTrim 是 XADD 和 XTRIM 的裁剪参数 MAXLEN|MINID [=|~] threshold [LIMIT count]
+type streamTrim struct {
+	byMaxLen bool
+	maxLen   int
+	minID    stream.ID
+	limit    int
+}
+
+// parseStreamTrim 从 args[i] 开始解析裁剪参数，args[i] 不是 MAXLEN 或 MINID 时返回 nil
+// 近似裁剪 "~" 在这里按精确裁剪执行，Redis 允许近似裁剪删除得更少，但精确裁剪的结果同样合法
+func parseStreamTrim(args [][]byte, i int) (*streamTrim, int, reply.ErrorReply) {
+	if i >= len(args) {
+		return nil, i, nil
+	}
+	trim := &streamTrim{}
+	switch strings.ToUpper(string(args[i])) {
+	case "MAXLEN":
+		trim.byMaxLen = true
+	case "MINID":
+	default:
+		return nil, i, nil
+	}
+	i++
+	approx := false
+	if i < len(args) {
+		switch string(args[i]) {
+		case "~":
+			approx = true
+			i++
+		case "=":
+			i++
+		}
+	}
+	if i >= len(args) {
+		return nil, i, reply.MakeSyntaxErrReply()
+	}
+	if trim.byMaxLen {
+		n, errReply := parseNonNegative(args[i])
+		if errReply != nil {
+			return nil, i, reply.MakeErrReply("ERR The MAXLEN argument must be >= 0.")
+		}
+		trim.maxLen = int(n)
+	} else {
+		id, errReply := parseStreamID(args[i])
+		if errReply != nil {
+			return nil, i, errReply
+		}
+		trim.minID = id
+	}
+	i++
+	if i+1 < len(args) && strings.ToUpper(string(args[i])) == "LIMIT" {
+		if !approx {
+			return nil, i, reply.MakeErrReply("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		n, errReply := parseNonNegative(args[i+1])
+		if errReply != nil {
+			return nil, i, reply.MakeErrReply("ERR The LIMIT argument must be >= 0.")
+		}
+		trim.limit = int(n)
+		i += 2
+	}
+	return trim, i, nil
+}
+
+func (trim *streamTrim) apply(s *stream.Stream) int {
+	if trim.byMaxLen {
+		return s.TrimMaxLen(trim.maxLen, trim.limit)
+	}
+	return s.TrimMinID(trim.minID, trim.limit)
+}
+
+/* -------- 基本的 stream 指令 ------- */
+
+// execXAdd XADD key [NOMKSTREAM] [MAXLEN|MINID [=|~] threshold [LIMIT count]] *|id field value [field value ...]
+func execXAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	i := 1
+	noMkStream := false
+	if strings.ToUpper(string(args[i])) == "NOMKSTREAM" {
+		noMkStream = true
+		i++
+	}
+	trim, i, errReply := parseStreamTrim(args, i)
+	if errReply != nil {
+		return errReply
+	}
+	if i >= len(args) || (len(args)-i-1) < 2 || (len(args)-i-1)%2 != 0 {
+		return reply.MakeArgNumErrReply("xadd")
+	}
+	idArg := string(args[i])
+	fields := make([][]byte, 0, len(args)-i-1)
+	for _, arg := range args[i+1:] {
+		field := make([]byte, len(arg))
+		copy(field, arg)
+		fields = append(fields, field)
+	}
+
+	s, created, errReply := db.getOrInitStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if created && noMkStream {
+		return &reply.NullBulkReply{}
+	}
+
+	var id stream.ID
+	var ok bool
+	switch {
+	case idArg == "*":
+		id, ok = s.NextID(uint64(nowMs()))
+		if !ok {
+			return reply.MakeErrReply("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+	case strings.HasSuffix(idArg, "-*"):
+		ms, err := strconv.ParseUint(strings.TrimSuffix(idArg, "-*"), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR Invalid stream ID specified as stream command argument")
+		}
+		id, ok = s.NextSeq(ms)
+		if !ok {
+			return reply.MakeErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+		}
+	default:
+		id, errReply = parseStreamID(args[i])
+		if errReply != nil {
+			return errReply
+		}
+	}
+	if id == stream.MinID {
+		return reply.MakeErrReply("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if !s.Add(id, fields) {
+		return reply.MakeErrReply("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	}
+	if created {
+		db.PutEntity(key, &database.DataEntity{Data: s})
+	} else {
+		// 新建的 stream 由 PutEntity 唤醒等待者，已有的 stream 是原地修改的，需要单独唤醒
+		db.signalKeyReady(key)
+	}
+	db.notifyKeyspaceEvent(notifyStream, "xadd", key)
+	if trim != nil && trim.apply(s) > 0 {
+		db.notifyKeyspaceEvent(notifyStream, "xtrim", key)
+	}
+	return makeStreamIDReply(id)
+}
+
+// execXLen XLEN key
+func execXLen(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(s.Len()))
+}
+
+// parseCountOption 解析可选的 COUNT count 参数，没有指定时返回0
+func parseCountOption(args [][]byte) (int, reply.ErrorReply) {
+	if len(args) == 0 {
+		return 0, nil
+	}
+	if len(args) != 2 || strings.ToUpper(string(args[0])) != "COUNT" {
+		return 0, reply.MakeSyntaxErrReply()
+	}
+	n, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	if n < 0 {
+		n = 0
+	}
+	return int(n), nil
+}
+
+func execRangeGeneric(db *DB, args [][]byte, rev bool) resp.Reply {
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	startArg, endArg := args[1], args[2]
+	if rev {
+		startArg, endArg = endArg, startArg
+	}
+	start, errReply := parseRangeID(startArg, true)
+	if errReply != nil {
+		return errReply
+	}
+	end, errReply := parseRangeID(endArg, false)
+	if errReply != nil {
+		return errReply
+	}
+	count := -1
+	if len(args) > 3 {
+		if count, errReply = parseCountOption(args[3:]); errReply != nil {
+			return errReply
+		}
+	}
+	if s == nil || count == 0 {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	if rev {
+		return makeStreamEntriesReply(s.RevRange(start, end, count))
+	}
+	return makeStreamEntriesReply(s.Range(start, end, count))
+}
+
+// execXRange XRANGE key start end [COUNT count]
+func execXRange(db *DB, args [][]byte) resp.Reply {
+	return execRangeGeneric(db, args, false)
+}
+
+// execXRevRange XREVRANGE key end start [COUNT count]
+func execXRevRange(db *DB, args [][]byte) resp.Reply {
+	return execRangeGeneric(db, args, true)
+}
+
+// execXDel XDEL key id [id ...]
+func execXDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	ids := make([]stream.ID, len(args)-1)
+	for i, arg := range args[1:] {
+		if ids[i], errReply = parseStreamID(arg); errReply != nil {
+			return errReply
+		}
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	deleted := 0
+	for _, id := range ids {
+		if s.Delete(id) {
+			deleted++
+		}
+	}
+	if deleted > 0 {
+		db.notifyKeyspaceEvent(notifyStream, "xdel", key)
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execXTrim XTRIM key MAXLEN|MINID [=|~] threshold [LIMIT count]
+func execXTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	trim, i, errReply := parseStreamTrim(args, 1)
+	if errReply != nil {
+		return errReply
+	}
+	if trim == nil || i != len(args) {
+		return reply.MakeSyntaxErrReply()
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	trimmed := trim.apply(s)
+	if trimmed > 0 {
+		db.notifyKeyspaceEvent(notifyStream, "xtrim", key)
+	}
+	return reply.MakeIntReply(int64(trimmed))
+}
+
+/* -------- XREAD 和 XREADGROUP ------- */
+
+// streamRead 是 XREAD 和 XREADGROUP 共用的参数
+type streamRead struct {
+	group    string
+	consumer string
+	count    int
+	block    bool
+	timeout  time.Duration
+	noAck    bool
+	keys     []string
+	ids      [][]byte
+}
+
+// parseStreamRead 解析 [GROUP group consumer] [COUNT count] [BLOCK ms] [NOACK] STREAMS key [key ...] id [id ...]
+func parseStreamRead(cmdName string, args [][]byte, withGroup bool) (*streamRead, reply.ErrorReply) {
+	opts := &streamRead{}
+	i := 0
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "GROUP":
+			if !withGroup || i+2 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.group, opts.consumer = string(args[i+1]), string(args[i+2])
+			i += 2
+		case "COUNT":
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if n > 0 {
+				opts.count = int(n)
+			}
+			i++
+		case "BLOCK":
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			ms, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeErrReply("ERR timeout is not an integer or out of range")
+			}
+			if ms < 0 {
+				return nil, reply.MakeErrReply("ERR timeout is negative")
+			}
+			opts.block = true
+			opts.timeout = time.Duration(ms) * time.Millisecond
+			i++
+		case "NOACK":
+			if !withGroup {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.noAck = true
+		case "STREAMS":
+			rest := args[i+1:]
+			if len(rest) == 0 || len(rest)%2 != 0 {
+				return nil, reply.MakeErrReply("ERR Unbalanced '" + cmdName + "' list of streams: for each stream key an ID or '$' must be specified.")
+			}
+			n := len(rest) / 2
+			opts.keys = make([]string, n)
+			for j := 0; j < n; j++ {
+				opts.keys[j] = string(rest[j])
+			}
+			opts.ids = rest[n:]
+			i = len(args)
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	if opts.keys == nil {
+		return nil, reply.MakeSyntaxErrReply()
+	}
+	if withGroup && opts.group == "" {
+		return nil, reply.MakeErrReply("ERR Missing GROUP option for XREADGROUP")
+	}
+	return opts, nil
+}
+
+// execXRead XREAD [COUNT count] [BLOCK milliseconds] STREAMS key [key ...] id [id ...]
+// 指定了 BLOCK 且没有新消息时阻塞客户端，BLOCK 0 表示一直等待
+func execXRead(db *DB, args [][]byte) resp.Reply {
+	opts, errReply := parseStreamRead("xread", args, false)
+	if errReply != nil {
+		return errReply
+	}
+	streams := make([]*stream.Stream, len(opts.keys))
+	after := make([]stream.ID, len(opts.keys))
+	for i, key := range opts.keys {
+		s, errReply := db.getAsStream(key)
+		if errReply != nil {
+			return errReply
+		}
+		streams[i] = s
+		switch string(opts.ids[i]) {
+		case "$":
+			if s != nil {
+				after[i] = s.LastID()
+			}
+		case ">":
+			return reply.MakeErrReply("ERR The > ID can be specified only when calling XREADGROUP using the GROUP <group> <consumer> option.")
+		default:
+			id, errReply := parseStreamID(opts.ids[i])
+			if errReply != nil {
+				return errReply
+			}
+			after[i] = id
+		}
+	}
+	result := make([]resp.Reply, 0)
+	for i, s := range streams {
+		if s == nil {
+			continue
+		}
+		entries := s.After(after[i], opts.count)
+		if len(entries) == 0 {
+			continue
+		}
+		result = append(result, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(opts.keys[i])),
+			makeStreamEntriesReply(entries),
+		}))
+	}
+	if len(result) == 0 {
+		if opts.block {
+			return db.Block(opts.keys, opts.timeout, &reply.NullMultiBulkReply{}).
+				withCmdLine(makeXReadCmdLine(args, opts, after))
+		}
+		return &reply.NullMultiBulkReply{}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// makeXReadCmdLine 构造阻塞的 XREAD 被唤醒后重新执行的指令，
+// "$" 表示开始阻塞时的最后一条消息，要换成具体的ID，否则重新执行时会错过唤醒它的消息
+func makeXReadCmdLine(args [][]byte, opts *streamRead, after []stream.ID) CmdLine {
+	cmdLine := make(CmdLine, 0, len(args)+1)
+	cmdLine = append(cmdLine, []byte("xread"))
+	cmdLine = append(cmdLine, args[:len(args)-len(opts.ids)]...)
+	for i, id := range opts.ids {
+		if string(id) == "$" {
+			id = []byte(after[i].String())
+		}
+		cmdLine = append(cmdLine, id)
+	}
+	return cmdLine
+}
+
+// execXReadGroup XREADGROUP GROUP group consumer [COUNT count] [BLOCK milliseconds] [NOACK] STREAMS key [key ...] id [id ...]
+// ID 为 ">" 时读取从未投递给这个组的新消息，其他 ID 读取该消费者 PEL 中ID更大的历史消息
+// 指定了 BLOCK 且没有可以读取的消息时阻塞客户端
+func execXReadGroup(db *DB, args [][]byte) resp.Reply {
+	opts, errReply := parseStreamRead("xreadgroup", args, true)
+	if errReply != nil {
+		return errReply
+	}
+	groups := make([]*stream.Group, len(opts.keys))
+	streams := make([]*stream.Stream, len(opts.keys))
+	history := make([]*stream.ID, len(opts.keys))
+	for i, key := range opts.keys {
+		s, errReply := db.getAsStream(key)
+		if errReply != nil {
+			return errReply
+		}
+		var group *stream.Group
+		if s != nil {
+			group = s.Group(opts.group)
+		}
+		if group == nil {
+			return reply.MakeErrReply("NOGROUP No such key '" + key + "' or consumer group '" + opts.group +
+				"' in XREADGROUP with GROUP option")
+		}
+		streams[i], groups[i] = s, group
+		if string(opts.ids[i]) == ">" {
+			continue
+		}
+		id, errReply := parseStreamID(opts.ids[i])
+		if errReply != nil {
+			return errReply
+		}
+		history[i] = &id
+	}
+
+	now := nowMs()
+	result := make([]resp.Reply, 0)
+	for i, s := range streams {
+		group := groups[i]
+		consumer, created := group.CreateConsumer(opts.consumer, now)
+		if created {
+			db.notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", opts.keys[i])
+		}
+		consumer.SeenTime = now
+		var entries resp.Reply
+		if history[i] != nil {
+			entries = readConsumerHistory(s, group, consumer, *history[i], opts.count)
+		} else {
+			delivered := readNewEntries(s, group, consumer, opts, now)
+			if len(delivered) == 0 {
+				continue
+			}
+			entries = makeStreamEntriesReply(delivered)
+		}
+		result = append(result, reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(opts.keys[i])),
+			entries,
+		}))
+	}
+	if len(result) == 0 {
+		// 只读取新消息时才会没有结果，重新执行时 ">" 仍然表示新消息，不需要改写指令
+		if opts.block {
+			return db.Block(opts.keys, opts.timeout, &reply.NullMultiBulkReply{})
+		}
+		return &reply.NullMultiBulkReply{}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// readNewEntries 把从未投递给组的消息投递给消费者，并推进组的 last-delivered-id
+func readNewEntries(s *stream.Stream, group *stream.Group, consumer *stream.Consumer, opts *streamRead, now int64) []*stream.Entry {
+	entries := s.After(group.LastID, opts.count)
+	if len(entries) == 0 {
+		return nil
+	}
+	for _, entry := range entries {
+		if !opts.noAck {
+			group.Deliver(entry.ID, consumer, now)
+		}
+	}
+	group.LastID = entries[len(entries)-1].ID
+	if group.EntriesRead >= 0 {
+		group.EntriesRead += int64(len(entries))
+	} else if group.LastID == s.LastID() {
+		group.EntriesRead = int64(s.EntriesAdded())
+	}
+	consumer.ActiveTime = now
+	return entries
+}
+
+// readConsumerHistory 返回消费者 PEL 中ID大于 after 的消息，已经被删除的消息回复 [id, nil]
+func readConsumerHistory(s *stream.Stream, group *stream.Group, consumer *stream.Consumer, after stream.ID, count int) resp.Reply {
+	start, ok := after.Incr()
+	if !ok {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	pending := group.PendingRange(start, stream.MaxID, count, consumer, 0, 0)
+	replies := make([]resp.Reply, len(pending))
+	for i, pe := range pending {
+		replies[i] = makeStreamEntryReply(pe.ID, s.Get(pe.ID))
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+/* -------- 消费者组的管理 ------- */
+
+// parseGroupStartID 解析 XGROUP CREATE/SETID 的起始ID和可选的 ENTRIESREAD 参数
+// 返回组的 last-delivered-id 和 entries-read
+func parseGroupStartID(s *stream.Stream, idArg []byte, opts [][]byte, allowMkStream bool) (
+	lastID stream.ID, entriesRead int64, mkStream bool, errReply reply.ErrorReply) {
+	entriesRead = -1
+	explicitRead := false
+	for i := 0; i < len(opts); i++ {
+		switch strings.ToUpper(string(opts[i])) {
+		case "MKSTREAM":
+			if !allowMkStream {
+				return lastID, 0, false, reply.MakeSyntaxErrReply()
+			}
+			mkStream = true
+		case "ENTRIESREAD":
+			if i+1 >= len(opts) {
+				return lastID, 0, false, reply.MakeSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(opts[i+1]), 10, 64)
+			if err != nil || n < -1 {
+				return lastID, 0, false, reply.MakeErrReply("ERR value for ENTRIESREAD must be positive or -1")
+			}
+			entriesRead, explicitRead = n, true
+			i++
+		default:
+			return lastID, 0, false, reply.MakeSyntaxErrReply()
+		}
+	}
+	if string(idArg) == "$" {
+		if s != nil {
+			lastID = s.LastID()
+			if !explicitRead {
+				entriesRead = int64(s.EntriesAdded())
+			}
+		}
+		return lastID, entriesRead, mkStream, nil
+	}
+	lastID, errReply = parseStreamID(idArg)
+	if errReply != nil {
+		return lastID, 0, false, errReply
+	}
+	if !explicitRead && (lastID == stream.MinID || s == nil || s.First() == nil || lastID.Less(s.First().ID)) {
+		entriesRead = 0
+	}
+	return lastID, entriesRead, mkStream, nil
+}
+
+var errXGroupNoKey = reply.MakeErrReply("ERR The XGROUP subcommand requires the key to exist. " +
+	"Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+
+// execXGroup XGROUP CREATE|SETID|DESTROY|CREATECONSUMER|DELCONSUMER key group ...
+func execXGroup(db *DB, args [][]byte) resp.Reply {
+	sub := strings.ToUpper(string(args[0]))
+	// 子命令后面的参数数量，负数表示至少需要的数量
+	arity := map[string]int{"CREATE": -3, "SETID": -3, "DESTROY": 2, "CREATECONSUMER": 3, "DELCONSUMER": 3}
+	n, ok := arity[sub]
+	if !ok {
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XGROUP HELP.")
+	}
+	rest := args[1:]
+	if n >= 0 && len(rest) != n || n < 0 && len(rest) < -n {
+		return reply.MakeErrReply("ERR wrong number of arguments for 'xgroup|" + strings.ToLower(sub) + "' command")
+	}
+	key, groupName := string(rest[0]), string(rest[1])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	if sub == "CREATE" {
+		lastID, entriesRead, mkStream, errReply := parseGroupStartID(s, rest[2], rest[3:], true)
+		if errReply != nil {
+			return errReply
+		}
+		if s == nil {
+			if !mkStream {
+				return errXGroupNoKey
+			}
+			s = stream.Make()
+			db.PutEntity(key, &database.DataEntity{Data: s})
+		}
+		if _, ok := s.CreateGroup(groupName, lastID, entriesRead); !ok {
+			return reply.MakeErrReply("BUSYGROUP Consumer Group name already exists")
+		}
+		db.notifyKeyspaceEvent(notifyStream, "xgroup-create", key)
+		return reply.MakeOkReply()
+	}
+
+	if s == nil {
+		return errXGroupNoKey
+	}
+	if sub == "DESTROY" {
+		if s.DestroyGroup(groupName) {
+			db.notifyKeyspaceEvent(notifyStream, "xgroup-destroy", key)
+			return reply.MakeIntReply(1)
+		}
+		return reply.MakeIntReply(0)
+	}
+	group := s.Group(groupName)
+	if group == nil {
+		return reply.MakeErrReply("NOGROUP No such consumer group '" + groupName + "' for key name '" + key + "'")
+	}
+	switch sub {
+	case "SETID":
+		lastID, entriesRead, _, errReply := parseGroupStartID(s, rest[2], rest[3:], false)
+		if errReply != nil {
+			return errReply
+		}
+		group.LastID, group.EntriesRead = lastID, entriesRead
+		db.notifyKeyspaceEvent(notifyStream, "xgroup-setid", key)
+		return reply.MakeOkReply()
+	case "CREATECONSUMER":
+		if _, created := group.CreateConsumer(string(rest[2]), nowMs()); created {
+			db.notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", key)
+			return reply.MakeIntReply(1)
+		}
+		return reply.MakeIntReply(0)
+	default: // DELCONSUMER
+		deleted, existed := group.DeleteConsumer(string(rest[2]))
+		if existed {
+			db.notifyKeyspaceEvent(notifyStream, "xgroup-delconsumer", key)
+		}
+		return reply.MakeIntReply(int64(deleted))
+	}
+}
+
+// getStreamGroup 返回 key 对应的 stream 和其中的消费者组，二者之一不存在时返回 NOGROUP 错误
+func (db *DB) getStreamGroup(key, groupName string) (*stream.Stream, *stream.Group, reply.ErrorReply) {
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return nil, nil, errReply
+	}
+	if s == nil || s.Group(groupName) == nil {
+		return nil, nil, makeNoGroupErr(key, groupName)
+	}
+	return s, s.Group(groupName), nil
+}
+
+// execXAck XACK key group id [id ...]
+func execXAck(db *DB, args [][]byte) resp.Reply {
+	ids := make([]stream.ID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, errReply := parseStreamID(arg)
+		if errReply != nil {
+			return errReply
+		}
+		ids[i] = id
+	}
+	s, errReply := db.getAsStream(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || s.Group(string(args[1])) == nil {
+		return reply.MakeIntReply(0)
+	}
+	group := s.Group(string(args[1]))
+	acked := 0
+	for _, id := range ids {
+		if group.Ack(id) {
+			acked++
+		}
+	}
+	return reply.MakeIntReply(int64(acked))
+}
+
+// execXPending XPENDING key group [[IDLE min-idle-time] start end count [consumer]]
+func execXPending(db *DB, args [][]byte) resp.Reply {
+	rest := args[2:]
+	if len(rest) != 0 && len(rest) < 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	var minIdle int64
+	if len(rest) > 0 && strings.ToUpper(string(rest[0])) == "IDLE" {
+		if len(rest) < 5 {
+			return reply.MakeSyntaxErrReply()
+		}
+		n, err := strconv.ParseInt(string(rest[1]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		minIdle = n
+		rest = rest[2:]
+	}
+	if len(rest) > 4 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	var start, end stream.ID
+	count := 0
+	if len(rest) > 0 {
+		var errReply reply.ErrorReply
+		if start, errReply = parseRangeID(rest[0], true); errReply != nil {
+			return errReply
+		}
+		if end, errReply = parseRangeID(rest[1], false); errReply != nil {
+			return errReply
+		}
+		n, err := strconv.ParseInt(string(rest[2]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR value is not an integer or out of range")
+		}
+		if n > 0 {
+			count = int(n)
+		}
+	}
+
+	_, group, errReply := db.getStreamGroup(string(args[0]), string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+
+	if len(rest) == 0 {
+		// 概要格式：[未确认消息数, 最小ID, 最大ID, [[消费者, 未确认消息数] ...]]
+		pending := group.PendingRange(stream.MinID, stream.MaxID, 0, nil, 0, 0)
+		if len(pending) == 0 {
+			return reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeIntReply(0), &reply.NullBulkReply{}, &reply.NullBulkReply{}, &reply.NullMultiBulkReply{},
+			})
+		}
+		consumers := make([]resp.Reply, 0)
+		for _, consumer := range group.Consumers() {
+			if consumer.PendingCount() == 0 {
+				continue
+			}
+			consumers = append(consumers, reply.MakeMultiBulkReply([][]byte{
+				[]byte(consumer.Name), []byte(strconv.Itoa(consumer.PendingCount())),
+			}))
+		}
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(int64(len(pending))),
+			makeStreamIDReply(pending[0].ID),
+			makeStreamIDReply(pending[len(pending)-1].ID),
+			reply.MakeMultiRawReply(consumers),
+		})
+	}
+
+	// 扩展格式：[[id, 消费者, 空闲时间, 投递次数] ...]
+	if count == 0 {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	var consumer *stream.Consumer
+	if len(rest) == 4 {
+		consumer = group.Consumer(string(rest[3]))
+		if consumer == nil {
+			return &reply.EmptyMultiBulkReply{}
+		}
+	}
+	now := nowMs()
+	pending := group.PendingRange(start, end, count, consumer, minIdle, now)
+	replies := make([]resp.Reply, len(pending))
+	for i, pe := range pending {
+		replies[i] = reply.MakeMultiRawReply([]resp.Reply{
+			makeStreamIDReply(pe.ID),
+			reply.MakeBulkReply([]byte(pe.Consumer.Name)),
+			reply.MakeIntReply(now - pe.DeliveryTime),
+			reply.MakeIntReply(pe.DeliveryCount),
+		})
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+/* -------- 认领消息 ------- */
+
+// streamClaim 是 XCLAIM 和 XAUTOCLAIM 共用的认领参数
+type streamClaim struct {
+	minIdle int64
+	// deliveryTime 是认领后记录的投递时间
+	deliveryTime int64
+	// retryCount >= 0 时直接设置投递次数
+	retryCount int64
+	justID     bool
+}
+
+// idleEnough 判断未确认消息的空闲时间是否达到了 min-idle-time
+func (opts *streamClaim) idleEnough(pe *stream.PendingEntry, now int64) bool {
+	return opts.minIdle <= 0 || now-pe.DeliveryTime >= opts.minIdle
+}
+
+// claim 把一条未确认消息转给 consumer
+// 不使用 JUSTID 时，认领视为一次新的投递，会增加投递次数
+func (opts *streamClaim) claim(group *stream.Group, pe *stream.PendingEntry, consumer *stream.Consumer, now int64) {
+	group.Transfer(pe, consumer)
+	pe.DeliveryTime = opts.deliveryTime
+	if opts.retryCount >= 0 {
+		pe.DeliveryCount = opts.retryCount
+	} else if !opts.justID {
+		pe.DeliveryCount++
+	}
+	consumer.ActiveTime = now
+}
+
+func parseMinIdle(arg []byte) (int64, reply.ErrorReply) {
+	n, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeErrReply("ERR Invalid min-idle-time argument for XCLAIM")
+	}
+	if n < 0 {
+		n = 0
+	}
+	return n, nil
+}
+
+// execXClaim XCLAIM key group consumer min-idle-time id [id ...] [IDLE ms] [TIME unix-time-milliseconds]
+// [RETRYCOUNT count] [FORCE] [JUSTID] [LASTID lastid]
+func execXClaim(db *DB, args [][]byte) resp.Reply {
+	now := nowMs()
+	minIdle, errReply := parseMinIdle(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	opts := &streamClaim{minIdle: minIdle, deliveryTime: now, retryCount: -1}
+	ids := make([]stream.ID, 0)
+	i := 4
+	for ; i < len(args); i++ {
+		id, err := stream.ParseID(string(args[i]), 0)
+		if err != nil {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return reply.MakeErrReply("ERR Invalid stream ID specified as stream command argument")
+	}
+	force := false
+	var lastID *stream.ID
+	for ; i < len(args); i++ {
+		opt := strings.ToUpper(string(args[i]))
+		switch opt {
+		case "FORCE":
+			force = true
+			continue
+		case "JUSTID":
+			opts.justID = true
+			continue
+		case "IDLE", "TIME", "RETRYCOUNT", "LASTID":
+		default:
+			return reply.MakeErrReply("ERR Unrecognized XCLAIM option '" + string(args[i]) + "'")
+		}
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		i++
+		if opt == "LASTID" {
+			id, errReply := parseStreamID(args[i])
+			if errReply != nil {
+				return errReply
+			}
+			lastID = &id
+			continue
+		}
+		n, err := strconv.ParseInt(string(args[i]), 10, 64)
+		if err != nil {
+			return reply.MakeErrReply("ERR Invalid " + opt + " option argument for XCLAIM")
+		}
+		switch opt {
+		case "IDLE":
+			opts.deliveryTime = now - n
+		case "TIME":
+			opts.deliveryTime = n
+		case "RETRYCOUNT":
+			opts.retryCount = n
+		}
+	}
+
+	s, group, errReply := db.getStreamGroup(string(args[0]), string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	if lastID != nil && group.LastID.Less(*lastID) {
+		group.LastID = *lastID
+	}
+	consumer, created := group.CreateConsumer(string(args[2]), now)
+	if created {
+		db.notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", string(args[0]))
+	}
+	consumer.SeenTime = now
+
+	claimed := make([]*stream.Entry, 0, len(ids))
+	claimedIDs := make([]stream.ID, 0, len(ids))
+	for _, id := range ids {
+		entry := s.Get(id)
+		pe := group.Pending(id)
+		if pe == nil {
+			if !force || entry == nil {
+				continue
+			}
+			pe = group.AddPending(id, consumer, now)
+		}
+		if entry == nil {
+			// 消息已经从 stream 中删除，没有认领的意义，直接从 PEL 中移除
+			group.Ack(id)
+			continue
+		}
+		if !opts.idleEnough(pe, now) {
+			continue
+		}
+		opts.claim(group, pe, consumer, now)
+		claimed = append(claimed, entry)
+		claimedIDs = append(claimedIDs, id)
+	}
+	if opts.justID {
+		return makeStreamIDsReply(claimedIDs)
+	}
+	return makeStreamEntriesReply(claimed)
+}
+
+// execXAutoClaim XAUTOCLAIM key group consumer min-idle-time start [COUNT count] [JUSTID]
+// 回复 [下一次扫描的起点, 认领到的消息, 已经被删除而从 PEL 中移除的消息ID]
+func execXAutoClaim(db *DB, args [][]byte) resp.Reply {
+	now := nowMs()
+	minIdle, errReply := parseMinIdle(args[3])
+	if errReply != nil {
+		return errReply
+	}
+	start, errReply := parseRangeID(args[4], true)
+	if errReply != nil {
+		return errReply
+	}
+	opts := &streamClaim{minIdle: minIdle, deliveryTime: now, retryCount: -1}
+	count := 100
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "JUSTID":
+			opts.justID = true
+		case "COUNT":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil || n < 1 || n > 1<<20 {
+				return reply.MakeErrReply("ERR COUNT must be > 0")
+			}
+			count = int(n)
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	s, group, errReply := db.getStreamGroup(string(args[0]), string(args[1]))
+	if errReply != nil {
+		return errReply
+	}
+	consumer, created := group.CreateConsumer(string(args[2]), now)
+	if created {
+		db.notifyKeyspaceEvent(notifyStream, "xgroup-createconsumer", string(args[0]))
+	}
+	consumer.SeenTime = now
+
+	// 与 Redis 一样，最多检查 count*10 条记录，避免 PEL 很大时一次扫描太久
+	attempts := count * 10
+	candidates := group.PendingRange(start, stream.MaxID, attempts+1, nil, 0, 0)
+	next := stream.MinID
+	claimed := make([]*stream.Entry, 0)
+	claimedIDs := make([]stream.ID, 0)
+	deleted := make([]stream.ID, 0)
+	for i, pe := range candidates {
+		if i == attempts || len(claimedIDs) == count {
+			next = pe.ID
+			break
+		}
+		if !opts.idleEnough(pe, now) {
+			continue
+		}
+		entry := s.Get(pe.ID)
+		if entry == nil {
+			group.Ack(pe.ID)
+			deleted = append(deleted, pe.ID)
+			continue
+		}
+		opts.claim(group, pe, consumer, now)
+		claimed = append(claimed, entry)
+		claimedIDs = append(claimedIDs, pe.ID)
+	}
+
+	var claimedReply resp.Reply
+	if opts.justID {
+		claimedReply = makeStreamIDsReply(claimedIDs)
+	} else {
+		claimedReply = makeStreamEntriesReply(claimed)
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		makeStreamIDReply(next),
+		claimedReply,
+		makeStreamIDsReply(deleted),
+	})
+}
+
+/* -------- XINFO ------- */
+
+// execXInfo XINFO STREAM key [FULL [COUNT count]] | GROUPS key | CONSUMERS key group
+func execXInfo(db *DB, args [][]byte) resp.Reply {
+	sub := strings.ToUpper(string(args[0]))
+	switch {
+	case sub == "STREAM" && len(args) >= 2:
+	case sub == "GROUPS" && len(args) == 2:
+	case sub == "CONSUMERS" && len(args) == 3:
+	case sub == "STREAM" || sub == "GROUPS" || sub == "CONSUMERS":
+		return reply.MakeErrReply("ERR wrong number of arguments for 'xinfo|" + strings.ToLower(sub) + "' command")
+	default:
+		return reply.MakeErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try XINFO HELP.")
+	}
+	key := string(args[1])
+	s, errReply := db.getAsStream(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeErrReply("ERR no such key")
+	}
+
+	now := nowMs()
+	switch sub {
+	case "GROUPS":
+		groups := s.Groups()
+		replies := make([]resp.Reply, len(groups))
+		for i, group := range groups {
+			replies[i] = makeFieldsReply(
+				"name", group.Name,
+				"consumers", group.ConsumerCount(),
+				"pending", group.PendingCount(),
+				"last-delivered-id", group.LastID,
+				"entries-read", makeEntriesReadReply(group),
+				"lag", s.Lag(group),
+			)
+		}
+		return reply.MakeMultiRawReply(replies)
+	case "CONSUMERS":
+		group := s.Group(string(args[2]))
+		if group == nil {
+			return reply.MakeErrReply("NOGROUP No such consumer group '" + string(args[2]) + "' for key name '" + key + "'")
+		}
+		consumers := group.Consumers()
+		replies := make([]resp.Reply, len(consumers))
+		for i, consumer := range consumers {
+			inactive := int64(-1)
+			if consumer.ActiveTime >= 0 {
+				inactive = now - consumer.ActiveTime
+			}
+			replies[i] = makeFieldsReply(
+				"name", consumer.Name,
+				"pending", consumer.PendingCount(),
+				"idle", now-consumer.SeenTime,
+				"inactive", inactive,
+			)
+		}
+		return reply.MakeMultiRawReply(replies)
+	}
+
+	opts := args[2:]
+	if len(opts) == 0 {
+		var first, last resp.Reply = &reply.NullBulkReply{}, &reply.NullBulkReply{}
+		if entry := s.First(); entry != nil {
+			first = makeStreamEntryReply(entry.ID, entry)
+		}
+		if entry := s.Last(); entry != nil {
+			last = makeStreamEntryReply(entry.ID, entry)
+		}
+		return makeFieldsReply(
+			"length", s.Len(),
+			"last-generated-id", s.LastID(),
+			"max-deleted-entry-id", s.MaxDeletedID(),
+			"entries-added", s.EntriesAdded(),
+			"recorded-first-entry-id", recordedFirstID(s),
+			"groups", len(s.Groups()),
+			"first-entry", first,
+			"last-entry", last,
+		)
+	}
+	if strings.ToUpper(string(opts[0])) != "FULL" {
+		return reply.MakeSyntaxErrReply()
+	}
+	count := 10
+	if len(opts) > 1 {
+		n, errReply := parseCountOption(opts[1:])
+		if errReply != nil {
+			return errReply
+		}
+		count = n
+	}
+	return makeStreamFullInfo(s, count)
+}
+
+// makeStreamFullInfo 构造 XINFO STREAM FULL 的回复，count 限制消息和每个 PEL 返回的数量，0 表示不限制
+func makeStreamFullInfo(s *stream.Stream, count int) resp.Reply {
+	groups := s.Groups()
+	groupReplies := make([]resp.Reply, len(groups))
+	for i, group := range groups {
+		pending := group.PendingRange(stream.MinID, stream.MaxID, count, nil, 0, 0)
+		pendingReplies := make([]resp.Reply, len(pending))
+		for j, pe := range pending {
+			pendingReplies[j] = reply.MakeMultiRawReply([]resp.Reply{
+				makeStreamIDReply(pe.ID),
+				reply.MakeBulkReply([]byte(pe.Consumer.Name)),
+				reply.MakeIntReply(pe.DeliveryTime),
+				reply.MakeIntReply(pe.DeliveryCount),
+			})
+		}
+		consumers := group.Consumers()
+		consumerReplies := make([]resp.Reply, len(consumers))
+		for j, consumer := range consumers {
+			owned := group.PendingRange(stream.MinID, stream.MaxID, count, consumer, 0, 0)
+			ownedReplies := make([]resp.Reply, len(owned))
+			for k, pe := range owned {
+				ownedReplies[k] = reply.MakeMultiRawReply([]resp.Reply{
+					makeStreamIDReply(pe.ID),
+					reply.MakeIntReply(pe.DeliveryTime),
+					reply.MakeIntReply(pe.DeliveryCount),
+				})
+			}
+			consumerReplies[j] = makeFieldsReply(
+				"name", consumer.Name,
+				"seen-time", consumer.SeenTime,
+				"active-time", consumer.ActiveTime,
+				"pel-count", consumer.PendingCount(),
+				"pending", reply.MakeMultiRawReply(ownedReplies),
+			)
+		}
+		groupReplies[i] = makeFieldsReply(
+			"name", group.Name,
+			"last-delivered-id", group.LastID,
+			"entries-read", makeEntriesReadReply(group),
+			"lag", s.Lag(group),
+			"pel-count", group.PendingCount(),
+			"pending", reply.MakeMultiRawReply(pendingReplies),
+			"consumers", reply.MakeMultiRawReply(consumerReplies),
+		)
+	}
+	return makeFieldsReply(
+		"length", s.Len(),
+		"last-generated-id", s.LastID(),
+		"max-deleted-entry-id", s.MaxDeletedID(),
+		"entries-added", s.EntriesAdded(),
+		"recorded-first-entry-id", recordedFirstID(s),
+		"entries", makeStreamEntriesReply(s.Range(stream.MinID, stream.MaxID, count)),
+		"groups", reply.MakeMultiRawReply(groupReplies),
+	)
+}
+
+func makeEntriesReadReply(group *stream.Group) resp.Reply {
+	if group.EntriesRead < 0 {
+		return &reply.NullBulkReply{}
+	}
+	return reply.MakeIntReply(group.EntriesRead)
+}
+
+func recordedFirstID(s *stream.Stream) stream.ID {
+	if entry := s.First(); entry != nil {
+		return entry.ID
+	}
+	return stream.MinID
+}
+
+// streamReadKeys 取出 XREAD 和 XREADGROUP 中 STREAMS 之后的 key，cmdLine 包括指令名
+// 参数不合法时返回 nil
+func streamReadKeys(cmdLine CmdLine) [][]byte {
+	for i := 1; i < len(cmdLine); i++ {
+		if !strings.EqualFold(string(cmdLine[i]), "STREAMS") {
+			continue
+		}
+		rest := cmdLine[i+1:]
+		if len(rest) == 0 || len(rest)%2 != 0 {
+			return nil
+		}
+		return rest[:len(rest)/2]
+	}
+	return nil
+}
+
+func init() {
+	RegisterCommand("XAdd", lockedExec(execXAdd), -5, flagWrite|flagDenyOOM|flagRandom|flagFast).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Appends a new message to a stream. Creates the key if it doesn't exist.")
+	RegisterCommand("XLen", lockedExec(execXLen), 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Return the number of messages in a stream.")
+	RegisterCommand("XRange", lockedExec(execXRange), -4, flagReadOnly).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Returns the messages from a stream within a range of IDs.")
+	RegisterCommand("XRevRange", lockedExec(execXRevRange), -4, flagReadOnly).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Returns the messages from a stream within a range of IDs in reverse order.")
+	RegisterCommand("XDel", lockedExec(execXDel), -3, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Returns the number of messages after removing them from a stream.")
+	RegisterCommand("XTrim", lockedExec(execXTrim), -4, flagWrite|flagRandom).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Deletes messages from the beginning of a stream.")
+	RegisterCommand("XRead", lockedExec(execXRead), -4, flagReadOnly).
+		attachKeys(1, 1, 1).attachKeysFunc(streamReadKeys).attachCategories("stream", "blocking").
+		attachDocs("stream", "5.0.0", "Returns messages from multiple streams with IDs greater than the ones requested. Blocks until a message is available otherwise.")
+	RegisterCommand("XGroup", lockedExec(execXGroup), -2, flagWrite|flagDenyOOM).
+		attachKeys(2, 2, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "A container for consumer groups commands.")
+	RegisterCommand("XReadGroup", lockedExec(execXReadGroup), -7, flagWrite).
+		attachKeys(1, 1, 1).attachKeysFunc(streamReadKeys).attachCategories("stream", "blocking").
+		attachDocs("stream", "5.0.0", "Returns new or historical messages from a stream for a consumer in a group. Blocks until a message is available otherwise.")
+	RegisterCommand("XAck", lockedExec(execXAck), -4, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Returns the number of messages that were successfully acknowledged by the consumer group member of a stream.")
+	RegisterCommand("XPending", lockedExec(execXPending), -3, flagReadOnly).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Returns the information and entries from a stream consumer group's pending entries list.")
+	RegisterCommand("XClaim", lockedExec(execXClaim), -6, flagWrite|flagRandom|flagFast).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "Changes, or acquires, ownership of a message in a consumer group, as if the message was delivered a consumer group member.")
+	RegisterCommand("XAutoClaim", lockedExec(execXAutoClaim), -6, flagWrite|flagRandom|flagFast).
+		attachKeys(1, 1, 1).attachCategories("stream").
+		attachDocs("stream", "6.2.0", "Changes, or acquires, ownership of messages in a consumer group, as if the messages were delivered to as consumer group member.")
+	RegisterCommand("XInfo", lockedExec(execXInfo), -2, flagReadOnly).
+		attachKeys(2, 2, 1).attachCategories("stream").
+		attachDocs("stream", "5.0.0", "A container for stream introspection commands.")
+}
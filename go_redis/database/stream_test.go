@@ -0,0 +1,234 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+func toCmdLine(args ...string) CmdLine {
+	cmdLine := make(CmdLine, len(args))
+	for i, arg := range args {
+		cmdLine[i] = []byte(arg)
+	}
+	return cmdLine
+}
+
+// execLine 在 db 上执行一条用空格分隔的指令，返回回复的 RESP 编码
+func execLine(db *DB, line string) string {
+	return string(db.Exec(nil, toCmdLine(strings.Fields(line)...)).ToBytes())
+}
+
+func TestXAddIDs(t *testing.T) {
+	db := makeDB()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"xadd s 0-0 f v", "-ERR The ID specified in XADD must be greater than 0-0\r\n"},
+		{"xadd s 1-1 f v", "$3\r\n1-1\r\n"},
+		{"xadd s 1-1 f v", "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{"xadd s 1-* f v", "$3\r\n1-2\r\n"},
+		{"xadd s 0-* f v", "-ERR The ID specified in XADD is equal or smaller than the target stream top item\r\n"},
+		{"xadd s 5 f v", "$3\r\n5-0\r\n"},
+		{"xadd s 6-0 f", "-ERR wrong number of arguments for 'xadd' command\r\n"},
+		{"xadd s x-1 f v", "-ERR Invalid stream ID specified as stream command argument\r\n"},
+		{"xadd s maxlen 2 7-0 f v", "$3\r\n7-0\r\n"},
+		{"xlen s", ":2\r\n"},
+		{"xadd missing nomkstream * f v", "$-1\r\n"},
+		{"exists missing", ":0\r\n"},
+		{"xadd bad 0-0 f v", "-ERR The ID specified in XADD must be greater than 0-0\r\n"},
+		{"exists bad", ":0\r\n"},
+		{"set str v", "+OK\r\n"},
+		{"xadd str * f v", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+		{"type s", "+stream\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestXRangeAndTrim(t *testing.T) {
+	db := makeDB()
+	for _, id := range []string{"1-0", "2-0", "3-0", "4-0"} {
+		execLine(db, "xadd s "+id+" f "+id)
+	}
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"xrange s - + count 2", "*2\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\nf\r\n$3\r\n1-0\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$3\r\n2-0\r\n"},
+		{"xrange s (3-0 +", "*1\r\n*2\r\n$3\r\n4-0\r\n*2\r\n$1\r\nf\r\n$3\r\n4-0\r\n"},
+		{"xrevrange s + - count 1", "*1\r\n*2\r\n$3\r\n4-0\r\n*2\r\n$1\r\nf\r\n$3\r\n4-0\r\n"},
+		{"xrange s 3 3", "*1\r\n*2\r\n$3\r\n3-0\r\n*2\r\n$1\r\nf\r\n$3\r\n3-0\r\n"},
+		{"xrange missing - +", "*0\r\n"},
+		{"xdel s 2-0 9-0", ":1\r\n"},
+		{"xtrim s minid 4", ":2\r\n"},
+		{"xtrim s maxlen = 0 limit 1", "-ERR syntax error, LIMIT cannot be used without the special ~ option\r\n"},
+		{"xlen s", ":1\r\n"},
+		{"xread count 1 streams s 0", "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n4-0\r\n*2\r\n$1\r\nf\r\n$3\r\n4-0\r\n"},
+		{"xread streams s $", "*-1\r\n"},
+		{"xread count 1 streams s", "-ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestConsumerGroup(t *testing.T) {
+	db := makeDB()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"xgroup create s g $", "-ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.\r\n"},
+		{"xgroup create s g $ mkstream", "+OK\r\n"},
+		{"xgroup create s g $", "-BUSYGROUP Consumer Group name already exists\r\n"},
+		{"xadd s 1-0 a 1", "$3\r\n1-0\r\n"},
+		{"xadd s 2-0 b 2", "$3\r\n2-0\r\n"},
+		{"xreadgroup group nope c streams s >", "-NOGROUP No such key 's' or consumer group 'nope' in XREADGROUP with GROUP option\r\n"},
+		{"xreadgroup group g alice count 1 streams s >", "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n1-0\r\n*2\r\n$1\r\na\r\n$1\r\n1\r\n"},
+		{"xreadgroup group g bob streams s >", "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{"xreadgroup group g bob streams s >", "*-1\r\n"},
+		// 历史消息：bob 的 PEL 中只有 2-0
+		{"xreadgroup group g bob streams s 0", "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nb\r\n$1\r\n2\r\n"},
+		{"xpending s g", "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n"},
+		{"xpending s nope", "-NOGROUP No such key 's' or consumer group 'nope'\r\n"},
+		{"xack s g 1-0 1-0 9-0", ":1\r\n"},
+		// 已经删除的消息在历史中回复 [id, nil]
+		{"xdel s 2-0", ":1\r\n"},
+		{"xreadgroup group g bob streams s 0", "*1\r\n*2\r\n$1\r\ns\r\n*1\r\n*2\r\n$3\r\n2-0\r\n*-1\r\n"},
+		{"xgroup createconsumer s g carol", ":1\r\n"},
+		{"xgroup createconsumer s g carol", ":0\r\n"},
+		{"xgroup delconsumer s g bob", ":1\r\n"},
+		{"xpending s g", "*4\r\n:0\r\n$-1\r\n$-1\r\n*-1\r\n"},
+		{"xgroup setid s nope 0", "-NOGROUP No such consumer group 'nope' for key name 's'\r\n"},
+		{"xgroup setid s g 0", "+OK\r\n"},
+		{"xgroup destroy s g", ":1\r\n"},
+		{"xgroup destroy s g", ":0\r\n"},
+		{"xgroup foo s g", "-ERR unknown subcommand 'foo'. Try XGROUP HELP.\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestXReadGroupNoAck(t *testing.T) {
+	db := makeDB()
+	execLine(db, "xgroup create s g 0 mkstream")
+	execLine(db, "xadd s 1-0 f v")
+	execLine(db, "xreadgroup group g c noack streams s >")
+	if got := execLine(db, "xpending s g"); got != "*4\r\n:0\r\n$-1\r\n$-1\r\n*-1\r\n" {
+		t.Errorf("NOACK reads must not enter the PEL, got %q", got)
+	}
+}
+
+func TestXClaim(t *testing.T) {
+	db := makeDB()
+	execLine(db, "xgroup create s g 0 mkstream")
+	for _, id := range []string{"1-0", "2-0", "3-0"} {
+		execLine(db, "xadd s "+id+" f v")
+	}
+	execLine(db, "xreadgroup group g alice streams s >")
+	execLine(db, "xdel s 3-0")
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		// 空闲时间不足，不能认领
+		{"xclaim s g bob 3600000 1-0", "*0\r\n"},
+		// IDLE 把投递时间设为很久以前，RETRYCOUNT 直接设置投递次数
+		{"xclaim s g alice 0 1-0 idle 7200000 retrycount 5 justid", "*1\r\n$3\r\n1-0\r\n"},
+		{"xclaim s g bob 3600000 1-0 justid", "*1\r\n$3\r\n1-0\r\n"},
+		{"xpending s g - + 10 bob", "*1\r\n*4\r\n$3\r\n1-0\r\n$3\r\nbob\r\n:"},
+		// 不使用 JUSTID 的认领会增加投递次数
+		{"xclaim s g alice 0 2-0", "*1\r\n*2\r\n$3\r\n2-0\r\n*2\r\n$1\r\nf\r\n$1\r\nv\r\n"},
+		// 已经删除的消息直接从 PEL 中移除
+		{"xclaim s g bob 0 3-0", "*0\r\n"},
+		{"xpending s g", "*4\r\n:2\r\n$3\r\n1-0\r\n$3\r\n2-0\r\n*2\r\n*2\r\n$5\r\nalice\r\n$1\r\n1\r\n*2\r\n$3\r\nbob\r\n$1\r\n1\r\n"},
+		// FORCE 可以认领不在 PEL 中但仍在 stream 中的消息
+		{"xadd s 4-0 f v", "$3\r\n4-0\r\n"},
+		{"xclaim s g carol 0 4-0", "*0\r\n"},
+		{"xclaim s g carol 0 4-0 force justid lastid 4-0", "*1\r\n$3\r\n4-0\r\n"},
+		{"xclaim s g carol 0 1-0 foo", "-ERR Unrecognized XCLAIM option 'foo'\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); !strings.HasPrefix(got, tt.want) {
+			t.Errorf("%s: got %q, want prefix %q", tt.cmd, got, tt.want)
+		}
+	}
+	// 1-0 的投递次数：RETRYCOUNT 设为5，之后 bob 用 JUSTID 认领不增加
+	if got := execLine(db, "xpending s g - + 1"); !strings.HasSuffix(got, ":5\r\n") {
+		t.Errorf("delivery count of 1-0: %q, want 5", got)
+	}
+	if got := execLine(db, "xpending s g 2-0 2-0 1"); !strings.HasSuffix(got, ":2\r\n") {
+		t.Errorf("delivery count of 2-0: %q, want 2", got)
+	}
+}
+
+func TestXAutoClaim(t *testing.T) {
+	db := makeDB()
+	execLine(db, "xgroup create s g 0 mkstream")
+	for _, id := range []string{"1-0", "2-0", "3-0", "4-0"} {
+		execLine(db, "xadd s "+id+" f v")
+	}
+	execLine(db, "xreadgroup group g alice streams s >")
+	execLine(db, "xdel s 2-0")
+
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"xautoclaim s g bob 3600000 0", "*3\r\n$3\r\n0-0\r\n*0\r\n*0\r\n"},
+		// 扫描到 2-0 时发现已删除，移出 PEL 并在第三个成员中返回
+		{"xautoclaim s g bob 0 0 count 2 justid", "*3\r\n$3\r\n4-0\r\n*2\r\n$3\r\n1-0\r\n$3\r\n3-0\r\n*1\r\n$3\r\n2-0\r\n"},
+		{"xautoclaim s g bob 0 4-0 justid", "*3\r\n$3\r\n0-0\r\n*1\r\n$3\r\n4-0\r\n*0\r\n"},
+		{"xautoclaim s g bob 0 0 count 0", "-ERR COUNT must be > 0\r\n"},
+		{"xautoclaim s nope bob 0 0", "-NOGROUP No such key 's' or consumer group 'nope'\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestXInfo(t *testing.T) {
+	db := makeDB()
+	execLine(db, "xadd s 1-0 f v")
+	execLine(db, "xadd s 2-0 f v")
+	execLine(db, "xadd s 3-0 f v")
+	execLine(db, "xgroup create s g 0")
+	execLine(db, "xreadgroup group g alice count 1 streams s >")
+	execLine(db, "xgroup createconsumer s g bob")
+	execLine(db, "xdel s 3-0")
+
+	tests := []struct {
+		cmd      string
+		contains []string
+	}{
+		{"xinfo groups s", []string{"$4\r\nname\r\n$1\r\ng\r\n", "$9\r\nconsumers\r\n:2\r\n", "$7\r\npending\r\n:1\r\n",
+			"$17\r\nlast-delivered-id\r\n$3\r\n1-0\r\n", "$12\r\nentries-read\r\n:1\r\n", "$3\r\nlag\r\n:1\r\n"}},
+		{"xinfo consumers s g", []string{"$5\r\nalice\r\n$7\r\npending\r\n:1\r\n", "$3\r\nbob\r\n$7\r\npending\r\n:0\r\n",
+			"$8\r\ninactive\r\n:-1\r\n"}},
+		{"xinfo stream s", []string{"$6\r\nlength\r\n:2\r\n", "$17\r\nlast-generated-id\r\n$3\r\n3-0\r\n",
+			"$20\r\nmax-deleted-entry-id\r\n$3\r\n3-0\r\n", "$13\r\nentries-added\r\n:3\r\n", "$6\r\ngroups\r\n:1\r\n"}},
+		{"xinfo stream s full", []string{"$7\r\nentries\r\n*2\r\n", "$9\r\npel-count\r\n:1\r\n", "$5\r\nalice\r\n"}},
+		{"xinfo stream missing", []string{"-ERR no such key\r\n"}},
+		{"xinfo consumers s nope", []string{"-NOGROUP No such consumer group 'nope' for key name 's'\r\n"}},
+	}
+	for _, tt := range tests {
+		got := execLine(db, tt.cmd)
+		for _, want := range tt.contains {
+			if !strings.Contains(got, want) {
+				t.Errorf("%s: %q does not contain %q", tt.cmd, got, want)
+			}
+		}
+	}
+}
@@ -3,6 +3,7 @@ package database
 import (
 	"go_redis/interface/database"
 	"go_redis/interface/resp"
+	"go_redis/lib/utils"
 	"go_redis/resp/reply"
 )
 
@@ -13,6 +14,7 @@ import (
 func (db *DB) getAsString(key string) ([]byte, reply.ErrorReply) {
 	entity, ok := db.GetEntity(key)
 	if !ok {
+		db.notifyKeyspaceEvent(notifyKeyMiss, "keymiss", key)
 		return nil, nil
 	}
 	bytes, ok := entity.Data.([]byte)
@@ -38,30 +40,41 @@ func execGet(db *DB, args [][]byte) resp.Reply {
 // execSet
 func execSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	value := args[1]
+	// 参数指向解析器复用的缓冲区，保存前需要复制
+	value := utils.CopyBytes(args[1])
 	entity := &database.DataEntity{
 		Data: value,
 	}
 	db.PutEntity(key, entity)
+	db.notifyKeyspaceEvent(notifyString, "set", key)
 	return &reply.OkReply{}
 }
 
 func execSetNX(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	value := args[1]
+	value := utils.CopyBytes(args[1])
 	entity := &database.DataEntity{
 		Data: value,
 	}
 	result := db.PutIfAbsent(key, entity)
+	if result > 0 {
+		db.notifyKeyspaceEvent(notifyString, "set", key)
+	}
 	return reply.MakeIntReply(int64(result))
 }
 
 func execGetSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	value := args[1]
+	value := utils.CopyBytes(args[1])
 
 	entity, exists := db.GetEntity(key)
+	if exists {
+		if _, ok := entity.Data.([]byte); !ok {
+			return &reply.WrongTypeErrReply{}
+		}
+	}
 	db.PutEntity(key, &database.DataEntity{Data: value})
+	db.notifyKeyspaceEvent(notifyString, "set", key)
 	if !exists {
 		return reply.MakeNullBulkReply()
 	}
@@ -74,16 +87,30 @@ func execStrLen(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	entity, exists := db.GetEntity(key)
 	if !exists {
+		db.notifyKeyspaceEvent(notifyKeyMiss, "keymiss", key)
 		return reply.MakeNullBulkReply()
 	}
-	old := entity.Data.([]byte)
+	old, ok := entity.Data.([]byte)
+	if !ok {
+		return &reply.WrongTypeErrReply{}
+	}
 	return reply.MakeIntReply(int64(len(old)))
 }
 
 func init() {
-	RegisterCommand("Get", execGet, 2)
-	RegisterCommand("Set", execSet, -3)
-	RegisterCommand("SetNx", execSetNX, 3)
-	RegisterCommand("GetSet", execGetSet, 3)
-	RegisterCommand("StrLen", execStrLen, 2)
+	RegisterCommand("Get", execGet, 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).attachCategories("string").
+		attachDocs("string", "1.0.0", "Returns the string value of a key.")
+	RegisterCommand("Set", execSet, -3, flagWrite|flagDenyOOM).
+		attachKeys(1, 1, 1).attachCategories("string").
+		attachDocs("string", "1.0.0", "Sets the string value of a key.")
+	RegisterCommand("SetNx", execSetNX, 3, flagWrite|flagDenyOOM|flagFast).
+		attachKeys(1, 1, 1).attachCategories("string").
+		attachDocs("string", "1.0.0", "Set the string value of a key only when the key doesn't exist.")
+	RegisterCommand("GetSet", execGetSet, 3, flagWrite|flagDenyOOM|flagFast).
+		attachKeys(1, 1, 1).attachCategories("string").
+		attachDocs("string", "1.0.0", "Returns the previous string value of a key after setting it to a new value.")
+	RegisterCommand("StrLen", execStrLen, 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).attachCategories("string").
+		attachDocs("string", "2.2.0", "Returns the length of a string value.")
 }
@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+// TestStoredArgsAreCopied 参数指向解析器复用的缓冲区，保存参数的指令必须先复制，
+// 执行之后修改参数的内容不能影响数据库中的数据
+func TestStoredArgsAreCopied(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	c := &blockingConn{}
+	for _, name := range []string{"set", "setnx", "getset"} {
+		key := name + "-key"
+		cmdLine := toCmdLine(name, key, "value")
+		mdb.Exec(c, cmdLine)
+		// 模拟解析器读取下一条指令时覆盖缓冲区
+		copy(cmdLine[1], "xxxxxxxxxxxxx")
+		copy(cmdLine[2], "XXXXX")
+
+		got := mdb.Exec(c, toCmdLine("get", key)).ToBytes()
+		if string(got) != "$5\r\nvalue\r\n" {
+			t.Errorf("%s: stored value changed to %q after the buffer was reused", name, got)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package database
+
+import (
+	"errors"
+	"go_redis/config"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * 客户端缓存：CLIENT TRACKING
+ * 开启 tracking 的客户端读取过的 key 被修改后，服务端向它发送失效消息，客户端据此清除本地缓存。
+ * 当前版本只支持 RESP2，失效消息以 __redis__:invalidate 频道的发布订阅消息的形式
+ * 发送给 REDIRECT 指定的连接，该连接通常已经订阅了这个频道。
+ *
+ * 默认模式下服务端在 tracking 表中记录每个客户端读取过的 key，表中的 key 数量超过
+ * tracking-table-max-keys 时，随机淘汰一部分 key 并提前发送失效消息。
+ * BCAST 模式下不记录读取过的 key，修改的 key 只要匹配客户端注册的前缀就发送失效消息。
+ */
+
+// trackingChannel 是失效消息使用的频道
+const trackingChannel = "__redis__:invalidate"
+
+// 客户端通过 CLIENT CACHING 设置的对下一条指令的缓存选项
+const (
+	cachingDefault = iota
+	cachingYes
+	cachingNo
+)
+
+// trackingClient 是一个开启了 tracking 的客户端
+type trackingClient struct {
+	conn resp.Connection
+	// 接收失效消息的连接
+	redirect   resp.Connection
+	redirectID int64
+	bcast      bool
+	prefixes   []string
+	optIn      bool
+	optOut     bool
+	noLoop     bool
+	// CLIENT CACHING 设置的选项，只对下一条指令有效
+	caching int
+	// caching 是不是当前这条指令设置的，是的话在指令执行完之后保留
+	cachingArmed bool
+}
+
+// trackingTable 保存开启了 tracking 的客户端和它们读取过的 key
+type trackingTable struct {
+	mu      sync.Mutex
+	clients map[resp.Connection]*trackingClient
+	// key -> 读取过这个 key 的客户端，客户端关闭 tracking 之后这里的记录会在下次失效时被清除
+	keys map[string]map[*trackingClient]struct{}
+}
+
+// trackingOptions 是 CLIENT TRACKING ON 的参数
+type trackingOptions struct {
+	redirect   resp.Connection
+	redirectID int64
+	bcast      bool
+	prefixes   []string
+	optIn      bool
+	optOut     bool
+	noLoop     bool
+}
+
+// enable 为客户端开启 tracking，已经开启时更新它的选项
+func (table *trackingTable) enable(c resp.Connection, opts *trackingOptions) error {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	if table.clients == nil {
+		table.clients = make(map[resp.Connection]*trackingClient)
+		table.keys = make(map[string]map[*trackingClient]struct{})
+	}
+	if old, ok := table.clients[c]; ok {
+		// 和Redis官方一样，不允许在开启状态下切换模式
+		if old.bcast != opts.bcast {
+			return errors.New("ERR You can't switch BCAST mode on/off before disabling tracking for this client, and then re-enabling it with a different mode.")
+		}
+		if old.optIn != opts.optIn || old.optOut != opts.optOut {
+			return errors.New("ERR You can't switch OPTIN/OPTOUT mode before disabling tracking for this client, and then re-enabling it with a different mode.")
+		}
+		// tracking 表中记录的是 *trackingClient，原地更新才能保留客户端已经读取过的 key
+		old.redirect = opts.redirect
+		old.redirectID = opts.redirectID
+		old.prefixes = append(old.prefixes, opts.prefixes...)
+		old.noLoop = opts.noLoop
+		return nil
+	}
+	table.clients[c] = &trackingClient{
+		conn:       c,
+		redirect:   opts.redirect,
+		redirectID: opts.redirectID,
+		bcast:      opts.bcast,
+		prefixes:   opts.prefixes,
+		optIn:      opts.optIn,
+		optOut:     opts.optOut,
+		noLoop:     opts.noLoop,
+	}
+	return nil
+}
+
+// disable 关闭客户端的 tracking
+func (table *trackingTable) disable(c resp.Connection) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	delete(table.clients, c)
+}
+
+// get 返回客户端的 tracking 状态的副本，没有开启时返回 nil
+func (table *trackingTable) get(c resp.Connection) *trackingClient {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	client, ok := table.clients[c]
+	if !ok {
+		return nil
+	}
+	copied := *client
+	return &copied
+}
+
+// setCaching 处理 CLIENT CACHING YES|NO
+func (table *trackingTable) setCaching(c resp.Connection, yes bool) error {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	client, ok := table.clients[c]
+	if !ok || (yes && !client.optIn) {
+		return errors.New("ERR CLIENT CACHING YES is only valid when tracking is enabled in OPTIN mode.")
+	}
+	if !yes && !client.optOut {
+		return errors.New("ERR CLIENT CACHING NO is only valid when tracking is enabled in OPTOUT mode.")
+	}
+	if yes {
+		client.caching = cachingYes
+	} else {
+		client.caching = cachingNo
+	}
+	client.cachingArmed = true
+	return nil
+}
+
+// removeClient 在客户端断开连接时清除它的 tracking 状态
+func (table *trackingTable) removeClient(c resp.Connection) {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	delete(table.clients, c)
+	for _, client := range table.clients {
+		if client.redirect == c {
+			// 接收失效消息的连接已经断开，之后的失效消息会被丢弃
+			client.redirect = nil
+		}
+	}
+}
+
+// count 返回开启了 tracking 的客户端数量
+func (table *trackingTable) count() int {
+	table.mu.Lock()
+	defer table.mu.Unlock()
+	return len(table.clients)
+}
+
+// invalidation 是一条待发送的失效消息
+type invalidation struct {
+	conn resp.Connection
+	keys [][]byte
+}
+
+// beforeCommand 在读取 key 之前调用：记录只读指令将要读取的 key。
+// 先记录再读取，读取之后其他客户端修改 key 时一定会发送失效消息，客户端不会缓存过期的值
+func (table *trackingTable) beforeCommand(c resp.Connection, cmd *command, cmdLine CmdLine) {
+	if cmd.flags&flagReadOnly == 0 {
+		return
+	}
+	table.mu.Lock()
+	client, ok := table.clients[c]
+	if !ok || client.bcast || !client.shouldCache() {
+		table.mu.Unlock()
+		return
+	}
+	for _, key := range cmd.getKeys(cmdLine) {
+		table.remember(client, string(key))
+	}
+	pending := table.evictIfNeeded()
+	table.mu.Unlock()
+	sendInvalidations(pending)
+}
+
+// afterCommand 在指令执行之后调用：为写指令修改的 key 发送失效消息，并清除只对这条指令有效的 CLIENT CACHING 选项
+func (table *trackingTable) afterCommand(c resp.Connection, cmd *command, cmdLine CmdLine) {
+	table.mu.Lock()
+	if len(table.clients) == 0 {
+		table.mu.Unlock()
+		return
+	}
+	var pending []invalidation
+	if client, ok := table.clients[c]; ok {
+		if client.cachingArmed {
+			client.cachingArmed = false
+		} else {
+			client.caching = cachingDefault
+		}
+	}
+	if cmd.flags&flagWrite > 0 {
+		for _, key := range cmd.getKeys(cmdLine) {
+			pending = append(pending, table.invalidateLocked(string(key), c)...)
+		}
+	}
+	table.mu.Unlock()
+	sendInvalidations(pending)
+}
+
+// shouldCache 判断当前指令读取的 key 是否需要记录
+func (client *trackingClient) shouldCache() bool {
+	if client.optIn {
+		return client.caching == cachingYes
+	}
+	if client.optOut {
+		return client.caching != cachingNo
+	}
+	return true
+}
+
+// remember 记录客户端读取过 key，必须在持有锁时调用
+func (table *trackingTable) remember(client *trackingClient, key string) {
+	clients, ok := table.keys[key]
+	if !ok {
+		clients = make(map[*trackingClient]struct{})
+		table.keys[key] = clients
+	}
+	clients[client] = struct{}{}
+}
+
+// evictIfNeeded 在 tracking 表超出 tracking-table-max-keys 时随机淘汰 key，
+// 返回需要发送的失效消息，必须在持有锁时调用
+func (table *trackingTable) evictIfNeeded() []invalidation {
+	maxKeys := config.Properties().TrackingTableMaxKeys
+	if maxKeys <= 0 || len(table.keys) <= maxKeys {
+		return nil
+	}
+	var pending []invalidation
+	// map 的遍历顺序是随机的
+	for key := range table.keys {
+		if len(table.keys) <= maxKeys {
+			break
+		}
+		pending = append(pending, table.untrackLocked(key, nil)...)
+	}
+	return pending
+}
+
+// invalidateLocked 生成 key 被修改后需要发送的失效消息，并从 tracking 表中删除 key，
+// source 是修改 key 的客户端，必须在持有锁时调用
+func (table *trackingTable) invalidateLocked(key string, source resp.Connection) []invalidation {
+	pending := table.untrackLocked(key, source)
+	for _, client := range table.clients {
+		if !client.bcast || client.redirect == nil || (client.noLoop && client.conn == source) {
+			continue
+		}
+		if matchPrefixes(client.prefixes, key) {
+			pending = append(pending, invalidation{conn: client.redirect, keys: [][]byte{[]byte(key)}})
+		}
+	}
+	return pending
+}
+
+// untrackLocked 从 tracking 表中删除 key，返回需要通知读取过 key 的客户端的失效消息，必须在持有锁时调用
+func (table *trackingTable) untrackLocked(key string, source resp.Connection) []invalidation {
+	var pending []invalidation
+	for client := range table.keys[key] {
+		if table.clients[client.conn] != client {
+			// 客户端已经关闭了 tracking 或者重新开启过
+			continue
+		}
+		if client.noLoop && client.conn == source {
+			continue
+		}
+		if client.redirect != nil {
+			pending = append(pending, invalidation{conn: client.redirect, keys: [][]byte{[]byte(key)}})
+		}
+	}
+	delete(table.keys, key)
+	return pending
+}
+
+// invalidate 在 key 被修改后发送失效消息，用于不经过 afterCommand 的修改，例如内存淘汰
+func (table *trackingTable) invalidate(key string) {
+	table.mu.Lock()
+	if len(table.clients) == 0 {
+		table.mu.Unlock()
+		return
+	}
+	pending := table.invalidateLocked(key, nil)
+	table.mu.Unlock()
+	sendInvalidations(pending)
+}
+
+// invalidateAll 在清空数据库后通知所有客户端清除全部缓存
+func (table *trackingTable) invalidateAll() {
+	table.mu.Lock()
+	if len(table.clients) == 0 {
+		table.mu.Unlock()
+		return
+	}
+	table.keys = make(map[string]map[*trackingClient]struct{})
+	pending := make([]invalidation, 0, len(table.clients))
+	for _, client := range table.clients {
+		if client.redirect != nil {
+			// keys 为 nil 表示所有的 key 都失效了
+			pending = append(pending, invalidation{conn: client.redirect})
+		}
+	}
+	table.mu.Unlock()
+	sendInvalidations(pending)
+}
+
+func matchPrefixes(prefixes []string, key string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendInvalidations 发送失效消息，在释放锁之后调用
+func sendInvalidations(pending []invalidation) {
+	for _, inv := range pending {
+		var payload resp.Reply
+		if inv.keys == nil {
+			payload = reply.MakeNullBulkReply()
+		} else {
+			payload = reply.MakeMultiBulkReply(inv.keys)
+		}
+		msg := reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("message")),
+			reply.MakeBulkReply([]byte(trackingChannel)),
+			payload,
+		})
+		_ = inv.conn.Write(msg.ToBytes())
+	}
+}
+
+// execClientTracking CLIENT TRACKING ON|OFF [REDIRECT id] [PREFIX prefix ...] [BCAST] [OPTIN] [OPTOUT] [NOLOOP]
+func execClientTracking(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("client|tracking")
+	}
+	opts := &trackingOptions{}
+	for i := 1; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "redirect":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+			id, err := strconv.ParseInt(string(args[i]), 10, 64)
+			if err != nil {
+				return reply.MakeErrReply("ERR value is not an integer or out of range")
+			}
+			if id == c.GetID() {
+				opts.redirect = c
+			} else if mdb.clientLookup != nil {
+				opts.redirect = mdb.clientLookup(id)
+			}
+			if opts.redirect == nil {
+				return reply.MakeErrReply("ERR The client ID you want redirect to does not exist")
+			}
+			opts.redirectID = id
+		case "prefix":
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+			opts.prefixes = append(opts.prefixes, string(args[i]))
+		case "bcast":
+			opts.bcast = true
+		case "optin":
+			opts.optIn = true
+		case "optout":
+			opts.optOut = true
+		case "noloop":
+			opts.noLoop = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	switch strings.ToLower(string(args[0])) {
+	case "on":
+		if len(opts.prefixes) > 0 && !opts.bcast {
+			return reply.MakeErrReply("ERR PREFIX option requires BCAST mode to be enabled")
+		}
+		if opts.optIn && opts.optOut {
+			return reply.MakeErrReply("ERR You can't use both OPTIN and OPTOUT")
+		}
+		if opts.bcast && (opts.optIn || opts.optOut) {
+			return reply.MakeErrReply("ERR OPTIN and OPTOUT are not compatible with BCAST")
+		}
+		if opts.redirect == nil {
+			// 当前版本没有实现 RESP3，客户端只能通过 REDIRECT 指定的连接接收失效消息
+			return reply.MakeErrReply("ERR RESP2 clients need REDIRECT to receive invalidation messages")
+		}
+		if err := mdb.tracking.enable(c, opts); err != nil {
+			return reply.MakeErrReply(err.Error())
+		}
+		return reply.MakeOkReply()
+	case "off":
+		mdb.tracking.disable(c)
+		return reply.MakeOkReply()
+	}
+	return reply.MakeSyntaxErrReply()
+}
+
+// execClientCaching CLIENT CACHING YES|NO
+func execClientCaching(mdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) != 1 {
+		return reply.MakeArgNumErrReply("client|caching")
+	}
+	var err error
+	switch strings.ToLower(string(args[0])) {
+	case "yes":
+		err = mdb.tracking.setCaching(c, true)
+	case "no":
+		err = mdb.tracking.setCaching(c, false)
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+	if err != nil {
+		return reply.MakeErrReply(err.Error())
+	}
+	return reply.MakeOkReply()
+}
+
+// execClientTrackingInfo CLIENT TRACKINGINFO
+func execClientTrackingInfo(mdb *Database, c resp.Connection) resp.Reply {
+	client := mdb.tracking.get(c)
+	flags := make([][]byte, 0, 4)
+	redirect := int64(-1)
+	var prefixes [][]byte
+	if client == nil {
+		flags = append(flags, []byte("off"))
+	} else {
+		flags = append(flags, []byte("on"))
+		if client.bcast {
+			flags = append(flags, []byte("bcast"))
+		}
+		if client.optIn {
+			flags = append(flags, []byte("optin"))
+			if client.caching == cachingYes {
+				flags = append(flags, []byte("caching-yes"))
+			}
+		}
+		if client.optOut {
+			flags = append(flags, []byte("optout"))
+			if client.caching == cachingNo {
+				flags = append(flags, []byte("caching-no"))
+			}
+		}
+		if client.noLoop {
+			flags = append(flags, []byte("noloop"))
+		}
+		if client.redirect == nil {
+			flags = append(flags, []byte("broken_redirect"))
+		}
+		redirect = client.redirectID
+		for _, prefix := range client.prefixes {
+			prefixes = append(prefixes, []byte(prefix))
+		}
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("flags")),
+		reply.MakeMultiBulkReply(flags),
+		reply.MakeBulkReply([]byte("redirect")),
+		reply.MakeIntReply(redirect),
+		reply.MakeBulkReply([]byte("prefixes")),
+		reply.MakeMultiBulkReply(prefixes),
+	})
+}
+
+// execClientGetRedir CLIENT GETREDIR
+func execClientGetRedir(mdb *Database, c resp.Connection) resp.Reply {
+	client := mdb.tracking.get(c)
+	if client == nil {
+		return reply.MakeIntReply(-1)
+	}
+	return reply.MakeIntReply(client.redirectID)
+}
@@ -0,0 +1,65 @@
+package database
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTrackingOnAgainKeepsTrackedKeys(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	reader := &recordingConn{blockingConn: &blockingConn{id: 1}}
+	id := strconv.FormatInt(reader.GetID(), 10)
+	mdb.Exec(reader, toCmdLine("client", "tracking", "on", "redirect", id))
+	mdb.Exec(reader, toCmdLine("get", "key"))
+	// 再次开启 tracking 只更新选项，之前读取过的 key 仍然会收到失效消息
+	mdb.Exec(reader, toCmdLine("client", "tracking", "on", "redirect", id, "noloop"))
+	mdb.Exec(&blockingConn{id: 2}, toCmdLine("set", "key", "value"))
+
+	msgs := strings.Join(reader.messages(), "")
+	if !strings.Contains(msgs, trackingChannel) || !strings.Contains(msgs, "$3\r\nkey\r\n") {
+		t.Fatalf("no invalidation for key, got %q", msgs)
+	}
+	if client := mdb.tracking.get(reader); client == nil || !client.noLoop {
+		t.Fatal("options of the second TRACKING ON were not applied")
+	}
+}
+
+func TestTrackingRemembersKeysBeforeRead(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	reader := &recordingConn{blockingConn: &blockingConn{id: 1}}
+	mdb.Exec(reader, toCmdLine("client", "tracking", "on", "redirect", strconv.FormatInt(reader.GetID(), 10)))
+
+	// 读取之前 key 已经在 tracking 表中，读取过程中其他客户端的修改会发送失效消息
+	get := cmdTable["get"]
+	mdb.tracking.beforeCommand(reader, get, toCmdLine("get", "key"))
+	mdb.Exec(&blockingConn{id: 2}, toCmdLine("set", "key", "value"))
+	if msgs := strings.Join(reader.messages(), ""); !strings.Contains(msgs, "$3\r\nkey\r\n") {
+		t.Fatalf("no invalidation for key read concurrently, got %q", msgs)
+	}
+}
+
+func TestTrackingInvalidatesAfterBlockedWrite(t *testing.T) {
+	mdb := NewDatabase()
+	defer mdb.Close()
+	blocker := &blockingConn{id: 3}
+	blocked, ok := mdb.Exec(blocker, toCmdLine("blpop", "list", "0")).(*BlockedReply)
+	if !ok {
+		t.Fatal("blpop on a missing key should block")
+	}
+	mdb.Exec(&blockingConn{id: 2}, toCmdLine("rpush", "list", "a"))
+	reader := &recordingConn{blockingConn: &blockingConn{id: 1}}
+	mdb.Exec(reader, toCmdLine("client", "tracking", "on", "redirect", "1"))
+	mdb.Exec(reader, toCmdLine("lrange", "list", "0", "-1"))
+
+	// 被唤醒的 BLPOP 弹出了元素，读取过这个 key 的客户端要收到失效消息
+	if got := string(mdb.Block(context.Background(), blocker, blocked).ToBytes()); got != "*2\r\n$4\r\nlist\r\n$1\r\na\r\n" {
+		t.Fatalf("blpop got %q", got)
+	}
+	if msgs := strings.Join(reader.messages(), ""); !strings.Contains(msgs, "$4\r\nlist\r\n") {
+		t.Fatalf("no invalidation after blocked pop, got %q", msgs)
+	}
+}
@@ -0,0 +1,383 @@
+package database
+
+import (
+	SortedSet "go_redis/datastructure/sortedset"
+	"go_redis/interface/database"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"math"
+	"strconv"
+	"strings"
+)
+
+/*
+ * 处理和 zset 类型有关的Redis指令
+ * zset 会被原地修改，所有指令都通过 lockedExec 在 DB 的锁内执行
+ * 和 Redis 一样，元素被全部删除后删除这个 key
+ */
+
+// getAsSortedSet 返回 key 对应的 zset，key 不存在时返回 nil
+func (db *DB) getAsSortedSet(key string) (*SortedSet.SortedSet, reply.ErrorReply) {
+	entity, ok := db.GetEntity(key)
+	if !ok {
+		return nil, nil
+	}
+	set, ok := entity.Data.(*SortedSet.SortedSet)
+	if !ok {
+		return nil, &reply.WrongTypeErrReply{}
+	}
+	db.touchContainer(key, entity)
+	return set, nil
+}
+
+// removeIfEmptySortedSet 在 zset 的元素被全部删除后删除 key
+func (db *DB) removeIfEmptySortedSet(key string, set *SortedSet.SortedSet) {
+	if set.Len() == 0 {
+		db.Remove(key)
+		db.notifyKeyspaceEvent(notifyGeneric, "del", key)
+	}
+}
+
+// zpopEvent 返回弹出分数最小或最大的元素的事件名称
+func zpopEvent(max bool) string {
+	if max {
+		return "zpopmax"
+	}
+	return "zpopmin"
+}
+
+// parseScore 解析分数，支持 inf、+inf 和 -inf
+func parseScore(arg []byte) (float64, reply.ErrorReply) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, reply.MakeErrReply("ERR value is not a valid float")
+	}
+	return score, nil
+}
+
+// formatScore 按照 Redis 的格式输出分数
+func formatScore(score float64) []byte {
+	switch {
+	case math.IsInf(score, 1):
+		return []byte("inf")
+	case math.IsInf(score, -1):
+		return []byte("-inf")
+	}
+	return []byte(strconv.FormatFloat(score, 'g', -1, 64))
+}
+
+// makeElementsReply 把元素转为回复，withScores 为 true 时每个 member 后面跟着它的分数
+func makeElementsReply(elements []*SortedSet.Element, withScores bool) resp.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, formatScore(element.Score))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execZAdd ZADD key [NX|XX] [CH] score member [score member ...]
+func execZAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	var nx, xx, ch bool
+	i := 1
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "NX":
+			nx = true
+			continue
+		case "XX":
+			xx = true
+			continue
+		case "CH":
+			ch = true
+			continue
+		}
+		break
+	}
+	if nx && xx {
+		return reply.MakeErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	// 先解析全部分数，有非法的分数时不做任何修改
+	elements := make([]*SortedSet.Element, 0, len(pairs)/2)
+	for j := 0; j < len(pairs); j += 2 {
+		score, errReply := parseScore(pairs[j])
+		if errReply != nil {
+			return errReply
+		}
+		elements = append(elements, &SortedSet.Element{Member: string(pairs[j+1]), Score: score})
+	}
+
+	set, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	created := false
+	if set == nil {
+		if xx {
+			return reply.MakeIntReply(0)
+		}
+		set = SortedSet.Make()
+		created = true
+	}
+	var added, changed int64
+	for _, element := range elements {
+		old, exists := set.Get(element.Member)
+		if exists && nx || !exists && xx {
+			continue
+		}
+		if !exists {
+			added++
+		} else if old.Score != element.Score {
+			changed++
+		}
+		set.Add(element.Member, element.Score)
+	}
+	if created {
+		if set.Len() > 0 {
+			db.PutEntity(key, &database.DataEntity{Data: set})
+		}
+	} else if added > 0 {
+		// 已有的 zset 是原地修改的，新增了元素时需要单独唤醒等待者
+		db.signalKeyReady(key)
+	}
+	if added+changed > 0 {
+		db.notifyKeyspaceEvent(notifyZSet, "zadd", key)
+	}
+	if ch {
+		return reply.MakeIntReply(added + changed)
+	}
+	return reply.MakeIntReply(added)
+}
+
+// execZCard ZCARD key
+func execZCard(db *DB, args [][]byte) resp.Reply {
+	set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(set.Len())
+}
+
+// execZScore ZSCORE key member
+func execZScore(db *DB, args [][]byte) resp.Reply {
+	set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return &reply.NullBulkReply{}
+	}
+	element, ok := set.Get(string(args[1]))
+	if !ok {
+		return &reply.NullBulkReply{}
+	}
+	return reply.MakeBulkReply(formatScore(element.Score))
+}
+
+// execZRange ZRANGE key start stop [REV] [WITHSCORES]，按排名取元素，下标可以是负数
+func execZRange(db *DB, args [][]byte) resp.Reply {
+	start, err1 := strconv.ParseInt(string(args[1]), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2]), 10, 64)
+	if err1 != nil || err2 != nil {
+		return reply.MakeErrReply("ERR value is not an integer or out of range")
+	}
+	var rev, withScores bool
+	for _, arg := range args[3:] {
+		switch strings.ToUpper(string(arg)) {
+		case "REV":
+			rev = true
+		case "WITHSCORES":
+			withScores = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	from, to, ok := normalizeRange(start, stop, set.Len())
+	if !ok {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	return makeElementsReply(set.Range(from, to, rev), withScores)
+}
+
+// execZRem ZREM key member [member ...]
+func execZRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	set, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return reply.MakeIntReply(0)
+	}
+	var removed int64
+	for _, member := range args[1:] {
+		if set.Remove(string(member)) {
+			removed++
+		}
+	}
+	if removed > 0 {
+		db.notifyKeyspaceEvent(notifyZSet, "zrem", key)
+	}
+	db.removeIfEmptySortedSet(key, set)
+	return reply.MakeIntReply(removed)
+}
+
+func popFromSortedSet(set *SortedSet.SortedSet, count int, max bool) []*SortedSet.Element {
+	if max {
+		return set.PopMax(count)
+	}
+	return set.PopMin(count)
+}
+
+func execZPopGeneric(db *DB, args [][]byte, max bool) resp.Reply {
+	key := string(args[0])
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	count := 1
+	if len(args) == 2 {
+		n, errReply := parseNonNegative(args[1])
+		if errReply != nil {
+			return errReply
+		}
+		count = int(n)
+	}
+	set, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if set == nil {
+		return &reply.EmptyMultiBulkReply{}
+	}
+	popped := popFromSortedSet(set, count, max)
+	if len(popped) > 0 {
+		db.notifyKeyspaceEvent(notifyZSet, zpopEvent(max), key)
+	}
+	db.removeIfEmptySortedSet(key, set)
+	return makeElementsReply(popped, true)
+}
+
+// execZPopMin ZPOPMIN key [count]
+func execZPopMin(db *DB, args [][]byte) resp.Reply {
+	return execZPopGeneric(db, args, false)
+}
+
+// execZPopMax ZPOPMAX key [count]
+func execZPopMax(db *DB, args [][]byte) resp.Reply {
+	return execZPopGeneric(db, args, true)
+}
+
+func execBZPopGeneric(db *DB, args [][]byte, max bool) resp.Reply {
+	timeout, errReply := parseBlockTimeout(args[len(args)-1])
+	if errReply != nil {
+		return errReply
+	}
+	keys := make([]string, len(args)-1)
+	for i, arg := range args[:len(args)-1] {
+		keys[i] = string(arg)
+	}
+	for _, key := range keys {
+		set, errReply := db.getAsSortedSet(key)
+		if errReply != nil {
+			return errReply
+		}
+		if set == nil {
+			continue
+		}
+		element := popFromSortedSet(set, 1, max)[0]
+		db.notifyKeyspaceEvent(notifyZSet, zpopEvent(max), key)
+		db.removeIfEmptySortedSet(key, set)
+		return reply.MakeMultiBulkReply([][]byte{[]byte(key), []byte(element.Member), formatScore(element.Score)})
+	}
+	return db.Block(keys, timeout, &reply.NullMultiBulkReply{})
+}
+
+// execBZPopMin BZPOPMIN key [key ...] timeout
+func execBZPopMin(db *DB, args [][]byte) resp.Reply {
+	return execBZPopGeneric(db, args, false)
+}
+
+// execBZPopMax BZPOPMAX key [key ...] timeout
+func execBZPopMax(db *DB, args [][]byte) resp.Reply {
+	return execBZPopGeneric(db, args, true)
+}
+
+// execZScan ZSCAN key cursor [MATCH pattern] [COUNT count]
+// 和 Redis 中元素较少的 zset 一样，一次返回全部匹配的元素，返回的游标总是0
+func execZScan(db *DB, args [][]byte) resp.Reply {
+	if _, errReply := parseScanCursor(args[1]); errReply != nil {
+		return errReply
+	}
+	opts, errReply := parseScanOptions(args[2:], false)
+	if errReply != nil {
+		return errReply
+	}
+	set, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, 0)
+	if set != nil {
+		set.ForEach(func(element *SortedSet.Element) bool {
+			if opts.pattern == nil || opts.pattern.IsMatch(element.Member) {
+				result = append(result, []byte(element.Member), formatScore(element.Score))
+			}
+			return true
+		})
+	}
+	return makeScanReply(0, result)
+}
+
+func init() {
+	RegisterCommand("ZAdd", lockedExec(execZAdd), -4, flagWrite|flagDenyOOM|flagFast).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "1.2.0", "Adds one or more members to a sorted set, or updates their scores. Creates the key if it doesn't exist.")
+	RegisterCommand("ZCard", lockedExec(execZCard), 2, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "1.2.0", "Returns the number of members in a sorted set.")
+	RegisterCommand("ZScore", lockedExec(execZScore), 3, flagReadOnly|flagFast).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "1.2.0", "Returns the score of a member in a sorted set.")
+	RegisterCommand("ZRange", lockedExec(execZRange), -4, flagReadOnly).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "1.2.0", "Returns members in a sorted set within a range of indexes.")
+	RegisterCommand("ZRem", lockedExec(execZRem), -3, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "1.2.0", "Removes one or more members from a sorted set. Deletes the sorted set if all members were removed.")
+	RegisterCommand("ZPopMin", lockedExec(execZPopMin), -2, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "5.0.0", "Returns the lowest-scoring members from a sorted set after removing them. Deletes the sorted set if the last member was popped.")
+	RegisterCommand("ZPopMax", lockedExec(execZPopMax), -2, flagWrite|flagFast).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "5.0.0", "Returns the highest-scoring members from a sorted set after removing them. Deletes the sorted set if the last member was popped.")
+	RegisterCommand("BZPopMin", lockedExec(execBZPopMin), -3, flagWrite|flagNoScript|flagFast).
+		attachKeys(1, -2, 1).attachCategories("sortedset", "blocking").
+		attachDocs("sorted_set", "5.0.0", "Removes and returns the member with the lowest score from one or more sorted sets. Blocks until a member is available otherwise.")
+	RegisterCommand("BZPopMax", lockedExec(execBZPopMax), -3, flagWrite|flagNoScript|flagFast).
+		attachKeys(1, -2, 1).attachCategories("sortedset", "blocking").
+		attachDocs("sorted_set", "5.0.0", "Removes and returns the member with the highest score from one or more sorted sets. Blocks until a member is available otherwise.")
+	RegisterCommand("ZScan", lockedExec(execZScan), -3, flagReadOnly|flagRandom).
+		attachKeys(1, 1, 1).attachCategories("sortedset").
+		attachDocs("sorted_set", "2.8.0", "Iterates over members and scores of a sorted set.")
+}
@@ -0,0 +1,60 @@
+package database
+
+import "testing"
+
+func TestZSetCommands(t *testing.T) {
+	db := makeDB()
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"zadd z 1 a 2 b 3 c", ":3\r\n"},
+		{"zadd z nx 5 a 4 d", ":1\r\n"},
+		{"zadd z xx ch 1.5 a 9 e", ":1\r\n"},
+		{"zadd z nx xx 1 a", "-ERR XX and NX options at the same time are not compatible\r\n"},
+		{"zadd z x a", "-ERR value is not a valid float\r\n"},
+		{"zadd z 1 a 2", "-Err syntax error\r\n"},
+		{"zcard z", ":4\r\n"},
+		{"zscore z a", "$3\r\n1.5\r\n"},
+		{"zscore z e", "$-1\r\n"},
+		{"zrange z 0 -1", "*4\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n$1\r\nd\r\n"},
+		{"zrange z 0 1 rev withscores", "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{"zadd z -inf m", ":1\r\n"},
+		{"zpopmin z", "*2\r\n$1\r\nm\r\n$4\r\n-inf\r\n"},
+		{"zpopmax z 2", "*4\r\n$1\r\nd\r\n$1\r\n4\r\n$1\r\nc\r\n$1\r\n3\r\n"},
+		{"zrem z a b x", ":2\r\n"},
+		{"exists z", ":0\r\n"},
+		{"zpopmin z", "*0\r\n"},
+		{"zadd z xx 1 a", ":0\r\n"},
+		{"exists z", ":0\r\n"},
+		{"zadd z2 1 a", ":1\r\n"},
+		{"type z2", "+zset\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
+
+func TestZScan(t *testing.T) {
+	db := makeDB()
+	execLine(db, "zadd z 1 a 2 b 3 ab")
+	execLine(db, "set str v")
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{"zscan z 0", "*2\r\n$1\r\n0\r\n*6\r\n$1\r\na\r\n$1\r\n1\r\n$1\r\nb\r\n$1\r\n2\r\n$2\r\nab\r\n$1\r\n3\r\n"},
+		{"zscan z 0 match a* count 1", "*2\r\n$1\r\n0\r\n*4\r\n$1\r\na\r\n$1\r\n1\r\n$2\r\nab\r\n$1\r\n3\r\n"},
+		{"zscan missing 0", "*2\r\n$1\r\n0\r\n*0\r\n"},
+		{"zscan z 0 type zset", "-Err syntax error\r\n"},
+		{"zscan z x", "-ERR invalid cursor\r\n"},
+		{"zscan str 0", "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n"},
+	}
+	for _, tt := range tests {
+		if got := execLine(db, tt.cmd); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.cmd, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package dict
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+/*
+ * ConcurrentDict 是一个分段加锁的字典，key 根据哈希值被分配到固定数量的 shard 中，
+ * 每个 shard 持有一把读写锁。shard 的数量在创建后就不再变化，
+ * 所以 shard 的下标可以直接作为 SCAN 指令的游标使用
+ */
+
+// ConcurrentDict 使用分段锁实现的并发安全的字典
+type ConcurrentDict struct {
+	table []*shard
+	count int32
+}
+
+type shard struct {
+	m     map[string]interface{}
+	mutex sync.RWMutex
+}
+
+// computeCapacity 返回不小于 param 的最小的 2 的整数次幂
+func computeCapacity(param int) (size int) {
+	if param <= 16 {
+		return 16
+	}
+	n := param - 1
+	n |= n >> 1
+	n |= n >> 2
+	n |= n >> 4
+	n |= n >> 8
+	n |= n >> 16
+	if n < 0 || n >= math.MaxInt32 {
+		return math.MaxInt32
+	}
+	return n + 1
+}
+
+// MakeConcurrent 创建一个含有 shardCount 个 shard 的 ConcurrentDict
+func MakeConcurrent(shardCount int) *ConcurrentDict {
+	shardCount = computeCapacity(shardCount)
+	table := make([]*shard, shardCount)
+	for i := 0; i < shardCount; i++ {
+		table[i] = &shard{
+			m: make(map[string]interface{}),
+		}
+	}
+	return &ConcurrentDict{
+		count: 0,
+		table: table,
+	}
+}
+
+const prime32 = uint32(16777619)
+
+// fnv32 计算 key 的哈希值
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash *= prime32
+		hash ^= uint32(key[i])
+	}
+	return hash
+}
+
+// spread 根据哈希值计算 key 所在的 shard 的下标
+func (dict *ConcurrentDict) spread(hashCode uint32) uint32 {
+	tableSize := uint32(len(dict.table))
+	return (tableSize - 1) & hashCode
+}
+
+func (dict *ConcurrentDict) getShard(key string) *shard {
+	return dict.table[dict.spread(fnv32(key))]
+}
+
+// Get 返回key对应的value以及 该key是否存在
+func (dict *ConcurrentDict) Get(key string) (val interface{}, exists bool) {
+	s := dict.getShard(key)
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	val, exists = s.m[key]
+	return
+}
+
+// Len 返回dict中的元素数量
+func (dict *ConcurrentDict) Len() int {
+	return int(atomic.LoadInt32(&dict.count))
+}
+
+// Put 向dict中添加key-value键值对，返回被覆盖的value和新插入的key-value数量
+func (dict *ConcurrentDict) Put(key string, val interface{}) (old interface{}, result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.m[key]; ok {
+		s.m[key] = val
+		return old, 0
+	}
+	dict.addCount()
+	s.m[key] = val
+	return nil, 1
+}
+
+// PutIfAbsent 当key不存在时，才向dict中添加key-value键值对，并返回更新的key-value的数量
+func (dict *ConcurrentDict) PutIfAbsent(key string, val interface{}) (result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.m[key]; ok {
+		return 0
+	}
+	s.m[key] = val
+	dict.addCount()
+	return 1
+}
+
+// PutIfExists 当dict中本来就存在key时，才将key-value插入，返回被覆盖的value和插入的key-value的数量
+func (dict *ConcurrentDict) PutIfExists(key string, val interface{}) (old interface{}, result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.m[key]; ok {
+		s.m[key] = val
+		return old, 1
+	}
+	return nil, 0
+}
+
+// Remove 移除key对应的key-value，返回被删除的value和删除的key-value的数量
+func (dict *ConcurrentDict) Remove(key string) (old interface{}, result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.m[key]; ok {
+		delete(s.m, key)
+		dict.decreaseCount()
+		return old, 1
+	}
+	return nil, 0
+}
+
+// RemoveIfSame 只有当key对应的value仍然是val时才移除它，返回删除的key-value的数量
+// 用于读取value之后、删除之前不加锁的场景，期间key被其他指令覆盖时不会误删新的value，val 必须是可以比较的类型
+func (dict *ConcurrentDict) RemoveIfSame(key string, val interface{}) (result int) {
+	s := dict.getShard(key)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if old, ok := s.m[key]; ok && old == val {
+		delete(s.m, key)
+		dict.decreaseCount()
+		return 1
+	}
+	return 0
+}
+
+func (dict *ConcurrentDict) addCount() int32 {
+	return atomic.AddInt32(&dict.count, 1)
+}
+
+func (dict *ConcurrentDict) decreaseCount() int32 {
+	return atomic.AddInt32(&dict.count, -1)
+}
+
+// ForEach 遍历整个dict，对dict中的每个key-value执行consumer方法
+// consumer 返回 false 时终止遍历
+func (dict *ConcurrentDict) ForEach(consumer Consumer) {
+	for _, s := range dict.table {
+		if !s.forEach(consumer) {
+			return
+		}
+	}
+}
+
+// forEach 遍历一个 shard，consumer 返回 false 时返回 false
+func (s *shard) forEach(consumer Consumer) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for key, value := range s.m {
+		if !consumer(key, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// Keys 返回dict中所有的key组成的Slice
+func (dict *ConcurrentDict) Keys() []string {
+	keys := make([]string, 0, dict.Len())
+	dict.ForEach(func(key string, val interface{}) bool {
+		keys = append(keys, key)
+		return true
+	})
+	return keys
+}
+
+// randomKey 随机返回一个 shard 中的一个key，shard 为空时第二个返回值为false
+func (s *shard) randomKey() (string, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for key := range s.m {
+		return key, true
+	}
+	return "", false
+}
+
+// randomKey 从随机的 shard 开始依次查找，返回第一个不为空的 shard 中的一个key，
+// 最多查找一遍所有的 shard，dict 为空时第二个返回值为false
+func (dict *ConcurrentDict) randomKey() (string, bool) {
+	shardCount := len(dict.table)
+	start := rand.Intn(shardCount)
+	for i := 0; i < shardCount; i++ {
+		if key, ok := dict.table[(start+i)&(shardCount-1)].randomKey(); ok {
+			return key, true
+		}
+	}
+	return "", false
+}
+
+// RandomKeys 随机返回给定数量的key组成的Slice，可能包含重复的key
+// 其他协程同时删除 key 导致 dict 变为空时，返回的 key 可能少于 limit
+func (dict *ConcurrentDict) RandomKeys(limit int) []string {
+	size := dict.Len()
+	if limit >= size {
+		return dict.Keys()
+	}
+
+	result := make([]string, 0, limit)
+	for len(result) < limit {
+		key, ok := dict.randomKey()
+		if !ok {
+			break
+		}
+		result = append(result, key)
+	}
+	return result
+}
+
+// maxDistinctAttemptsPerKey 限制 RandomDistinctKeys 随机抽取的次数，
+// 其他协程同时删除 key 时可能再也抽不到足够多的不同的 key
+const maxDistinctAttemptsPerKey = 16
+
+// RandomDistinctKeys 随机返回给定数量的key组成的Slice，不会包含重复的key
+// 随机抽取的次数用完时按遍历顺序补足，dict 中的 key 不够时返回的 key 少于 limit
+func (dict *ConcurrentDict) RandomDistinctKeys(limit int) []string {
+	size := dict.Len()
+	if limit >= size {
+		return dict.Keys()
+	}
+
+	result := make(map[string]struct{})
+	for attempts := limit * maxDistinctAttemptsPerKey; len(result) < limit && attempts > 0; attempts-- {
+		key, ok := dict.randomKey()
+		if !ok {
+			break
+		}
+		result[key] = struct{}{}
+	}
+	if len(result) < limit {
+		dict.ForEach(func(key string, val interface{}) bool {
+			result[key] = struct{}{}
+			return len(result) < limit
+		})
+	}
+	arr := make([]string, 0, limit)
+	for k := range result {
+		arr = append(arr, k)
+	}
+	return arr
+}
+
+// Clear 将dict中的数据清空
+func (dict *ConcurrentDict) Clear() {
+	for _, s := range dict.table {
+		s.mutex.Lock()
+		atomic.AddInt32(&dict.count, -int32(len(s.m)))
+		s.m = make(map[string]interface{})
+		s.mutex.Unlock()
+	}
+}
+
+// Scan 从游标 cursor 所指的 shard 开始遍历，每次遍历完整的 shard，
+// 直到遍历过的 key 的数量不少于 count 为止，返回下一次遍历的游标。
+// shard 的数量不会改变，所以在整个遍历过程中一直存在的 key 一定会被遍历到，
+// 即使字典在两次调用之间变大或变小。返回的游标为 0 说明已经遍历完整个字典。
+// 为了保证每个 shard 都被完整地遍历，consumer 的返回值会被忽略
+func (dict *ConcurrentDict) Scan(cursor int, count int, consumer Consumer) int {
+	if cursor < 0 || cursor >= len(dict.table) {
+		return 0
+	}
+	visited := 0
+	for cursor < len(dict.table) && visited < count {
+		dict.table[cursor].forEach(func(key string, val interface{}) bool {
+			visited++
+			consumer(key, val)
+			return true
+		})
+		cursor++
+	}
+	if cursor >= len(dict.table) {
+		return 0
+	}
+	return cursor
+}
@@ -0,0 +1,76 @@
+package dict
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestRandomKeysEmptiedConcurrently(t *testing.T) {
+	dict := MakeConcurrent(1 << 10)
+	for i := 0; i < 1000; i++ {
+		dict.Put(strconv.Itoa(i), i)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			dict.Remove(strconv.Itoa(i))
+		}
+	}()
+	// 删除 key 的同时抽取，dict 变为空之后必须返回而不是一直重试
+	for dict.Len() > 0 {
+		if keys := dict.RandomKeys(500); len(keys) > 500 {
+			t.Fatalf("got %d keys, want at most 500", len(keys))
+		}
+		if keys := dict.RandomDistinctKeys(500); len(keys) > 500 {
+			t.Fatalf("got %d distinct keys, want at most 500", len(keys))
+		}
+	}
+	wg.Wait()
+	if keys := dict.RandomKeys(10); len(keys) != 0 {
+		t.Fatalf("got %v from empty dict", keys)
+	}
+}
+
+func TestRandomDistinctKeys(t *testing.T) {
+	dict := MakeConcurrent(16)
+	for i := 0; i < 100; i++ {
+		dict.Put(strconv.Itoa(i), i)
+	}
+	keys := dict.RandomDistinctKeys(99)
+	if len(keys) != 99 {
+		t.Fatalf("got %d keys, want 99", len(keys))
+	}
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		if seen[key] {
+			t.Fatalf("duplicate key %s", key)
+		}
+		seen[key] = true
+	}
+}
+
+func TestRemoveIfSame(t *testing.T) {
+	dict := MakeConcurrent(16)
+	first, second := new(int), new(int)
+	dict.Put("key", first)
+	dict.Put("key", second)
+	// key 已经被覆盖，按旧的值删除不会删掉新的值
+	if result := dict.RemoveIfSame("key", first); result != 0 {
+		t.Fatalf("removed a value that was replaced, result %d", result)
+	}
+	if val, ok := dict.Get("key"); !ok || val != second {
+		t.Fatal("the new value was removed")
+	}
+	if result := dict.RemoveIfSame("key", second); result != 1 {
+		t.Fatalf("got result %d, want 1", result)
+	}
+	if dict.Len() != 0 {
+		t.Fatalf("got len %d after removing the only key", dict.Len())
+	}
+	if result := dict.RemoveIfSame("missing", first); result != 0 {
+		t.Fatalf("got result %d for a missing key", result)
+	}
+}
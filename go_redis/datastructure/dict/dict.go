@@ -12,13 +12,15 @@ type Consumer func(key string, val interface{}) bool
 type Dict interface {
 	Get(key string) (val interface{}, exists bool)
 	Len() int
-	Put(key string, val interface{}) (result int)
+	Put(key string, val interface{}) (old interface{}, result int)
 	PutIfAbsent(key string, val interface{}) (result int)
-	PutIfExists(key string, val interface{}) (result int)
-	Remove(key string) (result int)
+	PutIfExists(key string, val interface{}) (old interface{}, result int)
+	Remove(key string) (old interface{}, result int)
+	RemoveIfSame(key string, val interface{}) (result int)
 	ForEach(consumer Consumer)
 	Keys() []string
 	RandomKeys(limit int) []string
 	RandomDistinctKeys(limit int) []string
 	Clear()
+	Scan(cursor int, count int, consumer Consumer) (nextCursor int)
 }
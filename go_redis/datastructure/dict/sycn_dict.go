@@ -27,14 +27,14 @@ func (dict *SyncDict) Len() int {
 	return length
 }
 
-// Put 向dict中添加key-value键值对，并返回新插入的key-value数量
-func (dict *SyncDict) Put(key string, val interface{}) (result int) {
-	_, existed := dict.m.Load(key)
+// Put 向dict中添加key-value键值对，返回被覆盖的value和新插入的key-value数量
+func (dict *SyncDict) Put(key string, val interface{}) (old interface{}, result int) {
+	old, existed := dict.m.Load(key)
 	dict.m.Store(key, val)
 	if existed {
-		return 0 // 说明原dict中就存在key这个键，所以新插入的key-value键值对数量为0
+		return old, 0 // 说明原dict中就存在key这个键，所以新插入的key-value键值对数量为0
 	}
-	return 1
+	return nil, 1
 }
 
 // PutIfAbsent 当key不存在时，才向dict中添加key-value键值对，并返回更新的key-value的数量
@@ -47,21 +47,30 @@ func (dict *SyncDict) PutIfAbsent(key string, val interface{}) (result int) {
 	return 1
 }
 
-// PutIfExists 当dict中本来就存在key时，才将key-value插入，并返回插入的key-value的数量
-func (dict *SyncDict) PutIfExists(key string, val interface{}) (result int) {
-	_, existed := dict.m.Load(key)
+// PutIfExists 当dict中本来就存在key时，才将key-value插入，返回被覆盖的value和插入的key-value的数量
+func (dict *SyncDict) PutIfExists(key string, val interface{}) (old interface{}, result int) {
+	old, existed := dict.m.Load(key)
 	if existed {
 		dict.m.Store(key, val)
-		return 1
+		return old, 1
 	}
-	return 0
+	return nil, 0
 }
 
-// Remove 移除key对应的key-value，并返回删除的key-value的数量
-func (dict *SyncDict) Remove(key string) (result int) {
-	_, existed := dict.m.Load(key)
-	dict.m.Delete(key)
+// Remove 移除key对应的key-value，返回被删除的value和删除的key-value的数量
+func (dict *SyncDict) Remove(key string) (old interface{}, result int) {
+	old, existed := dict.m.LoadAndDelete(key)
 	if existed {
+		return old, 1
+	}
+	return nil, 0
+}
+
+// RemoveIfSame 只有当key对应的value仍然是val时才移除它，返回删除的key-value的数量
+func (dict *SyncDict) RemoveIfSame(key string, val interface{}) (result int) {
+	old, existed := dict.m.Load(key)
+	if existed && old == val {
+		dict.m.Delete(key)
 		return 1
 	}
 	return 0
@@ -118,3 +127,9 @@ func (dict *SyncDict) RandomDistinctKeys(limit int) []string {
 func (dict *SyncDict) Clear() {
 	*dict = *MakeSycnDict()
 }
+
+// Scan sync.Map 无法按位置分批遍历，所以一次遍历整个dict，并返回游标0
+func (dict *SyncDict) Scan(cursor int, count int, consumer Consumer) int {
+	dict.ForEach(consumer)
+	return 0
+}
@@ -0,0 +1,143 @@
+package list
+
+/*
+ * List 是 Redis list 类型的底层实现
+ * 使用环形缓冲区实现的双端队列：两端的插入和弹出都是 O(1)，按下标访问也是 O(1)
+ * 容量不足时翻倍扩容，元素数量降到容量的 1/4 以下时缩容
+ */
+
+const minCapacity = 8
+
+// List 是存放 []byte 的双端队列
+type List struct {
+	items [][]byte
+	// head 是第一个元素在 items 中的下标
+	head int
+	size int
+	// 所有元素的总字节数
+	bytes int
+}
+
+// Make 创建一个空的 List
+func Make() *List {
+	return &List{}
+}
+
+// Len 返回元素数量
+func (l *List) Len() int {
+	return l.size
+}
+
+// Bytes 返回所有元素的总字节数
+func (l *List) Bytes() int {
+	return l.bytes
+}
+
+// index 把逻辑下标转换为 items 中的下标
+func (l *List) index(i int) int {
+	return (l.head + i) % len(l.items)
+}
+
+// resize 把元素搬到容量为 capacity 的新缓冲区中，第一个元素放在下标0
+func (l *List) resize(capacity int) {
+	items := make([][]byte, capacity)
+	for i := 0; i < l.size; i++ {
+		items[i] = l.items[l.index(i)]
+	}
+	l.items = items
+	l.head = 0
+}
+
+func (l *List) grow() {
+	if l.size < len(l.items) {
+		return
+	}
+	capacity := len(l.items) * 2
+	if capacity < minCapacity {
+		capacity = minCapacity
+	}
+	l.resize(capacity)
+}
+
+func (l *List) shrink() {
+	if len(l.items) > minCapacity && l.size < len(l.items)/4 {
+		l.resize(len(l.items) / 2)
+	}
+}
+
+// PushFront 在头部插入元素
+func (l *List) PushFront(val []byte) {
+	l.grow()
+	l.head = (l.head - 1 + len(l.items)) % len(l.items)
+	l.items[l.head] = val
+	l.size++
+	l.bytes += len(val)
+}
+
+// PushBack 在尾部插入元素
+func (l *List) PushBack(val []byte) {
+	l.grow()
+	l.items[l.index(l.size)] = val
+	l.size++
+	l.bytes += len(val)
+}
+
+// PopFront 弹出头部的元素，列表为空时返回 nil
+func (l *List) PopFront() []byte {
+	if l.size == 0 {
+		return nil
+	}
+	val := l.items[l.head]
+	l.items[l.head] = nil
+	l.head = (l.head + 1) % len(l.items)
+	l.size--
+	l.bytes -= len(val)
+	l.shrink()
+	return val
+}
+
+// PopBack 弹出尾部的元素，列表为空时返回 nil
+func (l *List) PopBack() []byte {
+	if l.size == 0 {
+		return nil
+	}
+	i := l.index(l.size - 1)
+	val := l.items[i]
+	l.items[i] = nil
+	l.size--
+	l.bytes -= len(val)
+	l.shrink()
+	return val
+}
+
+// Get 返回下标为 i 的元素，i 必须在 [0, Len()) 之间
+func (l *List) Get(i int) []byte {
+	return l.items[l.index(i)]
+}
+
+// Range 返回下标在 [start, stop) 之间的元素，下标必须合法
+func (l *List) Range(start, stop int) [][]byte {
+	result := make([][]byte, 0, stop-start)
+	for i := start; i < stop; i++ {
+		result = append(result, l.Get(i))
+	}
+	return result
+}
+
+// ForEach 从头到尾遍历元素，consumer 返回 false 时停止遍历
+func (l *List) ForEach(consumer func(i int, val []byte) bool) {
+	for i := 0; i < l.size; i++ {
+		if !consumer(i, l.Get(i)) {
+			return
+		}
+	}
+}
+
+// Clone 返回 List 的深拷贝，元素的内容也会复制，修改其中一个不会影响另一个
+func (l *List) Clone() *List {
+	clone := &List{items: make([][]byte, len(l.items)), size: l.size, bytes: l.bytes}
+	for i := 0; i < l.size; i++ {
+		clone.items[i] = append([]byte(nil), l.items[l.index(i)]...)
+	}
+	return clone
+}
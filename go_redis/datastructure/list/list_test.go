@@ -0,0 +1,81 @@
+package list
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestDeque(t *testing.T) {
+	l := Make()
+	// 交替在两端插入，足以触发多次扩容和环绕
+	for i := 0; i < 100; i++ {
+		if i%2 == 0 {
+			l.PushBack([]byte(strconv.Itoa(i)))
+		} else {
+			l.PushFront([]byte(strconv.Itoa(i)))
+		}
+	}
+	if l.Len() != 100 {
+		t.Fatalf("Len() = %d, want 100", l.Len())
+	}
+	if got := string(l.Get(0)); got != "99" {
+		t.Errorf("front = %s, want 99", got)
+	}
+	if got := string(l.Get(99)); got != "98" {
+		t.Errorf("back = %s, want 98", got)
+	}
+	for i := 99; i >= 1; i -= 2 {
+		if got := string(l.PopFront()); got != strconv.Itoa(i) {
+			t.Fatalf("PopFront() = %s, want %d", got, i)
+		}
+	}
+	for i := 98; i >= 0; i -= 2 {
+		if got := string(l.PopBack()); got != strconv.Itoa(i) {
+			t.Fatalf("PopBack() = %s, want %d", got, i)
+		}
+	}
+	if l.PopFront() != nil || l.PopBack() != nil || l.Len() != 0 {
+		t.Error("empty list should pop nil")
+	}
+}
+
+func TestRange(t *testing.T) {
+	l := Make()
+	for i := 0; i < 10; i++ {
+		l.PushBack([]byte(strconv.Itoa(i)))
+	}
+	// 弹出头部后 head 不在下标0，Range 要按逻辑下标取值
+	l.PopFront()
+	l.PopFront()
+	l.PushBack([]byte("10"))
+	got := l.Range(1, 4)
+	want := []string{"3", "4", "5"}
+	for i := range want {
+		if string(got[i]) != want[i] {
+			t.Fatalf("Range(1, 4) = %q, want %q", got, want)
+		}
+	}
+}
+
+func TestClone(t *testing.T) {
+	l := Make()
+	// 先从头部插入，使元素在缓冲区中环绕
+	for i := 0; i < 10; i++ {
+		l.PushFront([]byte(strconv.Itoa(i)))
+	}
+	clone := l.Clone()
+	l.Get(0)[0] = 'x'
+	l.PushBack([]byte("new"))
+	if clone.Len() != 10 || clone.Bytes() != 10 {
+		t.Fatalf("clone Len() = %d, Bytes() = %d", clone.Len(), clone.Bytes())
+	}
+	for i := 0; i < 10; i++ {
+		if got := string(clone.Get(i)); got != strconv.Itoa(9-i) {
+			t.Fatalf("clone.Get(%d) = %s, want %d", i, got, 9-i)
+		}
+	}
+	clone.PushBack([]byte("10"))
+	if l.Len() != 11 || string(l.Get(10)) != "new" {
+		t.Error("pushing to the clone changed the original")
+	}
+}
@@ -0,0 +1,174 @@
+package sortedset
+
+import (
+	"math/rand"
+)
+
+/*
+ * 跳表，按 (score, member) 的顺序保存元素
+ * 和 Redis 的实现一样，每一层的指针都记录了跨越的元素数量(span)，用于按排名查找元素
+ */
+
+const (
+	maxLevel = 16
+	// 每升高一层的概率
+	levelP = 0.25
+)
+
+// Element 是有序集合中的一个元素
+type Element struct {
+	Member string
+	Score  float64
+}
+
+type level struct {
+	forward *node
+	// span 是从当前节点到 forward 跨越的元素数量
+	span int64
+}
+
+type node struct {
+	Element
+	backward *node
+	levels   []*level
+}
+
+type skiplist struct {
+	header *node
+	tail   *node
+	length int64
+	level  int
+}
+
+func makeNode(lvl int, score float64, member string) *node {
+	n := &node{
+		Element: Element{Member: member, Score: score},
+		levels:  make([]*level, lvl),
+	}
+	for i := range n.levels {
+		n.levels[i] = &level{}
+	}
+	return n
+}
+
+func makeSkiplist() *skiplist {
+	return &skiplist{
+		header: makeNode(maxLevel, 0, ""),
+		level:  1,
+	}
+}
+
+func randomLevel() int {
+	lvl := 1
+	for lvl < maxLevel && rand.Float64() < levelP {
+		lvl++
+	}
+	return lvl
+}
+
+// before 判断节点 n 是否排在元素 (score, member) 之前
+func (n *node) before(score float64, member string) bool {
+	return n.Score < score || n.Score == score && n.Member < member
+}
+
+func (sl *skiplist) insert(member string, score float64) *node {
+	update := make([]*node, maxLevel)
+	rank := make([]int64, maxLevel)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		if i < sl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			rank[i] += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+
+	lvl := randomLevel()
+	if lvl > sl.level {
+		for i := sl.level; i < lvl; i++ {
+			rank[i] = 0
+			update[i] = sl.header
+			update[i].levels[i].span = sl.length
+		}
+		sl.level = lvl
+	}
+
+	x = makeNode(lvl, score, member)
+	for i := 0; i < lvl; i++ {
+		x.levels[i].forward = update[i].levels[i].forward
+		update[i].levels[i].forward = x
+		x.levels[i].span = update[i].levels[i].span - (rank[0] - rank[i])
+		update[i].levels[i].span = rank[0] - rank[i] + 1
+	}
+	for i := lvl; i < sl.level; i++ {
+		update[i].levels[i].span++
+	}
+
+	if update[0] != sl.header {
+		x.backward = update[0]
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x
+	} else {
+		sl.tail = x
+	}
+	sl.length++
+	return x
+}
+
+func (sl *skiplist) removeNode(x *node, update []*node) {
+	for i := 0; i < sl.level; i++ {
+		if update[i].levels[i].forward == x {
+			update[i].levels[i].span += x.levels[i].span - 1
+			update[i].levels[i].forward = x.levels[i].forward
+		} else {
+			update[i].levels[i].span--
+		}
+	}
+	if x.levels[0].forward != nil {
+		x.levels[0].forward.backward = x.backward
+	} else {
+		sl.tail = x.backward
+	}
+	for sl.level > 1 && sl.header.levels[sl.level-1].forward == nil {
+		sl.level--
+	}
+	sl.length--
+}
+
+// remove 删除元素 (score, member)，返回是否删除成功
+func (sl *skiplist) remove(member string, score float64) bool {
+	update := make([]*node, maxLevel)
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && x.levels[i].forward.before(score, member) {
+			x = x.levels[i].forward
+		}
+		update[i] = x
+	}
+	x = x.levels[0].forward
+	if x != nil && x.Score == score && x.Member == member {
+		sl.removeNode(x, update)
+		return true
+	}
+	return false
+}
+
+// getByRank 返回排名为 rank 的节点，rank 从1开始
+func (sl *skiplist) getByRank(rank int64) *node {
+	var traversed int64
+	x := sl.header
+	for i := sl.level - 1; i >= 0; i-- {
+		for x.levels[i].forward != nil && traversed+x.levels[i].span <= rank {
+			traversed += x.levels[i].span
+			x = x.levels[i].forward
+		}
+		if traversed == rank {
+			return x
+		}
+	}
+	return nil
+}
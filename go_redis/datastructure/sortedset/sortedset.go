@@ -0,0 +1,131 @@
+package sortedset
+
+/*
+ * SortedSet 是 Redis zset 类型的底层实现
+ * 和 Redis 一样由字典和跳表组成：字典根据 member 查找 score，跳表按 (score, member) 的顺序保存元素
+ */
+
+// SortedSet 是按分数排序的集合
+type SortedSet struct {
+	dict     map[string]*Element
+	skiplist *skiplist
+	// 所有 member 的总字节数
+	memberBytes int
+}
+
+// Make 创建一个空的 SortedSet
+func Make() *SortedSet {
+	return &SortedSet{
+		dict:     make(map[string]*Element),
+		skiplist: makeSkiplist(),
+	}
+}
+
+// Add 添加元素或更新已有元素的分数，返回 true 表示新增了元素
+func (set *SortedSet) Add(member string, score float64) bool {
+	element, ok := set.dict[member]
+	if ok {
+		if element.Score == score {
+			return false
+		}
+		set.skiplist.remove(member, element.Score)
+	}
+	n := set.skiplist.insert(member, score)
+	set.dict[member] = &n.Element
+	if !ok {
+		set.memberBytes += len(member)
+	}
+	return !ok
+}
+
+// Len 返回元素数量
+func (set *SortedSet) Len() int64 {
+	return int64(len(set.dict))
+}
+
+// Bytes 返回所有 member 的总字节数
+func (set *SortedSet) Bytes() int {
+	return set.memberBytes
+}
+
+// Get 返回 member 对应的元素
+func (set *SortedSet) Get(member string) (*Element, bool) {
+	element, ok := set.dict[member]
+	return element, ok
+}
+
+// Remove 删除元素，返回是否删除成功
+func (set *SortedSet) Remove(member string) bool {
+	element, ok := set.dict[member]
+	if !ok {
+		return false
+	}
+	set.skiplist.remove(member, element.Score)
+	delete(set.dict, member)
+	set.memberBytes -= len(member)
+	return true
+}
+
+// Range 返回排名在 [start, stop) 之间的元素，排名从0开始，desc 为 true 时按分数从高到低排名
+// 下标必须在 [0, Len()] 之间
+func (set *SortedSet) Range(start, stop int64, desc bool) []*Element {
+	if start >= stop {
+		return nil
+	}
+	result := make([]*Element, 0, stop-start)
+	var n *node
+	if desc {
+		n = set.skiplist.getByRank(set.skiplist.length - start)
+	} else {
+		n = set.skiplist.getByRank(start + 1)
+	}
+	for i := start; i < stop && n != nil; i++ {
+		result = append(result, &Element{Member: n.Member, Score: n.Score})
+		if desc {
+			n = n.backward
+		} else {
+			n = n.levels[0].forward
+		}
+	}
+	return result
+}
+
+// PopMin 删除并返回分数最低的 count 个元素
+func (set *SortedSet) PopMin(count int) []*Element {
+	return set.pop(count, false)
+}
+
+// PopMax 删除并返回分数最高的 count 个元素，分数从高到低排列
+func (set *SortedSet) PopMax(count int) []*Element {
+	return set.pop(count, true)
+}
+
+func (set *SortedSet) pop(count int, max bool) []*Element {
+	if int64(count) > set.Len() {
+		count = int(set.Len())
+	}
+	popped := set.Range(0, int64(count), max)
+	for _, element := range popped {
+		set.Remove(element.Member)
+	}
+	return popped
+}
+
+// ForEach 按分数从低到高遍历元素，consumer 返回 false 时停止遍历
+func (set *SortedSet) ForEach(consumer func(element *Element) bool) {
+	for n := set.skiplist.header.levels[0].forward; n != nil; n = n.levels[0].forward {
+		if !consumer(&Element{Member: n.Member, Score: n.Score}) {
+			return
+		}
+	}
+}
+
+// Clone 返回 SortedSet 的拷贝，member 是不可变的字符串，复制元素即可
+func (set *SortedSet) Clone() *SortedSet {
+	clone := Make()
+	set.ForEach(func(element *Element) bool {
+		clone.Add(element.Member, element.Score)
+		return true
+	})
+	return clone
+}
@@ -0,0 +1,105 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func members(elements []*Element) []string {
+	result := make([]string, len(elements))
+	for i, element := range elements {
+		result[i] = element.Member
+	}
+	return result
+}
+
+func equalMembers(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRange(t *testing.T) {
+	set := Make()
+	set.Add("c", 3)
+	set.Add("a", 1)
+	set.Add("b", 2)
+	set.Add("b2", 2)
+	if set.Add("a", 1) {
+		t.Error("adding an existing member reported a new element")
+	}
+	set.Add("a", 4)
+	tests := []struct {
+		start, stop int64
+		desc        bool
+		want        []string
+	}{
+		{0, 4, false, []string{"b", "b2", "c", "a"}},
+		{1, 3, false, []string{"b2", "c"}},
+		{0, 2, true, []string{"a", "c"}},
+		{3, 4, true, []string{"b"}},
+		{2, 2, false, []string{}},
+	}
+	for _, tt := range tests {
+		if got := members(set.Range(tt.start, tt.stop, tt.desc)); !equalMembers(got, tt.want) {
+			t.Errorf("Range(%d, %d, %v) = %v, want %v", tt.start, tt.stop, tt.desc, got, tt.want)
+		}
+	}
+}
+
+func TestPop(t *testing.T) {
+	set := Make()
+	for i := 0; i < 5; i++ {
+		set.Add(strconv.Itoa(i), float64(i))
+	}
+	if got := members(set.PopMin(2)); !equalMembers(got, []string{"0", "1"}) {
+		t.Errorf("PopMin(2) = %v", got)
+	}
+	if got := members(set.PopMax(10)); !equalMembers(got, []string{"4", "3", "2"}) {
+		t.Errorf("PopMax(10) = %v", got)
+	}
+	if set.Len() != 0 {
+		t.Errorf("Len() = %d after popping everything", set.Len())
+	}
+}
+
+// TestRandomOperations 用随机的插入、更新和删除检查跳表的顺序和排名是否和排序的结果一致
+func TestRandomOperations(t *testing.T) {
+	set := Make()
+	scores := make(map[string]float64)
+	for i := 0; i < 2000; i++ {
+		member := strconv.Itoa(rand.Intn(300))
+		if rand.Intn(4) == 0 {
+			set.Remove(member)
+			delete(scores, member)
+			continue
+		}
+		score := float64(rand.Intn(50))
+		set.Add(member, score)
+		scores[member] = score
+	}
+	want := make([]string, 0, len(scores))
+	for member := range scores {
+		want = append(want, member)
+	}
+	sort.Slice(want, func(i, j int) bool {
+		si, sj := scores[want[i]], scores[want[j]]
+		return si < sj || si == sj && want[i] < want[j]
+	})
+	if got := members(set.Range(0, set.Len(), false)); !equalMembers(got, want) {
+		t.Fatalf("order mismatch")
+	}
+	for i := int64(0); i < set.Len(); i += 37 {
+		if got := set.Range(i, i+1, false)[0].Member; got != want[i] {
+			t.Fatalf("rank %d = %s, want %s", i, got, want[i])
+		}
+	}
+}
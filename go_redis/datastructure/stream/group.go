@@ -0,0 +1,274 @@
+package stream
+
+import (
+	"sort"
+)
+
+/*
+ * 消费者组：组内的消费者共同消费一个 stream，每条消息只会投递给组内的一个消费者
+ * 已投递但未确认(XACK)的消息记录在 pending entries list(PEL)中，
+ * 消费者宕机后，其他消费者可以通过 XCLAIM/XAUTOCLAIM 认领这些消息
+ */
+
+// PendingEntry 是 PEL 中的一条记录
+type PendingEntry struct {
+	ID ID
+	// Consumer 是当前持有这条消息的消费者
+	Consumer *Consumer
+	// DeliveryTime 是最后一次投递的时间，单位毫秒
+	DeliveryTime int64
+	// DeliveryCount 是这条消息被投递的次数
+	DeliveryCount int64
+}
+
+// Consumer 是消费者组中的一个消费者
+type Consumer struct {
+	Name string
+	// SeenTime 是消费者最后一次尝试读取或认领消息的时间，单位毫秒
+	SeenTime int64
+	// ActiveTime 是消费者最后一次成功读取或认领到消息的时间，从未成功过时为 -1
+	ActiveTime int64
+	pending    int
+}
+
+// PendingCount 返回该消费者持有的未确认消息数量
+func (c *Consumer) PendingCount() int {
+	return c.pending
+}
+
+// Group 是一个消费者组
+type Group struct {
+	Name string
+	// LastID 是最后一条投递给组内消费者的消息的ID
+	LastID ID
+	// EntriesRead 是组已经读取过的消息数量，无法确定时为 -1
+	EntriesRead int64
+	// pel 按ID递增的顺序保存，pelIndex 用于按ID查找
+	pel       []*PendingEntry
+	pelIndex  map[ID]*PendingEntry
+	consumers map[string]*Consumer
+}
+
+// CreateGroup 创建消费者组，同名的组已经存在时返回 false
+func (s *Stream) CreateGroup(name string, lastID ID, entriesRead int64) (*Group, bool) {
+	if _, ok := s.groups[name]; ok {
+		return nil, false
+	}
+	group := &Group{
+		Name:        name,
+		LastID:      lastID,
+		EntriesRead: entriesRead,
+		pelIndex:    make(map[ID]*PendingEntry),
+		consumers:   make(map[string]*Consumer),
+	}
+	s.groups[name] = group
+	return group, true
+}
+
+// Group 根据名称返回消费者组，不存在时返回 nil
+func (s *Stream) Group(name string) *Group {
+	return s.groups[name]
+}
+
+// DestroyGroup 删除消费者组，返回是否删除成功
+func (s *Stream) DestroyGroup(name string) bool {
+	if _, ok := s.groups[name]; !ok {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+// Groups 按名称顺序返回所有的消费者组
+func (s *Stream) Groups() []*Group {
+	groups := make([]*Group, 0, len(s.groups))
+	for _, group := range s.groups {
+		groups = append(groups, group)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
+}
+
+// Lag 返回 stream 中还没有投递给这个组的消息数量
+func (s *Stream) Lag(group *Group) int {
+	return s.CountAfter(group.LastID)
+}
+
+// Consumer 根据名称返回消费者，不存在时返回 nil
+func (g *Group) Consumer(name string) *Consumer {
+	return g.consumers[name]
+}
+
+// CreateConsumer 创建消费者，已经存在时返回已有的消费者和 false
+func (g *Group) CreateConsumer(name string, now int64) (*Consumer, bool) {
+	if consumer, ok := g.consumers[name]; ok {
+		return consumer, false
+	}
+	consumer := &Consumer{
+		Name:       name,
+		SeenTime:   now,
+		ActiveTime: -1,
+	}
+	g.consumers[name] = consumer
+	return consumer, true
+}
+
+// DeleteConsumer 删除消费者以及它持有的未确认消息，返回删除的未确认消息数量
+func (g *Group) DeleteConsumer(name string) (int, bool) {
+	consumer, ok := g.consumers[name]
+	if !ok {
+		return 0, false
+	}
+	deleted := consumer.pending
+	if deleted > 0 {
+		kept := g.pel[:0]
+		for _, pe := range g.pel {
+			if pe.Consumer == consumer {
+				delete(g.pelIndex, pe.ID)
+				continue
+			}
+			kept = append(kept, pe)
+		}
+		for i := len(kept); i < len(g.pel); i++ {
+			g.pel[i] = nil
+		}
+		g.pel = kept
+	}
+	delete(g.consumers, name)
+	return deleted, true
+}
+
+// Consumers 按名称顺序返回组内的所有消费者
+func (g *Group) Consumers() []*Consumer {
+	consumers := make([]*Consumer, 0, len(g.consumers))
+	for _, consumer := range g.consumers {
+		consumers = append(consumers, consumer)
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers
+}
+
+// ConsumerCount 返回组内的消费者数量
+func (g *Group) ConsumerCount() int {
+	return len(g.consumers)
+}
+
+// PendingCount 返回组内未确认的消息数量
+func (g *Group) PendingCount() int {
+	return len(g.pel)
+}
+
+// Pending 根据ID返回 PEL 中的记录，不存在时返回 nil
+func (g *Group) Pending(id ID) *PendingEntry {
+	return g.pelIndex[id]
+}
+
+// searchPending 返回 PEL 中第一个ID不小于 id 的记录的下标
+func (g *Group) searchPending(id ID) int {
+	return sort.Search(len(g.pel), func(i int) bool {
+		return !g.pel[i].ID.Less(id)
+	})
+}
+
+// PendingRange 按ID递增的顺序返回 [start, end] 之间的未确认消息
+// consumer 不为 nil 时只返回该消费者持有的消息，minIdle > 0 时只返回空闲时间不小于 minIdle 毫秒的消息
+// count <= 0 表示不限制数量
+func (g *Group) PendingRange(start, end ID, count int, consumer *Consumer, minIdle int64, now int64) []*PendingEntry {
+	result := make([]*PendingEntry, 0)
+	for i := g.searchPending(start); i < len(g.pel); i++ {
+		pe := g.pel[i]
+		if end.Less(pe.ID) || count > 0 && len(result) >= count {
+			break
+		}
+		if consumer != nil && pe.Consumer != consumer {
+			continue
+		}
+		if minIdle > 0 && now-pe.DeliveryTime < minIdle {
+			continue
+		}
+		result = append(result, pe)
+	}
+	return result
+}
+
+// Deliver 把消息投递给消费者并记入 PEL，消息已经在 PEL 中时转给新的消费者
+// 每次投递都会刷新投递时间并增加投递次数
+func (g *Group) Deliver(id ID, consumer *Consumer, now int64) *PendingEntry {
+	pe := g.AddPending(id, consumer, now)
+	g.Transfer(pe, consumer)
+	pe.DeliveryTime = now
+	pe.DeliveryCount++
+	return pe
+}
+
+// AddPending 把消息记入 PEL，由 consumer 持有，投递次数为0
+// 消息已经在 PEL 中时直接返回已有的记录，例如 XCLAIM 的 FORCE 选项认领不在 PEL 中的消息
+func (g *Group) AddPending(id ID, consumer *Consumer, now int64) *PendingEntry {
+	if pe, ok := g.pelIndex[id]; ok {
+		return pe
+	}
+	pe := &PendingEntry{
+		ID:           id,
+		Consumer:     consumer,
+		DeliveryTime: now,
+	}
+	i := g.searchPending(id)
+	g.pel = append(g.pel, nil)
+	copy(g.pel[i+1:], g.pel[i:])
+	g.pel[i] = pe
+	g.pelIndex[id] = pe
+	consumer.pending++
+	return pe
+}
+
+// Transfer 把 PEL 中的记录转给另一个消费者
+func (g *Group) Transfer(pe *PendingEntry, consumer *Consumer) {
+	if pe.Consumer == consumer {
+		return
+	}
+	pe.Consumer.pending--
+	consumer.pending++
+	pe.Consumer = consumer
+}
+
+// Ack 确认一条消息，将它从 PEL 中移除，返回消息是否在 PEL 中
+func (g *Group) Ack(id ID) bool {
+	pe, ok := g.pelIndex[id]
+	if !ok {
+		return false
+	}
+	i := g.searchPending(id)
+	copy(g.pel[i:], g.pel[i+1:])
+	g.pel[len(g.pel)-1] = nil
+	g.pel = g.pel[:len(g.pel)-1]
+	delete(g.pelIndex, id)
+	pe.Consumer.pending--
+	return true
+}
+
+// clone 返回消费者组的深拷贝，PEL 中的记录指向拷贝中对应的消费者
+func (g *Group) clone() *Group {
+	clone := &Group{
+		Name:        g.Name,
+		LastID:      g.LastID,
+		EntriesRead: g.EntriesRead,
+		pel:         make([]*PendingEntry, len(g.pel)),
+		pelIndex:    make(map[ID]*PendingEntry, len(g.pelIndex)),
+		consumers:   make(map[string]*Consumer, len(g.consumers)),
+	}
+	for name, consumer := range g.consumers {
+		c := *consumer
+		clone.consumers[name] = &c
+	}
+	for i, pe := range g.pel {
+		entry := *pe
+		entry.Consumer = clone.consumers[pe.Consumer.Name]
+		clone.pel[i] = &entry
+		clone.pelIndex[entry.ID] = &entry
+	}
+	return clone
+}
@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// ID 是 stream 中消息的唯一标识，格式为 "<毫秒时间戳>-<序号>"
+type ID struct {
+	Ms  uint64
+	Seq uint64
+}
+
+var (
+	// MinID 是最小的消息ID，即 "0-0"
+	MinID = ID{}
+	// MaxID 是最大的消息ID
+	MaxID = ID{Ms: ^uint64(0), Seq: ^uint64(0)}
+
+	errInvalidID = errors.New("ERR Invalid stream ID specified as stream command argument")
+)
+
+// String 返回 "<ms>-<seq>" 格式的ID
+func (id ID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+// Less 判断 id 是否小于 other
+func (id ID) Less(other ID) bool {
+	if id.Ms != other.Ms {
+		return id.Ms < other.Ms
+	}
+	return id.Seq < other.Seq
+}
+
+// Compare 比较两个ID，id 小于、等于、大于 other 时分别返回 -1、0、1
+func (id ID) Compare(other ID) int {
+	if id.Less(other) {
+		return -1
+	}
+	if other.Less(id) {
+		return 1
+	}
+	return 0
+}
+
+// Incr 返回比 id 大的下一个ID，id 已经是最大值时 ok 为 false
+func (id ID) Incr() (next ID, ok bool) {
+	if id.Seq < ^uint64(0) {
+		return ID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	}
+	if id.Ms < ^uint64(0) {
+		return ID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Decr 返回比 id 小的上一个ID，id 已经是最小值时 ok 为 false
+func (id ID) Decr() (prev ID, ok bool) {
+	if id.Seq > 0 {
+		return ID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	}
+	if id.Ms > 0 {
+		return ID{Ms: id.Ms - 1, Seq: ^uint64(0)}, true
+	}
+	return id, false
+}
+
+// ParseID 解析 "<ms>-<seq>" 或 "<ms>" 格式的ID
+// 只有毫秒部分时，序号取 missingSeq，例如作为范围起点时取0，作为终点时取最大值
+func ParseID(s string, missingSeq uint64) (ID, error) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return ID{}, errInvalidID
+	}
+	if !hasSeq {
+		return ID{Ms: ms, Seq: missingSeq}, nil
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return ID{}, errInvalidID
+	}
+	return ID{Ms: ms, Seq: seq}, nil
+}
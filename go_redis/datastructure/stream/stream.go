@@ -0,0 +1,273 @@
+package stream
+
+import (
+	"sort"
+)
+
+/*
+ * Stream 是只追加的消息日志，消息按ID递增的顺序保存
+ * Redis 使用 radix tree + listpack 存储消息，这里使用按ID有序的切片，
+ * 追加在末尾，查找使用二分，对当前版本的数据规模足够了
+ */
+
+// Entry 是 stream 中的一条消息，Fields 按 field value field value ... 的顺序存放
+type Entry struct {
+	ID     ID
+	Fields [][]byte
+}
+
+// Stream 是消息日志以及挂在它上面的消费者组
+type Stream struct {
+	entries []*Entry
+	// lastID 是最后一次生成的ID，即使对应的消息已经被删除也不会回退
+	lastID ID
+	// maxDeletedID 是被 XDEL 或裁剪删除的最大的ID
+	maxDeletedID ID
+	// entriesAdded 是这个 stream 生命周期中一共追加过的消息数量
+	entriesAdded uint64
+	// 所有消息的 field 和 value 的总字节数
+	bytes  int
+	groups map[string]*Group
+}
+
+// Make 创建一个空的 stream
+func Make() *Stream {
+	return &Stream{
+		groups: make(map[string]*Group),
+	}
+}
+
+// size 返回消息的 field 和 value 的总字节数
+func (e *Entry) size() int {
+	n := 0
+	for _, field := range e.Fields {
+		n += len(field)
+	}
+	return n
+}
+
+// Bytes 返回所有消息的 field 和 value 的总字节数
+func (s *Stream) Bytes() int {
+	return s.bytes
+}
+
+// Len 返回 stream 中的消息数量
+func (s *Stream) Len() int {
+	return len(s.entries)
+}
+
+// LastID 返回最后一次生成的ID
+func (s *Stream) LastID() ID {
+	return s.lastID
+}
+
+// MaxDeletedID 返回被删除的最大的ID
+func (s *Stream) MaxDeletedID() ID {
+	return s.maxDeletedID
+}
+
+// EntriesAdded 返回一共追加过的消息数量
+func (s *Stream) EntriesAdded() uint64 {
+	return s.entriesAdded
+}
+
+// Clone 返回 stream 的深拷贝，包括消息的内容和消费者组
+func (s *Stream) Clone() *Stream {
+	clone := &Stream{
+		entries:      make([]*Entry, len(s.entries)),
+		lastID:       s.lastID,
+		maxDeletedID: s.maxDeletedID,
+		entriesAdded: s.entriesAdded,
+		bytes:        s.bytes,
+		groups:       make(map[string]*Group, len(s.groups)),
+	}
+	for i, entry := range s.entries {
+		fields := make([][]byte, len(entry.Fields))
+		for j, field := range entry.Fields {
+			fields[j] = append([]byte(nil), field...)
+		}
+		clone.entries[i] = &Entry{ID: entry.ID, Fields: fields}
+	}
+	for name, group := range s.groups {
+		clone.groups[name] = group.clone()
+	}
+	return clone
+}
+
+// SetLastID 修改最后生成的ID，对应 XSETID，新的ID不能小于当前最大的消息ID
+func (s *Stream) SetLastID(id ID) bool {
+	if last := s.Last(); last != nil && id.Less(last.ID) {
+		return false
+	}
+	s.lastID = id
+	return true
+}
+
+// NextID 根据当前时间生成一个新的ID，时钟回拨时沿用 lastID 的毫秒部分
+func (s *Stream) NextID(nowMs uint64) (ID, bool) {
+	if nowMs > s.lastID.Ms {
+		return ID{Ms: nowMs}, true
+	}
+	return s.lastID.Incr()
+}
+
+// NextSeq 为调用方指定的毫秒时间戳生成序号，对应 "<ms>-*" 格式的ID
+func (s *Stream) NextSeq(ms uint64) (ID, bool) {
+	if ms > s.lastID.Ms {
+		return ID{Ms: ms}, true
+	}
+	if ms == s.lastID.Ms {
+		return s.lastID.Incr()
+	}
+	return ID{}, false
+}
+
+// Add 在末尾追加一条消息，id 必须大于 lastID（lastID 初始为 0-0），否则返回 false
+func (s *Stream) Add(id ID, fields [][]byte) bool {
+	if !s.lastID.Less(id) {
+		return false
+	}
+	entry := &Entry{ID: id, Fields: fields}
+	s.entries = append(s.entries, entry)
+	s.bytes += entry.size()
+	s.lastID = id
+	s.entriesAdded++
+	return true
+}
+
+// search 返回第一个ID不小于 id 的消息的下标
+func (s *Stream) search(id ID) int {
+	return sort.Search(len(s.entries), func(i int) bool {
+		return !s.entries[i].ID.Less(id)
+	})
+}
+
+// Get 根据ID查找消息，不存在时返回 nil
+func (s *Stream) Get(id ID) *Entry {
+	i := s.search(id)
+	if i < len(s.entries) && s.entries[i].ID == id {
+		return s.entries[i]
+	}
+	return nil
+}
+
+// First 返回第一条消息，stream 为空时返回 nil
+func (s *Stream) First() *Entry {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	return s.entries[0]
+}
+
+// Last 返回最后一条消息，stream 为空时返回 nil
+func (s *Stream) Last() *Entry {
+	if len(s.entries) == 0 {
+		return nil
+	}
+	return s.entries[len(s.entries)-1]
+}
+
+// Range 按ID递增的顺序返回 [start, end] 之间的消息，count <= 0 表示不限制数量
+func (s *Stream) Range(start, end ID, count int) []*Entry {
+	if end.Less(start) {
+		return nil
+	}
+	from := s.search(start)
+	to := from
+	for to < len(s.entries) && !end.Less(s.entries[to].ID) {
+		if count > 0 && to-from >= count {
+			break
+		}
+		to++
+	}
+	result := make([]*Entry, to-from)
+	copy(result, s.entries[from:to])
+	return result
+}
+
+// RevRange 按ID递减的顺序返回 [start, end] 之间的消息，count <= 0 表示不限制数量
+func (s *Stream) RevRange(start, end ID, count int) []*Entry {
+	if end.Less(start) {
+		return nil
+	}
+	upper := len(s.entries)
+	if next, ok := end.Incr(); ok {
+		upper = s.search(next)
+	}
+	result := make([]*Entry, 0)
+	for i := upper - 1; i >= 0 && !s.entries[i].ID.Less(start); i-- {
+		if count > 0 && len(result) >= count {
+			break
+		}
+		result = append(result, s.entries[i])
+	}
+	return result
+}
+
+// After 返回ID大于 id 的消息，count <= 0 表示不限制数量
+func (s *Stream) After(id ID, count int) []*Entry {
+	next, ok := id.Incr()
+	if !ok {
+		return nil
+	}
+	return s.Range(next, MaxID, count)
+}
+
+// CountAfter 返回ID大于 id 的消息数量
+func (s *Stream) CountAfter(id ID) int {
+	next, ok := id.Incr()
+	if !ok {
+		return 0
+	}
+	return len(s.entries) - s.search(next)
+}
+
+// Delete 删除指定ID的消息，返回是否删除成功
+func (s *Stream) Delete(id ID) bool {
+	i := s.search(id)
+	if i >= len(s.entries) || s.entries[i].ID != id {
+		return false
+	}
+	s.bytes -= s.entries[i].size()
+	copy(s.entries[i:], s.entries[i+1:])
+	s.entries[len(s.entries)-1] = nil
+	s.entries = s.entries[:len(s.entries)-1]
+	if s.maxDeletedID.Less(id) {
+		s.maxDeletedID = id
+	}
+	return true
+}
+
+// removeHead 删除最前面的 n 条消息
+func (s *Stream) removeHead(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if last := s.entries[n-1].ID; s.maxDeletedID.Less(last) {
+		s.maxDeletedID = last
+	}
+	for i := 0; i < n; i++ {
+		s.bytes -= s.entries[i].size()
+		s.entries[i] = nil
+	}
+	s.entries = s.entries[n:]
+	return n
+}
+
+// TrimMaxLen 从头部删除消息，直到剩余的消息数量不超过 maxLen，limit > 0 时最多删除 limit 条
+func (s *Stream) TrimMaxLen(maxLen int, limit int) int {
+	n := len(s.entries) - maxLen
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	return s.removeHead(n)
+}
+
+// TrimMinID 从头部删除ID小于 minID 的消息，limit > 0 时最多删除 limit 条
+func (s *Stream) TrimMinID(minID ID, limit int) int {
+	n := s.search(minID)
+	if limit > 0 && n > limit {
+		n = limit
+	}
+	return s.removeHead(n)
+}
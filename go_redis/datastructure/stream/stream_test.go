@@ -0,0 +1,210 @@
+package stream
+
+import (
+	"testing"
+)
+
+func makeTestStream(ids ...ID) *Stream {
+	s := Make()
+	for _, id := range ids {
+		s.Add(id, [][]byte{[]byte("f"), []byte("v")})
+	}
+	return s
+}
+
+func entryIDs(entries []*Entry) []ID {
+	ids := make([]ID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+func equalIDs(a, b []ID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestParseID(t *testing.T) {
+	tests := []struct {
+		in         string
+		missingSeq uint64
+		want       ID
+		wantErr    bool
+	}{
+		{in: "1-2", want: ID{1, 2}},
+		{in: "5", want: ID{5, 0}},
+		{in: "5", missingSeq: ^uint64(0), want: ID{5, ^uint64(0)}},
+		{in: "18446744073709551615-18446744073709551615", want: MaxID},
+		{in: "1-", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "a-1", wantErr: true},
+		{in: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseID(tt.in, tt.missingSeq)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseID(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if err == nil && got != tt.want {
+			t.Errorf("ParseID(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestAddRejectsSmallerID(t *testing.T) {
+	s := Make()
+	if s.Add(MinID, nil) {
+		t.Error("0-0 should be rejected")
+	}
+	if !s.Add(ID{1, 1}, nil) {
+		t.Fatal("first add failed")
+	}
+	if s.Add(ID{1, 1}, nil) || s.Add(ID{1, 0}, nil) {
+		t.Error("IDs not greater than the last one should be rejected")
+	}
+	s.Delete(ID{1, 1})
+	if s.Add(ID{1, 1}, nil) {
+		t.Error("the last ID must not go back after deleting the last entry")
+	}
+	if next, _ := s.NextID(0); next != (ID{1, 2}) {
+		t.Errorf("NextID with a clock behind lastID = %v, want 1-2", next)
+	}
+}
+
+func TestRange(t *testing.T) {
+	s := makeTestStream(ID{1, 0}, ID{1, 1}, ID{2, 0}, ID{3, 5})
+	tests := []struct {
+		name       string
+		start, end ID
+		count      int
+		rev        bool
+		want       []ID
+	}{
+		{name: "all", start: MinID, end: MaxID, want: []ID{{1, 0}, {1, 1}, {2, 0}, {3, 5}}},
+		{name: "count", start: MinID, end: MaxID, count: 2, want: []ID{{1, 0}, {1, 1}}},
+		{name: "inner", start: ID{1, 1}, end: ID{2, 0}, want: []ID{{1, 1}, {2, 0}}},
+		{name: "empty interval", start: ID{3, 0}, end: ID{2, 0}, want: []ID{}},
+		{name: "rev all", start: MinID, end: MaxID, rev: true, want: []ID{{3, 5}, {2, 0}, {1, 1}, {1, 0}}},
+		{name: "rev count", start: MinID, end: ID{2, 0}, count: 2, rev: true, want: []ID{{2, 0}, {1, 1}}},
+	}
+	for _, tt := range tests {
+		var got []*Entry
+		if tt.rev {
+			got = s.RevRange(tt.start, tt.end, tt.count)
+		} else {
+			got = s.Range(tt.start, tt.end, tt.count)
+		}
+		if !equalIDs(entryIDs(got), tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, entryIDs(got), tt.want)
+		}
+	}
+	if got := entryIDs(s.After(ID{1, 1}, 0)); !equalIDs(got, []ID{{2, 0}, {3, 5}}) {
+		t.Errorf("After(1-1) = %v", got)
+	}
+	if n := s.CountAfter(ID{1, 0}); n != 3 {
+		t.Errorf("CountAfter(1-0) = %d, want 3", n)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	ids := []ID{{1, 0}, {2, 0}, {3, 0}, {4, 0}, {5, 0}}
+	tests := []struct {
+		name    string
+		trim    func(s *Stream) int
+		removed int
+		first   ID
+	}{
+		{name: "maxlen", trim: func(s *Stream) int { return s.TrimMaxLen(2, 0) }, removed: 3, first: ID{4, 0}},
+		{name: "maxlen limit", trim: func(s *Stream) int { return s.TrimMaxLen(0, 2) }, removed: 2, first: ID{3, 0}},
+		{name: "maxlen larger", trim: func(s *Stream) int { return s.TrimMaxLen(10, 0) }, removed: 0, first: ID{1, 0}},
+		{name: "minid", trim: func(s *Stream) int { return s.TrimMinID(ID{3, 0}, 0) }, removed: 2, first: ID{3, 0}},
+		{name: "minid limit", trim: func(s *Stream) int { return s.TrimMinID(ID{5, 0}, 1) }, removed: 1, first: ID{2, 0}},
+	}
+	for _, tt := range tests {
+		s := makeTestStream(ids...)
+		if removed := tt.trim(s); removed != tt.removed {
+			t.Errorf("%s: removed %d, want %d", tt.name, removed, tt.removed)
+		}
+		if s.First().ID != tt.first {
+			t.Errorf("%s: first entry %v, want %v", tt.name, s.First().ID, tt.first)
+		}
+		if tt.removed > 0 && s.MaxDeletedID() != ids[tt.removed-1] {
+			t.Errorf("%s: max deleted %v, want %v", tt.name, s.MaxDeletedID(), ids[tt.removed-1])
+		}
+	}
+}
+
+func TestPendingEntries(t *testing.T) {
+	s := makeTestStream(ID{1, 0}, ID{2, 0}, ID{3, 0})
+	group, _ := s.CreateGroup("g", MinID, 0)
+	alice, _ := group.CreateConsumer("alice", 0)
+	bob, _ := group.CreateConsumer("bob", 0)
+
+	// 乱序投递，PEL 仍然按ID有序
+	group.Deliver(ID{3, 0}, alice, 10)
+	group.Deliver(ID{1, 0}, alice, 20)
+	group.Deliver(ID{2, 0}, bob, 30)
+	all := group.PendingRange(MinID, MaxID, 0, nil, 0, 0)
+	if len(all) != 3 || all[0].ID != (ID{1, 0}) || all[2].ID != (ID{3, 0}) {
+		t.Fatalf("PEL is not ordered: %v", all)
+	}
+	if alice.PendingCount() != 2 || bob.PendingCount() != 1 {
+		t.Fatalf("pending counts alice=%d bob=%d", alice.PendingCount(), bob.PendingCount())
+	}
+	if idle := group.PendingRange(MinID, MaxID, 0, nil, 10, 30); len(idle) != 2 {
+		t.Errorf("entries idle for at least 10ms: %d, want 2", len(idle))
+	}
+
+	// 重新投递给另一个消费者会转移所有权并增加投递次数
+	pe := group.Deliver(ID{3, 0}, bob, 40)
+	if pe.DeliveryCount != 2 || pe.Consumer != bob || alice.PendingCount() != 1 || bob.PendingCount() != 2 {
+		t.Errorf("redelivery: count=%d alice=%d bob=%d", pe.DeliveryCount, alice.PendingCount(), bob.PendingCount())
+	}
+
+	if !group.Ack(ID{2, 0}) || group.Ack(ID{2, 0}) {
+		t.Error("ack should succeed exactly once")
+	}
+	if deleted, _ := group.DeleteConsumer("bob"); deleted != 1 {
+		t.Errorf("deleting bob dropped %d pending entries, want 1", deleted)
+	}
+	if group.PendingCount() != 1 || group.Pending(ID{1, 0}) == nil {
+		t.Errorf("only alice's entry should remain, got %d", group.PendingCount())
+	}
+}
+
+func TestClone(t *testing.T) {
+	s := makeTestStream(ID{1, 0}, ID{2, 0})
+	group, _ := s.CreateGroup("g", ID{}, 0)
+	alice, _ := group.CreateConsumer("alice", 0)
+	group.Deliver(ID{1, 0}, alice, 10)
+
+	clone := s.Clone()
+	s.Get(ID{1, 0}).Fields[1][0] = 'x'
+	s.Add(ID{3, 0}, [][]byte{[]byte("f"), []byte("v")})
+	group.Ack(ID{1, 0})
+
+	if clone.Len() != 2 || clone.LastID() != (ID{2, 0}) || clone.EntriesAdded() != 2 {
+		t.Fatalf("clone Len() = %d, LastID() = %v, EntriesAdded() = %d", clone.Len(), clone.LastID(), clone.EntriesAdded())
+	}
+	if got := string(clone.Get(ID{1, 0}).Fields[1]); got != "v" {
+		t.Errorf("clone entry value = %q, want v", got)
+	}
+	cloned := clone.Group("g")
+	pe := cloned.Pending(ID{1, 0})
+	// PEL 中的记录指向拷贝中的消费者，而不是原来的消费者
+	if pe == nil || pe.Consumer != cloned.Consumer("alice") || pe.Consumer == alice {
+		t.Fatalf("cloned pending entry %+v", pe)
+	}
+	if pe.Consumer.PendingCount() != 1 || alice.PendingCount() != 0 {
+		t.Errorf("pending counts clone=%d original=%d", pe.Consumer.PendingCount(), alice.PendingCount())
+	}
+}
@@ -0,0 +1,102 @@
+package embedded
+
+import (
+	"context"
+	"go_redis/database"
+	"go_redis/resp/connection"
+	"go_redis/resp/handler"
+	"go_redis/resp/reply"
+	"strings"
+	"sync"
+)
+
+/**
+ * 在当前进程中运行的存储引擎，不需要监听端口，主要用于单元测试：
+ * Exec 直接调用存储引擎执行指令，不经过网络和RESP协议，每次调用都是一个新的客户端；
+ * Session 是进程内的一个客户端，SELECT 等修改客户端状态的指令只影响这个 Session；
+ * Dial 返回一个通过 net.Pipe 连接到进程内服务端的连接，经过同网络连接完全相同的协议处理流程
+ */
+
+// Engine 是进程内的存储引擎，可以被多个协程同时使用
+type Engine struct {
+	db *database.Database
+
+	mu sync.Mutex
+	// 第一次 Dial 时才创建
+	handler *handler.RespHandler
+	closed  bool
+}
+
+// NewEngine 创建一个进程内的存储引擎，使用当前的配置项 config.Properties
+func NewEngine() *Engine {
+	return &Engine{
+		db: database.NewDatabase(),
+	}
+}
+
+// Exec 执行一条指令，例如 Exec(ctx, "SET", "k", "v")，总是在0号数据库上执行
+// 每次调用使用一个新的客户端，多个协程同时调用互不影响，修改客户端状态的指令需要通过 Session 执行
+// 指令一旦开始执行就不会被中断，ctx 在执行前检查；BLPOP 等阻塞指令等待期间 ctx 结束时返回 ctx 的错误
+func (e *Engine) Exec(ctx context.Context, args ...string) *Result {
+	if len(args) > 0 {
+		switch name := strings.ToLower(args[0]); name {
+		case "select", "client":
+			// 每次调用的客户端都不同，修改的客户端状态对之后的调用没有作用
+			return makeResult(reply.MakeErrReply("ERR '" + name + "' is not supported by Exec, use a Session"))
+		}
+	}
+	return e.exec(ctx, connection.NewFakeConn(), args)
+}
+
+// exec 以客户端 c 的身份执行一条指令
+func (e *Engine) exec(ctx context.Context, c *connection.FakeConn, args []string) *Result {
+	if err := ctx.Err(); err != nil {
+		return &Result{err: err}
+	}
+	if len(args) == 0 {
+		return makeResult(reply.MakeErrReply("ERR empty command"))
+	}
+	if e.isClosed() {
+		return &Result{err: ErrClosed}
+	}
+	switch name := strings.ToLower(args[0]); name {
+	case "subscribe", "psubscribe", "monitor":
+		// 这些指令之后服务端通过连接推送数据，Exec 没有办法接收，需要通过 Dial 的连接执行
+		return makeResult(reply.MakeErrReply("ERR '" + name + "' is not supported by Exec, use a connection from Dial"))
+	}
+	cmdLine := make([][]byte, len(args))
+	for i, arg := range args {
+		cmdLine[i] = []byte(arg)
+	}
+	result := e.db.Exec(c, cmdLine)
+	if blocked, ok := result.(*database.BlockedReply); ok {
+		// 同网络层一样挂起调用方，直到等待的 key 有数据、超时或者 ctx 结束
+		result = e.db.Block(ctx, c, blocked)
+		if result == nil {
+			return &Result{err: ctx.Err()}
+		}
+	}
+	return makeResult(result)
+}
+
+// Close 关闭存储引擎和所有通过 Dial 建立的连接
+func (e *Engine) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	if e.handler != nil {
+		// 关闭 Handler 时会关闭存储引擎
+		return e.handler.Close()
+	}
+	e.db.Close()
+	return nil
+}
+
+func (e *Engine) isClosed() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.closed
+}
@@ -0,0 +1,268 @@
+package embedded
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"go_redis/client"
+	"go_redis/resp/reply"
+	"io"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newEngine(t *testing.T) *Engine {
+	t.Helper()
+	e := NewEngine()
+	t.Cleanup(func() {
+		_ = e.Close()
+	})
+	return e
+}
+
+func TestExecResultTypes(t *testing.T) {
+	e := newEngine(t)
+	ctx := context.Background()
+
+	if ok, err := e.Exec(ctx, "SET", "k", "v").Bool(); err != nil || !ok {
+		t.Fatalf("SET got %v, %v", ok, err)
+	}
+	if got, err := e.Exec(ctx, "GET", "k").String(); err != nil || got != "v" {
+		t.Fatalf("GET got %q, %v", got, err)
+	}
+	if _, err := e.Exec(ctx, "GET", "missing").String(); err != ErrNil {
+		t.Fatalf("GET missing got error %v, want ErrNil", err)
+	}
+	if n, err := e.Exec(ctx, "STRLEN", "k").Int64(); err != nil || n != 1 {
+		t.Fatalf("STRLEN got %d, %v", n, err)
+	}
+	if ok, err := e.Exec(ctx, "EXISTS", "missing").Bool(); err != nil || ok {
+		t.Fatalf("EXISTS missing got %v, %v", ok, err)
+	}
+	if keys, err := e.Exec(ctx, "KEYS", "*").Strings(); err != nil || len(keys) != 1 || keys[0] != "k" {
+		t.Fatalf("KEYS got %q, %v", keys, err)
+	}
+
+	result := e.Exec(ctx, "NOSUCHCOMMAND")
+	var errReply reply.ErrorReply
+	if !errors.As(result.Err(), &errReply) {
+		t.Fatalf("unknown command got error %v, want an error reply", result.Err())
+	}
+	if _, err := result.String(); err != result.Err() {
+		t.Fatalf("conversion returned %v, want the error reply", err)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := e.Exec(cancelled, "SET", "k", "other").Err(); err != context.Canceled {
+		t.Fatalf("cancelled context got %v", err)
+	}
+	if got, _ := e.Exec(ctx, "GET", "k").String(); got != "v" {
+		t.Fatalf("command ran after the context was cancelled, GET got %q", got)
+	}
+}
+
+func TestExecRejectsStatefulCommands(t *testing.T) {
+	e := newEngine(t)
+	ctx := context.Background()
+	for _, args := range [][]string{
+		{"SELECT", "1"},
+		{"CLIENT", "SETNAME", "name"},
+		{"CLIENT", "TRACKING", "ON"},
+		{"SUBSCRIBE", "news"},
+		{"MONITOR"},
+	} {
+		var errReply reply.ErrorReply
+		if err := e.Exec(ctx, args...).Err(); !errors.As(err, &errReply) {
+			t.Errorf("%q got error %v, want an error reply", args, err)
+		}
+	}
+}
+
+func TestConcurrentExecAndSessions(t *testing.T) {
+	e := newEngine(t)
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := e.NewSession()
+			defer s.Close()
+			db := strconv.Itoa(i%4 + 1)
+			for j := 0; j < 50; j++ {
+				if err := s.Exec(ctx, "SELECT", db).Err(); err != nil {
+					t.Error(err)
+					return
+				}
+				if err := s.Exec(ctx, "SET", "db", db).Err(); err != nil {
+					t.Error(err)
+					return
+				}
+				// 其他 Session 的 SELECT 不会影响这个 Session 和 Exec 使用的数据库
+				if got, err := s.Exec(ctx, "GET", "db").String(); err != nil || got != db {
+					t.Errorf("session on db %s read %q, %v", db, got, err)
+					return
+				}
+				if _, err := e.Exec(ctx, "GET", "db").String(); err != ErrNil {
+					t.Errorf("Exec read db 0 and got %v, want ErrNil", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestSessionClientState(t *testing.T) {
+	e := newEngine(t)
+	ctx := context.Background()
+	s := e.NewSession()
+	if err := s.Exec(ctx, "CLIENT", "SETNAME", "worker").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Exec(ctx, "CLIENT", "GETNAME").String(); err != nil || got != "worker" {
+		t.Fatalf("CLIENT GETNAME got %q, %v", got, err)
+	}
+	other := e.NewSession()
+	defer other.Close()
+	if _, err := other.Exec(ctx, "CLIENT", "GETNAME").String(); err != ErrNil {
+		t.Fatalf("name leaked to another session, got error %v", err)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Exec(ctx, "PING").Err(); err != ErrClosed {
+		t.Fatalf("Exec after Session.Close got %v, want ErrClosed", err)
+	}
+}
+
+func TestDialRoundTrip(t *testing.T) {
+	e := newEngine(t)
+	conn, err := e.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Write([]byte("*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\nPING\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"+OK\r\n", "+PONG\r\n"} {
+		line, err := r.ReadString('\n')
+		if err != nil || line != want {
+			t.Fatalf("got %q, %v, want %q", line, err, want)
+		}
+	}
+	// 通过连接写入的数据和 Exec 在同一个存储引擎中
+	if got, err := e.Exec(context.Background(), "GET", "k").String(); err != nil || got != "v" {
+		t.Fatalf("GET got %q, %v", got, err)
+	}
+}
+
+func TestNewClientRoundTrip(t *testing.T) {
+	e := newEngine(t)
+	ctx := context.Background()
+	c := e.NewClient(client.Options{DB: 2})
+	defer c.Close()
+	if err := c.Set(ctx, "k", "v"); err != nil {
+		t.Fatal(err)
+	}
+	s := e.NewSession()
+	defer s.Close()
+	if err := s.Exec(ctx, "SELECT", "2").Err(); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := s.Exec(ctx, "GET", "k").String(); err != nil || got != "v" {
+		t.Fatalf("GET got %q, %v", got, err)
+	}
+
+	ps, err := c.Subscribe(ctx, "news")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ps.Close()
+	deadline := time.Now().Add(time.Second)
+	for {
+		// 订阅的确认由接收协程读取，重复发布直到订阅生效
+		if n, _ := e.Exec(ctx, "PUBLISH", "news", "hello").Int64(); n == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription did not take effect")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case msg := <-ps.Channel():
+		if msg.Channel != "news" || string(msg.Payload) != "hello" {
+			t.Fatalf("got message %+v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no message received")
+	}
+}
+
+func TestClose(t *testing.T) {
+	e := NewEngine()
+	s := e.NewSession()
+	conn, err := e.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatalf("second Close got %v", err)
+	}
+	if err := e.Exec(context.Background(), "PING").Err(); err != ErrClosed {
+		t.Fatalf("Exec after Close got %v, want ErrClosed", err)
+	}
+	if err := s.Exec(context.Background(), "PING").Err(); err != ErrClosed {
+		t.Fatalf("Session.Exec after Close got %v, want ErrClosed", err)
+	}
+	if _, err := e.Dial(); err != ErrClosed {
+		t.Fatalf("Dial after Close got %v, want ErrClosed", err)
+	}
+	// 关闭存储引擎时断开已经建立的连接
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read on a dialed connection after Close got %v, want io.EOF", err)
+	}
+}
+
+func TestExecBlocking(t *testing.T) {
+	e := newEngine(t)
+	ctx := context.Background()
+
+	done := make(chan *Result, 1)
+	go func() {
+		done <- e.Exec(ctx, "BLPOP", "list", "0")
+	}()
+	// 等待 BLPOP 开始阻塞，即使 RPUSH 先执行 BLPOP 也会取到同一个元素
+	time.Sleep(20 * time.Millisecond)
+	if err := e.Exec(ctx, "RPUSH", "list", "a").Err(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case result := <-done:
+		if got, err := result.Strings(); err != nil || len(got) != 2 || got[0] != "list" || got[1] != "a" {
+			t.Fatalf("BLPOP got %q, %v", got, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BLPOP was not woken up")
+	}
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := e.Exec(timeout, "BLPOP", "other", "0").Err(); err != context.DeadlineExceeded {
+		t.Fatalf("BLPOP after the context ended got %v, want context.DeadlineExceeded", err)
+	}
+}
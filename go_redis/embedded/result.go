@@ -0,0 +1,85 @@
+package embedded
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go_redis/client"
+	"go_redis/interface/resp"
+	"go_redis/resp/parser"
+	"go_redis/resp/reply"
+)
+
+var (
+	// ErrNil 表示 key 不存在，同 client.ErrNil 是同一个错误
+	ErrNil = client.ErrNil
+	// ErrClosed 表示存储引擎已经关闭
+	ErrClosed = errors.New("embedded: engine is closed")
+)
+
+// Result 是 Exec 执行指令的结果，提供同 client 包一致的类型转换
+type Result struct {
+	reply resp.Reply
+	err   error
+}
+
+// makeResult 把存储引擎返回的回复转换为 Result
+// 存储引擎内部用多种类型表示回复，比如 *reply.OkReply 和 *reply.MultiBulkReply，
+// 这里先编码再解析，得到和通过网络收到的回复相同的类型，类型转换因此可以复用 client 包
+func makeResult(r resp.Reply) *Result {
+	if r == nil {
+		r = reply.MakeErrReply("ERR unknown")
+	}
+	raw := r.ToBytes()
+	if len(raw) > 0 {
+		if parsed, err := parser.NewReader(bytes.NewReader(raw)).ReadReply(); err == nil {
+			r = parsed
+		}
+	}
+	result := &Result{reply: r}
+	if errReply, ok := r.(reply.ErrorReply); ok {
+		result.err = errReply
+	}
+	return result
+}
+
+// Reply 返回指令的回复，出错时可能为 nil
+func (r *Result) Reply() resp.Reply {
+	return r.reply
+}
+
+// Err 返回执行指令的错误，服务端的错误回复是 reply.ErrorReply 类型
+func (r *Result) Err() error {
+	return r.err
+}
+
+// String 把字符串、状态和整数回复转换为字符串，null 回复返回 ErrNil
+func (r *Result) String() (string, error) {
+	return client.String(r.reply, r.err)
+}
+
+// Int64 把整数回复转换为 int64
+func (r *Result) Int64() (int64, error) {
+	return client.Int64(r.reply, r.err)
+}
+
+// Strings 把数组回复转换为字符串切片
+func (r *Result) Strings() ([]string, error) {
+	return client.Strings(r.reply, r.err)
+}
+
+// Bool 把整数回复转换为它是否不为0，把状态回复转换为它是否为 OK，null 回复返回 ErrNil
+func (r *Result) Bool() (bool, error) {
+	if r.err != nil {
+		return false, r.err
+	}
+	switch v := r.reply.(type) {
+	case *reply.IntReply:
+		return v.Code != 0, nil
+	case *reply.StatusReply:
+		return v.Status == "OK", nil
+	case *reply.NullBulkReply, *reply.NullMultiBulkReply:
+		return false, ErrNil
+	}
+	return false, fmt.Errorf("redis: unexpected reply %q", r.reply.ToBytes())
+}
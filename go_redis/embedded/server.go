@@ -0,0 +1,38 @@
+package embedded
+
+import (
+	"context"
+	"go_redis/client"
+	"go_redis/resp/handler"
+	"net"
+)
+
+// Dial 返回一个连接到进程内服务端的连接，服务端通过 RespHandler.Handle 处理它，
+// 同 TCP 连接一样需要按照RESP协议读写，关闭连接即断开同服务端的连接
+func (e *Engine) Dial() (net.Conn, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.closed {
+		return nil, ErrClosed
+	}
+	if e.handler == nil {
+		e.handler = handler.MakeHandlerWithDatabase(e.db)
+	}
+	serverSide, clientSide := net.Pipe()
+	go e.handler.Handle(context.Background(), serverSide)
+	return clientSide, nil
+}
+
+// DialContext 同 Dial，签名符合 client.Options 的 Dialer
+func (e *Engine) DialContext(ctx context.Context) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return e.Dial()
+}
+
+// NewClient 创建一个连接进程内服务端的客户端，opts 中的 Network、Addr 和 Dialer 被忽略
+func (e *Engine) NewClient(opts client.Options) *client.Client {
+	opts.Dialer = e.DialContext
+	return client.NewClient(opts)
+}
@@ -0,0 +1,49 @@
+package embedded
+
+import (
+	"context"
+	"go_redis/resp/connection"
+	"sync"
+)
+
+// Session 是进程内的一个客户端，同一个 Session 上执行的指令共享客户端状态，
+// 比如 SELECT 选择的数据库、CLIENT SETNAME 设置的名字和 CLIENT TRACKING 的设置。
+// Session 可以被多个协程同时使用，指令按调用 Exec 的顺序依次执行，同一条网络连接上的指令一样
+type Session struct {
+	engine *Engine
+	conn   *connection.FakeConn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewSession 创建一个进程内的客户端，不再使用时需要调用 Close
+func (e *Engine) NewSession() *Session {
+	return &Session{
+		engine: e,
+		conn:   connection.NewFakeConn(),
+	}
+}
+
+// Exec 以这个客户端的身份执行一条指令，例如 Exec(ctx, "SELECT", "1")
+// ctx 的作用同 Engine.Exec，阻塞指令等待期间这个 Session 上的其他调用也要等待
+func (s *Session) Exec(ctx context.Context, args ...string) *Result {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return &Result{err: ErrClosed}
+	}
+	return s.engine.exec(ctx, s.conn, args)
+}
+
+// Close 断开这个客户端，清理它在存储引擎中的状态，比如 CLIENT TRACKING 记录的 key
+func (s *Session) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	s.engine.db.AfterClientClose(s.conn)
+	return nil
+}
@@ -16,4 +16,9 @@ type Database interface {
 // 将data和key绑定，包括string list has set
 type DataEntity struct {
 	Data interface{}
+	// AccessTime 是最近一次访问该实体的时间(毫秒时间戳)，用于LRU淘汰策略
+	// 在LFU淘汰策略下，也用来计算访问计数器应该衰减多少
+	AccessTime int64
+	// Counter 是对数形式的访问频率计数器，用于LFU淘汰策略
+	Counter uint32
 }
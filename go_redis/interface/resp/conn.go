@@ -1,10 +1,20 @@
 package resp
 
+import "net"
+
 // Connection 表示一个与redis客户端的连接
 type Connection interface {
-	Write([]byte) error // 向客户端发送数据
-	GetDBIndex() int    // redis内部默认分为16个数据库，返回当前使用的数据库的索引
-	SelectDB(int)       // 切换使用的数据库
+	Write([]byte) error   // 向客户端发送数据
+	GetDBIndex() int      // redis内部默认分为16个数据库，返回当前使用的数据库的索引
+	SelectDB(int)         // 切换使用的数据库
+	RemoteAddr() net.Addr // 返回客户端的网络地址
+	GetName() string      // 返回客户端通过 CLIENT SETNAME 设置的名字
+	SetName(string)       // 设置客户端的名字
+	GetID() int64         // 返回服务端为连接分配的唯一ID
+	SetSubscribed(bool)   // 标记客户端是否处于订阅模式，订阅模式下使用 pubsub 类别的输出缓冲区限制
+	// 配置了 requirepass 时，记录客户端是否已经通过 AUTH 验证了密码
+	SetAuthenticated(bool)
+	IsAuthenticated() bool
 }
 
 // Reply 是RESP(redis serialization protocol)向客户端发送的消息的接口
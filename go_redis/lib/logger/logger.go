@@ -41,6 +41,29 @@ const (
 
 const flags = log.LstdFlags
 
+// level is the lowest level that gets printed
+var level = DEBUG
+
+// SetLevel sets the lowest level that gets printed
+func SetLevel(l logLevel) {
+	mu.Lock()
+	defer mu.Unlock()
+	level = l
+}
+
+// ParseLevel converts a redis.conf loglevel (debug, verbose, notice, warning) into a log level
+func ParseLevel(name string) (logLevel, bool) {
+	switch name {
+	case "debug", "verbose":
+		return DEBUG, true
+	case "notice":
+		return INFO, true
+	case "warning":
+		return WARNING, true
+	}
+	return DEBUG, false
+}
+
 func init() {
 	logger = log.New(os.Stdout, defaultPrefix, flags)
 }
@@ -75,14 +98,20 @@ func setPrefix(level logLevel) {
 func Debug(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if level > DEBUG {
+		return
+	}
 	setPrefix(DEBUG)
-	logger.Println(v)
+	logger.Println(v...)
 }
 
 // Info prints normal log
 func Info(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if level > INFO {
+		return
+	}
 	setPrefix(INFO)
 	logger.Println(v...)
 }
@@ -91,6 +120,9 @@ func Info(v ...interface{}) {
 func Warn(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if level > WARNING {
+		return
+	}
 	setPrefix(WARNING)
 	logger.Println(v...)
 }
@@ -99,6 +131,9 @@ func Warn(v ...interface{}) {
 func Error(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if level > ERROR {
+		return
+	}
 	setPrefix(ERROR)
 	logger.Println(v...)
 }
@@ -0,0 +1,169 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go_redis/lib/logger"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/*
+ * A minimal writer of the Prometheus text exposition format and an HTTP server for it,
+ * built on the standard library only
+ */
+
+// Label is a name/value pair attached to a sample
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Collector writes the current metrics into w
+type Collector interface {
+	WriteMetrics(w *Writer)
+}
+
+// Writer builds a text exposition, writing the HELP and TYPE lines once per metric family
+type Writer struct {
+	buf      bytes.Buffer
+	families map[string]bool
+}
+
+// NewWriter returns an empty Writer
+func NewWriter() *Writer {
+	return &Writer{
+		families: make(map[string]bool),
+	}
+}
+
+// Bytes returns the exposition written so far
+func (w *Writer) Bytes() []byte {
+	return w.buf.Bytes()
+}
+
+func (w *Writer) header(name string, typ string, help string) {
+	if w.families[name] {
+		return
+	}
+	w.families[name] = true
+	w.buf.WriteString("# HELP " + name + " " + escapeHelp(help) + "\n")
+	w.buf.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func (w *Writer) sample(name string, labels []Label, value float64) {
+	w.buf.WriteString(name)
+	if len(labels) > 0 {
+		w.buf.WriteByte('{')
+		for i, l := range labels {
+			if i > 0 {
+				w.buf.WriteByte(',')
+			}
+			w.buf.WriteString(l.Name + "=\"" + escapeLabelValue(l.Value) + "\"")
+		}
+		w.buf.WriteByte('}')
+	}
+	w.buf.WriteString(" " + formatFloat(value) + "\n")
+}
+
+// Gauge writes a gauge sample
+func (w *Writer) Gauge(name string, help string, value float64, labels ...Label) {
+	w.header(name, "gauge", help)
+	w.sample(name, labels, value)
+}
+
+// Counter writes a counter sample, name should end with _total
+func (w *Writer) Counter(name string, help string, value float64, labels ...Label) {
+	w.header(name, "counter", help)
+	w.sample(name, labels, value)
+}
+
+// Histogram writes a histogram, bounds are the upper bounds of the buckets in increasing order
+// and counts holds the number of observations that fell into each bucket (not cumulative),
+// with one extra trailing element for observations above the last bound
+func (w *Writer) Histogram(name string, help string, bounds []float64, counts []uint64, sum float64, labels ...Label) {
+	w.header(name, "histogram", help)
+	var cumulative uint64
+	for i, bound := range bounds {
+		cumulative += counts[i]
+		w.sample(name+"_bucket", withLabel(labels, "le", formatFloat(bound)), float64(cumulative))
+	}
+	cumulative += counts[len(bounds)]
+	w.sample(name+"_bucket", withLabel(labels, "le", "+Inf"), float64(cumulative))
+	w.sample(name+"_sum", labels, sum)
+	w.sample(name+"_count", labels, float64(cumulative))
+}
+
+func withLabel(labels []Label, name string, value string) []Label {
+	result := make([]Label, 0, len(labels)+1)
+	result = append(result, labels...)
+	return append(result, Label{Name: name, Value: value})
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	return strings.ReplaceAll(s, "\n", "\\n")
+}
+
+func escapeLabelValue(s string) string {
+	s = strings.ReplaceAll(s, "\\", "\\\\")
+	s = strings.ReplaceAll(s, "\"", "\\\"")
+	return strings.ReplaceAll(s, "\n", "\\n")
+}
+
+// Server serves the metrics of collectors on /metrics
+type Server struct {
+	httpServer *http.Server
+	listener   net.Listener
+}
+
+// ListenAndServe starts serving metrics on address in a new goroutine
+func ListenAndServe(address string, collectors ...Collector) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(rw http.ResponseWriter, r *http.Request) {
+		w := NewWriter()
+		for _, c := range collectors {
+			c.WriteMetrics(w)
+		}
+		rw.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_, _ = rw.Write(w.Bytes())
+	})
+	server := &Server{
+		httpServer: &http.Server{
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+		listener: listener,
+	}
+	go func() {
+		if err := server.httpServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			logger.Error(fmt.Sprintf("metrics server error: %v", err))
+		}
+	}()
+	logger.Info(fmt.Sprintf("metrics: %s, start listening...", address))
+	return server, nil
+}
+
+// Addr returns the address the server is listening on
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops the metrics server
+func (s *Server) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.httpServer.Shutdown(ctx)
+}
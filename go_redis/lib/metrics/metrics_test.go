@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	tests := []struct {
+		name  string
+		write func(w *Writer)
+		want  string
+	}{
+		{
+			name: "gauge",
+			write: func(w *Writer) {
+				w.Gauge("up", "Whether the server is up.", 1)
+			},
+			want: "# HELP up Whether the server is up.\n# TYPE up gauge\nup 1\n",
+		},
+		{
+			name: "header written once per family",
+			write: func(w *Writer) {
+				w.Counter("calls_total", "Calls.", 3, Label{Name: "cmd", Value: "get"})
+				w.Counter("calls_total", "Calls.", 0.5, Label{Name: "cmd", Value: "set"})
+			},
+			want: "# HELP calls_total Calls.\n# TYPE calls_total counter\n" +
+				"calls_total{cmd=\"get\"} 3\ncalls_total{cmd=\"set\"} 0.5\n",
+		},
+		{
+			name: "escaping",
+			write: func(w *Writer) {
+				w.Gauge("g", "a\\b\nc", 1, Label{Name: "l", Value: "x\"y\\z\n"})
+			},
+			want: "# HELP g a\\\\b\\nc\n# TYPE g gauge\ng{l=\"x\\\"y\\\\z\\n\"} 1\n",
+		},
+		{
+			name: "cumulative histogram",
+			write: func(w *Writer) {
+				w.Histogram("latency", "Latency.", []float64{0.1, 1}, []uint64{2, 3, 1}, 4.5, Label{Name: "cmd", Value: "get"})
+			},
+			want: "# HELP latency Latency.\n# TYPE latency histogram\n" +
+				"latency_bucket{cmd=\"get\",le=\"0.1\"} 2\n" +
+				"latency_bucket{cmd=\"get\",le=\"1\"} 5\n" +
+				"latency_bucket{cmd=\"get\",le=\"+Inf\"} 6\n" +
+				"latency_sum{cmd=\"get\"} 4.5\n" +
+				"latency_count{cmd=\"get\"} 6\n",
+		},
+	}
+	for _, tt := range tests {
+		w := NewWriter()
+		tt.write(w)
+		if got := string(w.Bytes()); got != tt.want {
+			t.Errorf("%s:\ngot\n%s\nwant\n%s", tt.name, got, tt.want)
+		}
+	}
+}
+
+type collectorFunc func(w *Writer)
+
+func (f collectorFunc) WriteMetrics(w *Writer) {
+	f(w)
+}
+
+func TestServer(t *testing.T) {
+	server, err := ListenAndServe("127.0.0.1:0", collectorFunc(func(w *Writer) {
+		w.Gauge("up", "Whether the server is up.", 1)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	resp, err := http.Get("http://" + server.Addr().String() + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+	if !strings.HasSuffix(string(body), "up 1\n") {
+		t.Errorf("unexpected body %q", body)
+	}
+}
@@ -18,3 +18,8 @@ func BytesEquals(a []byte, b []byte) bool {
 	}
 	return true
 }
+
+// CopyBytes 返回字节数组的副本
+func CopyBytes(b []byte) []byte {
+	return append([]byte(nil), b...)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"go_redis/config"
 	"go_redis/lib/logger"
+	"go_redis/lib/metrics"
 	"go_redis/resp/handler"
 	"go_redis/tcp"
 	"os"
@@ -11,16 +12,35 @@ import (
 
 const configFile string = "redis.conf"
 
-var defaultProperties = &config.ServerProperties{
-	Bind: "0.0.0.0",
-	Port: 6379,
-}
-
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	return err == nil && !info.IsDir()
 }
 
+// applyLogLevel 将配置中的日志级别应用到 logger
+func applyLogLevel(props *config.ServerProperties) {
+	if level, ok := logger.ParseLevel(props.LogLevel); ok {
+		logger.SetLevel(level)
+	}
+}
+
+// tlsFiles 返回配置中的TLS证书文件
+func tlsFiles(props *config.ServerProperties) *tcp.TLSFiles {
+	return &tcp.TLSFiles{
+		CertFile:    props.TLSCertFile,
+		KeyFile:     props.TLSKeyFile,
+		CACertFile:  props.TLSCACertFile,
+		AuthClients: props.TLSAuthClients,
+	}
+}
+
+// reloadConfig 收到 SIGHUP 信号时重新读取配置文件
+func reloadConfig() {
+	if err := config.Reload(); err != nil {
+		logger.Error("config reload failed: " + err.Error())
+	}
+}
+
 func main() {
 	logger.Setup(&logger.Settings{
 		Path:       "logs",
@@ -32,16 +52,56 @@ func main() {
 	if fileExists(configFile) {
 		config.SetupConfig(configFile)
 	} else {
-		config.Properties = defaultProperties
+		// 没有配置文件时使用默认配置，监听所有网卡
+		config.Update(func(props *config.ServerProperties) {
+			props.Bind = "0.0.0.0"
+		})
+	}
+	applyLogLevel(config.Properties())
+	config.AddUpdateListener(applyLogLevel)
+
+	props := config.Properties()
+	respHandler := handler.MakeHandler()
+	if props.MetricsPort > 0 {
+		// 配置了 metrics-port 时，通过 HTTP 以 Prometheus 的格式导出运行指标
+		metricsServer, err := metrics.ListenAndServe(
+			fmt.Sprintf("%s:%d", props.Bind, props.MetricsPort),
+			respHandler)
+		if err != nil {
+			logger.Error(err)
+		} else {
+			defer metricsServer.Close()
+		}
+	}
+
+	tcpConfig := &tcp.Config{
+		Reload: reloadConfig,
+	}
+	// port 为 0 时不监听普通的TCP端口，只接受TLS连接和Unix Socket连接
+	if props.Port > 0 {
+		tcpConfig.Address = fmt.Sprintf("%s:%d", props.Bind, props.Port)
+	}
+	if props.UnixSocket != "" {
+		tcpConfig.UnixSocket = props.UnixSocket
+		tcpConfig.UnixSocketPerm = os.FileMode(props.UnixSocketPerm)
+	}
+	if props.TLSPort > 0 {
+		certs, err := tcp.NewCertReloader(tlsFiles(props))
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		// 重新加载配置文件或者修改了配置时重新读取证书，替换证书文件之后发送 SIGHUP 即可生效
+		config.AddUpdateListener(func(updated *config.ServerProperties) {
+			if err := certs.Reload(tlsFiles(updated)); err != nil {
+				logger.Error("tls certificate reload failed, keep using the old one: " + err.Error())
+			}
+		})
+		tcpConfig.TLSAddress = fmt.Sprintf("%s:%d", props.Bind, props.TLSPort)
+		tcpConfig.TLS = certs
 	}
 
-	err := tcp.ListenAndServeWithSignal(
-		&tcp.Config{
-			Address: fmt.Sprintf("%s:%d",
-				config.Properties.Bind,
-				config.Properties.Port),
-		},
-		handler.MakeHandler())
+	err := tcp.ListenAndServeWithSignal(tcpConfig, respHandler)
 	if err != nil {
 		logger.Error(err)
 	}
@@ -1,29 +1,77 @@
 package connection
 
 import (
-	"go_redis/lib/sync/wait"
+	"errors"
+	"fmt"
+	"go_redis/config"
+	"go_redis/lib/logger"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// lastID 是最近一次分配的连接ID，连接ID从1开始递增
+var lastID int64
+
+// errClosed 表示连接已经关闭，不再接受要发送的数据
+var errClosed = errors.New("connection closed")
+
+// closeTimeout 是关闭连接时最多等待输出缓冲区发送完的时间
+const closeTimeout = 10 * time.Second
+
+// corkFlushSize 是暂缓发送时输出缓冲区的上限，超过后即使处于暂缓状态也会唤醒写协程发送
+const corkFlushSize = 64 * 1024
+
 // Connection 代表的是 一个同Redis客户端的连接
+//
+// 发给客户端的数据先放进输出缓冲区，再由单独的写协程发送，
+// 一个不读取回复的客户端因此不会阻塞执行指令和发布消息的协程，
+// 但它的输出缓冲区会不断增长，超过 client-output-buffer-limit 时连接会被断开
 type Connection struct {
 	conn net.Conn
-	// 等到向客户端发送消息的协程都结束工作后，再关闭同Redis客户端的连接
-	waitingReply wait.Wait
-	// 在handler向客户端发送消息时上锁，
-	// 确保同时只能有一个Connection向客户端发送数据
+	// 保护输出缓冲区和 closed 标志位
 	mu sync.Mutex
+	// 等待发送的数据
+	pending [][]byte
+	// 输出缓冲区的大小，包括写协程正在发送的数据
+	pendingSize int64
+	// 输出缓冲区超过软限制的开始时间，没有超过时为零值
+	softLimitSince time.Time
+	// 连接关闭后不再接受新的数据
+	closed bool
+	// 为true时 Write 不唤醒写协程，用于把管道中多条指令的回复合并成一次发送
+	corked bool
+	// 通知写协程有新的数据或连接正在关闭，容量为1
+	wakeup chan struct{}
+	// 写协程退出时关闭
+	writerDone chan struct{}
+	closeOnce  sync.Once
 	// 表示选择的数据库引擎的索引
 	selectedDB int
+	// 是否已经通过 AUTH 验证了密码
+	authenticated bool
+	// 客户端通过 CLIENT SETNAME 设置的名字
+	name string
+	// 连接的唯一ID，CLIENT ID 返回的就是它
+	id int64
+	// 最后一次收到客户端指令的时间，单位纳秒，用于关闭空闲的连接
+	lastActive int64
+	// 客户端是否处于订阅模式，为1时使用 pubsub 类别的输出缓冲区限制
+	subscribed int32
 }
 
 // NewConn 建立一个新的同Redis客户端的连接
 func NewConn(conn net.Conn) *Connection {
-	return &Connection{
-		conn: conn,
+	c := &Connection{
+		conn:       conn,
+		wakeup:     make(chan struct{}, 1),
+		writerDone: make(chan struct{}),
+		id:         atomic.AddInt64(&lastID, 1),
+		lastActive: time.Now().UnixNano(),
 	}
+	go c.writeLoop()
+	return c
 }
 
 // RemoteAddr 返回连接的客户端的网络地址
@@ -31,27 +79,161 @@ func (c *Connection) RemoteAddr() net.Addr {
 	return c.conn.RemoteAddr()
 }
 
-// Close 断开同客户端的连接
+// Addr 返回用于日志的客户端地址，Unix Socket 连接的客户端没有地址
+func (c *Connection) Addr() string {
+	addr := c.RemoteAddr()
+	if addr == nil || addr.Network() == "unix" {
+		return "unix socket"
+	}
+	return addr.String()
+}
+
+// Close 断开同客户端的连接，最多等待10秒把输出缓冲区中的数据发送完
 func (c *Connection) Close() error {
-	c.waitingReply.WaitWithTimeout(10 * time.Second)
-	_ = c.conn.Close()
+	return c.CloseWithDeadline(time.Now().Add(closeTimeout))
+}
+
+// CloseWithDeadline 断开同客户端的连接，在 deadline 之前把输出缓冲区中的数据发送完，
+// 同时关闭多个连接时可以并行调用并使用同一个 deadline，总的等待时间不会超过 deadline
+func (c *Connection) CloseWithDeadline(deadline time.Time) error {
+	c.closeOnce.Do(func() {
+		c.mu.Lock()
+		c.closed = true
+		c.mu.Unlock()
+		// 不读取回复的客户端会让写协程阻塞在发送上，写超时让它在 deadline 时返回
+		_ = c.conn.SetWriteDeadline(deadline)
+		c.notify()
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case <-c.writerDone:
+		case <-timer.C:
+		}
+		_ = c.conn.Close()
+	})
 	return nil
 }
 
-// Write 通过TCP 连接向客户端发送数据
+// Write 把数据放进输出缓冲区，由写协程发送给客户端
+// 输出缓冲区超过限制时断开连接，连接关闭后返回错误
 func (c *Connection) Write(b []byte) error {
 	if len(b) == 0 {
 		return nil
 	}
 	c.mu.Lock()
-	c.waitingReply.Add(1)
-	defer func() {
-		c.waitingReply.Done()
+	if c.closed {
+		c.mu.Unlock()
+		return errClosed
+	}
+	c.pending = append(c.pending, b)
+	c.pendingSize += int64(len(b))
+	if reason := c.checkLimit(time.Now()); reason != "" {
+		// 直接丢弃未发送的数据并关闭底层连接，读协程会因此退出并清理这个客户端
+		c.closed = true
+		c.pending = nil
+		c.mu.Unlock()
+		logger.Warn(fmt.Sprintf("client id=%d addr=%s closed for overcoming of output buffer limits: %s",
+			c.id, c.Addr(), reason))
+		_ = c.conn.Close()
+		return errClosed
+	}
+	wakeup := !c.holding()
+	c.mu.Unlock()
+	if wakeup {
+		c.notify()
+	}
+	return nil
+}
+
+// SetCorked 设置是否暂缓发送输出缓冲区中的数据，取消暂缓时立即唤醒写协程发送
+// handler 在执行指令期间暂缓发送，等待读取客户端的数据之前再一次性发送所有回复
+func (c *Connection) SetCorked(corked bool) {
+	c.mu.Lock()
+	wasCorked := c.corked
+	c.corked = corked
+	c.mu.Unlock()
+	if wasCorked && !corked {
+		c.notify()
+	}
+}
+
+// holding 返回是否要暂缓发送输出缓冲区中的数据，必须在持有锁时调用
+// 连接关闭时不再暂缓，暂缓期间输出缓冲区达到 corkFlushSize 时也不再暂缓
+func (c *Connection) holding() bool {
+	return c.corked && !c.closed && c.pendingSize < corkFlushSize
+}
+
+// checkLimit 检查输出缓冲区是否超过了客户端所属类别的限制，超过时返回原因，必须在持有锁时调用
+func (c *Connection) checkLimit(now time.Time) string {
+	class := c.class()
+	limit := config.Properties().ClientOutputBufferLimit.For(class)
+	if limit.Hard > 0 && c.pendingSize >= limit.Hard {
+		return fmt.Sprintf("%s class, %d bytes reached the hard limit of %d", class, c.pendingSize, limit.Hard)
+	}
+	if limit.Soft <= 0 || c.pendingSize < limit.Soft {
+		c.softLimitSince = time.Time{}
+		return ""
+	}
+	if c.softLimitSince.IsZero() {
+		c.softLimitSince = now
+		return ""
+	}
+	if elapsed := now.Sub(c.softLimitSince); elapsed > time.Duration(limit.SoftSeconds)*time.Second {
+		return fmt.Sprintf("%s class, %d bytes over the soft limit of %d for %s",
+			class, c.pendingSize, limit.Soft, elapsed.Truncate(time.Second))
+	}
+	return ""
+}
+
+// class 返回客户端所属的 client-output-buffer-limit 类别
+func (c *Connection) class() string {
+	if atomic.LoadInt32(&c.subscribed) == 1 {
+		return config.ClientClassPubSub
+	}
+	return config.ClientClassNormal
+}
+
+// notify 唤醒写协程，写协程已经有待处理的通知时不会阻塞
+func (c *Connection) notify() {
+	select {
+	case c.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// writeLoop 把输出缓冲区中的数据批量发送给客户端，直到连接关闭且数据发送完毕
+func (c *Connection) writeLoop() {
+	defer close(c.writerDone)
+	for {
+		c.mu.Lock()
+		// 暂缓发送时即使被唤醒也继续等待，唤醒可能来自之前的 Write 留下的通知
+		for len(c.pending) == 0 || c.holding() {
+			if c.closed && len(c.pending) == 0 {
+				c.mu.Unlock()
+				return
+			}
+			c.mu.Unlock()
+			<-c.wakeup
+			c.mu.Lock()
+		}
+		batch := net.Buffers(c.pending)
+		c.pending = nil
 		c.mu.Unlock()
-	}()
 
-	_, err := c.conn.Write(b)
-	return err
+		n, err := batch.WriteTo(c.conn)
+
+		c.mu.Lock()
+		c.pendingSize -= n
+		if err != nil {
+			// 客户端已经不可写，丢弃剩下的数据，读协程会发现连接出错并关闭它
+			c.closed = true
+			c.pending = nil
+			c.pendingSize = 0
+			c.mu.Unlock()
+			return
+		}
+		c.mu.Unlock()
+	}
 }
 
 // GetDBIndex 返回当前使用的数据库的索引
@@ -63,3 +245,47 @@ func (c *Connection) GetDBIndex() int {
 func (c *Connection) SelectDB(dbNum int) {
 	c.selectedDB = dbNum
 }
+
+// SetAuthenticated 记录客户端是否已经通过 AUTH 验证了密码
+func (c *Connection) SetAuthenticated(authenticated bool) {
+	c.authenticated = authenticated
+}
+
+// IsAuthenticated 返回客户端是否已经通过 AUTH 验证了密码
+func (c *Connection) IsAuthenticated() bool {
+	return c.authenticated
+}
+
+// GetName 返回客户端的名字
+func (c *Connection) GetName() string {
+	return c.name
+}
+
+// SetName 设置客户端的名字
+func (c *Connection) SetName(name string) {
+	c.name = name
+}
+
+// GetID 返回连接的唯一ID
+func (c *Connection) GetID() int64 {
+	return c.id
+}
+
+// SetSubscribed 标记客户端是否处于订阅模式
+func (c *Connection) SetSubscribed(subscribed bool) {
+	var v int32
+	if subscribed {
+		v = 1
+	}
+	atomic.StoreInt32(&c.subscribed, v)
+}
+
+// Touch 记录客户端在 now 时刻发来了指令
+func (c *Connection) Touch(now time.Time) {
+	atomic.StoreInt64(&c.lastActive, now.UnixNano())
+}
+
+// IdleTime 返回客户端距离上一次发来指令的时间
+func (c *Connection) IdleTime(now time.Time) time.Duration {
+	return time.Duration(now.UnixNano() - atomic.LoadInt64(&c.lastActive))
+}
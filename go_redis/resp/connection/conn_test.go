@@ -0,0 +1,149 @@
+package connection
+
+import (
+	"go_redis/config"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stuckConn 返回一个对端从不读取的连接，写协程会一直阻塞在发送上
+func stuckConn(t *testing.T) *Connection {
+	t.Helper()
+	server, client := net.Pipe()
+	t.Cleanup(func() { _ = client.Close() })
+	c := NewConn(server)
+	if err := c.Write([]byte("+OK\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCloseWithDeadlineSharedAcrossConnections(t *testing.T) {
+	conns := []*Connection{stuckConn(t), stuckConn(t), stuckConn(t)}
+	start := time.Now()
+	deadline := start.Add(100 * time.Millisecond)
+	var wg sync.WaitGroup
+	for _, c := range conns {
+		wg.Add(1)
+		go func(c *Connection) {
+			defer wg.Done()
+			_ = c.CloseWithDeadline(deadline)
+		}(c)
+	}
+	wg.Wait()
+	// 并行关闭时总的等待时间由同一个 deadline 决定，而不是每个连接各等一次
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("closing took %v", elapsed)
+	}
+	for _, c := range conns {
+		select {
+		case <-c.writerDone:
+		case <-time.After(time.Second):
+			t.Fatal("writer still running after close")
+		}
+	}
+}
+
+func TestCloseFlushesPendingOutput(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := NewConn(server)
+	_ = c.Write([]byte("+OK\r\n"))
+	done := make(chan struct{})
+	go func() {
+		_ = c.Close()
+		close(done)
+	}()
+	buf := make([]byte, 5)
+	if _, err := client.Read(buf); err != nil || string(buf) != "+OK\r\n" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close did not return after the output was sent")
+	}
+}
+
+func TestOutputBufferLimit(t *testing.T) {
+	old := config.Properties()
+	defer config.Update(func(props *config.ServerProperties) {
+		*props = *old
+	})
+	tests := []struct {
+		name       string
+		limits     string
+		subscribed bool
+		writes     []int
+		pause      time.Duration
+		wantClosed bool
+	}{
+		{"under hard limit", "normal 100 0 0", false, []int{10, 10}, 0, false},
+		{"hard limit", "normal 20 0 0", false, []int{10, 10}, 0, true},
+		{"soft limit within time", "normal 0 10 60", false, []int{10, 10}, 0, false},
+		{"soft limit exceeded", "normal 0 10 0", false, []int{10, 10}, 10 * time.Millisecond, true},
+		{"pubsub class", "normal 0 0 0 pubsub 20 0 0", true, []int{10, 10}, 0, true},
+		{"normal class ignores pubsub limit", "normal 0 0 0 pubsub 20 0 0", false, []int{10, 10}, 0, false},
+	}
+	for _, tt := range tests {
+		config.Update(func(props *config.ServerProperties) {
+			_ = props.ClientOutputBufferLimit.Set([]string{tt.limits})
+		})
+		server, client := net.Pipe()
+		c := NewConn(server)
+		c.SetSubscribed(tt.subscribed)
+		var err error
+		for i, size := range tt.writes {
+			if i > 0 {
+				time.Sleep(tt.pause)
+			}
+			if err = c.Write(make([]byte, size)); err != nil {
+				break
+			}
+		}
+		if closed := err != nil; closed != tt.wantClosed {
+			t.Errorf("%s: closed = %v, want %v", tt.name, closed, tt.wantClosed)
+		}
+		_ = client.Close()
+		_ = c.Close()
+	}
+}
+
+func TestCorkedWrite(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := NewConn(server)
+	defer c.Close()
+	// 先收发一次回复，确保写协程已经在等待新的数据
+	_ = c.Write([]byte("+OK\r\n"))
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(client, buf[:5]); err != nil {
+		t.Fatal(err)
+	}
+
+	c.SetCorked(true)
+	_ = c.Write([]byte("+OK\r\n"))
+	_ = c.Write([]byte(":1\r\n"))
+	// 暂缓发送期间客户端读不到回复
+	_ = client.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if n, err := client.Read(buf); err == nil {
+		t.Fatalf("read %q while corked", buf[:n])
+	}
+	// 取消暂缓后一次性发送所有回复
+	_ = client.SetReadDeadline(time.Now().Add(time.Second))
+	c.SetCorked(false)
+	if _, err := io.ReadFull(client, buf); err != nil || string(buf) != "+OK\r\n:1\r\n" {
+		t.Fatalf("read %q, %v", buf, err)
+	}
+
+	// 输出缓冲区超过 corkFlushSize 时即使处于暂缓状态也会发送
+	c.SetCorked(true)
+	_ = c.Write(make([]byte, corkFlushSize))
+	big := make([]byte, corkFlushSize)
+	if _, err := io.ReadFull(client, big); err != nil {
+		t.Fatalf("large reply not flushed while corked: %v", err)
+	}
+}
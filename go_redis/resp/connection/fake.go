@@ -0,0 +1,82 @@
+package connection
+
+import (
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// FakeConn 是不对应网络连接的客户端，用于在进程内直接调用存储引擎执行指令
+// 指令的回复由 Exec 直接返回，服务端主动推送的数据（比如 CLIENT TRACKING 的失效消息）被丢弃
+type FakeConn struct {
+	mu sync.Mutex
+	// 表示选择的数据库引擎的索引
+	selectedDB int
+	// 客户端通过 CLIENT SETNAME 设置的名字
+	name string
+	// 连接的唯一ID，同网络连接使用同一个计数器分配
+	id int64
+}
+
+// NewFakeConn 创建一个进程内的客户端
+func NewFakeConn() *FakeConn {
+	return &FakeConn{
+		id: atomic.AddInt64(&lastID, 1),
+	}
+}
+
+// Write 丢弃服务端主动推送的数据
+func (c *FakeConn) Write(b []byte) error {
+	return nil
+}
+
+// RemoteAddr 进程内的客户端没有网络地址
+func (c *FakeConn) RemoteAddr() net.Addr {
+	return nil
+}
+
+// GetDBIndex 返回当前使用的数据库的索引
+func (c *FakeConn) GetDBIndex() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.selectedDB
+}
+
+// SelectDB 选择一个数据库
+func (c *FakeConn) SelectDB(dbNum int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.selectedDB = dbNum
+}
+
+// GetName 返回客户端的名字
+func (c *FakeConn) GetName() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name
+}
+
+// SetName 设置客户端的名字
+func (c *FakeConn) SetName(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.name = name
+}
+
+// GetID 返回连接的唯一ID
+func (c *FakeConn) GetID() int64 {
+	return c.id
+}
+
+// SetSubscribed 进程内的客户端没有输出缓冲区，不需要区分订阅模式
+func (c *FakeConn) SetSubscribed(subscribed bool) {
+}
+
+// SetAuthenticated 进程内的客户端总是视为已经通过验证，不需要记录
+func (c *FakeConn) SetAuthenticated(authenticated bool) {
+}
+
+// IsAuthenticated 进程内的客户端由所在的程序直接调用，设置了 requirepass 时也不需要验证密码
+func (c *FakeConn) IsAuthenticated() bool {
+	return true
+}
@@ -2,38 +2,155 @@ package handler
 
 import (
 	"context"
+	"fmt"
+	"go_redis/config"
 	"go_redis/database"
 	databaseface "go_redis/interface/database"
+	"go_redis/interface/resp"
 	"go_redis/lib/logger"
+	"go_redis/lib/metrics"
 	"go_redis/lib/sync/atomic"
 	"go_redis/resp/connection"
 	"go_redis/resp/parser"
 	"go_redis/resp/reply"
-	"io"
 	"net"
-	"strings"
 	"sync"
+	"time"
 )
 
+// idleCheckInterval 是检查空闲连接的间隔
+const idleCheckInterval = time.Second
+
+// closeTimeout 是关闭 Handler 时最多等待客户端输出缓冲区发送完的时间
+const closeTimeout = 10 * time.Second
+
 var (
 	// 收到客户端发送的不符合RESP协议的未知消息时，向客户端发送如下回复
 	unknowErrReplyBytes = []byte("-ERR unknown\r\n")
+	// 客户端连接数量达到 maxclients 时，向新的客户端发送如下回复
+	maxClientsErrReplyBytes = []byte("-ERR max number of clients reached\r\n")
 )
 
+// maxBlockedInput 是客户端阻塞期间最多暂存的数据量，超过后断开这个客户端
+const maxBlockedInput = 1 << 20
+
+// blocker 是能够挂起执行阻塞指令的客户端的存储引擎
+type blocker interface {
+	Block(ctx context.Context, c resp.Connection, blocked *database.BlockedReply) resp.Reply
+}
+
 type RespHandler struct {
 	activeConn sync.Map // 存放同Redis客户端的连接的容器
 	db         databaseface.Database
 	// 表示当前Redis服务端是否处于关闭或正在关闭中
 	// 值为true时拒绝新的客户端连接和新的请求，开始执行关闭Redis服务端的逻辑
 	closing atomic.Boolean
+	// 关闭后停止检查空闲连接的协程
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// idleExempter 由存储引擎实现，判断客户端是否不受 timeout 限制，例如订阅了频道的客户端
+type idleExempter interface {
+	IsIdleExempt(c resp.Connection) bool
 }
 
 // MakeHandler 返回一个RespHandler实例
 func MakeHandler() *RespHandler {
-	var db databaseface.Database
-	db = database.NewDatabase()
-	return &RespHandler{
-		db: db,
+	return MakeHandlerWithDatabase(database.NewDatabase())
+}
+
+// MakeHandlerWithDatabase 返回一个使用指定存储引擎的RespHandler实例，
+// 关闭 Handler 时存储引擎也会被关闭
+func MakeHandlerWithDatabase(mdb *database.Database) *RespHandler {
+	h := &RespHandler{
+		done: make(chan struct{}),
+	}
+	mdb.SetClientCounter(h.ClientCount)
+	mdb.SetClientLookup(h.FindClient)
+	h.db = mdb
+	go h.closeIdleClients()
+	return h
+}
+
+// closeIdleClients 定期关闭空闲时间超过 timeout 的连接，timeout 为 0 时不关闭
+func (h *RespHandler) closeIdleClients() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case now := <-ticker.C:
+			timeout := config.Properties().Timeout
+			if timeout <= 0 {
+				continue
+			}
+			exempter, _ := h.db.(idleExempter)
+			h.activeConn.Range(func(key, value any) bool {
+				client := key.(*connection.Connection)
+				if client.IdleTime(now) <= timeout {
+					return true
+				}
+				if exempter != nil && exempter.IsIdleExempt(client) {
+					return true
+				}
+				logger.Info("closing idle client: " + client.Addr())
+				// 关闭连接后，处理这个连接的协程会读到错误并完成清理工作，
+				// 关闭时可能要等待发送输出缓冲区，在单独的协程中关闭以免耽误检查其他连接
+				go client.Close()
+				return true
+			})
+		}
+	}
+}
+
+// setKeepAlive 按照 tcp-keepalive 配置设置TCP连接的 keepalive，TLS连接设置的是底层的TCP连接
+func setKeepAlive(conn net.Conn) {
+	if wrapped, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = wrapped.NetConn()
+	}
+	tcpConn, ok := conn.(*net.TCPConn)
+	if !ok {
+		return
+	}
+	period := config.Properties().TCPKeepAlive
+	if period <= 0 {
+		_ = tcpConn.SetKeepAlive(false)
+		return
+	}
+	_ = tcpConn.SetKeepAlive(true)
+	_ = tcpConn.SetKeepAlivePeriod(period)
+}
+
+// ClientCount 返回当前同Redis服务端连接的客户端数量
+func (h *RespHandler) ClientCount() int {
+	count := 0
+	h.activeConn.Range(func(key, value any) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// FindClient 根据连接ID查找客户端连接，找不到时返回 nil
+func (h *RespHandler) FindClient(id int64) resp.Connection {
+	var result resp.Connection
+	h.activeConn.Range(func(key, value any) bool {
+		client := key.(*connection.Connection)
+		if client.GetID() == id {
+			result = client
+			return false
+		}
+		return true
+	})
+	return result
+}
+
+// WriteMetrics 导出存储引擎的运行指标，存储引擎不支持导出指标时什么也不做
+func (h *RespHandler) WriteMetrics(w *metrics.Writer) {
+	if collector, ok := h.db.(metrics.Collector); ok {
+		collector.WriteMetrics(w)
 	}
 }
 
@@ -49,45 +166,60 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	if h.closing.Get() {
 		// 关闭handler即关闭Redis服务端，同时拒绝新的客户端连接
 		_ = conn.Close()
+		return
 	}
 
+	// 连接数量达到上限时拒绝新的客户端连接，maxclients 可以通过 CONFIG SET 在运行时修改
+	if maxClients := config.Properties().MaxClients; maxClients > 0 && h.ClientCount() >= maxClients {
+		_, _ = conn.Write(maxClientsErrReplyBytes)
+		_ = conn.Close()
+		return
+	}
+
+	setKeepAlive(conn)
 	// 包装客户端连接，并将客户端对象放到容器中
 	client := connection.NewConn(conn)
 	h.activeConn.Store(client, 1)
 
-	// 开始解析客户端发来的指令消息，并将其写入Channel中
-	ch := parser.ParseStream(conn)
-
-	for payload := range ch {
-		if payload.Err != nil {
-			if payload.Err == io.EOF ||
-				payload.Err == io.ErrUnexpectedEOF ||
-				strings.Contains(payload.Err.Error(), "use of closed network connection") {
-				// 这些错误说明底层的TCP连接已经关闭
+	// 在当前协程中逐条读取并执行客户端发来的指令，
+	// 执行期间暂缓发送回复，读完已收到的数据、需要等待客户端时才一次性发送，
+	// 客户端以管道方式发来的一批指令的回复因此只需要一次系统调用
+	client.SetCorked(true)
+	input := &flushingReader{conn: conn, client: client}
+	reader := parser.NewReader(input)
+	for {
+		// proto-max-bulk-len 等限制可以通过 CONFIG SET 在运行时修改
+		props := config.Properties()
+		reader.SetLimits(props.ProtoMaxBulkLen, props.ProtoMaxMultiBulkLen)
+		args, err := reader.ReadCommand()
+		if err != nil {
+			if protoErr, ok := err.(*reply.ProtocolErrReply); ok {
+				// 协议错误，无法确定下一条指令从哪里开始，同Redis一样将错误信息返回给客户端后关闭连接
+				_ = client.Write(protoErr.ToBytes())
 				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
+				logger.Info(fmt.Sprintf("protocol error (%s) from client: %s, connection closed", protoErr.Msg, client.Addr()))
 				return
 			}
-			// 代码执行到这说明是协议错误，底层的TCP连接没有问题
-			errReply := reply.MakeErrReply(payload.Err.Error())
-			err := client.Write(errReply.ToBytes()) // 将错误信息返回给客户端
-			if err != nil {
-				h.closeClient(client)
-				logger.Info("connection closed: " + client.RemoteAddr().String())
-				return
-			}
-			continue
-		}
-		if payload.Data == nil {
-			logger.Error("empty payload")
-			continue
+			// 其他错误说明底层的连接已经关闭或不可用
+			h.closeClient(client)
+			logger.Info("connection closed: " + client.Addr())
+			return
 		}
-		r, ok := payload.Data.(*reply.MultiBulkReply)
-		if !ok {
-			logger.Error("require multi bulk reply")
-			continue
+		client.Touch(time.Now())
+		result := h.db.Exec(client, args)
+		if blocked, ok := result.(*database.BlockedReply); ok {
+			if b, ok := h.db.(blocker); ok {
+				var closed bool
+				result, closed = h.block(ctx, b, input, blocked)
+				if closed {
+					h.closeClient(client)
+					logger.Info("connection closed: " + client.Addr())
+					return
+				}
+				// 阻塞的时间不计入空闲时间
+				client.Touch(time.Now())
+			}
 		}
-		result := h.db.Exec(client, r.Args)
 		if result != nil {
 			_ = client.Write(result.ToBytes())
 		} else {
@@ -96,6 +228,77 @@ func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	}
 }
 
+// block 挂起执行阻塞指令的客户端，返回要发给客户端的回复
+// 挂起期间在另一个协程中继续读取连接，以便及时发现客户端断开，读到的数据暂存起来，恢复后再交给解析器；
+// 客户端断开或者暂存的数据超过 maxBlockedInput 时结束挂起，closed 为 true 表示要断开这个客户端
+func (h *RespHandler) block(ctx context.Context, b blocker, input *flushingReader,
+	blocked *database.BlockedReply) (result resp.Reply, closed bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// 先发出挂起之前暂缓的回复
+	input.client.SetCorked(false)
+	defer input.client.SetCorked(true)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		closed = input.watch(cancel)
+	}()
+
+	result = b.Block(ctx, input.client, blocked)
+	// 让读取连接的协程从 Read 中返回，等它退出后再恢复由解析器读取
+	_ = input.conn.SetReadDeadline(time.Unix(1, 0))
+	<-watchDone
+	_ = input.conn.SetReadDeadline(time.Time{})
+	return result, closed
+}
+
+// flushingReader 在从连接读取数据之前发送暂缓的回复，读取可能阻塞，
+// 客户端可能正在等待之前指令的回复，读取返回后重新暂缓发送
+type flushingReader struct {
+	conn   net.Conn
+	client *connection.Connection
+	// 客户端挂起期间读到的数据，之后的 Read 先返回它们
+	pending []byte
+}
+
+func (r *flushingReader) Read(p []byte) (int, error) {
+	if len(r.pending) > 0 {
+		n := copy(p, r.pending)
+		r.pending = r.pending[n:]
+		if len(r.pending) == 0 {
+			r.pending = nil
+		}
+		return n, nil
+	}
+	r.client.SetCorked(false)
+	n, err := r.conn.Read(p)
+	r.client.SetCorked(true)
+	return n, err
+}
+
+// watch 在客户端挂起期间读取连接，读到超时时返回，超时由 block 设置，用来结束读取
+// 读到其他错误说明客户端已经断开，暂存的数据超过 maxBlockedInput 时也不再等待，
+// 这两种情况都调用 cancel 结束挂起，并返回 true 表示要断开这个客户端
+func (r *flushingReader) watch(cancel context.CancelFunc) bool {
+	buf := make([]byte, 4096)
+	for {
+		n, err := r.conn.Read(buf)
+		r.pending = append(r.pending, buf[:n]...)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				return false
+			}
+			cancel()
+			return true
+		}
+		if len(r.pending) > maxBlockedInput {
+			logger.Warn("client sent too much data while blocked: " + r.client.Addr())
+			cancel()
+			return true
+		}
+	}
+}
+
 // Close 关闭Handler 即关闭Redis的服务端
 func (h *RespHandler) Close() error {
 	logger.Info("handler shutting down...")
@@ -103,13 +306,26 @@ func (h *RespHandler) Close() error {
 	// 遍历存放客户端连接的activeConn，为其中的每个客户端连接
 	// 执行关闭
 	h.closing.Set(true)
+	// 收到关闭信号和发生意料外的错误时都可能调用 Close，多次调用只关闭一次 done
+	h.closeOnce.Do(func() {
+		close(h.done)
+	})
+	// 并行关闭所有客户端连接，使用同一个 deadline，
+	// 最多等待 closeTimeout 而不是每个连接各等一次
+	deadline := time.Now().Add(closeTimeout)
+	var wg sync.WaitGroup
 	h.activeConn.Range(func(key, value any) bool {
 		client := key.(*connection.Connection)
-		_ = client.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.CloseWithDeadline(deadline)
+		}()
 		// 返回true 则会继续遍历映射后面的元素，
 		// 返回false则不会继续遍历
 		return true
 	})
+	wg.Wait()
 	h.db.Close()
 	return nil
 }
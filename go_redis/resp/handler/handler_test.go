@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// startServer 在 127.0.0.1 的随机端口上用 RespHandler 处理连接，返回一个已经连接的客户端
+func startServer(b testing.TB) net.Conn {
+	b.Helper()
+	conn, _ := startServerAt(b)
+	return conn
+}
+
+// startServerAt 同 startServer，同时返回服务端的地址，用于建立更多的连接
+func startServerAt(b testing.TB) (net.Conn, string) {
+	b.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	h := MakeHandler()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go h.Handle(context.Background(), conn)
+		}
+	}()
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = conn.Close()
+		_ = listener.Close()
+		_ = h.Close()
+	})
+	return conn, listener.Addr().String()
+}
+
+// dial 建立一个到服务端的新连接，测试结束时关闭
+func dial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { _ = conn.Close() })
+	return conn
+}
+
+// expect 读取回复并检查内容
+func expect(t *testing.T, conn net.Conn, want string) {
+	t.Helper()
+	got := make([]byte, len(want))
+	if _, err := io.ReadFull(conn, got); err != nil || string(got) != want {
+		t.Fatalf("got %q, %v, want %q", got, err, want)
+	}
+}
+
+func TestHandleBlockedPipeline(t *testing.T) {
+	blocked, addr := startServerAt(t)
+	_ = blocked.SetDeadline(time.Now().Add(5 * time.Second))
+	// 阻塞期间收到的指令在解除阻塞后才执行
+	_, _ = blocked.Write([]byte("blpop l 0\r\nrpush l b\r\nlpop l\r\n"))
+	other := dial(t, addr)
+	// 等待第一个客户端挂起之后再写入
+	time.Sleep(50 * time.Millisecond)
+	_, _ = other.Write([]byte("rpush l a\r\n"))
+	expect(t, other, ":1\r\n")
+	expect(t, blocked, "*2\r\n$1\r\nl\r\n$1\r\na\r\n:1\r\n$1\r\nb\r\n")
+}
+
+func TestHandleBlockedClientClose(t *testing.T) {
+	blocked, addr := startServerAt(t)
+	_, _ = blocked.Write([]byte("blpop l 0\r\n"))
+	time.Sleep(50 * time.Millisecond)
+	_ = blocked.Close()
+	time.Sleep(50 * time.Millisecond)
+	// 断开的客户端不再等待，写入的数据留在列表中
+	other := dial(t, addr)
+	_, _ = other.Write([]byte("rpush l a\r\nllen l\r\n"))
+	expect(t, other, ":1\r\n:1\r\n")
+}
+
+func TestHandleBlockedInputLimit(t *testing.T) {
+	blocked, addr := startServerAt(t)
+	_ = blocked.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = blocked.Write([]byte("blpop l 0\r\n"))
+	time.Sleep(50 * time.Millisecond)
+	// 阻塞期间发来的数据超过 maxBlockedInput 时断开客户端，即使客户端之后没有断开
+	go func() {
+		_, _ = blocked.Write(bytes.Repeat([]byte("ping\r\n"), maxBlockedInput/6+1))
+	}()
+	if _, err := io.ReadAll(blocked); err != nil {
+		t.Fatalf("connection is not closed: %v", err)
+	}
+	other := dial(t, addr)
+	_, _ = other.Write([]byte("rpush l a\r\nllen l\r\n"))
+	expect(t, other, ":1\r\n:1\r\n")
+}
+
+func TestHandleProtocolError(t *testing.T) {
+	conn := startServer(t)
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	// 协议错误之后的数据不再执行，回复错误后关闭连接
+	_, _ = conn.Write([]byte("*1\r\n$-5\r\nping\r\n"))
+	got, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "-ERR Protocol error: 'invalid bulk length'\r\n"; string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// benchmarkPipeline 每次迭代以管道方式发送 n 条指令，并读取全部回复
+func benchmarkPipeline(b *testing.B, n int, cmd []byte, replySize int) {
+	conn := startServer(b)
+	pipeline := bytes.Repeat(cmd, n)
+	replies := make([]byte, replySize*n)
+	b.SetBytes(int64(len(pipeline)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		// 回复和请求同时收发，否则回复填满 socket 缓冲区后服务端会停止读取
+		errCh := make(chan error, 1)
+		go func() {
+			_, err := conn.Write(pipeline)
+			errCh <- err
+		}()
+		if _, err := io.ReadFull(conn, replies); err != nil {
+			b.Fatal(err)
+		}
+		if err := <-errCh; err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(b.N*n)/time.Since(start).Seconds(), "cmds/s")
+}
+
+func BenchmarkHandlePipelinePing(b *testing.B) {
+	ping := []byte("*1\r\n$4\r\nPING\r\n")
+	for _, n := range []int{1, 10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkPipeline(b, n, ping, len("+PONG\r\n"))
+		})
+	}
+}
+
+func BenchmarkHandlePipelineSet(b *testing.B) {
+	set := []byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n")
+	for _, n := range []int{1, 10, 100, 1000} {
+		b.Run(strconv.Itoa(n), func(b *testing.B) {
+			benchmarkPipeline(b, n, set, len("+OK\r\n"))
+		})
+	}
+}
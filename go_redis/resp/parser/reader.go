@@ -0,0 +1,338 @@
+package parser
+
+import (
+	"bufio"
+	"go_redis/interface/resp"
+	"go_redis/resp/reply"
+	"io"
+)
+
+/**
+ * Reader 是服务端读取客户端指令的同步解析器，由调用方在处理连接的协程中按需拉取指令，
+ * 不需要为每个连接额外开启一个解析协程。
+ *
+ * 解析过程中复用同一块缓冲区存放指令的参数，数字在原始字节上直接解析，
+ * 稳定状态下读取一条指令不会产生内存分配。
+ * 除了RESP数组格式的指令，也支持用空格分隔参数的内联指令，比如通过 telnet 发送的 PING
+ */
+
+// readBufferSize 是读取客户端数据的缓冲区大小，也是内联指令和消息头的最大长度
+const readBufferSize = 16 * 1024
+
+// maxRetainedArgsSize 是两条指令之间保留的参数缓冲区的最大容量，
+// 客户端偶尔发来很大的指令后不会一直占用同样大的内存
+const maxRetainedArgsSize = 1024 * 1024
+
+// bulkGrowStep 是读取大参数时缓冲区每次至少扩容的字节数，
+// 大参数按实际收到的数据逐步扩容，客户端只发送一个很大的长度时不会让服务端立即分配这么多内存
+const bulkGrowStep = 1024 * 1024
+
+func protocolError(msg string) error {
+	return &reply.ProtocolErrReply{Msg: msg}
+}
+
+// Reader 从客户端连接中读取指令
+type Reader struct {
+	br *bufio.Reader
+	// 存放当前指令所有参数的内容，每次读取指令时复用
+	buf []byte
+	// 每个参数在 buf 中的结束位置
+	ends []int
+	// ReadCommand 返回的参数切片，每次读取指令时复用
+	args [][]byte
+	// 单个字符串的最大长度和数组的最大元素数量，小于等于0时不限制
+	maxBulkLen      int64
+	maxMultiBulkLen int64
+}
+
+// NewReader 创建一个从 rd 中读取指令的 Reader，默认不限制字符串的长度和数组的元素数量
+func NewReader(rd io.Reader) *Reader {
+	return &Reader{
+		br: bufio.NewReaderSize(rd, readBufferSize),
+	}
+}
+
+// SetLimits 设置单个字符串的最大长度和数组的最大元素数量，小于等于0时不限制，
+// 服务端用 proto-max-bulk-len 和 proto-max-multibulk-len 限制客户端发来的指令
+func (r *Reader) SetLimits(maxBulkLen, maxMultiBulkLen int) {
+	r.maxBulkLen = int64(maxBulkLen)
+	r.maxMultiBulkLen = int64(maxMultiBulkLen)
+}
+
+// exceeds 判断 n 是否超过了限制 limit
+func exceeds(n, limit int64) bool {
+	return limit > 0 && n > limit
+}
+
+// ReadCommand 读取并解析下一条指令，空指令会被跳过
+// 返回的参数指向 Reader 内部的缓冲区，只在下一次调用 ReadCommand 之前有效，需要保存的参数必须先复制
+// 客户端数据格式错误或超过 SetLimits 设置的限制时返回 *reply.ProtocolErrReply，
+// 此时已经无法确定下一条指令的开始位置，调用方应该关闭连接。读取连接出错时返回底层的错误
+func (r *Reader) ReadCommand() ([][]byte, error) {
+	for {
+		line, err := r.readLine("too big inline request")
+		if err != nil {
+			return nil, err
+		}
+		if cap(r.buf) > maxRetainedArgsSize {
+			r.buf = nil
+		}
+		r.buf = r.buf[:0]
+		r.ends = r.ends[:0]
+		if len(line) > 0 && line[0] == '*' {
+			err = r.readMultiBulk(line)
+		} else {
+			r.splitInline(line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(r.ends) == 0 {
+			continue
+		}
+		return r.buildArgs(), nil
+	}
+}
+
+// ReadReply 读取并解析一条任意类型的回复，数组可以嵌套，用于客户端读取服务端的回复
+// 数组回复解析为 *reply.MultiRawReply，null 分别解析为 *reply.NullBulkReply 和 *reply.NullMultiBulkReply，
+// 错误回复解析为 *reply.StandardErrReply 而不是作为 error 返回。
+// 与 ReadCommand 不同，返回的回复不引用 Reader 内部的缓冲区，可以长期保存
+func (r *Reader) ReadReply() (resp.Reply, error) {
+	line, err := r.readLine("too big reply line")
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, protocolError("empty reply line")
+	}
+	switch line[0] {
+	case '+':
+		return reply.MakeStatusReply(string(line[1:])), nil
+	case '-':
+		return reply.MakeErrReply(string(line[1:])), nil
+	case ':':
+		n, ok := parseInt(line[1:])
+		if !ok {
+			return nil, protocolError("invalid integer reply")
+		}
+		return reply.MakeIntReply(n), nil
+	case '$':
+		n, ok := parseInt(line[1:])
+		if !ok || n < -1 || exceeds(n, r.maxBulkLen) {
+			return nil, protocolError("invalid bulk length")
+		}
+		if n == -1 {
+			return &reply.NullBulkReply{}, nil
+		}
+		data, err := r.readFresh(int(n) + 2)
+		if err != nil {
+			return nil, err
+		}
+		if data[n] != '\r' || data[n+1] != '\n' {
+			return nil, protocolError("bulk string is not terminated by CRLF")
+		}
+		return reply.MakeBulkReply(data[:n:n]), nil
+	case '*':
+		n, ok := parseInt(line[1:])
+		if !ok || n < -1 || exceeds(n, r.maxMultiBulkLen) {
+			return nil, protocolError("invalid multibulk length")
+		}
+		if n == -1 {
+			return &reply.NullMultiBulkReply{}, nil
+		}
+		if n == 0 {
+			return &reply.EmptyMultiBulkReply{}, nil
+		}
+		// 按实际收到的成员扩容，不按照声明的个数预先分配
+		replies := make([]resp.Reply, 0, minInt(int(n), 64))
+		for i := int64(0); i < n; i++ {
+			item, err := r.ReadReply()
+			if err != nil {
+				return nil, err
+			}
+			replies = append(replies, item)
+		}
+		return reply.MakeMultiRawReply(replies), nil
+	}
+	return nil, protocolError("unexpected reply type '" + printable(line[:1]) + "'")
+}
+
+// readLine 读取一行数据，返回的内容不包含结尾的 \r\n，只在下一次读取之前有效
+// 一行数据超过读缓冲区的大小时返回内容为 tooBig 的协议错误
+func (r *Reader) readLine(tooBig string) ([]byte, error) {
+	line, err := r.br.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, protocolError(tooBig)
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// readMultiBulk 读取数组格式的指令，header 是数组的消息头，比如 *3
+func (r *Reader) readMultiBulk(header []byte) error {
+	count, ok := parseInt(header[1:])
+	if !ok || exceeds(count, r.maxMultiBulkLen) {
+		return protocolError("invalid multibulk length")
+	}
+	for i := int64(0); i < count; i++ {
+		line, err := r.readLine("too big bulk count string")
+		if err != nil {
+			return err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return protocolError("expected '$', got '" + printable(line) + "'")
+		}
+		bulkLen, ok := parseInt(line[1:])
+		if !ok || bulkLen < 0 || exceeds(bulkLen, r.maxBulkLen) {
+			return protocolError("invalid bulk length")
+		}
+		if err := r.readBulk(int(bulkLen)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readBulk 把 n 个字节的参数内容和结尾的 \r\n 读入 buf
+func (r *Reader) readBulk(n int) error {
+	start := len(r.buf)
+	end := start + n + 2
+	for len(r.buf) < end {
+		// 每次最多扩容到已读取内容的两倍，且不少于 bulkGrowStep
+		size := end - len(r.buf)
+		if step := len(r.buf) - start; size > bulkGrowStep && size > step {
+			size = step
+			if size < bulkGrowStep {
+				size = bulkGrowStep
+			}
+		}
+		from := len(r.buf)
+		r.grow(size)
+		if _, err := io.ReadFull(r.br, r.buf[from:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	if r.buf[start+n] != '\r' || r.buf[start+n+1] != '\n' {
+		return protocolError("bulk string is not terminated by CRLF")
+	}
+	r.buf = r.buf[:start+n]
+	r.ends = append(r.ends, start+n)
+	return nil
+}
+
+// readFresh 读取 n 个字节到新分配的切片中，和 readBulk 一样按实际收到的数据逐步扩容
+func (r *Reader) readFresh(n int) ([]byte, error) {
+	data := make([]byte, 0, minInt(n, bulkGrowStep))
+	for len(data) < n {
+		size := minInt(n-len(data), maxInt(len(data), bulkGrowStep))
+		from := len(data)
+		if cap(data)-from < size {
+			grown := make([]byte, from, from+size)
+			copy(grown, data)
+			data = grown
+		}
+		data = data[:from+size]
+		if _, err := io.ReadFull(r.br, data[from:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// grow 把 buf 的长度增加 size，容量不够时按两倍扩容
+func (r *Reader) grow(size int) {
+	length := len(r.buf)
+	if cap(r.buf)-length < size {
+		grown := make([]byte, length, 2*cap(r.buf)+size)
+		copy(grown, r.buf)
+		r.buf = grown
+	}
+	r.buf = r.buf[:length+size]
+}
+
+// splitInline 把以空格分隔参数的内联指令拆分到 buf 中
+func (r *Reader) splitInline(line []byte) {
+	i := 0
+	for {
+		for i < len(line) && (line[i] == ' ' || line[i] == '\t') {
+			i++
+		}
+		if i >= len(line) {
+			return
+		}
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			r.buf = append(r.buf, line[i])
+			i++
+		}
+		r.ends = append(r.ends, len(r.buf))
+	}
+}
+
+// buildArgs 根据每个参数的结束位置把 buf 切分成参数，buf 扩容完成后才能切分
+func (r *Reader) buildArgs() [][]byte {
+	r.args = r.args[:0]
+	start := 0
+	for _, end := range r.ends {
+		r.args = append(r.args, r.buf[start:end:end])
+		start = end
+	}
+	return r.args
+}
+
+// parseInt 直接在字节上解析十进制整数，避免 strconv 需要的 string 转换
+func parseInt(b []byte) (int64, bool) {
+	negative := len(b) > 0 && b[0] == '-'
+	if negative {
+		b = b[1:]
+	}
+	// 最多18位数字，不会溢出 int64
+	if len(b) == 0 || len(b) > 18 {
+		return 0, false
+	}
+	var n int64
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	if negative {
+		n = -n
+	}
+	return n, true
+}
+
+// printable 返回用于错误信息的数据，过长时截断
+func printable(b []byte) string {
+	if len(b) > 32 {
+		b = b[:32]
+	}
+	return string(b)
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,215 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"go_redis/resp/reply"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func joinArgs(args [][]byte) string {
+	parts := make([]string, len(args))
+	for i, arg := range args {
+		parts[i] = string(arg)
+	}
+	return strings.Join(parts, " ")
+}
+
+// readAll 读取 input 中所有的指令，直到读完或出错
+func readAll(r *Reader) ([]string, error) {
+	var commands []string
+	for {
+		args, err := r.ReadCommand()
+		if err != nil {
+			return commands, err
+		}
+		commands = append(commands, joinArgs(args))
+	}
+}
+
+func TestReadCommandFragmented(t *testing.T) {
+	input := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nva\r\nl\r\n" +
+		"\r\n" +
+		"PING  hello\tworld\r\n" +
+		"*1\r\n$0\r\n\r\n" +
+		"*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n"
+	want := []string{"SET key va\r\nl", "PING hello world", "", "GET key"}
+	readers := map[string]io.Reader{
+		"whole":    strings.NewReader(input),
+		"one byte": iotest.OneByteReader(strings.NewReader(input)),
+		"half":     iotest.HalfReader(strings.NewReader(input)),
+	}
+	for name, rd := range readers {
+		commands, err := readAll(NewReader(rd))
+		if err != io.EOF {
+			t.Errorf("%s: got error %v, want io.EOF", name, err)
+		}
+		if strings.Join(commands, "|") != strings.Join(want, "|") {
+			t.Errorf("%s: got %q, want %q", name, commands, want)
+		}
+	}
+}
+
+func TestReadCommandTruncated(t *testing.T) {
+	for _, input := range []string{
+		"*2\r\n$3\r\nGET\r\n",
+		"*1\r\n$5\r\nPI",
+		"*1\r\n$4\r\nPING",
+	} {
+		_, err := NewReader(strings.NewReader(input)).ReadCommand()
+		if err != io.ErrUnexpectedEOF && err != io.EOF {
+			t.Errorf("%q: got error %v, want an EOF error", input, err)
+		}
+	}
+}
+
+func TestReadCommandProtocolErrors(t *testing.T) {
+	cases := map[string]string{
+		"*1\r\n:1\r\n":               "expected '$'",
+		"*1\r\n$4\r\nPINGxx":         "not terminated by CRLF",
+		"*1\r\n$-1\r\n":              "invalid bulk length",
+		"*x\r\n":                     "invalid multibulk length",
+		strings.Repeat("a", 20*1024): "too big inline request",
+		"*1\r\n$" + strings.Repeat("9", 19) + "\r\n": "invalid bulk length",
+	}
+	for input, want := range cases {
+		_, err := NewReader(strings.NewReader(input)).ReadCommand()
+		var protoErr *reply.ProtocolErrReply
+		if !errors.As(err, &protoErr) || !strings.Contains(protoErr.Msg, want) {
+			t.Errorf("%q: got error %v, want protocol error %q", printable([]byte(input)), err, want)
+		}
+	}
+}
+
+func TestReadCommandLimits(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"*2\r\n$4\r\nPING\r\n$4\r\nPONG\r\n", ""},
+		{"*3\r\n$1\r\na\r\n$1\r\nb\r\n$1\r\nc\r\n", "invalid multibulk length"},
+		{"*1\r\n$5\r\nhello\r\n", "invalid bulk length"},
+	}
+	for _, tt := range tests {
+		r := NewReader(strings.NewReader(tt.input))
+		r.SetLimits(4, 2)
+		_, err := r.ReadCommand()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.input, err)
+			}
+			continue
+		}
+		var protoErr *reply.ProtocolErrReply
+		if !errors.As(err, &protoErr) || !strings.Contains(protoErr.Msg, tt.want) {
+			t.Errorf("%q: got error %v, want protocol error %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestReadCommandLargeBulkGrowsWithData(t *testing.T) {
+	// 只发送了消息头的大参数不会让 Reader 按声明的长度分配内存
+	r := NewReader(strings.NewReader("*1\r\n$536870912\r\nabc"))
+	if _, err := r.ReadCommand(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got error %v, want io.ErrUnexpectedEOF", err)
+	}
+	if cap(r.buf) > 2*bulkGrowStep {
+		t.Fatalf("buffer grew to %d bytes for 3 bytes of data", cap(r.buf))
+	}
+}
+
+func TestReadReplyLimits(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"$4\r\nPONG\r\n", ""},
+		{"*2\r\n:1\r\n:2\r\n", ""},
+		{"$5\r\nhello\r\n", "invalid bulk length"},
+		{"*3\r\n:1\r\n:2\r\n:3\r\n", "invalid multibulk length"},
+	}
+	for _, tt := range tests {
+		r := NewReader(strings.NewReader(tt.input))
+		r.SetLimits(4, 2)
+		_, err := r.ReadReply()
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("%q: unexpected error %v", tt.input, err)
+			}
+			continue
+		}
+		var protoErr *reply.ProtocolErrReply
+		if !errors.As(err, &protoErr) || !strings.Contains(protoErr.Msg, tt.want) {
+			t.Errorf("%q: got error %v, want protocol error %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestReadReplyHugeLengthWithoutLimit(t *testing.T) {
+	// 不限制长度时，只声明了很大的长度而没有数据的回复不能让 Reader 按声明的长度分配内存
+	r := NewReader(strings.NewReader("$" + strconv.Itoa(1<<40) + "\r\nshort\r\n"))
+	if _, err := r.ReadReply(); err != io.ErrUnexpectedEOF {
+		t.Fatalf("got error %v, want io.ErrUnexpectedEOF", err)
+	}
+}
+
+func TestReadCommandLargeBulk(t *testing.T) {
+	// 大于 bulkGrowStep 的参数需要多次扩容
+	value := bytes.Repeat([]byte("x"), 3*bulkGrowStep+7)
+	var input bytes.Buffer
+	input.WriteString("*2\r\n$3\r\nSET\r\n$" + strconv.Itoa(len(value)) + "\r\n")
+	input.Write(value)
+	input.WriteString("\r\n")
+	args, err := NewReader(iotest.HalfReader(&input)).ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(args) != 2 || !bytes.Equal(args[1], value) {
+		t.Fatalf("large bulk was not read back intact")
+	}
+}
+
+func TestReadCommandReusesBuffer(t *testing.T) {
+	r := NewReader(strings.NewReader("*1\r\n$3\r\nfoo\r\n*1\r\n$3\r\nbar\r\n"))
+	first, err := r.ReadCommand()
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := first[0]
+	if _, err := r.ReadCommand(); err != nil {
+		t.Fatal(err)
+	}
+	// 参数只在下一次 ReadCommand 之前有效，需要保存的参数必须先复制
+	if string(kept) != "bar" {
+		t.Fatalf("expected the buffer to be reused, first argument is now %q", kept)
+	}
+}
+
+// loopReader 循环返回同一段数据，用于不产生额外分配的基准测试
+type loopReader struct {
+	data []byte
+	pos  int
+}
+
+func (l *loopReader) Read(p []byte) (int, error) {
+	n := copy(p, l.data[l.pos:])
+	l.pos = (l.pos + n) % len(l.data)
+	return n, nil
+}
+
+func BenchmarkReadCommand(b *testing.B) {
+	cmd := []byte("*3\r\n$3\r\nSET\r\n$8\r\nkey:1234\r\n$16\r\nvalue-0123456789\r\n")
+	r := NewReader(&loopReader{data: bytes.Repeat(cmd, 64)})
+	b.SetBytes(int64(len(cmd)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := r.ReadCommand(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
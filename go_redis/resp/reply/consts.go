@@ -43,6 +43,15 @@ func MakeNullBulkReply() *NullBulkReply {
 	return &NullBulkReply{}
 }
 
+// 回复null数组，例如 XREAD 没有读到任何消息时的回复
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+type NullMultiBulkReply struct{}
+
+func (r *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
 // 向客户端回复空字符串
 var emptyMultiBulkBytes = []byte("*0\r\n")
 
@@ -0,0 +1,83 @@
+package tcp
+
+import (
+	"net"
+	"sync"
+)
+
+/**
+ * A listener accepting connections from several listeners, e.g. plain TCP and TLS
+ */
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// multiListener merges the connections accepted by several listeners,
+// so ListenAndServe can serve them all with the same handler
+type multiListener struct {
+	listeners []net.Listener
+	results   chan acceptResult
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newMultiListener(listeners ...net.Listener) *multiListener {
+	ml := &multiListener{
+		listeners: listeners,
+		results:   make(chan acceptResult),
+		done:      make(chan struct{}),
+	}
+	for _, l := range listeners {
+		go ml.acceptLoop(l)
+	}
+	return ml
+}
+
+func (ml *multiListener) acceptLoop(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		select {
+		case ml.results <- acceptResult{conn: conn, err: err}:
+		case <-ml.done:
+			if conn != nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Accept waits for a connection from any of the listeners,
+// an error from one of them is returned as is and stops the server like a single listener would
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case result := <-ml.results:
+		return result.conn, result.err
+	case <-ml.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes all the listeners
+func (ml *multiListener) Close() error {
+	var err error
+	ml.closeOnce.Do(func() {
+		close(ml.done)
+		for _, l := range ml.listeners {
+			if e := l.Close(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+// Addr returns the address of the first listener
+func (ml *multiListener) Addr() net.Addr {
+	return ml.listeners[0].Addr()
+}
@@ -2,6 +2,8 @@ package tcp
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"go_redis/interface/tcp"
 	"go_redis/lib/logger"
@@ -18,7 +20,18 @@ import (
 
 // Config stores tcp server properties
 type Config struct {
+	// Address of the plain TCP listener, empty means plain TCP is disabled
 	Address string
+	// TLSAddress of the TLS listener, empty means TLS is disabled
+	TLSAddress string
+	// TLS provides the certificates of the TLS listener, required when TLSAddress is set
+	TLS *CertReloader
+	// UnixSocket is the path of the unix socket listener, empty means it is disabled
+	UnixSocket string
+	// UnixSocketPerm is applied to the socket file, 0 keeps the permission given by umask
+	UnixSocketPerm os.FileMode
+	// Reload is called when the process receives SIGHUP, nil means SIGHUP is ignored
+	Reload func()
 }
 
 // ListenAndServeWithSignal binds port and handle requests, blocking until receive stop signal
@@ -26,26 +39,72 @@ func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	// 起到发送关闭信号的作用，在程序被关闭时即收到系统发来的关闭信号后，向ListenAndServe方法发送
 	// 关闭信号，空结构体即起到发送信号的作用。在ListenAndServe处理程序关闭时具体的善后逻辑
 	closeChan := make(chan struct{})
-	sigCh := make(chan os.Signal) // 接收系统发来的信号
+	sigCh := make(chan os.Signal, 1) // 接收系统发来的信号
 	// 注册系统要接收的系统信号
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT)
 	// 启动一个协程监听系统发来的信号，一旦收到系统发来的关闭程序的信号，就像closeChan发送空结构体作为程序
-	// 退出的信号
+	// 退出的信号。SIGHUP 不会关闭程序，而是重新加载配置，已经建立的连接不受影响
 	go func() {
-		sig := <-sigCh
-		switch sig {
-		case syscall.SIGHUP, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
-			closeChan <- struct{}{}
+		for sig := range sigCh {
+			switch sig {
+			case syscall.SIGHUP:
+				logger.Info("received SIGHUP, reloading config")
+				if cfg.Reload != nil {
+					cfg.Reload()
+				}
+			case syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGINT:
+				closeChan <- struct{}{}
+				return
+			}
 		}
 	}()
 
-	// 通过Go的net包创建一个监听cfg.Address端口的TCP Socket
-	listener, err := net.Listen("tcp", cfg.Address)
-	if err != nil {
-		return err
+	// 通过Go的net包创建监听 cfg.Address 和 cfg.TLSAddress 的TCP Socket，
+	// 两个端口上的连接交给同一个 handler 处理
+	listeners := make([]net.Listener, 0, 2)
+	closeAll := func() {
+		for _, l := range listeners {
+			_ = l.Close()
+		}
+	}
+	if cfg.Address != "" {
+		listener, err := net.Listen("tcp", cfg.Address)
+		if err != nil {
+			return err
+		}
+		listeners = append(listeners, listener)
+		logger.Info(fmt.Sprintf("bind: %s, start listening...", cfg.Address))
+	}
+	if cfg.TLSAddress != "" {
+		if cfg.TLS == nil {
+			closeAll()
+			return errors.New("TLS listener requires certificates")
+		}
+		listener, err := net.Listen("tcp", cfg.TLSAddress)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, tls.NewListener(listener, cfg.TLS.TLSConfig()))
+		logger.Info(fmt.Sprintf("bind: %s, start listening for TLS...", cfg.TLSAddress))
+	}
+	if cfg.UnixSocket != "" {
+		listener, err := listenUnix(cfg.UnixSocket, cfg.UnixSocketPerm)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		listeners = append(listeners, listener)
+		logger.Info(fmt.Sprintf("unix socket: %s, start listening...", cfg.UnixSocket))
+	}
+	if len(listeners) == 0 {
+		return errors.New("no listener configured")
+	}
+	if len(listeners) == 1 {
+		ListenAndServe(listeners[0], handler, closeChan)
+	} else {
+		ListenAndServe(newMultiListener(listeners...), handler, closeChan)
 	}
-	logger.Info(fmt.Sprintf("bind: %s, start listening...", cfg.Address))
-	ListenAndServe(listener, handler, closeChan)
 	return nil
 }
 
@@ -85,3 +144,22 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan
 	}
 	waitDone.Wait()
 }
+
+// listenUnix listens on a unix socket, the socket file is removed when the listener is closed
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	// a socket file left behind by a crashed server would make the bind fail
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
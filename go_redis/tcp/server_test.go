@@ -0,0 +1,97 @@
+package tcp
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenUnix(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		prepare func(path string)
+		perm    os.FileMode
+		wantErr bool
+	}{
+		{"new socket", func(string) {}, 0, false},
+		{"permission", func(string) {}, 0700, false},
+		{"stale socket", func(path string) {
+			// 模拟崩溃后留下的 socket 文件
+			l, err := net.Listen("unix", path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l.(*net.UnixListener).SetUnlinkOnClose(false)
+			_ = l.Close()
+		}, 0, false},
+		{"regular file", func(path string) {
+			if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+				t.Fatal(err)
+			}
+		}, 0, true},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, string(rune('a'+i))+".sock")
+		tt.prepare(path)
+		listener, err := listenUnix(path, tt.perm)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+			if listener != nil {
+				_ = listener.Close()
+			}
+			continue
+		}
+		if err != nil {
+			// 普通文件不会被删除
+			if _, err := os.Stat(path); err != nil {
+				t.Errorf("%s: file was removed", tt.name)
+			}
+			continue
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+		} else if tt.perm != 0 && info.Mode().Perm() != tt.perm {
+			t.Errorf("%s: got permission %v, want %v", tt.name, info.Mode().Perm(), tt.perm)
+		}
+		_ = listener.Close()
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: socket file is not removed after close", tt.name)
+		}
+	}
+}
+
+func TestServeUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	listener, err := listenUnix(path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ListenAndServe(newMultiListener(listener), MakeHandler(), closeChan)
+		close(done)
+	}()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = conn.Write([]byte("ping\n"))
+	if got, err := bufio.NewReader(conn).ReadString('\n'); err != nil || got != "ping\n" {
+		t.Fatalf("got %q, %v", got, err)
+	}
+	_ = conn.Close()
+
+	close(closeChan)
+	<-done
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("socket file is not removed on shutdown")
+	}
+}
@@ -0,0 +1,103 @@
+package tcp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+/**
+ * TLS certificates that can be replaced while the server is running
+ */
+
+// TLSFiles names the files the TLS listener loads its certificates from
+type TLSFiles struct {
+	CertFile   string
+	KeyFile    string
+	CACertFile string
+	// AuthClients is one of "yes", "no" or "optional", "yes" requires clients to present a certificate signed by CACertFile
+	AuthClients string
+}
+
+// CertReloader hands out the most recently loaded certificates to new TLS connections,
+// existing connections keep the certificates they were established with
+type CertReloader struct {
+	mu      sync.RWMutex
+	current *tls.Config
+}
+
+// NewCertReloader loads the certificates named by files
+func NewCertReloader(files *TLSFiles) (*CertReloader, error) {
+	r := &CertReloader{}
+	if err := r.Reload(files); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads the certificates named by files again, on error the previous certificates stay in use
+func (r *CertReloader) Reload(files *TLSFiles) error {
+	config, err := loadTLSConfig(files)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.current = config
+	r.mu.Unlock()
+	return nil
+}
+
+// TLSConfig returns a config for tls.NewListener that always uses the latest certificates
+func (r *CertReloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return r.current, nil
+		},
+	}
+}
+
+func loadTLSConfig(files *TLSFiles) (*tls.Config, error) {
+	if files.CertFile == "" || files.KeyFile == "" {
+		return nil, errors.New("tls-cert-file and tls-key-file are required to enable TLS")
+	}
+	cert, err := tls.LoadX509KeyPair(files.CertFile, files.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls certificate: %v", err)
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	switch files.AuthClients {
+	case "", "yes":
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	case "optional":
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	case "no":
+		config.ClientAuth = tls.NoClientCert
+	default:
+		return nil, fmt.Errorf("invalid tls-auth-clients '%s'", files.AuthClients)
+	}
+	if config.ClientAuth == tls.NoClientCert {
+		return config, nil
+	}
+	if files.CACertFile == "" {
+		return nil, errors.New("tls-ca-cert-file is required to authenticate clients")
+	}
+	pem, err := os.ReadFile(files.CACertFile)
+	if err != nil {
+		return nil, fmt.Errorf("load tls ca certificate: %v", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", files.CACertFile)
+	}
+	config.ClientCAs = pool
+	return config, nil
+}
@@ -0,0 +1,217 @@
+package tcp
+
+import (
+	"bufio"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA is a certificate authority signing the certificates used by the tests
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+	file string
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	file := filepath.Join(dir, name+".crt")
+	writePEM(t, file, "CERTIFICATE", der)
+	return &testCA{cert: cert, key: key, pool: pool, file: file}
+}
+
+// issue signs a certificate for 127.0.0.1 and writes it and its key to dir
+func (ca *testCA) issue(t *testing.T, dir, name string) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile = filepath.Join(dir, name+".crt")
+	keyFile = filepath.Join(dir, name+".key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	if err := os.WriteFile(file, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	certFile, keyFile := ca.issue(t, dir, "server")
+	tests := []struct {
+		name    string
+		files   TLSFiles
+		wantErr bool
+		auth    tls.ClientAuthType
+	}{
+		{"default requires client certs", TLSFiles{certFile, keyFile, ca.file, ""}, false, tls.RequireAndVerifyClientCert},
+		{"optional", TLSFiles{certFile, keyFile, ca.file, "optional"}, false, tls.VerifyClientCertIfGiven},
+		{"no client auth without ca", TLSFiles{certFile, keyFile, "", "no"}, false, tls.NoClientCert},
+		{"client auth without ca", TLSFiles{certFile, keyFile, "", "yes"}, true, 0},
+		{"missing key file", TLSFiles{certFile, "", ca.file, "yes"}, true, 0},
+		{"unreadable cert file", TLSFiles{filepath.Join(dir, "nosuch.crt"), keyFile, ca.file, "yes"}, true, 0},
+		{"ca file without certificates", TLSFiles{certFile, keyFile, keyFile, "yes"}, true, 0},
+		{"bad auth clients", TLSFiles{certFile, keyFile, ca.file, "maybe"}, true, 0},
+	}
+	for _, tt := range tests {
+		files := tt.files
+		config, err := loadTLSConfig(&files)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: got error %v, want error %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if err == nil && config.ClientAuth != tt.auth {
+			t.Errorf("%s: got client auth %v, want %v", tt.name, config.ClientAuth, tt.auth)
+		}
+	}
+}
+
+// echoOverTLS sends a line over a new TLS connection and returns the echoed line
+func echoOverTLS(addr string, config *tls.Config) (string, error) {
+	conn, err := tls.Dial("tcp", addr, config)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		return "", err
+	}
+	return bufio.NewReader(conn).ReadString('\n')
+}
+
+func TestTLSListener(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t, dir, "ca")
+	serverCert, serverKey := ca.issue(t, dir, "server")
+	clientCert, clientKey := ca.issue(t, dir, "client")
+	certs, err := NewCertReloader(&TLSFiles{serverCert, serverKey, ca.file, "yes"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plain, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secure, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closeChan := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		ListenAndServe(newMultiListener(plain, tls.NewListener(secure, certs.TLSConfig())), MakeHandler(), closeChan)
+		close(done)
+	}()
+	defer func() {
+		close(closeChan)
+		<-done
+	}()
+
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withCert := &tls.Config{RootCAs: ca.pool, Certificates: []tls.Certificate{pair}}
+	if got, err := echoOverTLS(secure.Addr().String(), withCert); err != nil || got != "ping\n" {
+		t.Fatalf("client with certificate: got %q, %v", got, err)
+	}
+	if _, err := echoOverTLS(secure.Addr().String(), &tls.Config{RootCAs: ca.pool}); err == nil {
+		t.Fatal("client without certificate should be rejected")
+	}
+
+	// 普通TCP端口和TLS端口同时可用
+	conn, err := net.Dial("tcp", plain.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, _ = conn.Write([]byte("ping\n"))
+	if got, err := bufio.NewReader(conn).ReadString('\n'); err != nil || got != "ping\n" {
+		t.Fatalf("plain tcp: got %q, %v", got, err)
+	}
+	_ = conn.Close()
+
+	// 加载失败时继续使用原来的证书
+	if err := certs.Reload(&TLSFiles{filepath.Join(dir, "nosuch.crt"), serverKey, ca.file, "yes"}); err == nil {
+		t.Fatal("reload of a missing certificate should fail")
+	}
+	if got, err := echoOverTLS(secure.Addr().String(), withCert); err != nil || got != "ping\n" {
+		t.Fatalf("after failed reload: got %q, %v", got, err)
+	}
+
+	// 换成另一个CA签发的证书之后，新的连接使用新证书
+	newCA := newTestCA(t, dir, "new-ca")
+	newCert, newKey := newCA.issue(t, dir, "new-server")
+	if err := certs.Reload(&TLSFiles{newCert, newKey, ca.file, "yes"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := echoOverTLS(secure.Addr().String(), withCert); err == nil {
+		t.Fatal("client trusting only the old ca should reject the new certificate")
+	}
+	withCert.RootCAs = newCA.pool
+	if got, err := echoOverTLS(secure.Addr().String(), withCert); err != nil || got != "ping\n" {
+		t.Fatalf("after reload: got %q, %v", got, err)
+	}
+}